@@ -1,123 +1,250 @@
 package auth
 
 import (
+	"context"
+	"crypto/subtle"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/A-Victory/blog/logging"
+	"github.com/A-Victory/blog/metrics"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func GenerateJWT(username string) (string, error) {
+type contextKey string
 
-	token := jwt.New(jwt.SigningMethodHS256)
-	singingKey := []byte(os.Getenv("SIGNINGKEY"))
+const (
+	usernameKey contextKey = "username"
+	userIDKey   contextKey = "uid"
+)
 
-	claims := token.Claims.(jwt.MapClaims)
-	claims["username"] = username
-	claims["authorized"] = true
-	claims["exp"] = jwt.NewNumericDate(time.Now().Add(15 * time.Minute))
-	tokenString, err := token.SignedString(singingKey)
-	if err != nil {
-		fmt.Println("Error signing token: ", err)
+var key atomic.Pointer[[]byte]
+
+// SetSigningKey sets the key signing the tokens. It is called once, before
+// serving.
+func SetSigningKey(signingKey []byte) {
+	key.Store(&signingKey)
+}
+
+func signingKey() []byte {
+	if k := key.Load(); k != nil {
+		return *k
 	}
+	return nil
+}
 
-	return tokenString, nil
+func GenerateJWT(userID int, username string) (string, error) {
+	return signToken(jwt.MapClaims{"uid": userID, "username": username})
+}
 
+func signToken(claims jwt.MapClaims) (string, error) {
+
+	token := jwt.New(jwt.SigningMethodHS256)
+
+	tokenClaims := token.Claims.(jwt.MapClaims)
+	for key, value := range claims {
+		tokenClaims[key] = value
+	}
+	tokenClaims["authorized"] = true
+	tokenClaims["exp"] = jwt.NewNumericDate(time.Now().Add(15 * time.Minute))
+	return token.SignedString(signingKey())
 }
 
 func Verify(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Header.Get("Authorization") == "" {
-			_, err := w.Write([]byte("You're Unauthorized due to invalid token"))
+	return VerifyWith(textError)(next)
+}
+
+// VerifyWith returns Verify with its failures written by fail, for APIs with
+// their own error bodies.
+func VerifyWith(fail func(w http.ResponseWriter, status int, msg string)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			tokenString, fromCookie := requestToken(r)
+			if tokenString == "" {
+				metrics.AuthFailures.WithLabelValues(metrics.ReasonMissingToken).Inc()
+				fail(w, http.StatusUnauthorized, "User not authorized please login!")
+				return
+			}
+
+			token, err := parseToken(tokenString)
 			if err != nil {
+				slog.DebugContext(r.Context(), "rejected token", "error", err)
+				metrics.AuthFailures.WithLabelValues(metrics.ReasonInvalidToken).Inc()
+				fail(w, http.StatusUnauthorized, "Token is either invalid or expired, please login!")
 				return
 			}
-			return
-		}
 
-		singingKey := []byte(os.Getenv("SIGNINGKEY"))
+			claims := token.Claims.(jwt.MapClaims)
 
-		fullstring := r.Header["Authorization"][0]
-		if fullstring == "" {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintln(w, "User not authorized please login!")
-			return
-		}
+			if fromCookie && !safeMethod(r.Method) && !validCSRF(r, claims) {
+				metrics.AuthFailures.WithLabelValues(metrics.ReasonCSRF).Inc()
+				fail(w, http.StatusForbidden, "Missing or invalid CSRF token")
+				return
+			}
 
-		tokenString := strings.Split(fullstring, " ")
+			newTkn, err := refreshToken(claims)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "failed to refresh token", "error", err)
+				fail(w, http.StatusInternalServerError, "Error creating signature")
+				return
+			}
+			if newTkn != "" {
+				if fromCookie {
+					csrf, _ := claims["csrf"].(string)
+					setSessionCookie(w, newTkn, csrf)
+				} else {
+					w.Header().Set("Authorization", newTkn)
+				}
+			}
 
-		token, err := jwt.Parse(tokenString[0], func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("%v", "There was an error in parsing token.")
+			if token.Valid {
+				next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
+			} else {
+				metrics.AuthFailures.WithLabelValues(metrics.ReasonInvalidToken).Inc()
+				fail(w, http.StatusUnauthorized, "You're Unauthorized due to invalid token")
 			}
-			return singingKey, nil
 		})
+	}
+}
+
+// textError writes the plain text failures of Verify.
+func textError(w http.ResponseWriter, status int, msg string) {
+	w.WriteHeader(status)
+	fmt.Fprintln(w, msg)
+}
 
-		if err != nil {
-			log.Println(err.Error())
-			w.WriteHeader(http.StatusUnauthorized)
-			fmt.Fprintln(w, "Token is either invalid or expired, please login!")
-			return
+// parseToken checks the signature of a JWT and parses it.
+func parseToken(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("%v", "There was an error in parsing token.")
 		}
+		return signingKey(), nil
+	})
+}
 
-		claims := token.Claims.(jwt.MapClaims)
+// refreshToken returns a new token with the same claims when the current one
+// expires within a minute, and an empty string otherwise.
+func refreshToken(claims jwt.MapClaims) (string, error) {
+	exp, _ := claims.GetExpirationTime()
+	if exp != nil && time.Until(exp.Time) >= 1*time.Minute {
+		return "", nil
+	}
 
-		exp, _ := claims.GetExpirationTime()
+	claims["exp"] = jwt.NewNumericDate(time.Now().Add(15 * time.Minute))
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(signingKey())
+}
 
-		if time.Until(exp.Time) < 1*time.Minute {
-			claims["exp"] = jwt.NewNumericDate(time.Now().Add(15 * time.Minute))
-			token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-			newTkn, err := token.SignedString(singingKey)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				log.Println(err)
-				fmt.Fprintln(w, "Error creating signature")
-			}
+// withClaims stores the user named by the token claims in the context and
+// adds their id to the log lines of the request.
+func withClaims(ctx context.Context, claims jwt.MapClaims) context.Context {
+	username, _ := claims["username"].(string)
+	userID, _ := claims["uid"].(float64)
+	logging.Add(ctx, slog.Int("user_id", int(userID)))
+	ctx = context.WithValue(ctx, usernameKey, username)
+	return context.WithValue(ctx, userIDKey, int(userID))
+}
 
-			w.Header().Set("Authorization", newTkn)
-		}
+// Username returns the username stored in the request context by Verify.
+func Username(ctx context.Context) string {
+	username, _ := ctx.Value(usernameKey).(string)
+	return username
+}
 
-		if token.Valid {
-			next.ServeHTTP(w, r)
-		} else {
-			w.WriteHeader(http.StatusUnauthorized)
-			_, err := w.Write([]byte("You're Unauthorized due to invalid token"))
-			if err != nil {
-				return
-			}
-		}
-	})
+// UserID returns the user id stored in the request context by Verify. It is
+// zero for tokens issued before ids were added to the claims.
+func UserID(ctx context.Context) int {
+	userID, _ := ctx.Value(userIDKey).(int)
+	return userID
+}
 
+// RequestMode reports whether the request was authenticated with the session
+// cookie or with a token in the Authorization header.
+func RequestMode(r *http.Request) string {
+	if _, fromCookie := requestToken(r); fromCookie {
+		return ModeCookie
+	}
+	return ModeToken
 }
 
-func GetUser(authToken string) (string, error) {
+// requestToken extracts the JWT from the Authorization header, accepting both
+// "Bearer <token>" and a bare token, and falls back to the session cookie.
+// The second return value reports whether the token came from the cookie.
+func requestToken(r *http.Request) (string, bool) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		return ParseAuthorization(header), false
+	}
 
-	tokenString := strings.Split(authToken, " ")
+	if cookie, err := r.Cookie(SessionCookie); err == nil && cookie.Value != "" {
+		return cookie.Value, true
+	}
+
+	return "", false
+}
 
-	signingkey := []byte(os.Getenv("SIGNINGKEY"))
+// ParseAuthorization returns the token carried by an Authorization header
+// value, with or without the "Bearer" scheme.
+func ParseAuthorization(header string) string {
+	fields := strings.Fields(header)
+	switch {
+	case len(fields) == 1:
+		return fields[0]
+	case len(fields) == 2 && strings.EqualFold(fields[0], "Bearer"):
+		return fields[1]
+	default:
+		return ""
+	}
+}
 
-	token, err := jwt.Parse(tokenString[0], func(token *jwt.Token) (interface{}, error) {
+func GetUser(authToken string) (string, error) {
+
+	token, err := jwt.Parse(ParseAuthorization(authToken), func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("%v", "There was an error in parsing token.")
 		}
-		return signingkey, nil
+		return signingKey(), nil
 	})
 	if err != nil {
 		return "", err
 	}
-	// ... error handling
 
-	// do something with decoded claims
 	claim, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
 		return "", fmt.Errorf("error decoding user info from token")
 	}
 
-	username := claim["username"].(string)
+	username, ok := claim["username"].(string)
+	if !ok {
+		return "", fmt.Errorf("error decoding user info from token")
+	}
 
 	return username, nil
 }
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// validCSRF implements the double-submit check: the header must match the
+// CSRF cookie, and both must match the token bound to the session.
+func validCSRF(r *http.Request, claims jwt.MapClaims) bool {
+	header := r.Header.Get(CSRFHeader)
+	cookie, err := r.Cookie(CSRFCookie)
+	if header == "" || err != nil {
+		return false
+	}
+	bound, _ := claims["csrf"].(string)
+
+	return subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(header), []byte(bound)) == 1
+}
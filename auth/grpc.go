@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/A-Victory/blog/metrics"
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// AuthorizationMetadata is the gRPC metadata key carrying the JWT, with or
+// without the "Bearer" scheme. A refreshed token is sent back under the same
+// key in the response header.
+const AuthorizationMetadata = "authorization"
+
+// UnaryServerInterceptor authenticates unary gRPC calls the way Verify
+// authenticates HTTP requests, storing the user in the context for Username
+// and UserID. Calls to the public methods, given by full name such as
+// "/blog.v1.UserService/Login", are let through without a token.
+func UnaryServerInterceptor(public ...string) grpc.UnaryServerInterceptor {
+	skip := methodSet(public)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if skip[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		ctx, err := authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of
+// UnaryServerInterceptor.
+func StreamServerInterceptor(public ...string) grpc.StreamServerInterceptor {
+	skip := methodSet(public)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if skip[info.FullMethod] {
+			return handler(srv, ss)
+		}
+
+		ctx, err := authenticate(ss.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticate checks the token in the incoming metadata and returns the
+// context with the user stored. A token close to expiry is refreshed in the
+// response header.
+func authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(AuthorizationMetadata)
+	if len(values) == 0 || ParseAuthorization(values[0]) == "" {
+		metrics.AuthFailures.WithLabelValues(metrics.ReasonMissingToken).Inc()
+		return nil, status.Error(codes.Unauthenticated, "user not authorized please login")
+	}
+
+	token, err := parseToken(ParseAuthorization(values[0]))
+	if err != nil || !token.Valid {
+		metrics.AuthFailures.WithLabelValues(metrics.ReasonInvalidToken).Inc()
+		return nil, status.Error(codes.Unauthenticated, "token is either invalid or expired, please login")
+	}
+	claims := token.Claims.(jwt.MapClaims)
+
+	newToken, err := refreshToken(claims)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "error creating signature")
+	}
+	if newToken != "" {
+		grpc.SetHeader(ctx, metadata.Pairs(AuthorizationMetadata, newToken))
+	}
+
+	return withClaims(ctx, claims), nil
+}
+
+func methodSet(methods []string) map[string]bool {
+	set := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		set[method] = true
+	}
+	return set
+}
+
+// authenticatedStream replaces the context of a server stream.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// OIDCStateCookie is the cookie holding the signed login state between the
+// redirect to the identity provider and the callback.
+const OIDCStateCookie = "oidc_state"
+
+// OIDCConfig describes an external OpenID Connect identity provider.
+type OIDCConfig struct {
+	Name          string
+	Issuer        string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string
+	Scopes        []string
+	AutoProvision bool
+}
+
+// OIDCProvider runs the authorization code + PKCE flow against a single
+// identity provider.
+type OIDCProvider struct {
+	Name          string
+	Issuer        string
+	AutoProvision bool
+
+	verifier *oidc.IDTokenVerifier
+	oauth    oauth2.Config
+}
+
+// OIDCIdentity holds the claims taken from a verified ID token.
+type OIDCIdentity struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+}
+
+type oidcState struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.RegisteredClaims
+}
+
+// NewOIDCProvider performs discovery against the issuer and returns a provider
+// ready to build login URLs and verify callbacks.
+func NewOIDCProvider(ctx context.Context, config OIDCConfig) (*OIDCProvider, error) {
+	provider, err := oidc.NewProvider(ctx, config.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery for %s failed: %w", config.Name, err)
+	}
+
+	scopes := config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"profile", "email"}
+	}
+
+	return &OIDCProvider{
+		Name:          config.Name,
+		Issuer:        config.Issuer,
+		AutoProvision: config.AutoProvision,
+		verifier:      provider.Verifier(&oidc.Config{ClientID: config.ClientID}),
+		oauth: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       append([]string{oidc.ScopeOpenID}, scopes...),
+		},
+	}, nil
+}
+
+// AuthCodeURL returns the URL to redirect the browser to, along with the
+// signed state that must be stored in the OIDCStateCookie until the callback.
+func (p *OIDCProvider) AuthCodeURL() (string, string, error) {
+	state, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	claims := oidcState{
+		Provider: p.Name,
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(10 * time.Minute)),
+		},
+	}
+	stateToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(signingKey())
+	if err != nil {
+		return "", "", fmt.Errorf("error signing oidc state: %w", err)
+	}
+
+	url := p.oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	return url, stateToken, nil
+}
+
+// Exchange validates the callback state against the signed state token,
+// redeems the code with the PKCE verifier and verifies the returned ID token.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, state, stateToken string) (OIDCIdentity, error) {
+	saved := oidcState{}
+	_, err := jwt.ParseWithClaims(stateToken, &saved, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("%v", "There was an error in parsing token.")
+		}
+		return signingKey(), nil
+	})
+	if err != nil {
+		return OIDCIdentity{}, fmt.Errorf("invalid login state: %w", err)
+	}
+	if saved.Provider != p.Name || saved.State != state {
+		return OIDCIdentity{}, fmt.Errorf("login state does not match")
+	}
+
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(saved.Verifier))
+	if err != nil {
+		return OIDCIdentity{}, fmt.Errorf("failed to exchange code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return OIDCIdentity{}, fmt.Errorf("no id_token in token response")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return OIDCIdentity{}, fmt.Errorf("failed to verify id_token: %w", err)
+	}
+	if idToken.Nonce != saved.Nonce {
+		return OIDCIdentity{}, fmt.Errorf("id_token nonce does not match")
+	}
+
+	var claims struct {
+		Email             string `json:"email"`
+		EmailVerified     bool   `json:"email_verified"`
+		PreferredUsername string `json:"preferred_username"`
+		Name              string `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return OIDCIdentity{}, fmt.Errorf("error decoding id_token claims: %w", err)
+	}
+
+	return OIDCIdentity{
+		Issuer:            idToken.Issuer,
+		Subject:           idToken.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		PreferredUsername: claims.PreferredUsername,
+		Name:              claims.Name,
+	}, nil
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
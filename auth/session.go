@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// SessionCookie holds the session JWT for browser clients.
+	SessionCookie = "session"
+	// CSRFCookie holds the CSRF token, readable by scripts so it can be
+	// echoed back in the CSRFHeader on unsafe requests.
+	CSRFCookie = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+
+	// ModeHeader lets a client choose how the session is delivered on login.
+	ModeHeader  = "X-Session-Mode"
+	ModeCookie  = "cookie"
+	ModeToken   = "token"
+	sessionLife = 15 * 60
+)
+
+// SessionMode returns the session mode requested by the client, either
+// through the X-Session-Mode header or the "mode" query parameter. Clients
+// that do not ask for cookies keep receiving bearer tokens.
+func SessionMode(r *http.Request) string {
+	mode := r.Header.Get(ModeHeader)
+	if mode == "" {
+		mode = r.URL.Query().Get("mode")
+	}
+	if strings.EqualFold(mode, ModeCookie) {
+		return ModeCookie
+	}
+	return ModeToken
+}
+
+// StartSession issues a session cookie and a matching CSRF cookie for the
+// user and returns the CSRF token.
+func StartSession(w http.ResponseWriter, userID int, username string) (string, error) {
+	csrf, err := randomString()
+	if err != nil {
+		return "", err
+	}
+
+	token, err := signToken(jwt.MapClaims{"uid": userID, "username": username, "csrf": csrf})
+	if err != nil {
+		return "", err
+	}
+
+	setSessionCookie(w, token, csrf)
+
+	return csrf, nil
+}
+
+// EndSession clears the session and CSRF cookies.
+func EndSession(w http.ResponseWriter) {
+	for _, name := range []string{SessionCookie, CSRFCookie} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Path:     "/",
+			MaxAge:   -1,
+			Secure:   true,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+}
+
+func setSessionCookie(w http.ResponseWriter, token, csrf string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   sessionLife,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookie,
+		Value:    csrf,
+		Path:     "/",
+		MaxAge:   sessionLife,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
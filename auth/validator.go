@@ -25,3 +25,15 @@ func (va *Validation) ValidateUserInfo(u models.User) error {
 	}
 	return nil
 }
+
+// Validate checks any struct carrying validate tags, reporting the first
+// failing field the same way ValidateUserInfo does.
+func (va *Validation) Validate(data interface{}) error {
+	err := va.validate.Struct(data)
+	if err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			return fmt.Errorf("please input a valid %s", err.Field())
+		}
+	}
+	return nil
+}
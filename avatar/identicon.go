@@ -0,0 +1,57 @@
+package avatar
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+const (
+	gridSize = 5
+	cellSize = 48
+	padding  = 24
+)
+
+// Identicon renders a deterministic, horizontally symmetric 5x5 pattern for
+// the given seed as a PNG, in the style of Gravatar's identicons.
+func Identicon(seed string) ([]byte, error) {
+	sum := sha256.Sum256([]byte(seed))
+
+	fg := color.RGBA{R: sum[0], G: sum[1], B: sum[2], A: 255}
+	bg := color.RGBA{R: 240, G: 240, B: 240, A: 255}
+
+	size := gridSize*cellSize + 2*padding
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	fill(img, img.Bounds(), bg)
+
+	// Only the left three columns come from the hash; the right two mirror them.
+	half := (gridSize + 1) / 2
+	for row := 0; row < gridSize; row++ {
+		for col := 0; col < half; col++ {
+			if sum[3+row*half+col]%2 == 0 {
+				continue
+			}
+			for _, c := range []int{col, gridSize - 1 - col} {
+				x := padding + c*cellSize
+				y := padding + row*cellSize
+				fill(img, image.Rect(x, y, x+cellSize, y+cellSize), fg)
+			}
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func fill(img *image.RGBA, rect image.Rectangle, c color.RGBA) {
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package avatar
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+)
+
+const (
+	// MaxUploadSize is the largest avatar accepted, in bytes.
+	MaxUploadSize = 1 << 20
+	maxDimension  = 2048
+)
+
+var allowedTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+}
+
+// Validate checks that an uploaded avatar is a PNG, JPEG or GIF image of a
+// reasonable size and returns its content type. The type is sniffed from the
+// data rather than trusted from the client.
+func Validate(data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", fmt.Errorf("avatar is empty")
+	}
+	if len(data) > MaxUploadSize {
+		return "", fmt.Errorf("avatar must be at most %d bytes", MaxUploadSize)
+	}
+
+	contentType := http.DetectContentType(data)
+	if !allowedTypes[contentType] {
+		return "", fmt.Errorf("avatar must be a PNG, JPEG or GIF image, got %s", contentType)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("avatar is not a valid image: %w", err)
+	}
+	if config.Width > maxDimension || config.Height > maxDimension {
+		return "", fmt.Errorf("avatar must be at most %dx%d pixels", maxDimension, maxDimension)
+	}
+
+	return contentType, nil
+}
@@ -0,0 +1,277 @@
+// Package config loads the settings of the server into a single Config.
+// Settings come from, in increasing precedence: the defaults, an optional
+// YAML or TOML file, the environment, filled in from a .env file when there
+// is one, and the command line flags. A setting NAME can also be read from
+// the file named by NAME_FILE, for secrets mounted into the container.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/A-Victory/blog/logging"
+	"github.com/A-Victory/blog/ratelimit"
+	"github.com/A-Victory/blog/server"
+	"github.com/A-Victory/blog/tracing"
+)
+
+// Config holds every setting of the server. The env and flag tags name the
+// variable and the flag setting each field; required ones cannot be empty.
+type Config struct {
+	HTTP      HTTP           `yaml:"http" toml:"http"`
+	GRPC      GRPC           `yaml:"grpc" toml:"grpc"`
+	Database  Database       `yaml:"database" toml:"database"`
+	Auth      Auth           `yaml:"auth" toml:"auth"`
+	API       API            `yaml:"api" toml:"api"`
+	Log       Log            `yaml:"log" toml:"log"`
+	Metrics   Metrics        `yaml:"metrics" toml:"metrics"`
+	Tracing   Tracing        `yaml:"tracing" toml:"tracing"`
+	SMTP      SMTP           `yaml:"smtp" toml:"smtp"`
+	Stream    Stream         `yaml:"stream" toml:"stream"`
+	Search    Search         `yaml:"search" toml:"search"`
+	Webhooks  Webhooks       `yaml:"webhooks" toml:"webhooks"`
+	RateLimit RateLimit      `yaml:"rateLimit" toml:"rateLimit"`
+	OIDC      []OIDCProvider `yaml:"oidc" toml:"oidc"`
+}
+
+type HTTP struct {
+	Port              string        `yaml:"port" toml:"port" env:"PORT" flag:"port" usage:"port of the API"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout" toml:"readHeaderTimeout" env:"HTTP_READ_HEADER_TIMEOUT" flag:"http-read-header-timeout" usage:"time to read the request headers"`
+	ReadTimeout       time.Duration `yaml:"readTimeout" toml:"readTimeout" env:"HTTP_READ_TIMEOUT" flag:"http-read-timeout" usage:"time to read a request"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout" toml:"writeTimeout" env:"HTTP_WRITE_TIMEOUT" flag:"http-write-timeout" usage:"time to handle a request and write its response"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout" toml:"idleTimeout" env:"HTTP_IDLE_TIMEOUT" flag:"http-idle-timeout" usage:"time before idle connections are closed"`
+	TLSCertFile       string        `yaml:"tlsCertFile" toml:"tlsCertFile" env:"TLS_CERT_FILE" flag:"tls-cert-file" usage:"PEM certificate, to serve TLS"`
+	TLSKeyFile        string        `yaml:"tlsKeyFile" toml:"tlsKeyFile" env:"TLS_KEY_FILE" flag:"tls-key-file" usage:"PEM key of the certificate"`
+	ShutdownTimeout   time.Duration `yaml:"shutdownTimeout" toml:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" usage:"time to drain the requests in flight on shutdown"`
+	ShutdownDelay     time.Duration `yaml:"shutdownDelay" toml:"shutdownDelay" env:"SHUTDOWN_DELAY" flag:"shutdown-delay" usage:"time between failing readiness and closing the listeners"`
+}
+
+type GRPC struct {
+	Port string `yaml:"port" toml:"port" env:"GRPC_PORT" flag:"grpc-port" usage:"port of the gRPC API"`
+}
+
+type Database struct {
+	URI  string `yaml:"uri" toml:"uri" env:"DB_URI" flag:"db-uri" required:"true" usage:"MySQL data source name"`
+	Name string `yaml:"name" toml:"name" env:"DB_NAME" flag:"db-name" required:"true" usage:"name of the database"`
+}
+
+type Auth struct {
+	SigningKey string `yaml:"signingKey" toml:"signingKey" env:"SIGNINGKEY" required:"true"`
+}
+
+type API struct {
+	BaseURL                string `yaml:"baseUrl" toml:"baseUrl" env:"APP_URL" flag:"app-url" usage:"public URL of the API, used in links"`
+	RequireIfMatch         bool   `yaml:"requireIfMatch" toml:"requireIfMatch" env:"REQUIRE_IF_MATCH" flag:"require-if-match" usage:"make If-Match mandatory on post and comment writes"`
+	DeletionGraceDays      int    `yaml:"deletionGraceDays" toml:"deletionGraceDays" env:"ACCOUNT_DELETION_GRACE_DAYS" flag:"deletion-grace-days" usage:"days before a deleted account is purged"`
+	IdempotencyWindowHours int    `yaml:"idempotencyWindowHours" toml:"idempotencyWindowHours" env:"IDEMPOTENCY_WINDOW_HOURS" flag:"idempotency-window-hours" usage:"hours Idempotency-Key responses are kept"`
+	V1Sunset               Date   `yaml:"v1Sunset" toml:"v1Sunset" env:"API_V1_SUNSET" flag:"v1-sunset" usage:"date, as YYYY-MM-DD, when /api/v1 is to be removed"`
+}
+
+// DeletionGrace is the time before a deleted account is purged.
+func (api API) DeletionGrace() time.Duration {
+	return time.Duration(api.DeletionGraceDays) * 24 * time.Hour
+}
+
+// IdempotencyWindow is how long Idempotency-Key responses are kept.
+func (api API) IdempotencyWindow() time.Duration {
+	return time.Duration(api.IdempotencyWindowHours) * time.Hour
+}
+
+type Log struct {
+	Level  string `yaml:"level" toml:"level" env:"LOG_LEVEL" flag:"log-level" usage:"debug, info, warn or error"`
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT" flag:"log-format" usage:"json or text"`
+}
+
+type Metrics struct {
+	// Port serves the metrics apart from the API when set.
+	Port string `yaml:"port" toml:"port" env:"METRICS_PORT" flag:"metrics-port" usage:"admin port of the metrics and probes"`
+}
+
+type Tracing struct {
+	Exporter    string `yaml:"exporter" toml:"exporter" env:"TRACES_EXPORTER" flag:"traces-exporter" usage:"none, otlp or stdout"`
+	ServiceName string `yaml:"serviceName" toml:"serviceName" env:"OTEL_SERVICE_NAME" flag:"service-name" usage:"name of the service in the traces"`
+}
+
+// SMTP sends the emails when Addr is set; they are logged otherwise.
+type SMTP struct {
+	Addr     string `yaml:"addr" toml:"addr" env:"SMTP_ADDR" flag:"smtp-addr" usage:"SMTP server as host:port"`
+	From     string `yaml:"from" toml:"from" env:"SMTP_FROM" flag:"smtp-from" usage:"sender of the emails"`
+	Username string `yaml:"username" toml:"username" env:"SMTP_USERNAME"`
+	Password string `yaml:"password" toml:"password" env:"SMTP_PASSWORD"`
+}
+
+type Stream struct {
+	Broker string `yaml:"broker" toml:"broker" env:"STREAM_BROKER" flag:"stream-broker" usage:"local or mysql"`
+}
+
+type Search struct {
+	Backend string `yaml:"backend" toml:"backend" env:"SEARCH_BACKEND" flag:"search-backend" usage:"mysql or memory"`
+}
+
+type Webhooks struct {
+	// AllowHTTP accepts plain http subscription URLs, for receivers on a
+	// development machine. Only https is accepted otherwise.
+	AllowHTTP bool `yaml:"allowHttp" toml:"allowHttp" env:"WEBHOOKS_ALLOW_HTTP" flag:"webhooks-allow-http" usage:"accept plain http webhook URLs"`
+}
+
+// RateLimit limits the requests of each client, per group of routes. Rates
+// are written as requests/period, such as 10/1m.
+type RateLimit struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"RATE_LIMIT_ENABLED" flag:"rate-limit" usage:"limit the request rate of each client"`
+	// TrustedProxies are the IPs and CIDRs, comma-separated, of the proxies
+	// whose X-Forwarded-For is used to find the client IP.
+	TrustedProxies string         `yaml:"trustedProxies" toml:"trustedProxies" env:"TRUSTED_PROXIES" flag:"trusted-proxies" usage:"comma-separated IPs and CIDRs of the proxies setting X-Forwarded-For"`
+	Auth           ratelimit.Rate `yaml:"auth" toml:"auth" env:"RATE_LIMIT_AUTH" flag:"rate-limit-auth" usage:"rate of logins and registrations per client IP"`
+	Read           ratelimit.Rate `yaml:"read" toml:"read" env:"RATE_LIMIT_READ" flag:"rate-limit-read" usage:"rate of reads per user or client IP"`
+	Write          ratelimit.Rate `yaml:"write" toml:"write" env:"RATE_LIMIT_WRITE" flag:"rate-limit-write" usage:"rate of writes per user"`
+}
+
+// OIDCProvider is an identity provider. In the environment, the providers
+// are listed in OIDC_PROVIDERS and each provider NAME is configured through
+// OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET,
+// OIDC_<NAME>_REDIRECT_URL and OIDC_<NAME>_AUTO_PROVISION.
+type OIDCProvider struct {
+	Name          string `yaml:"name" toml:"name"`
+	Issuer        string `yaml:"issuer" toml:"issuer"`
+	ClientID      string `yaml:"clientId" toml:"clientId"`
+	ClientSecret  string `yaml:"clientSecret" toml:"clientSecret"`
+	RedirectURL   string `yaml:"redirectUrl" toml:"redirectUrl"`
+	AutoProvision bool   `yaml:"autoProvision" toml:"autoProvision"`
+}
+
+// Date is a day, written as YYYY-MM-DD.
+type Date struct {
+	time.Time
+}
+
+func (d *Date) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		d.Time = time.Time{}
+		return nil
+	}
+	t, err := time.Parse(time.DateOnly, string(text))
+	if err != nil {
+		return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", text)
+	}
+	d.Time = t
+	return nil
+}
+
+func (d Date) MarshalText() ([]byte, error) {
+	if d.IsZero() {
+		return nil, nil
+	}
+	return []byte(d.Format(time.DateOnly)), nil
+}
+
+// Default returns the settings used when nothing else sets them.
+func Default() Config {
+	return Config{
+		HTTP: HTTP{
+			Port:              "8080",
+			ReadHeaderTimeout: server.DefaultReadHeaderTimeout,
+			ReadTimeout:       server.DefaultReadTimeout,
+			WriteTimeout:      server.DefaultWriteTimeout,
+			IdleTimeout:       server.DefaultIdleTimeout,
+			ShutdownTimeout:   server.DefaultShutdownTimeout,
+		},
+		GRPC:    GRPC{Port: "9090"},
+		API:     API{DeletionGraceDays: 14, IdempotencyWindowHours: 24},
+		Log:     Log{Level: "info", Format: logging.FormatJSON},
+		Tracing: Tracing{Exporter: tracing.ExporterNone, ServiceName: "blog"},
+		Stream:  Stream{Broker: "local"},
+		Search:  Search{Backend: "mysql"},
+		RateLimit: RateLimit{
+			Enabled: true,
+			Auth:    ratelimit.Rate{Limit: 10, Period: time.Minute},
+			Read:    ratelimit.Rate{Limit: 300, Period: time.Minute},
+			Write:   ratelimit.Rate{Limit: 60, Period: time.Minute},
+		},
+	}
+}
+
+// Validate reports every setting that is missing or invalid.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	for _, s := range settings(&c) {
+		check(!s.required || !s.value.IsZero(), "%s is required", s.env)
+	}
+
+	check(validPort(c.HTTP.Port), "PORT must be a port number, got %q", c.HTTP.Port)
+	check(validPort(c.GRPC.Port), "GRPC_PORT must be a port number, got %q", c.GRPC.Port)
+	check(c.Metrics.Port == "" || validPort(c.Metrics.Port), "METRICS_PORT must be a port number, got %q", c.Metrics.Port)
+	for _, timeout := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"HTTP_READ_HEADER_TIMEOUT", c.HTTP.ReadHeaderTimeout},
+		{"HTTP_READ_TIMEOUT", c.HTTP.ReadTimeout},
+		{"HTTP_WRITE_TIMEOUT", c.HTTP.WriteTimeout},
+		{"HTTP_IDLE_TIMEOUT", c.HTTP.IdleTimeout},
+		{"SHUTDOWN_TIMEOUT", c.HTTP.ShutdownTimeout},
+	} {
+		check(timeout.value > 0, "%s must be positive, got %s", timeout.name, timeout.value)
+	}
+	check(c.HTTP.ShutdownDelay >= 0, "SHUTDOWN_DELAY cannot be negative, got %s", c.HTTP.ShutdownDelay)
+	check((c.HTTP.TLSCertFile == "") == (c.HTTP.TLSKeyFile == ""), "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+
+	check(c.API.DeletionGraceDays >= 1, "ACCOUNT_DELETION_GRACE_DAYS must be at least 1, got %d", c.API.DeletionGraceDays)
+	check(c.API.IdempotencyWindowHours >= 1, "IDEMPOTENCY_WINDOW_HOURS must be at least 1, got %d", c.API.IdempotencyWindowHours)
+
+	_, err := logging.ParseLevel(c.Log.Level)
+	check(err == nil, "LOG_LEVEL must be debug, info, warn or error, got %q", c.Log.Level)
+	check(oneOf(c.Log.Format, logging.FormatJSON, logging.FormatText), "LOG_FORMAT must be json or text, got %q", c.Log.Format)
+	check(oneOf(c.Tracing.Exporter, tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout), "TRACES_EXPORTER must be none, otlp or stdout, got %q", c.Tracing.Exporter)
+	check(oneOf(c.Stream.Broker, "local", "mysql"), "STREAM_BROKER must be local or mysql, got %q", c.Stream.Broker)
+	check(oneOf(c.Search.Backend, "mysql", "memory"), "SEARCH_BACKEND must be mysql or memory, got %q", c.Search.Backend)
+
+	_, err = ratelimit.ParseProxies(c.RateLimit.TrustedProxies)
+	check(err == nil, "TRUSTED_PROXIES: %v", err)
+	if c.RateLimit.Enabled {
+		for _, rate := range []struct {
+			name  string
+			value ratelimit.Rate
+		}{
+			{"RATE_LIMIT_AUTH", c.RateLimit.Auth},
+			{"RATE_LIMIT_READ", c.RateLimit.Read},
+			{"RATE_LIMIT_WRITE", c.RateLimit.Write},
+		} {
+			check(rate.value.Valid(), "%s must allow requests, got %s", rate.name, rate.value)
+		}
+	}
+
+	for i, p := range c.OIDC {
+		name := p.Name
+		if name == "" {
+			name = "#" + strconv.Itoa(i+1)
+		}
+		check(p.Name != "", "identity provider %s needs a name", name)
+		check(p.Issuer != "", "identity provider %s needs an issuer", name)
+		check(p.ClientID != "", "identity provider %s needs a client id", name)
+		check(p.RedirectURL != "", "identity provider %s needs a redirect URL", name)
+	}
+
+	return errors.Join(errs...)
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n < 65536
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
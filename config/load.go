@@ -0,0 +1,261 @@
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Load reads the settings from args, the command line flags without the
+// program name, and from the sources with lower precedence, then validates
+// them. The settings file is named by the -config flag or CONFIG_FILE.
+func Load(args []string) (Config, error) {
+	config := Default()
+
+	flags := flag.NewFlagSet("blog", flag.ContinueOnError)
+	configFile := flags.String("config", "", "YAML or TOML settings file")
+	set := map[string]string{}
+	for _, s := range settings(&config) {
+		if s.flag == "" {
+			continue
+		}
+		name := s.flag
+		collect := func(value string) error {
+			set[name] = value
+			return nil
+		}
+		if s.value.Kind() == reflect.Bool {
+			flags.BoolFunc(name, s.usage, collect)
+		} else {
+			flags.Func(name, s.usage, collect)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return Config{}, err
+	}
+	if flags.NArg() > 0 {
+		return Config{}, fmt.Errorf("unexpected arguments %q", flags.Args())
+	}
+
+	// the variables already set win over the .env file
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return Config{}, fmt.Errorf("reading .env: %w", err)
+	}
+
+	file := *configFile
+	if file == "" {
+		value, _, err := lookup("CONFIG_FILE")
+		if err != nil {
+			return Config{}, err
+		}
+		file = value
+	}
+	if file != "" {
+		if err := readFile(file, &config); err != nil {
+			return Config{}, err
+		}
+	}
+
+	for _, s := range settings(&config) {
+		value, ok, err := lookup(s.env)
+		if err != nil {
+			return Config{}, err
+		}
+		if !ok {
+			continue
+		}
+		if err := setValue(s.value, value); err != nil {
+			return Config{}, fmt.Errorf("%s: %w", s.env, err)
+		}
+	}
+	if err := lookupOIDC(&config); err != nil {
+		return Config{}, err
+	}
+
+	for _, s := range settings(&config) {
+		value, ok := set[s.flag]
+		if s.flag == "" || !ok {
+			continue
+		}
+		if err := setValue(s.value, value); err != nil {
+			return Config{}, fmt.Errorf("-%s: %w", s.flag, err)
+		}
+	}
+
+	return config, config.Validate()
+}
+
+// readFile reads a YAML or TOML file, by its extension, over config. Unknown
+// keys are errors, so that a misspelled setting is not silently ignored.
+func readFile(file string, config *Config) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	switch ext := filepath.Ext(file); ext {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(content), config)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("%s: unknown settings %v", file, undecoded)
+		}
+	default:
+		return fmt.Errorf("%s: unknown settings format %q, expected .yaml, .yml or .toml", file, ext)
+	}
+	return nil
+}
+
+// lookup reads a variable, or the file named by the variable with the _FILE
+// suffix. Empty variables count as unset.
+func lookup(name string) (string, bool, error) {
+	value, file := os.Getenv(name), os.Getenv(name+"_FILE")
+	switch {
+	case value != "" && file != "":
+		return "", false, fmt.Errorf("%s and %s_FILE are both set", name, name)
+	case file != "":
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+		}
+		return strings.TrimRight(string(content), "\r\n"), true, nil
+	case value != "":
+		return value, true, nil
+	}
+	return "", false, nil
+}
+
+// lookupOIDC reads the identity providers from OIDC_PROVIDERS, replacing
+// those of the settings file.
+func lookupOIDC(config *Config) error {
+	names, ok, err := lookup("OIDC_PROVIDERS")
+	if err != nil || !ok {
+		return err
+	}
+
+	config.OIDC = nil
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := OIDCProvider{Name: name}
+
+		for suffix, field := range map[string]*string{
+			"ISSUER":        &provider.Issuer,
+			"CLIENT_ID":     &provider.ClientID,
+			"CLIENT_SECRET": &provider.ClientSecret,
+			"REDIRECT_URL":  &provider.RedirectURL,
+		} {
+			if *field, _, err = lookup(prefix + suffix); err != nil {
+				return err
+			}
+		}
+		autoProvision, ok, err := lookup(prefix + "AUTO_PROVISION")
+		if err != nil {
+			return err
+		}
+		if ok {
+			if provider.AutoProvision, err = strconv.ParseBool(autoProvision); err != nil {
+				return fmt.Errorf("%sAUTO_PROVISION: %w", prefix, err)
+			}
+		}
+
+		config.OIDC = append(config.OIDC, provider)
+	}
+	return nil
+}
+
+// setting is a field of Config set by a variable and maybe a flag.
+type setting struct {
+	env      string
+	flag     string
+	usage    string
+	required bool
+	value    reflect.Value
+}
+
+// settings lists the fields of config with an env tag, in order.
+func settings(config *Config) []setting {
+	var list []setting
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field, value := t.Field(i), v.Field(i)
+			if env := field.Tag.Get("env"); env != "" {
+				list = append(list, setting{
+					env:      env,
+					flag:     field.Tag.Get("flag"),
+					usage:    field.Tag.Get("usage"),
+					required: field.Tag.Get("required") == "true",
+					value:    value,
+				})
+			} else if value.Kind() == reflect.Struct {
+				walk(value)
+			}
+		}
+	}
+	walk(reflect.ValueOf(config).Elem())
+	return list
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setValue parses text into a field.
+func setValue(v reflect.Value, text string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(text))
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(text)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package conn
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/A-Victory/blog/models"
+)
+
+func (db *DB) AddActivity(activity models.AccountActivity) (int, error) {
+	db, span := db.trace("AddActivity")
+	defer span.End()
+
+	activity.CreatedAt = time.Now().Local().Format("2006-01-02 15:04:05")
+	query := "INSERT INTO AccountActivity (userId, action, detail, ipAddress, createdAt) VALUES (?, ?, ?, ?, ?)"
+
+	result, err := db.exec(query, activity.UserID, activity.Action, activity.Detail, activity.IPAddress, activity.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+func (db *DB) GetActivity(userID, limit, offset int) ([]models.AccountActivity, error) {
+	db, span := db.trace("GetActivity")
+	defer span.End()
+	query := "SELECT id, userId, action, detail, ipAddress, createdAt FROM AccountActivity WHERE userId = ? ORDER BY createdAt DESC, id DESC LIMIT ? OFFSET ?"
+	rows, err := db.query(query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activities []models.AccountActivity
+	for rows.Next() {
+		var activity models.AccountActivity
+		err := rows.Scan(&activity.ID, &activity.UserID, &activity.Action, &activity.Detail, &activity.IPAddress, &activity.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		activities = append(activities, activity)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return activities, nil
+}
+
+// SaveEmailVerification stores a pending email change, replacing any earlier
+// pending change for the same user.
+func (db *DB) SaveEmailVerification(verification models.EmailVerification) (int, error) {
+	db, span := db.trace("SaveEmailVerification")
+	defer span.End()
+
+	_, err := db.exec("DELETE FROM EmailVerifications WHERE userId = ?", verification.UserID)
+	if err != nil {
+		return 0, err
+	}
+
+	query := "INSERT INTO EmailVerifications (userId, email, tokenHash, expiresAt) VALUES (?, ?, ?, ?)"
+	result, err := db.exec(query, verification.UserID, verification.Email, verification.TokenHash, verification.ExpiresAt)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+func (db *DB) GetEmailVerification(tokenHash string) (models.EmailVerification, error) {
+	db, span := db.trace("GetEmailVerification")
+	defer span.End()
+	query := "SELECT id, userId, email, tokenHash, expiresAt FROM EmailVerifications WHERE tokenHash = ?"
+	row := db.queryRow(query, tokenHash)
+
+	var verification models.EmailVerification
+	err := row.Scan(&verification.ID, &verification.UserID, &verification.Email, &verification.TokenHash, &verification.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.EmailVerification{}, nil
+		}
+		return models.EmailVerification{}, err
+	}
+
+	return verification, nil
+}
+
+func (db *DB) DeleteEmailVerification(id int) (int, error) {
+	db, span := db.trace("DeleteEmailVerification")
+	defer span.End()
+	result, err := db.exec("DELETE FROM EmailVerifications WHERE id = ?", id)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
@@ -0,0 +1,321 @@
+package conn
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/A-Victory/blog/models"
+	"github.com/go-sql-driver/mysql"
+)
+
+// ErrDuplicateList is returned when a user already has a reading list with
+// the same name.
+var ErrDuplicateList = errors.New("a reading list with this name already exists")
+
+// ErrInvalidOrder is returned when a new reading list order does not hold
+// exactly the posts in the list.
+var ErrInvalidOrder = errors.New("invalid reading list order")
+
+// isDuplicate reports whether err is a MySQL unique key violation.
+func isDuplicate(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
+// AddBookmark saves a post for a user. It returns 0 if the post was already
+// bookmarked.
+func (db *DB) AddBookmark(userID, postID int) (int, error) {
+	db, span := db.trace("AddBookmark")
+	defer span.End()
+	createdAt := time.Now().Local().Format("2006-01-02 15:04:05")
+	result, err := db.exec("INSERT IGNORE INTO Bookmarks (userId, postId, createdAt) VALUES (?, ?, ?)", userID, postID, createdAt)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
+
+func (db *DB) RemoveBookmark(userID, postID int) (int, error) {
+	db, span := db.trace("RemoveBookmark")
+	defer span.End()
+	result, err := db.exec("DELETE FROM Bookmarks WHERE userId = ? AND postId = ?", userID, postID)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
+
+// GetBookmarkedPosts returns a page of the posts a user bookmarked, sorted by
+// when they were bookmarked, with the same search as GetPosts. Posts that
+// were unpublished since are left out unless the user wrote them.
+func (db *DB) GetBookmarkedPosts(userID int, opts models.ListOptions, searchTerm string) ([]models.Post, models.Page, error) {
+	db, span := db.trace("GetBookmarkedPosts")
+	defer span.End()
+	q, err := createdOrdering("b.createdAt", "b.postId").list(opts)
+	if err != nil {
+		return nil, models.Page{}, err
+	}
+
+	filter := " FROM Bookmarks b JOIN posts p ON p.id = b.postId WHERE b.userId = ? AND (p.status = ? OR p.authorId = ?)"
+	params := []interface{}{userID, models.PostPublished, userID}
+
+	search, searchParams := postSearch("p.", searchTerm)
+	filter += search
+	params = append(params, searchParams...)
+
+	total, err := db.count("SELECT COUNT(*)"+filter, params...)
+	if err != nil {
+		return nil, models.Page{}, err
+	}
+
+	query := "SELECT p.id, p.title, p.content, p.authorId, p.status, p.createdAt, p.updatedAt, p.version" + q.column() + filter
+	return db.listPosts(q, query, params, total)
+}
+
+func (db *DB) CreateReadingList(list models.ReadingList) (int, error) {
+	db, span := db.trace("CreateReadingList")
+	defer span.End()
+
+	list.CreatedAt = time.Now().Local().Format("2006-01-02 15:04:05")
+	query := "INSERT INTO ReadingLists (userId, name, description, public, createdAt, updatedAt) VALUES (?, ?, ?, ?, ?, ?)"
+
+	result, err := db.exec(query, list.UserID, list.Name, list.Description, list.Public, list.CreatedAt, list.CreatedAt)
+	if err != nil {
+		if isDuplicate(err) {
+			return 0, ErrDuplicateList
+		}
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// GetReadingList returns the list without its posts, or an empty list if
+// there is none with the given id.
+func (db *DB) GetReadingList(listID int) (models.ReadingList, error) {
+	db, span := db.trace("GetReadingList")
+	defer span.End()
+	query := `SELECT l.id, l.userId, l.name, l.description, l.public, l.createdAt, l.updatedAt,
+		(SELECT COUNT(*) FROM ReadingListItems WHERE listId = l.id)
+		FROM ReadingLists l WHERE l.id = ?`
+
+	var list models.ReadingList
+	err := db.queryRow(query, listID).Scan(&list.ID, &list.UserID, &list.Name, &list.Description, &list.Public, &list.CreatedAt, &list.UpdatedAt, &list.PostCount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.ReadingList{}, nil
+		}
+		return models.ReadingList{}, err
+	}
+
+	return list, nil
+}
+
+// GetReadingLists returns a user's lists, optionally only the public ones.
+func (db *DB) GetReadingLists(userID int, publicOnly bool) ([]models.ReadingList, error) {
+	db, span := db.trace("GetReadingLists")
+	defer span.End()
+	query := `SELECT l.id, l.userId, l.name, l.description, l.public, l.createdAt, l.updatedAt,
+		(SELECT COUNT(*) FROM ReadingListItems WHERE listId = l.id)
+		FROM ReadingLists l WHERE l.userId = ?`
+	if publicOnly {
+		query += " AND l.public = TRUE"
+	}
+	query += " ORDER BY l.name"
+
+	rows, err := db.query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []models.ReadingList{}
+	for rows.Next() {
+		var list models.ReadingList
+		if err := rows.Scan(&list.ID, &list.UserID, &list.Name, &list.Description, &list.Public, &list.CreatedAt, &list.UpdatedAt, &list.PostCount); err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+
+	return lists, rows.Err()
+}
+
+func (db *DB) UpdateReadingList(list models.ReadingList) (int, error) {
+	db, span := db.trace("UpdateReadingList")
+	defer span.End()
+	updatedAt := time.Now().Local().Format("2006-01-02 15:04:05")
+	query := "UPDATE ReadingLists SET name = ?, description = ?, public = ?, updatedAt = ? WHERE id = ? AND userId = ?"
+
+	result, err := db.exec(query, list.Name, list.Description, list.Public, updatedAt, list.ID, list.UserID)
+	if err != nil {
+		if isDuplicate(err) {
+			return 0, ErrDuplicateList
+		}
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
+
+func (db *DB) DeleteReadingList(listID, userID int) (int, error) {
+	db, span := db.trace("DeleteReadingList")
+	defer span.End()
+	result, err := db.exec("DELETE FROM ReadingLists WHERE id = ? AND userId = ?", listID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
+
+// AddToReadingList appends a post to the end of a list. It returns 0 if the
+// post is already in the list.
+func (db *DB) AddToReadingList(listID, postID int) (int, error) {
+	db, span := db.trace("AddToReadingList")
+	defer span.End()
+	query := `INSERT IGNORE INTO ReadingListItems (listId, postId, position)
+		SELECT ?, ?, COALESCE(MAX(position), 0) + 1 FROM ReadingListItems WHERE listId = ?`
+
+	result, err := db.exec(query, listID, postID, listID)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
+
+func (db *DB) RemoveFromReadingList(listID, postID int) (int, error) {
+	db, span := db.trace("RemoveFromReadingList")
+	defer span.End()
+	result, err := db.exec("DELETE FROM ReadingListItems WHERE listId = ? AND postId = ?", listID, postID)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
+
+// ReorderReadingList sets the order of a list. postIDs must hold exactly the
+// posts in the list.
+func (db *DB) ReorderReadingList(listID int, postIDs []int) error {
+	db, span := db.trace("ReorderReadingList")
+	defer span.End()
+
+	tx, err := db.begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := db.queryIn(tx, "SELECT postId FROM ReadingListItems WHERE listId = ? FOR UPDATE", listID)
+	if err != nil {
+		return err
+	}
+	current := map[int]bool{}
+	for rows.Next() {
+		var postID int
+		if err := rows.Scan(&postID); err != nil {
+			rows.Close()
+			return err
+		}
+		current[postID] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(postIDs) != len(current) {
+		return fmt.Errorf("%w: the new order must list all %d posts in the reading list", ErrInvalidOrder, len(current))
+	}
+	for _, postID := range postIDs {
+		if !current[postID] {
+			return fmt.Errorf("%w: post %d is not in the reading list", ErrInvalidOrder, postID)
+		}
+	}
+
+	for i, postID := range postIDs {
+		if _, err := db.execIn(tx, "UPDATE ReadingListItems SET position = ? WHERE listId = ? AND postId = ?", i+1, listID, postID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetReadingListPosts returns the posts of a list in order. Unpublished posts
+// are only included for their author.
+func (db *DB) GetReadingListPosts(listID, viewerID int) ([]models.Post, error) {
+	db, span := db.trace("GetReadingListPosts")
+	defer span.End()
+	query := `SELECT p.id, p.title, p.content, p.authorId, p.status, p.createdAt, p.updatedAt, p.version FROM ReadingListItems i
+		JOIN posts p ON p.id = i.postId
+		WHERE i.listId = ? AND (p.status = ? OR p.authorId = ?)
+		ORDER BY i.position, i.addedAt`
+
+	return db.queryPosts(query, listID, models.PostPublished, viewerID)
+}
+
+func (db *DB) queryPosts(query string, params ...interface{}) ([]models.Post, error) {
+	rows, err := db.query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []models.Post{}
+	for rows.Next() {
+		var post models.Post
+		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.AuthorID, &post.Status, &post.CreatedAt, &post.UpdatedAt, &post.Version)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return posts, db.loadTags(posts)
+}
@@ -8,12 +8,14 @@ import (
 )
 
 func (db *DB) AddComment(data models.Comment) (int, error) {
+	db, span := db.trace("AddComment")
+	defer span.End()
 
 	data.CreatedAt = time.Now().Local().Format("2006-01-02 15:04:05")
 	data.UpdatedAt = time.Now().Local().Format("2006-01-02 15:04:05")
 	query := "INSERT INTO comments (postId, authorId, content, createdAt, updatedAt) VALUES (?, ?, ?, ?, ?)"
 
-	result, err := db.Conn.DB.Exec(query, data.Postid, data.AuthorID, data.Content, data.CreatedAt, data.UpdatedAt)
+	result, err := db.exec(query, data.Postid, data.AuthorID, data.Content, data.CreatedAt, data.UpdatedAt)
 	if err != nil {
 		return 0, err
 	}
@@ -32,9 +34,19 @@ func (db *DB) AddComment(data models.Comment) (int, error) {
 	return int(comment_id), nil
 }
 
-func (db *DB) DeleteComment(commentID int) (int, error) {
+// DeleteComment deletes a comment. A non-zero version must match the
+// comment's version, otherwise ErrVersionConflict is returned.
+func (db *DB) DeleteComment(commentID, version int) (int, error) {
+	db, span := db.trace("DeleteComment")
+	defer span.End()
 	query := "DELETE FROM comments WHERE id = ?"
-	result, err := db.Conn.DB.Exec(query, commentID)
+	params := []interface{}{commentID}
+	if version > 0 {
+		query += " AND version = ?"
+		params = append(params, version)
+	}
+
+	result, err := db.exec(query, params...)
 	if err != nil {
 		return 0, err
 	}
@@ -45,19 +57,32 @@ func (db *DB) DeleteComment(commentID int) (int, error) {
 	}
 
 	if rowsAffected == 0 {
+		if version > 0 {
+			return 0, ErrVersionConflict
+		}
 		return 0, nil // No rows affected, indicating no post with the given ID was found
 	}
 
 	return int(rowsAffected), nil
 }
 
+// EditComment replaces the content of a comment and bumps its version. A
+// non-zero comment.Version must match the stored version, otherwise
+// ErrVersionConflict is returned.
 func (db *DB) EditComment(comment models.Comment) (int, error) {
+	db, span := db.trace("EditComment")
+	defer span.End()
 
 	updatedAt := time.Now().Local().Format("2006-01-02 15:04:05")
 
-	query := "UPDATE comments SET content = ?, updatedAt = ? WHERE id = ? AND authorId = ? AND postId = ?"
+	query := "UPDATE comments SET content = ?, updatedAt = ?, version = version + 1 WHERE id = ? AND authorId = ? AND postId = ?"
+	params := []interface{}{comment.Content, updatedAt, comment.ID, comment.AuthorID, comment.Postid}
+	if comment.Version > 0 {
+		query += " AND version = ?"
+		params = append(params, comment.Version)
+	}
 
-	result, err := db.Conn.DB.Exec(query, comment.Content, updatedAt, comment.ID, comment.AuthorID, comment.Postid)
+	result, err := db.exec(query, params...)
 	if err != nil {
 		return 0, err
 	}
@@ -68,43 +93,77 @@ func (db *DB) EditComment(comment models.Comment) (int, error) {
 	}
 
 	if rowsAffected == 0 {
+		if comment.Version > 0 {
+			return 0, ErrVersionConflict
+		}
 		return 0, nil // No rows affected, indicating no comment with the given criteria was found
 	}
 
 	return int(rowsAffected), nil
 }
 
-func (db *DB) GetComments(postID, limit, offset int) ([]models.Comment, error) {
-	query := "SELECT id, postId, authorId, content, createdAt, updatedAt FROM comments WHERE postId = ? LIMIT ? OFFSET ?"
-	rows, err := db.Conn.DB.Query(query, postID, limit, offset)
+// commentOrdering is the sort orders of a post's comments.
+var commentOrdering = ordering{
+	sorts: map[string]sortKey{
+		models.SortNewest:  {expr: "createdAt"},
+		models.SortOldest:  {expr: "createdAt", ascending: true},
+		models.SortUpdated: {expr: "updatedAt"},
+	},
+	id: "id",
+}
+
+// GetComments returns a page of the comments on a post.
+func (db *DB) GetComments(postID int, opts models.ListOptions) ([]models.Comment, models.Page, error) {
+	db, span := db.trace("GetComments")
+	defer span.End()
+	q, err := commentOrdering.list(opts)
 	if err != nil {
-		return nil, err
+		return nil, models.Page{}, err
+	}
+
+	total, err := db.count("SELECT COUNT(*) FROM comments WHERE postId = ?", postID)
+	if err != nil {
+		return nil, models.Page{}, err
+	}
+
+	query := "SELECT id, postId, authorId, content, createdAt, updatedAt, version" + q.column() + " FROM comments WHERE postId = ?" + q.tail
+	rows, err := db.query(query, append([]interface{}{postID}, q.params...)...)
+	if err != nil {
+		return nil, models.Page{}, err
 	}
 	defer rows.Close()
 
-	var comments []models.Comment
+	comments := []models.Comment{}
+	var keys []string
+	var ids []int
 	for rows.Next() {
 		var comment models.Comment
-		err := rows.Scan(&comment.ID, &comment.Postid, &comment.AuthorID, &comment.Content, &comment.CreatedAt, &comment.UpdatedAt)
+		var key string
+		err := rows.Scan(&comment.ID, &comment.Postid, &comment.AuthorID, &comment.Content, &comment.CreatedAt, &comment.UpdatedAt, &comment.Version, &key)
 		if err != nil {
-			return nil, err
+			return nil, models.Page{}, err
 		}
 		comments = append(comments, comment)
+		keys = append(keys, key)
+		ids = append(ids, comment.ID)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, models.Page{}, err
 	}
 
-	return comments, nil
+	page, n := q.page(total, keys, ids)
+	return comments[:n], page, nil
 }
 
 func (db *DB) GetCommentByID(commentID int) (models.Comment, error) {
-	query := "SELECT id, postId, content, authorId, createdAt, updatedAt FROM comments WHERE id = ?"
-	row := db.Conn.DB.QueryRow(query, commentID)
+	db, span := db.trace("GetCommentByID")
+	defer span.End()
+	query := "SELECT id, postId, content, authorId, createdAt, updatedAt, version FROM comments WHERE id = ?"
+	row := db.queryRow(query, commentID)
 
 	var comment models.Comment
-	err := row.Scan(&comment.ID, &comment.Postid, &comment.Content, &comment.AuthorID, &comment.CreatedAt, &comment.UpdatedAt)
+	err := row.Scan(&comment.ID, &comment.Postid, &comment.Content, &comment.AuthorID, &comment.CreatedAt, &comment.UpdatedAt, &comment.Version)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			// return models.Post{}, fmt.Errorf("no post found with ID %d", postID)
@@ -115,3 +174,113 @@ func (db *DB) GetCommentByID(commentID int) (models.Comment, error) {
 
 	return comment, nil
 }
+
+// GetPublishedComments returns every comment on a published post, used to
+// build a search index.
+func (db *DB) GetPublishedComments() ([]models.Comment, error) {
+	db, span := db.trace("GetPublishedComments")
+	defer span.End()
+	query := `SELECT c.id, c.postId, c.authorId, c.content, c.createdAt, c.updatedAt, c.version FROM comments c
+		JOIN posts p ON p.id = c.postId WHERE p.status = ?`
+	rows, err := db.query(query, models.PostPublished)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []models.Comment
+	for rows.Next() {
+		var comment models.Comment
+		err := rows.Scan(&comment.ID, &comment.Postid, &comment.AuthorID, &comment.Content, &comment.CreatedAt, &comment.UpdatedAt, &comment.Version)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+
+	return comments, rows.Err()
+}
+
+// GetRecentComments returns the first limit comments of each of the posts in
+// the given sort order, keyed by post id, in one query.
+func (db *DB) GetRecentComments(postIDs []int, sort string, limit int) (map[int][]models.Comment, error) {
+	db, span := db.trace("GetRecentComments")
+	defer span.End()
+	comments := map[int][]models.Comment{}
+	if len(postIDs) == 0 {
+		return comments, nil
+	}
+
+	if sort == "" {
+		sort = models.SortNewest
+	}
+	key, ok := commentOrdering.sorts[sort]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+	direction := " DESC"
+	if key.ascending {
+		direction = " ASC"
+	}
+	order := key.expr + direction + ", id" + direction
+
+	params := make([]interface{}, 0, len(postIDs)+1)
+	for _, id := range postIDs {
+		params = append(params, id)
+	}
+	params = append(params, limit)
+
+	query := `SELECT id, postId, authorId, content, createdAt, updatedAt, version FROM (
+		SELECT id, postId, authorId, content, createdAt, updatedAt, version,
+			ROW_NUMBER() OVER (PARTITION BY postId ORDER BY ` + order + `) AS position
+		FROM comments WHERE postId IN (` + placeholders(len(postIDs)) + `)
+	) ranked WHERE position <= ? ORDER BY postId, position`
+	rows, err := db.query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var comment models.Comment
+		err := rows.Scan(&comment.ID, &comment.Postid, &comment.AuthorID, &comment.Content, &comment.CreatedAt, &comment.UpdatedAt, &comment.Version)
+		if err != nil {
+			return nil, err
+		}
+		comments[comment.Postid] = append(comments[comment.Postid], comment)
+	}
+
+	return comments, rows.Err()
+}
+
+// CountComments returns the number of comments on each of the posts, keyed by
+// post id. Posts without comments are left out.
+func (db *DB) CountComments(postIDs []int) (map[int]int, error) {
+	db, span := db.trace("CountComments")
+	defer span.End()
+	counts := map[int]int{}
+	if len(postIDs) == 0 {
+		return counts, nil
+	}
+
+	params := make([]interface{}, len(postIDs))
+	for i, id := range postIDs {
+		params[i] = id
+	}
+
+	rows, err := db.query("SELECT postId, COUNT(*) FROM comments WHERE postId IN ("+placeholders(len(postIDs))+") GROUP BY postId", params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID, count int
+		if err := rows.Scan(&postID, &count); err != nil {
+			return nil, err
+		}
+		counts[postID] = count
+	}
+
+	return counts, rows.Err()
+}
@@ -1,9 +1,15 @@
 package conn
 
-import "github.com/A-Victory/blog/database"
+import (
+	"context"
+
+	"github.com/A-Victory/blog/database"
+)
 
 type DB struct {
 	Conn *database.DBconn
+
+	ctx context.Context
 }
 
 func NewConn(conn *database.DBconn) *DB {
@@ -11,3 +17,18 @@ func NewConn(conn *database.DBconn) *DB {
 		Conn: conn,
 	}
 }
+
+// WithContext returns a copy of db whose queries run with ctx: they are
+// cancelled with it and traced as children of its span.
+func (db *DB) WithContext(ctx context.Context) *DB {
+	scoped := *db
+	scoped.ctx = ctx
+	return &scoped
+}
+
+func (db *DB) context() context.Context {
+	if db.ctx == nil {
+		return context.Background()
+	}
+	return db.ctx
+}
@@ -0,0 +1,86 @@
+package conn
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/A-Victory/blog/models"
+)
+
+// EraseUser removes a user and everything tied to them. In anonymize mode the
+// user's posts and comments are kept and reassigned to the "deleted user"
+// account; in delete mode they are removed. Personal records (identities,
+// follows, bookmarks, reading lists, activity, exports, pending email
+// changes) are always removed.
+// Everything runs in one transaction so a failure leaves the account
+// untouched.
+func (db *DB) EraseUser(userID int, mode string) error {
+	db, span := db.trace("EraseUser")
+	defer span.End()
+
+	tx, err := db.begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	switch mode {
+	case models.ErasureAnonymize:
+		var deletedID int
+		// The account is the one the migration created, never a user who
+		// held the name before it ran.
+		err := db.queryRowIn(tx, "SELECT id FROM users WHERE username = ? AND password = '!'", models.DeletedUsername).Scan(&deletedID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("the %q account is missing", models.DeletedUsername)
+			}
+			return err
+		}
+		if deletedID == userID {
+			return fmt.Errorf("the %q account cannot be erased", models.DeletedUsername)
+		}
+
+		if _, err := db.execIn(tx, "UPDATE comments SET authorId = ?, version = version + 1 WHERE authorId = ?", deletedID, userID); err != nil {
+			return err
+		}
+		if _, err := db.execIn(tx, "UPDATE posts SET authorId = ?, version = version + 1 WHERE authorId = ?", deletedID, userID); err != nil {
+			return err
+		}
+	case models.ErasureDelete, "":
+		// Comments on the user's posts go with the posts.
+		if _, err := db.execIn(tx, "DELETE FROM comments WHERE authorId = ? OR postId IN (SELECT id FROM posts WHERE authorId = ?)", userID, userID); err != nil {
+			return err
+		}
+		if _, err := db.execIn(tx, "DELETE FROM posts WHERE authorId = ?", userID); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid erasure mode %q", mode)
+	}
+
+	// Anonymized posts leave the feeds of the user's followers too.
+	if _, err := db.execIn(tx, "DELETE FROM FeedItems WHERE userId = ? OR authorId = ?", userID, userID); err != nil {
+		return err
+	}
+	if _, err := db.execIn(tx, "DELETE FROM Follows WHERE followerId = ? OR followeeId = ?", userID, userID); err != nil {
+		return err
+	}
+
+	statements := []string{
+		"DELETE FROM Bookmarks WHERE userId = ?",
+		"DELETE FROM ReadingLists WHERE userId = ?",
+		"DELETE FROM UserIdentities WHERE userId = ?",
+		"DELETE FROM UserAvatars WHERE userId = ?",
+		"DELETE FROM AccountActivity WHERE userId = ?",
+		"DELETE FROM EmailVerifications WHERE userId = ?",
+		"DELETE FROM DataExports WHERE userId = ?",
+		"DELETE FROM users WHERE id = ?",
+	}
+	for _, statement := range statements {
+		if _, err := db.execIn(tx, statement, userID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
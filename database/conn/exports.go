@@ -0,0 +1,218 @@
+package conn
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/A-Victory/blog/models"
+)
+
+func (db *DB) CreateExport(userID int) (int, error) {
+	db, span := db.trace("CreateExport")
+	defer span.End()
+
+	createdAt := time.Now().Local().Format("2006-01-02 15:04:05")
+	query := "INSERT INTO DataExports (userId, status, createdAt) VALUES (?, ?, ?)"
+
+	result, err := db.exec(query, userID, models.ExportPending, createdAt)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// GetExport returns an export without its archive.
+func (db *DB) GetExport(exportID int) (models.DataExport, error) {
+	db, span := db.trace("GetExport")
+	defer span.End()
+	query := "SELECT id, userId, status, error, createdAt, COALESCE(completedAt, '') FROM DataExports WHERE id = ?"
+	row := db.queryRow(query, exportID)
+
+	var export models.DataExport
+	err := row.Scan(&export.ID, &export.UserID, &export.Status, &export.Error, &export.CreatedAt, &export.CompletedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.DataExport{}, nil
+		}
+		return models.DataExport{}, err
+	}
+
+	return export, nil
+}
+
+func (db *DB) GetExportArchive(exportID int) ([]byte, error) {
+	db, span := db.trace("GetExportArchive")
+	defer span.End()
+	var archive []byte
+	err := db.queryRow("SELECT archive FROM DataExports WHERE id = ? AND status = ?", exportID, models.ExportReady).Scan(&archive)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return archive, nil
+}
+
+func (db *DB) GetPendingExports(limit int) ([]models.DataExport, error) {
+	db, span := db.trace("GetPendingExports")
+	defer span.End()
+	query := "SELECT id, userId, status, error, createdAt FROM DataExports WHERE status = ? ORDER BY id LIMIT ?"
+	rows, err := db.query(query, models.ExportPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var exports []models.DataExport
+	for rows.Next() {
+		var export models.DataExport
+		if err := rows.Scan(&export.ID, &export.UserID, &export.Status, &export.Error, &export.CreatedAt); err != nil {
+			return nil, err
+		}
+		exports = append(exports, export)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return exports, nil
+}
+
+func (db *DB) CompleteExport(exportID int, archive []byte) (int, error) {
+	db, span := db.trace("CompleteExport")
+	defer span.End()
+	return db.finishExport(exportID, models.ExportReady, archive, "")
+}
+
+func (db *DB) FailExport(exportID int, reason string) (int, error) {
+	db, span := db.trace("FailExport")
+	defer span.End()
+	if len(reason) > 255 {
+		reason = reason[:255]
+	}
+	return db.finishExport(exportID, models.ExportFailed, nil, reason)
+}
+
+func (db *DB) finishExport(exportID int, status string, archive []byte, reason string) (int, error) {
+	completedAt := time.Now().Local().Format("2006-01-02 15:04:05")
+	query := "UPDATE DataExports SET status = ?, archive = ?, error = ?, completedAt = ? WHERE id = ?"
+
+	result, err := db.exec(query, status, archive, reason, completedAt, exportID)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
+
+// DeleteExpiredExports removes exports created before the cutoff.
+func (db *DB) DeleteExpiredExports(before time.Time) (int, error) {
+	db, span := db.trace("DeleteExpiredExports")
+	defer span.End()
+	result, err := db.exec("DELETE FROM DataExports WHERE createdAt < ?", before.Local().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
+
+func (db *DB) GetPostsByAuthor(authorID int) ([]models.Post, error) {
+	db, span := db.trace("GetPostsByAuthor")
+	defer span.End()
+	query := "SELECT id, title, content, authorId, status, createdAt, updatedAt, version FROM posts WHERE authorId = ? ORDER BY createdAt, id"
+	rows, err := db.query(query, authorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []models.Post
+	for rows.Next() {
+		var post models.Post
+		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.AuthorID, &post.Status, &post.CreatedAt, &post.UpdatedAt, &post.Version)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return posts, db.loadTags(posts)
+}
+
+func (db *DB) GetCommentsByAuthor(authorID int) ([]models.Comment, error) {
+	db, span := db.trace("GetCommentsByAuthor")
+	defer span.End()
+	query := "SELECT id, postId, authorId, content, createdAt, updatedAt, version FROM comments WHERE authorId = ? ORDER BY createdAt, id"
+	rows, err := db.query(query, authorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []models.Comment
+	for rows.Next() {
+		var comment models.Comment
+		err := rows.Scan(&comment.ID, &comment.Postid, &comment.AuthorID, &comment.Content, &comment.CreatedAt, &comment.UpdatedAt, &comment.Version)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+func (db *DB) GetIdentities(userID int) ([]models.UserIdentity, error) {
+	db, span := db.trace("GetIdentities")
+	defer span.End()
+	query := "SELECT id, userId, issuer, subject, email, createdAt FROM UserIdentities WHERE userId = ? ORDER BY id"
+	rows, err := db.query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []models.UserIdentity
+	for rows.Next() {
+		var identity models.UserIdentity
+		err := rows.Scan(&identity.ID, &identity.UserID, &identity.Issuer, &identity.Subject, &identity.Email, &identity.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
@@ -0,0 +1,203 @@
+package conn
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/A-Victory/blog/models"
+)
+
+// feedBackfill is how many of an author's recent posts are copied into a
+// user's feed when they start following the author.
+const feedBackfill = 50
+
+// Follow makes followerID follow followeeID and backfills the follower's feed
+// with the author's recent posts. It returns 0 if the follow already existed.
+func (db *DB) Follow(followerID, followeeID int) (int, error) {
+	db, span := db.trace("Follow")
+	defer span.End()
+
+	tx, err := db.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	createdAt := time.Now().Local().Format("2006-01-02 15:04:05")
+	result, err := db.execIn(tx, "INSERT IGNORE INTO Follows (followerId, followeeId, createdAt) VALUES (?, ?, ?)", followerID, followeeID, createdAt)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if rowsAffected == 0 {
+		return 0, nil
+	}
+
+	query := `INSERT IGNORE INTO FeedItems (userId, postId, authorId, createdAt)
+		SELECT ?, id, authorId, createdAt FROM posts WHERE authorId = ? AND status = ?
+		ORDER BY createdAt DESC, id DESC LIMIT ?`
+	if _, err := db.execIn(tx, query, followerID, followeeID, models.PostPublished, feedBackfill); err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), tx.Commit()
+}
+
+// Unfollow removes the follow and the author's posts from the follower's feed.
+func (db *DB) Unfollow(followerID, followeeID int) (int, error) {
+	db, span := db.trace("Unfollow")
+	defer span.End()
+
+	tx, err := db.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := db.execIn(tx, "DELETE FROM Follows WHERE followerId = ? AND followeeId = ?", followerID, followeeID)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := db.execIn(tx, "DELETE FROM FeedItems WHERE userId = ? AND authorId = ?", followerID, followeeID); err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), tx.Commit()
+}
+
+func (db *DB) IsFollowing(followerID, followeeID int) (bool, error) {
+	db, span := db.trace("IsFollowing")
+	defer span.End()
+	var exists bool
+	err := db.queryRow("SELECT EXISTS(SELECT 1 FROM Follows WHERE followerId = ? AND followeeId = ?)", followerID, followeeID).Scan(&exists)
+	return exists, err
+}
+
+// GetFollowers returns a page of the users following userID.
+func (db *DB) GetFollowers(userID int, opts models.ListOptions) ([]models.Follow, models.Page, error) {
+	db, span := db.trace("GetFollowers")
+	defer span.End()
+	return db.getFollows("followeeId", "followerId", userID, opts)
+}
+
+// GetFollowing returns a page of the users userID follows.
+func (db *DB) GetFollowing(userID int, opts models.ListOptions) ([]models.Follow, models.Page, error) {
+	db, span := db.trace("GetFollowing")
+	defer span.End()
+	return db.getFollows("followerId", "followeeId", userID, opts)
+}
+
+// getFollows lists the follows whose column matches userID, joined with the
+// user in the other column.
+func (db *DB) getFollows(column, other string, userID int, opts models.ListOptions) ([]models.Follow, models.Page, error) {
+	q, err := createdOrdering("f.createdAt", "f."+other).list(opts)
+	if err != nil {
+		return nil, models.Page{}, err
+	}
+
+	total, err := db.count("SELECT COUNT(*) FROM Follows WHERE "+column+" = ?", userID)
+	if err != nil {
+		return nil, models.Page{}, err
+	}
+
+	query := "SELECT u.id, u.username, u.displayName, f.createdAt" + q.column() + " FROM Follows f JOIN users u ON u.id = f." + other + " WHERE f." + column + " = ?" + q.tail
+	rows, err := db.query(query, append([]interface{}{userID}, q.params...)...)
+	if err != nil {
+		return nil, models.Page{}, err
+	}
+	defer rows.Close()
+
+	follows := []models.Follow{}
+	var keys []string
+	var ids []int
+	for rows.Next() {
+		var follow models.Follow
+		var key string
+		if err := rows.Scan(&follow.UserID, &follow.Username, &follow.DisplayName, &follow.FollowedAt, &key); err != nil {
+			return nil, models.Page{}, err
+		}
+		follows = append(follows, follow)
+		keys = append(keys, key)
+		ids = append(ids, follow.UserID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, models.Page{}, err
+	}
+
+	page, n := q.page(total, keys, ids)
+	return follows[:n], page, nil
+}
+
+// GetFeed returns the published posts of the authors userID follows, newest
+// first unless opts asks for the oldest.
+func (db *DB) GetFeed(userID int, opts models.ListOptions) ([]models.Post, models.Page, error) {
+	db, span := db.trace("GetFeed")
+	defer span.End()
+	q, err := createdOrdering("f.createdAt", "f.postId").list(opts)
+	if err != nil {
+		return nil, models.Page{}, err
+	}
+
+	from := ` FROM FeedItems f
+		JOIN posts p ON p.id = f.postId
+		WHERE f.userId = ? AND p.status = ?`
+
+	total, err := db.count("SELECT COUNT(*)"+from, userID, models.PostPublished)
+	if err != nil {
+		return nil, models.Page{}, err
+	}
+
+	query := "SELECT p.id, p.title, p.content, p.authorId, p.status, p.createdAt, p.updatedAt, p.version" + q.column() + from + q.tail
+	rows, err := db.query(query, append([]interface{}{userID, models.PostPublished}, q.params...)...)
+	if err != nil {
+		return nil, models.Page{}, err
+	}
+	defer rows.Close()
+
+	posts := []models.Post{}
+	var keys []string
+	var ids []int
+	for rows.Next() {
+		var post models.Post
+		var key string
+		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.AuthorID, &post.Status, &post.CreatedAt, &post.UpdatedAt, &post.Version, &key)
+		if err != nil {
+			return nil, models.Page{}, err
+		}
+		posts = append(posts, post)
+		keys = append(keys, key)
+		ids = append(ids, post.ID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, models.Page{}, err
+	}
+
+	page, n := q.page(total, keys, ids)
+	posts = posts[:n]
+	return posts, page, db.loadTags(posts)
+}
+
+// fanOut copies a published post into the feed of every follower of its
+// author. Posts already in a feed are left alone, so it is safe to call again
+// when a post is re-published. It runs within tx, the transaction writing
+// the post.
+func (db *DB) fanOut(tx *sql.Tx, postID int) error {
+	query := `INSERT IGNORE INTO FeedItems (userId, postId, authorId, createdAt)
+		SELECT f.followerId, p.id, p.authorId, p.createdAt FROM posts p
+		JOIN Follows f ON f.followeeId = p.authorId
+		WHERE p.id = ? AND p.status = ?`
+	_, err := db.execIn(tx, query, postID, models.PostPublished)
+	return err
+}
@@ -0,0 +1,100 @@
+package conn
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/A-Victory/blog/models"
+)
+
+// ReserveIdempotencyKey claims a key for the first request sent with it. It
+// returns true when the key was free or had expired. Otherwise it returns
+// false and the record of the earlier request, which may still be pending.
+func (db *DB) ReserveIdempotencyKey(record models.IdempotencyRecord) (models.IdempotencyRecord, bool, error) {
+	db, span := db.trace("ReserveIdempotencyKey")
+	defer span.End()
+	now := time.Now().UTC().Format("2006-01-02 15:04:05")
+
+	_, err := db.exec("DELETE FROM IdempotencyKeys WHERE userId = ? AND idempotencyKey = ? AND expiresAt <= ?", record.UserID, record.Key, now)
+	if err != nil {
+		return models.IdempotencyRecord{}, false, err
+	}
+
+	query := "INSERT INTO IdempotencyKeys (userId, idempotencyKey, fingerprint, headers, body, createdAt, expiresAt) VALUES (?, ?, ?, '{}', '', ?, ?)"
+	_, err = db.exec(query, record.UserID, record.Key, record.Fingerprint, now, record.ExpiresAt)
+	if err == nil {
+		return record, true, nil
+	}
+	if !isDuplicate(err) {
+		return models.IdempotencyRecord{}, false, err
+	}
+
+	existing, err := db.GetIdempotencyKey(record.UserID, record.Key)
+	return existing, false, err
+}
+
+func (db *DB) GetIdempotencyKey(userID int, key string) (models.IdempotencyRecord, error) {
+	db, span := db.trace("GetIdempotencyKey")
+	defer span.End()
+	query := "SELECT userId, idempotencyKey, fingerprint, status, headers, body, createdAt, expiresAt FROM IdempotencyKeys WHERE userId = ? AND idempotencyKey = ?"
+
+	var record models.IdempotencyRecord
+	var headers string
+	err := db.queryRow(query, userID, key).Scan(&record.UserID, &record.Key, &record.Fingerprint, &record.Status, &headers, &record.Body, &record.CreatedAt, &record.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.IdempotencyRecord{}, nil
+		}
+		return models.IdempotencyRecord{}, err
+	}
+
+	if err := json.Unmarshal([]byte(headers), &record.Headers); err != nil {
+		return models.IdempotencyRecord{}, err
+	}
+
+	return record, nil
+}
+
+// CompleteIdempotencyKey stores the response of the request holding the key
+// so that retries can be answered with it.
+func (db *DB) CompleteIdempotencyKey(record models.IdempotencyRecord) error {
+	db, span := db.trace("CompleteIdempotencyKey")
+	defer span.End()
+	headers, err := json.Marshal(record.Headers)
+	if err != nil {
+		return err
+	}
+
+	query := "UPDATE IdempotencyKeys SET status = ?, headers = ?, body = ? WHERE userId = ? AND idempotencyKey = ?"
+	_, err = db.exec(query, record.Status, string(headers), record.Body, record.UserID, record.Key)
+	return err
+}
+
+// ReleaseIdempotencyKey frees a key whose request failed, so that a retry is
+// handled again.
+func (db *DB) ReleaseIdempotencyKey(userID int, key string) error {
+	db, span := db.trace("ReleaseIdempotencyKey")
+	defer span.End()
+	_, err := db.exec("DELETE FROM IdempotencyKeys WHERE userId = ? AND idempotencyKey = ?", userID, key)
+	return err
+}
+
+// PurgeIdempotencyKeys deletes the keys whose window is over and returns how
+// many there were.
+func (db *DB) PurgeIdempotencyKeys() (int, error) {
+	db, span := db.trace("PurgeIdempotencyKeys")
+	defer span.End()
+	now := time.Now().UTC().Format("2006-01-02 15:04:05")
+	result, err := db.exec("DELETE FROM IdempotencyKeys WHERE expiresAt <= ?", now)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
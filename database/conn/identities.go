@@ -0,0 +1,46 @@
+package conn
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/A-Victory/blog/models"
+)
+
+func (db *DB) LinkIdentity(identity models.UserIdentity) (int, error) {
+	db, span := db.trace("LinkIdentity")
+	defer span.End()
+
+	identity.CreatedAt = time.Now().Local().Format("2006-01-02 15:04:05")
+	query := "INSERT INTO UserIdentities (userId, issuer, subject, email, createdAt) VALUES (?, ?, ?, ?, ?)"
+
+	result, err := db.exec(query, identity.UserID, identity.Issuer, identity.Subject, identity.Email, identity.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+func (db *DB) GetIdentity(issuer, subject string) (models.UserIdentity, error) {
+	db, span := db.trace("GetIdentity")
+	defer span.End()
+	query := "SELECT id, userId, issuer, subject, email, createdAt FROM UserIdentities WHERE issuer = ? AND subject = ?"
+	row := db.queryRow(query, issuer, subject)
+
+	var identity models.UserIdentity
+	err := row.Scan(&identity.ID, &identity.UserID, &identity.Issuer, &identity.Subject, &identity.Email, &identity.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.UserIdentity{}, nil
+		}
+		return models.UserIdentity{}, err
+	}
+
+	return identity, nil
+}
@@ -0,0 +1,132 @@
+package conn
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/A-Victory/blog/models"
+)
+
+var (
+	ErrInvalidSort   = errors.New("unsupported sort order")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// sortKey is the expression a sort order orders by.
+type sortKey struct {
+	expr      string
+	ascending bool
+}
+
+// ordering lists the sort orders a list supports. id breaks ties so that
+// every row has a unique position, which keyset pagination relies on.
+type ordering struct {
+	sorts map[string]sortKey
+	id    string
+}
+
+// postOrdering is shared by the post lists. prefix qualifies the post
+// columns.
+func postOrdering(prefix string) ordering {
+	return ordering{
+		sorts: map[string]sortKey{
+			models.SortNewest:   {expr: prefix + "createdAt"},
+			models.SortOldest:   {expr: prefix + "createdAt", ascending: true},
+			models.SortUpdated:  {expr: prefix + "updatedAt"},
+			models.SortComments: {expr: "(SELECT COUNT(*) FROM comments WHERE comments.postId = " + prefix + "id)"},
+		},
+		id: prefix + "id",
+	}
+}
+
+// createdOrdering sorts by creation time only.
+func createdOrdering(created, id string) ordering {
+	return ordering{
+		sorts: map[string]sortKey{
+			models.SortNewest: {expr: created},
+			models.SortOldest: {expr: created, ascending: true},
+		},
+		id: id,
+	}
+}
+
+// listQuery holds the parts of a list query that depend on the sort order
+// and the page.
+type listQuery struct {
+	sort  string
+	limit int
+	// key is the sort expression. List queries select it after their own
+	// columns so the cursor can be built from the last row.
+	key    string
+	tail   string
+	params []interface{}
+}
+
+// list returns the keyset condition, ORDER BY and LIMIT for opts, to be
+// appended to a query whose WHERE clause holds the list's own filters. One
+// row more than the limit is read to tell whether another page follows.
+func (o ordering) list(opts models.ListOptions) (listQuery, error) {
+	sort := opts.Sort
+	if sort == "" {
+		sort = models.SortNewest
+	}
+	key, ok := o.sorts[sort]
+	if !ok {
+		return listQuery{}, ErrInvalidSort
+	}
+
+	compare, direction := "<", "DESC"
+	if key.ascending {
+		compare, direction = ">", "ASC"
+	}
+
+	var tail strings.Builder
+	var params []interface{}
+
+	if opts.Cursor != nil {
+		if opts.Cursor.Sort != sort {
+			return listQuery{}, ErrInvalidCursor
+		}
+		fmt.Fprintf(&tail, " AND (%s %s ? OR (%s = ? AND %s %s ?))", key.expr, compare, key.expr, o.id, compare)
+		params = append(params, opts.Cursor.Value, opts.Cursor.Value, opts.Cursor.ID)
+	}
+
+	fmt.Fprintf(&tail, " ORDER BY %s %s, %s %s", key.expr, direction, o.id, direction)
+
+	if opts.Limit > 0 {
+		tail.WriteString(" LIMIT ?")
+		params = append(params, opts.Limit+1)
+		if opts.Cursor == nil && opts.Offset > 0 {
+			tail.WriteString(" OFFSET ?")
+			params = append(params, opts.Offset)
+		}
+	}
+
+	return listQuery{sort: sort, limit: opts.Limit, key: key.expr, tail: tail.String(), params: params}, nil
+}
+
+// column returns the sort key to add to the select list.
+func (q listQuery) column() string {
+	return ", " + q.key
+}
+
+// page builds the page description from the sort keys and ids of the rows
+// read, and returns how many of the rows belong to the page.
+func (q listQuery) page(total int, keys []string, ids []int) (models.Page, int) {
+	page := models.Page{Total: total, Sort: q.sort}
+	if q.limit == 0 || len(keys) <= q.limit {
+		return page, len(keys)
+	}
+
+	last := q.limit - 1
+	page.NextCursor = models.Cursor{Sort: q.sort, Value: keys[last], ID: ids[last]}.Encode()
+	return page, q.limit
+}
+
+// count runs a COUNT(*) query for a list's total.
+func (db *DB) count(query string, params ...interface{}) (int, error) {
+	var total int
+	err := db.queryRow(query, params...).Scan(&total)
+	return total, err
+}
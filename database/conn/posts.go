@@ -2,20 +2,36 @@ package conn
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
 	"strings"
 	"time"
 
 	"github.com/A-Victory/blog/models"
 )
 
+// ErrVersionConflict is returned when a post or comment was changed since the
+// version the caller expected.
+var ErrVersionConflict = errors.New("the resource was modified since it was read")
+
 func (db *DB) CreatePost(data models.Post) (int, error) {
+	db, span := db.trace("CreatePost")
+	defer span.End()
 
 	data.CreatedAt = time.Now().Local().Format("2006-01-02 15:04:05")
 	data.UpdatedAt = time.Now().UTC().Format("2006-01-02 15:04:05")
-	query := "INSERT INTO Posts (title, content, authorId, createdAt, updatedAt) VALUES (?, ?, ?, ?, ?)"
-	result, err := db.Conn.DB.Exec(query, data.Title, data.Content, data.AuthorID, data.CreatedAt, data.UpdatedAt)
+	if data.Status == "" {
+		data.Status = models.PostPublished
+	}
+
+	tx, err := db.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := "INSERT INTO Posts (title, content, authorId, status, createdAt, updatedAt) VALUES (?, ?, ?, ?, ?, ?)"
+	result, err := db.execIn(tx, query, data.Title, data.Content, data.AuthorID, data.Status, data.CreatedAt, data.UpdatedAt)
 	if err != nil {
 		return 0, err
 	}
@@ -23,12 +39,37 @@ func (db *DB) CreatePost(data models.Post) (int, error) {
 	if err != nil {
 		return 0, err
 	}
+
+	if len(data.Tags) > 0 {
+		if err := db.setTags(tx, int(postID), data.Tags); err != nil {
+			return 0, err
+		}
+	}
+	if data.Status == models.PostPublished {
+		if err := db.fanOut(tx, int(postID)); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
 	return int(postID), nil
 }
 
-func (db *DB) DeletePost(postID int) (int, error) {
+// DeletePost deletes a post. A non-zero version must match the post's
+// version, otherwise ErrVersionConflict is returned.
+func (db *DB) DeletePost(postID, version int) (int, error) {
+	db, span := db.trace("DeletePost")
+	defer span.End()
 	query := "DELETE FROM posts WHERE id = ?"
-	result, err := db.Conn.DB.Exec(query, postID)
+	params := []interface{}{postID}
+	if version > 0 {
+		query += " AND version = ?"
+		params = append(params, version)
+	}
+
+	result, err := db.exec(query, params...)
 	if err != nil {
 		return 0, err
 	}
@@ -39,13 +80,21 @@ func (db *DB) DeletePost(postID int) (int, error) {
 	}
 
 	if rowsAffected == 0 {
+		if version > 0 {
+			return 0, ErrVersionConflict
+		}
 		return 0, nil // No rows affected, indicating no post with the given ID was found
 	}
 
 	return int(rowsAffected), nil
 }
 
+// UpdatePost updates the fields of the post that are set and bumps its
+// version. A non-zero post.Version must match the stored version, otherwise
+// ErrVersionConflict is returned.
 func (db *DB) UpdatePost(post models.Post) (int, error) {
+	db, span := db.trace("UpdatePost")
+	defer span.End()
 	query := "UPDATE posts SET "
 	params := []interface{}{}
 
@@ -59,18 +108,31 @@ func (db *DB) UpdatePost(post models.Post) (int, error) {
 		params = append(params, post.Content)
 	}
 
-	if len(params) == 0 {
+	if post.Status != "" {
+		query += "status = ?, "
+		params = append(params, post.Status)
+	}
+
+	if len(params) == 0 && post.Tags == nil {
 		return 0, fmt.Errorf("no fields to update")
 	}
 
 	updatedAt := time.Now().UTC().Format("2006-01-02 15:04:05")
 
-	query += "updatedAt = ? WHERE id = ? AND authorId = ?"
+	query += "updatedAt = ?, version = version + 1 WHERE id = ? AND authorId = ?"
 	params = append(params, updatedAt, post.ID, post.AuthorID)
+	if post.Version > 0 {
+		query += " AND version = ?"
+		params = append(params, post.Version)
+	}
 
-	log.Printf("%+v", params)
+	tx, err := db.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
 
-	result, err := db.Conn.DB.Exec(query, params...)
+	result, err := db.execIn(tx, query, params...)
 	if err != nil {
 		return 0, err
 	}
@@ -81,65 +143,163 @@ func (db *DB) UpdatePost(post models.Post) (int, error) {
 	}
 
 	if rowsAffected == 0 {
+		if post.Version > 0 {
+			return 0, ErrVersionConflict
+		}
 		return 0, nil // No rows affected, indicating no post with the given ID was found
 	}
 
+	if post.Tags != nil {
+		if err := db.setTags(tx, post.ID, post.Tags); err != nil {
+			return 0, err
+		}
+	}
+	if post.Status == models.PostPublished {
+		if err := db.fanOut(tx, post.ID); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
 	//id, _ := result.LastInsertId()
 
 	return int(rowsAffected), nil
 }
 
-func (db *DB) GetPosts(limit, offset *int, searchTerm *string) ([]models.Post, error) {
-	query := `SELECT id, title, content, authorId, createdAt, updatedAt FROM posts WHERE 1=1`
+// GetPosts returns a page of the posts matching the filter.
+func (db *DB) GetPosts(opts models.ListOptions, f models.PostFilter) ([]models.Post, models.Page, error) {
+	db, span := db.trace("GetPosts")
+	defer span.End()
+	q, err := postOrdering("p.").list(opts)
+	if err != nil {
+		return nil, models.Page{}, err
+	}
 
-	params := []interface{}{}
+	filter, params := postFilter(f)
 
-	if searchTerm != nil && *searchTerm != "" {
-		query += " AND (title LIKE ? OR content LIKE ?)"
-		searchValue := "%" + strings.TrimSpace(*searchTerm) + "%"
-		params = append(params, searchValue, searchValue)
+	total, err := db.count("SELECT COUNT(*) FROM posts p"+filter, params...)
+	if err != nil {
+		return nil, models.Page{}, err
 	}
 
-	if limit != nil && offset != nil {
-		query += " LIMIT ? OFFSET ?"
-		params = append(params, *limit, *offset)
+	query := "SELECT p.id, p.title, p.content, p.authorId, p.status, p.createdAt, p.updatedAt, p.version" + q.column() + " FROM posts p" + filter
+	return db.listPosts(q, query, params, total)
+}
+
+// postFilter builds the WHERE clause of the posts listing. Every value is
+// passed as a parameter; only the shape of the clause depends on the filter.
+func postFilter(f models.PostFilter) (string, []interface{}) {
+	var filter strings.Builder
+	var params []interface{}
+
+	switch f.Status {
+	case models.PostDraft:
+		filter.WriteString(" WHERE p.status = ? AND p.authorId = ?")
+		params = append(params, models.PostDraft, f.ViewerID)
+	case "all":
+		filter.WriteString(" WHERE (p.status = ? OR p.authorId = ?)")
+		params = append(params, models.PostPublished, f.ViewerID)
+	default:
+		filter.WriteString(" WHERE p.status = ?")
+		params = append(params, models.PostPublished)
 	}
 
-	stmt, err := db.Conn.DB.Prepare(query)
-	if err != nil {
-		return nil, err
+	search, searchParams := postSearch("p.", f.Search)
+	filter.WriteString(search)
+	params = append(params, searchParams...)
+
+	if f.Author != "" {
+		filter.WriteString(" AND p.authorId = (SELECT id FROM users WHERE username = ?)")
+		params = append(params, f.Author)
 	}
-	defer stmt.Close()
 
-	rows, err := stmt.Query(params...)
+	for _, bound := range []struct {
+		condition string
+		value     string
+	}{
+		{" AND p.createdAt >= ?", f.CreatedAfter},
+		{" AND p.createdAt < ?", f.CreatedBefore},
+		{" AND p.updatedAt >= ?", f.UpdatedAfter},
+		{" AND p.updatedAt < ?", f.UpdatedBefore},
+	} {
+		if bound.value != "" {
+			filter.WriteString(bound.condition)
+			params = append(params, bound.value)
+		}
+	}
+
+	if len(f.Tags) > 0 {
+		filter.WriteString(" AND EXISTS (SELECT 1 FROM PostTags t WHERE t.postId = p.id AND t.tag IN (" + placeholders(len(f.Tags)) + "))")
+		for _, tag := range f.Tags {
+			params = append(params, tag)
+		}
+	}
+
+	if f.HasComments != nil {
+		if *f.HasComments {
+			filter.WriteString(" AND EXISTS (SELECT 1 FROM comments c WHERE c.postId = p.id)")
+		} else {
+			filter.WriteString(" AND NOT EXISTS (SELECT 1 FROM comments c WHERE c.postId = p.id)")
+		}
+	}
+
+	return filter.String(), params
+}
+
+// postSearch builds the search clause shared by the post listings. prefix
+// qualifies the post columns when the query joins other tables.
+func postSearch(prefix string, searchTerm string) (string, []interface{}) {
+	if strings.TrimSpace(searchTerm) == "" {
+		return "", nil
+	}
+
+	searchValue := "%" + strings.TrimSpace(searchTerm) + "%"
+	return fmt.Sprintf(" AND (%stitle LIKE ? OR %scontent LIKE ?)", prefix, prefix), []interface{}{searchValue, searchValue}
+}
+
+// listPosts runs a post list query built for q, which selects the post
+// columns followed by the sort key, and returns the page.
+func (db *DB) listPosts(q listQuery, query string, params []interface{}, total int) ([]models.Post, models.Page, error) {
+	rows, err := db.query(query+q.tail, append(params, q.params...)...)
 	if err != nil {
-		return nil, err
+		return nil, models.Page{}, err
 	}
 	defer rows.Close()
 
-	var posts []models.Post
+	posts := []models.Post{}
+	var keys []string
+	var ids []int
 	for rows.Next() {
 		var post models.Post
-		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.AuthorID, &post.CreatedAt, &post.UpdatedAt)
+		var key string
+		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.AuthorID, &post.Status, &post.CreatedAt, &post.UpdatedAt, &post.Version, &key)
 		if err != nil {
-			return nil, err
+			return nil, models.Page{}, err
 		}
 		posts = append(posts, post)
+		keys = append(keys, key)
+		ids = append(ids, post.ID)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, models.Page{}, err
 	}
 
-	return posts, nil
+	page, n := q.page(total, keys, ids)
+	posts = posts[:n]
+	return posts, page, db.loadTags(posts)
 }
 
 func (db *DB) GetPostByID(postID int) (models.Post, error) {
-	query := "SELECT id, title, content, authorId, createdAt, updatedAt FROM posts WHERE id = ?"
-	row := db.Conn.DB.QueryRow(query, postID)
+	db, span := db.trace("GetPostByID")
+	defer span.End()
+	query := "SELECT id, title, content, authorId, status, createdAt, updatedAt, version FROM posts WHERE id = ?"
+	row := db.queryRow(query, postID)
 
 	var post models.Post
-	err := row.Scan(&post.ID, &post.Title, &post.Content, &post.AuthorID, &post.CreatedAt, &post.UpdatedAt)
+	err := row.Scan(&post.ID, &post.Title, &post.Content, &post.AuthorID, &post.Status, &post.CreatedAt, &post.UpdatedAt, &post.Version)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			// return models.Post{}, fmt.Errorf("no post found with ID %d", postID)
@@ -148,5 +308,57 @@ func (db *DB) GetPostByID(postID int) (models.Post, error) {
 		return models.Post{}, err
 	}
 
-	return post, nil
+	posts := []models.Post{post}
+	if err := db.loadTags(posts); err != nil {
+		return models.Post{}, err
+	}
+
+	return posts[0], nil
+}
+
+// GetPostsByIDs returns the posts with the given ids, keyed by id. Ids
+// without a post are left out.
+func (db *DB) GetPostsByIDs(ids []int) (map[int]models.Post, error) {
+	db, span := db.trace("GetPostsByIDs")
+	defer span.End()
+	found := map[int]models.Post{}
+	if len(ids) == 0 {
+		return found, nil
+	}
+
+	params := make([]interface{}, len(ids))
+	for i, id := range ids {
+		params[i] = id
+	}
+
+	posts, err := db.queryPosts("SELECT id, title, content, authorId, status, createdAt, updatedAt, version FROM posts WHERE id IN ("+placeholders(len(ids))+")", params...)
+	if err != nil {
+		return nil, err
+	}
+	for _, post := range posts {
+		found[post.ID] = post
+	}
+
+	return found, nil
+}
+
+// GetPublishedPostsByAuthor returns a page of an author's published posts.
+func (db *DB) GetPublishedPostsByAuthor(authorID int, opts models.ListOptions) ([]models.Post, models.Page, error) {
+	db, span := db.trace("GetPublishedPostsByAuthor")
+	defer span.End()
+	q, err := postOrdering("p.").list(opts)
+	if err != nil {
+		return nil, models.Page{}, err
+	}
+
+	filter := " WHERE p.authorId = ? AND p.status = ?"
+	params := []interface{}{authorID, models.PostPublished}
+
+	total, err := db.count("SELECT COUNT(*) FROM posts p"+filter, params...)
+	if err != nil {
+		return nil, models.Page{}, err
+	}
+
+	query := "SELECT p.id, p.title, p.content, p.authorId, p.status, p.createdAt, p.updatedAt, p.version" + q.column() + " FROM posts p" + filter
+	return db.listPosts(q, query, params, total)
 }
@@ -0,0 +1,147 @@
+package conn
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/A-Victory/blog/models"
+)
+
+// profileQuery selects the public profile columns read by scanProfile.
+const profileQuery = `SELECT u.id, u.username, u.displayName, u.bio, u.website, u.socialLinks, a.userId IS NOT NULL,
+		(SELECT COUNT(*) FROM Follows WHERE followeeId = u.id),
+		(SELECT COUNT(*) FROM Follows WHERE followerId = u.id)
+		FROM users u LEFT JOIN UserAvatars a ON a.userId = u.id`
+
+// GetProfile returns the public profile of the user with the given username.
+// The avatar URL is left for the caller to fill in.
+func (db *DB) GetProfile(username string) (models.Profile, error) {
+	db, span := db.trace("GetProfile")
+	defer span.End()
+	row := db.queryRow(profileQuery+" WHERE u.username = ?", username)
+
+	profile, err := scanProfile(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Profile{}, nil
+		}
+		return models.Profile{}, err
+	}
+
+	return profile, nil
+}
+
+// GetProfilesByIDs returns the public profiles of the users with the given
+// ids, keyed by id. Ids without a user are left out.
+func (db *DB) GetProfilesByIDs(ids []int) (map[int]models.Profile, error) {
+	db, span := db.trace("GetProfilesByIDs")
+	defer span.End()
+	profiles := map[int]models.Profile{}
+	if len(ids) == 0 {
+		return profiles, nil
+	}
+
+	params := make([]interface{}, len(ids))
+	for i, id := range ids {
+		params[i] = id
+	}
+
+	rows, err := db.query(profileQuery+" WHERE u.id IN ("+placeholders(len(ids))+")", params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		profile, err := scanProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles[profile.ID] = profile
+	}
+
+	return profiles, rows.Err()
+}
+
+func scanProfile(row interface{ Scan(...interface{}) error }) (models.Profile, error) {
+	var profile models.Profile
+	var socialLinks string
+	err := row.Scan(&profile.ID, &profile.Username, &profile.DisplayName, &profile.Bio, &profile.Website, &socialLinks, &profile.HasAvatar, &profile.Followers, &profile.Following)
+	if err != nil {
+		return models.Profile{}, err
+	}
+
+	profile.SocialLinks = map[string]string{}
+	if err := json.Unmarshal([]byte(socialLinks), &profile.SocialLinks); err != nil {
+		return models.Profile{}, err
+	}
+
+	return profile, nil
+}
+
+func (db *DB) UpdateProfile(userID int, update models.ProfileUpdate) (int, error) {
+	db, span := db.trace("UpdateProfile")
+	defer span.End()
+
+	if update.SocialLinks == nil {
+		update.SocialLinks = map[string]string{}
+	}
+	socialLinks, err := json.Marshal(update.SocialLinks)
+	if err != nil {
+		return 0, err
+	}
+
+	query := "UPDATE users SET displayName = ?, bio = ?, website = ?, socialLinks = ? WHERE id = ?"
+	result, err := db.exec(query, update.DisplayName, update.Bio, update.Website, string(socialLinks), userID)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
+
+func (db *DB) SaveAvatar(userID int, avatar models.Avatar) error {
+	db, span := db.trace("SaveAvatar")
+	defer span.End()
+	query := "INSERT INTO UserAvatars (userId, contentType, data) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE contentType = VALUES(contentType), data = VALUES(data)"
+	_, err := db.exec(query, userID, avatar.ContentType, avatar.Data)
+	return err
+}
+
+func (db *DB) GetAvatar(userID int) (models.Avatar, error) {
+	db, span := db.trace("GetAvatar")
+	defer span.End()
+	query := "SELECT contentType, data, updatedAt FROM UserAvatars WHERE userId = ?"
+
+	var avatar models.Avatar
+	err := db.queryRow(query, userID).Scan(&avatar.ContentType, &avatar.Data, &avatar.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Avatar{}, nil
+		}
+		return models.Avatar{}, err
+	}
+
+	return avatar, nil
+}
+
+func (db *DB) DeleteAvatar(userID int) (int, error) {
+	db, span := db.trace("DeleteAvatar")
+	defer span.End()
+	result, err := db.exec("DELETE FROM UserAvatars WHERE userId = ?", userID)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
@@ -0,0 +1,67 @@
+package conn
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/A-Victory/blog/models"
+)
+
+// setTags replaces the tags of a post within tx, the transaction writing the
+// post, so that the post never changes without its tags.
+func (db *DB) setTags(tx *sql.Tx, postID int, tags []string) error {
+	if _, err := db.execIn(tx, "DELETE FROM PostTags WHERE postId = ?", postID); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := db.execIn(tx, "INSERT INTO PostTags (postId, tag) VALUES (?, ?)", postID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadTags fills in the tags of the posts with one query.
+func (db *DB) loadTags(posts []models.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	params := make([]interface{}, len(posts))
+	for i, post := range posts {
+		params[i] = post.ID
+	}
+	query := "SELECT postId, tag FROM PostTags WHERE postId IN (" + placeholders(len(posts)) + ") ORDER BY tag"
+
+	rows, err := db.query(query, params...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tags := map[int][]string{}
+	for rows.Next() {
+		var postID int
+		var tag string
+		if err := rows.Scan(&postID, &tag); err != nil {
+			return err
+		}
+		tags[postID] = append(tags[postID], tag)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range posts {
+		posts[i].Tags = tags[posts[i].ID]
+		if posts[i].Tags == nil {
+			posts[i].Tags = []string{}
+		}
+	}
+	return nil
+}
+
+// placeholders returns n comma separated query placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
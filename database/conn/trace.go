@@ -0,0 +1,116 @@
+package conn
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/A-Victory/blog/database/conn")
+
+// trace starts the span of a DB method and returns a copy of db whose
+// statements are traced under it.
+func (db *DB) trace(method string) (*DB, trace.Span) {
+	ctx, span := tracer.Start(db.context(), "conn.DB."+method,
+		trace.WithAttributes(semconv.DBSystemMySQL),
+	)
+	return db.WithContext(ctx), span
+}
+
+// runner is a *sql.DB or a *sql.Tx.
+type runner interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (db *DB) exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.execIn(db.Conn.DB, query, args...)
+}
+
+func (db *DB) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.queryIn(db.Conn.DB, query, args...)
+}
+
+func (db *DB) queryRow(query string, args ...interface{}) *sql.Row {
+	return db.queryRowIn(db.Conn.DB, query, args...)
+}
+
+func (db *DB) begin() (*sql.Tx, error) {
+	return db.Conn.DB.BeginTx(db.context(), nil)
+}
+
+func (db *DB) execIn(r runner, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := db.statement(query)
+	defer span.End()
+	result, err := r.ExecContext(ctx, query, args...)
+	recordError(span, err)
+	return result, err
+}
+
+func (db *DB) queryIn(r runner, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := db.statement(query)
+	defer span.End()
+	rows, err := r.QueryContext(ctx, query, args...)
+	recordError(span, err)
+	return rows, err
+}
+
+func (db *DB) queryRowIn(r runner, query string, args ...interface{}) *sql.Row {
+	ctx, span := db.statement(query)
+	defer span.End()
+	row := r.QueryRowContext(ctx, query, args...)
+	recordError(span, row.Err())
+	return row
+}
+
+// statement starts the span of a SQL statement, named after its operation,
+// such as SELECT. Its text is sanitized, so that no value can leak into the
+// traces.
+func (db *DB) statement(query string) (context.Context, trace.Span) {
+	operation := "SQL"
+	if fields := strings.Fields(query); len(fields) > 0 {
+		operation = strings.ToUpper(fields[0])
+	}
+	return tracer.Start(db.context(), operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemMySQL,
+			semconv.DBOperationName(operation),
+			semconv.DBQueryText(SanitizeSQL(query)),
+		),
+	)
+}
+
+func recordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+var (
+	sqlLiteral    = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'|"(?:[^"\\]|\\.)*"|\b\d+(?:\.\d+)?\b`)
+	sqlWhitespace = regexp.MustCompile(`\s+`)
+)
+
+// maxStatement is the length past which statements are cut in traces.
+const maxStatement = 2000
+
+// SanitizeSQL replaces the string and number literals of query with ? and
+// collapses its whitespace. Values are passed as parameters everywhere, so
+// this only guards against literals written into queries.
+func SanitizeSQL(query string) string {
+	query = sqlLiteral.ReplaceAllString(query, "?")
+	query = strings.TrimSpace(sqlWhitespace.ReplaceAllString(query, " "))
+	if len(query) > maxStatement {
+		query = query[:maxStatement] + "..."
+	}
+	return query
+}
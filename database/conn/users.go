@@ -3,15 +3,18 @@ package conn
 import (
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/A-Victory/blog/models"
 )
 
 func (db *DB) SaveUser(data models.User) (int, error) {
+	db, span := db.trace("SaveUser")
+	defer span.End()
 
 	query := "INSERT INTO Users (username, email, password) VALUES (?, ?, ?)"
 
-	result, err := db.Conn.DB.Exec(query, data.Username, data.Email, data.Password)
+	result, err := db.exec(query, data.Username, data.Email, data.Password)
 	if err != nil {
 		return 0, err
 	}
@@ -25,21 +28,23 @@ func (db *DB) SaveUser(data models.User) (int, error) {
 }
 
 func (db *DB) GetUser(identifierType string, value interface{}) (models.User, error) {
+	db, span := db.trace("GetUser")
+	defer span.End()
 	var query string
 
 	switch identifierType {
 	case "id":
-		query = "SELECT id, username, email, password FROM users WHERE id = ?"
+		query = "SELECT id, username, email, password, COALESCE(deletionScheduledAt, '') FROM users WHERE id = ?"
 	case "username":
-		query = "SELECT id, username, email, password FROM users WHERE username = ?"
+		query = "SELECT id, username, email, password, COALESCE(deletionScheduledAt, '') FROM users WHERE username = ?"
 	case "email":
-		query = "SELECT id, username, email, password FROM users WHERE email = ?"
+		query = "SELECT id, username, email, password, COALESCE(deletionScheduledAt, '') FROM users WHERE email = ?"
 	default:
 		return models.User{}, errors.New("invalid identifier type")
 	}
 	user := models.User{}
 
-	err := db.Conn.DB.QueryRow(query, value).Scan(&user.ID, &user.Username, &user.Email, &user.Password)
+	err := db.queryRow(query, value).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.DeletionScheduledAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return models.User{}, sql.ErrNoRows
@@ -49,3 +54,116 @@ func (db *DB) GetUser(identifierType string, value interface{}) (models.User, er
 	return user, nil
 
 }
+
+func (db *DB) UpdateUsername(userID int, username string) (int, error) {
+	db, span := db.trace("UpdateUsername")
+	defer span.End()
+	return db.updateUserField("username", userID, username)
+}
+
+func (db *DB) UpdateEmail(userID int, email string) (int, error) {
+	db, span := db.trace("UpdateEmail")
+	defer span.End()
+	return db.updateUserField("email", userID, email)
+}
+
+func (db *DB) UpdatePassword(userID int, password string) (int, error) {
+	db, span := db.trace("UpdatePassword")
+	defer span.End()
+	return db.updateUserField("password", userID, password)
+}
+
+// ScheduleDeletion marks the account for erasure at deleteAt using the given
+// erasure mode.
+func (db *DB) ScheduleDeletion(userID int, deleteAt time.Time, mode string) (int, error) {
+	db, span := db.trace("ScheduleDeletion")
+	defer span.End()
+	query := "UPDATE users SET deletionScheduledAt = ?, erasureMode = ? WHERE id = ?"
+	result, err := db.exec(query, deleteAt.Local().Format("2006-01-02 15:04:05"), mode, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
+
+func (db *DB) CancelDeletion(userID int) (int, error) {
+	db, span := db.trace("CancelDeletion")
+	defer span.End()
+	return db.updateUserField("deletionScheduledAt", userID, nil)
+}
+
+// PurgeDeletedUsers erases the accounts whose deletion grace period has
+// passed, using the erasure mode chosen when the deletion was requested, and
+// returns how many were erased.
+func (db *DB) PurgeDeletedUsers() (int, error) {
+	db, span := db.trace("PurgeDeletedUsers")
+	defer span.End()
+	now := time.Now().Local().Format("2006-01-02 15:04:05")
+	rows, err := db.query("SELECT id, erasureMode FROM users WHERE deletionScheduledAt IS NOT NULL AND deletionScheduledAt <= ?", now)
+	if err != nil {
+		return 0, err
+	}
+
+	type dueUser struct {
+		id   int
+		mode string
+	}
+	var due []dueUser
+	for rows.Next() {
+		var user dueUser
+		if err := rows.Scan(&user.id, &user.mode); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, user)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, user := range due {
+		if err := db.EraseUser(user.id, user.mode); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+func (db *DB) updateUserField(field string, userID int, value interface{}) (int, error) {
+	var query string
+
+	switch field {
+	case "username":
+		query = "UPDATE users SET username = ? WHERE id = ?"
+	case "email":
+		query = "UPDATE users SET email = ? WHERE id = ?"
+	case "password":
+		query = "UPDATE users SET password = ? WHERE id = ?"
+	case "deletionScheduledAt":
+		query = "UPDATE users SET deletionScheduledAt = ? WHERE id = ?"
+	default:
+		return 0, errors.New("invalid field")
+	}
+
+	result, err := db.exec(query, value, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
@@ -0,0 +1,321 @@
+package conn
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/A-Victory/blog/models"
+)
+
+const webhookColumns = "id, userId, url, secret, events, active, createdAt"
+
+func scanWebhook(scanner interface{ Scan(...interface{}) error }) (models.WebhookSubscription, error) {
+	var sub models.WebhookSubscription
+	var events string
+	if err := scanner.Scan(&sub.ID, &sub.UserID, &sub.URL, &sub.Secret, &events, &sub.Active, &sub.CreatedAt); err != nil {
+		return models.WebhookSubscription{}, err
+	}
+	sub.Events = strings.Split(events, ",")
+	return sub, nil
+}
+
+func (db *DB) CreateWebhook(sub models.WebhookSubscription) (int, error) {
+	db, span := db.trace("CreateWebhook")
+	defer span.End()
+	query := "INSERT INTO WebhookSubscriptions (userId, url, secret, events, active) VALUES (?, ?, ?, ?, ?)"
+	result, err := db.exec(query, sub.UserID, sub.URL, sub.Secret, strings.Join(sub.Events, ","), sub.Active)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+func (db *DB) GetWebhook(subscriptionID int) (models.WebhookSubscription, error) {
+	db, span := db.trace("GetWebhook")
+	defer span.End()
+	row := db.queryRow("SELECT "+webhookColumns+" FROM WebhookSubscriptions WHERE id = ?", subscriptionID)
+	sub, err := scanWebhook(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.WebhookSubscription{}, nil
+		}
+		return models.WebhookSubscription{}, err
+	}
+	return sub, nil
+}
+
+func (db *DB) GetWebhooks(userID int) ([]models.WebhookSubscription, error) {
+	db, span := db.trace("GetWebhooks")
+	defer span.End()
+	return db.queryWebhooks("SELECT "+webhookColumns+" FROM WebhookSubscriptions WHERE userId = ? ORDER BY id", userID)
+}
+
+// GetWebhooksForEvent returns the active subscriptions that receive event.
+func (db *DB) GetWebhooksForEvent(event string) ([]models.WebhookSubscription, error) {
+	db, span := db.trace("GetWebhooksForEvent")
+	defer span.End()
+	return db.queryWebhooks("SELECT "+webhookColumns+" FROM WebhookSubscriptions WHERE active = TRUE AND FIND_IN_SET(?, events) > 0 ORDER BY id", event)
+}
+
+func (db *DB) queryWebhooks(query string, params ...interface{}) ([]models.WebhookSubscription, error) {
+	rows, err := db.query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []models.WebhookSubscription{}
+	for rows.Next() {
+		sub, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subs, nil
+}
+
+// UpdateWebhook replaces a subscription's URL, events and state. The secret
+// is only changed when a new one is given.
+func (db *DB) UpdateWebhook(sub models.WebhookSubscription) (int, error) {
+	db, span := db.trace("UpdateWebhook")
+	defer span.End()
+	query := "UPDATE WebhookSubscriptions SET url = ?, events = ?, active = ?"
+	params := []interface{}{sub.URL, strings.Join(sub.Events, ","), sub.Active}
+	if sub.Secret != "" {
+		query += ", secret = ?"
+		params = append(params, sub.Secret)
+	}
+	query += " WHERE id = ? AND userId = ?"
+	params = append(params, sub.ID, sub.UserID)
+
+	result, err := db.exec(query, params...)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
+
+// DeleteWebhook removes a subscription along with its deliveries.
+func (db *DB) DeleteWebhook(subscriptionID, userID int) (int, error) {
+	db, span := db.trace("DeleteWebhook")
+	defer span.End()
+	result, err := db.exec("DELETE FROM WebhookSubscriptions WHERE id = ? AND userId = ?", subscriptionID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
+
+// EnqueueWebhookDeliveries queues the payload of an event for each of the
+// subscriptions, due straight away.
+func (db *DB) EnqueueWebhookDeliveries(subscriptionIDs []int, event, payload string) error {
+	db, span := db.trace("EnqueueWebhookDeliveries")
+	defer span.End()
+	if len(subscriptionIDs) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC().Format("2006-01-02 15:04:05")
+
+	var values []string
+	var params []interface{}
+	for _, id := range subscriptionIDs {
+		values = append(values, "(?, ?, ?, ?, ?, ?)")
+		params = append(params, id, event, payload, models.DeliveryPending, now, now)
+	}
+
+	query := "INSERT INTO WebhookDeliveries (subscriptionId, event, payload, status, nextAttemptAt, createdAt) VALUES " + strings.Join(values, ", ")
+	_, err := db.exec(query, params...)
+	return err
+}
+
+const deliveryColumns = "id, subscriptionId, event, payload, status, attempts, responseStatus, error, nextAttemptAt, createdAt, COALESCE(completedAt, '')"
+
+func scanDelivery(scanner interface{ Scan(...interface{}) error }, extra ...interface{}) (models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	dest := []interface{}{&delivery.ID, &delivery.SubscriptionID, &delivery.Event, &delivery.Payload, &delivery.Status, &delivery.Attempts, &delivery.ResponseStatus, &delivery.Error, &delivery.NextAttemptAt, &delivery.CreatedAt, &delivery.CompletedAt}
+	if err := scanner.Scan(append(dest, extra...)...); err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	if delivery.Status != models.DeliveryPending {
+		delivery.NextAttemptAt = ""
+	}
+	return delivery, nil
+}
+
+// GetDueWebhookDeliveries returns pending deliveries whose next attempt is
+// due, oldest first.
+func (db *DB) GetDueWebhookDeliveries(limit int) ([]models.WebhookDelivery, error) {
+	db, span := db.trace("GetDueWebhookDeliveries")
+	defer span.End()
+	now := time.Now().UTC().Format("2006-01-02 15:04:05")
+	query := "SELECT " + deliveryColumns + " FROM WebhookDeliveries WHERE status = ? AND nextAttemptAt <= ? ORDER BY nextAttemptAt, id LIMIT ?"
+	rows, err := db.query(query, models.DeliveryPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// ClaimWebhookDelivery pushes a due delivery's next attempt back by lease so
+// that no other worker sends it meanwhile. It returns false when another
+// worker claimed it first.
+func (db *DB) ClaimWebhookDelivery(deliveryID int, lease time.Duration) (bool, error) {
+	db, span := db.trace("ClaimWebhookDelivery")
+	defer span.End()
+	now := time.Now().UTC()
+	query := "UPDATE WebhookDeliveries SET nextAttemptAt = ? WHERE id = ? AND status = ? AND nextAttemptAt <= ?"
+	result, err := db.exec(query, now.Add(lease).Format("2006-01-02 15:04:05"), deliveryID, models.DeliveryPending, now.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// RecordWebhookAttempt stores the outcome of an attempt. A pending delivery
+// is tried again at nextAttemptAt; delivered and dead ones are complete.
+func (db *DB) RecordWebhookAttempt(deliveryID int, status string, responseStatus int, reason string, nextAttemptAt time.Time) error {
+	db, span := db.trace("RecordWebhookAttempt")
+	defer span.End()
+	if len(reason) > 500 {
+		reason = reason[:500]
+	}
+
+	query := "UPDATE WebhookDeliveries SET status = ?, attempts = attempts + 1, responseStatus = ?, error = ?, nextAttemptAt = ?, completedAt = ? WHERE id = ?"
+	var completedAt interface{}
+	if status != models.DeliveryPending {
+		completedAt = time.Now().UTC().Format("2006-01-02 15:04:05")
+	}
+	_, err := db.exec(query, status, responseStatus, reason, nextAttemptAt.UTC().Format("2006-01-02 15:04:05"), completedAt, deliveryID)
+	return err
+}
+
+func (db *DB) GetWebhookDelivery(deliveryID int) (models.WebhookDelivery, error) {
+	db, span := db.trace("GetWebhookDelivery")
+	defer span.End()
+	row := db.queryRow("SELECT "+deliveryColumns+" FROM WebhookDeliveries WHERE id = ?", deliveryID)
+	delivery, err := scanDelivery(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.WebhookDelivery{}, nil
+		}
+		return models.WebhookDelivery{}, err
+	}
+	return delivery, nil
+}
+
+// GetWebhookDeliveries returns a page of a subscription's delivery log,
+// optionally only the deliveries with the given status.
+func (db *DB) GetWebhookDeliveries(subscriptionID int, status string, opts models.ListOptions) ([]models.WebhookDelivery, models.Page, error) {
+	db, span := db.trace("GetWebhookDeliveries")
+	defer span.End()
+	q, err := createdOrdering("createdAt", "id").list(opts)
+	if err != nil {
+		return nil, models.Page{}, err
+	}
+
+	where := " WHERE subscriptionId = ?"
+	params := []interface{}{subscriptionID}
+	if status != "" {
+		where += " AND status = ?"
+		params = append(params, status)
+	}
+
+	total, err := db.count("SELECT COUNT(*) FROM WebhookDeliveries"+where, params...)
+	if err != nil {
+		return nil, models.Page{}, err
+	}
+
+	rows, err := db.query("SELECT "+deliveryColumns+q.column()+" FROM WebhookDeliveries"+where+q.tail, append(params, q.params...)...)
+	if err != nil {
+		return nil, models.Page{}, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	var keys []string
+	var ids []int
+	for rows.Next() {
+		var key string
+		delivery, err := scanDelivery(rows, &key)
+		if err != nil {
+			return nil, models.Page{}, err
+		}
+		deliveries = append(deliveries, delivery)
+		keys = append(keys, key)
+		ids = append(ids, delivery.ID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, models.Page{}, err
+	}
+
+	page, n := q.page(total, keys, ids)
+	return deliveries[:n], page, nil
+}
+
+// RetryWebhookDelivery queues a delivery again with a fresh set of attempts,
+// typically one that was dead-lettered.
+func (db *DB) RetryWebhookDelivery(deliveryID int) (int, error) {
+	db, span := db.trace("RetryWebhookDelivery")
+	defer span.End()
+	now := time.Now().UTC().Format("2006-01-02 15:04:05")
+	query := "UPDATE WebhookDeliveries SET status = ?, attempts = 0, nextAttemptAt = ?, completedAt = NULL WHERE id = ? AND status <> ?"
+	result, err := db.exec(query, models.DeliveryPending, now, deliveryID, models.DeliveryPending)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
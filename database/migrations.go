@@ -0,0 +1,172 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// migration is a schema change to a table that already exists. Initialize
+// keeps creating tables in their original shape, and every later change to
+// them is listed here so existing databases pick it up as well.
+type migration struct {
+	version    int
+	name       string
+	statements []string
+}
+
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "add account deletion schedule to users",
+		statements: []string{
+			"ALTER TABLE Users ADD COLUMN deletionScheduledAt DATETIME NULL",
+		},
+	},
+	{
+		version: 2,
+		name:    "add erasure mode to users",
+		statements: []string{
+			"ALTER TABLE Users ADD COLUMN erasureMode VARCHAR(16) NOT NULL DEFAULT 'delete'",
+		},
+	},
+	{
+		// Anonymized content is reassigned to this account. Its password is
+		// not a bcrypt hash and its email is not deliverable, so nobody can
+		// sign in as it, and creating it here reserves the username. A user
+		// already holding the name fails the migration rather than being
+		// taken over; rename them and restart.
+		version: 3,
+		name:    "add deleted user account",
+		statements: []string{
+			"INSERT INTO Users (username, email, password) VALUES ('deleted user', 'deleted-user@invalid', '!')",
+		},
+	},
+	{
+		version: 4,
+		name:    "add public profile fields to users",
+		statements: []string{
+			"ALTER TABLE Users ADD COLUMN displayName VARCHAR(64) NOT NULL DEFAULT ''",
+			"ALTER TABLE Users ADD COLUMN bio VARCHAR(500) NOT NULL DEFAULT ''",
+			"ALTER TABLE Users ADD COLUMN website VARCHAR(255) NOT NULL DEFAULT ''",
+			"ALTER TABLE Users ADD COLUMN socialLinks VARCHAR(2048) NOT NULL DEFAULT '{}'",
+		},
+	},
+	{
+		version: 5,
+		name:    "add status to posts",
+		statements: []string{
+			"ALTER TABLE Posts ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'published'",
+			"CREATE INDEX author_status_created ON Posts (authorId, status, createdAt)",
+		},
+	},
+	{
+		// Titles and contents are indexed separately as well so search can
+		// weigh title matches above content matches.
+		version: 6,
+		name:    "add full-text indexes to posts and comments",
+		statements: []string{
+			"ALTER TABLE Posts ADD FULLTEXT INDEX ft_post_text (title, content)",
+			"ALTER TABLE Posts ADD FULLTEXT INDEX ft_post_title (title)",
+			"ALTER TABLE Posts ADD FULLTEXT INDEX ft_post_content (content)",
+			"ALTER TABLE Comments ADD FULLTEXT INDEX ft_comment_content (content)",
+		},
+	},
+	{
+		// Lists are read in keyset order, so each sort order needs an
+		// index ending in its sort column and the id.
+		version: 7,
+		name:    "add list ordering indexes",
+		statements: []string{
+			"CREATE INDEX status_created ON Posts (status, createdAt, id)",
+			"CREATE INDEX status_updated ON Posts (status, updatedAt, id)",
+			"CREATE INDEX post_created ON Comments (postId, createdAt, id)",
+			"CREATE INDEX post_updated ON Comments (postId, updatedAt, id)",
+			"CREATE INDEX follower_created ON Follows (followerId, createdAt)",
+		},
+	},
+	{
+		version: 8,
+		name:    "add versions to posts and comments",
+		statements: []string{
+			"ALTER TABLE Posts ADD COLUMN version INT NOT NULL DEFAULT 1",
+			"ALTER TABLE Comments ADD COLUMN version INT NOT NULL DEFAULT 1",
+		},
+	},
+}
+
+// migrate applies the migrations that have not been recorded yet, in order.
+func (dbConn *DBconn) migrate() error {
+
+	createMigrationTable := `
+	CREATE TABLE IF NOT EXISTS SchemaMigrations (
+		version INT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		appliedAt DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := dbConn.DB.Exec(createMigrationTable); err != nil {
+		return err
+	}
+
+	applied, err := dbConn.appliedMigrations(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+
+		for _, statement := range m.statements {
+			if _, err := dbConn.DB.Exec(statement); err != nil {
+				return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+			}
+		}
+
+		if _, err := dbConn.DB.Exec("INSERT INTO SchemaMigrations (version, name) VALUES (?, ?)", m.version, m.name); err != nil {
+			return err
+		}
+		slog.Info("applied migration", "version", m.version, "name", m.name)
+	}
+
+	return nil
+}
+
+// PendingMigrations returns the versions of the migrations not applied yet,
+// which is none once Initialize has run, unless the database was restored
+// from an older backup.
+func (dbConn *DBconn) PendingMigrations(ctx context.Context) ([]int, error) {
+	applied, err := dbConn.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []int
+	for _, m := range migrations {
+		if !applied[m.version] {
+			pending = append(pending, m.version)
+		}
+	}
+	return pending, nil
+}
+
+func (dbConn *DBconn) appliedMigrations(ctx context.Context) (map[int]bool, error) {
+	rows, err := dbConn.DB.QueryContext(ctx, "SELECT version FROM SchemaMigrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]bool{}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"database/sql"
 	"log"
+	"log/slog"
 
 	_ "github.com/go-sql-driver/mysql"
 )
@@ -88,22 +89,240 @@ func (dbConn *DBconn) Initialize() error {
 		FOREIGN KEY (authorId) REFERENCES Users(id) ON DELETE CASCADE
 	);`
 
+	// Create the UserIdentities table linking users to external identity providers
+	createIdentityTable := `
+	CREATE TABLE IF NOT EXISTS UserIdentities (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		userId INT NOT NULL,
+		issuer VARCHAR(255) NOT NULL,
+		subject VARCHAR(255) NOT NULL,
+		email VARCHAR(255) NOT NULL DEFAULT '',
+		createdAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE KEY issuer_subject (issuer, subject),
+		FOREIGN KEY (userId) REFERENCES Users(id) ON DELETE CASCADE
+	);`
+
+	// Create the AccountActivity table recording changes users make to their account
+	createActivityTable := `
+	CREATE TABLE IF NOT EXISTS AccountActivity (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		userId INT NOT NULL,
+		action VARCHAR(64) NOT NULL,
+		detail VARCHAR(255) NOT NULL DEFAULT '',
+		ipAddress VARCHAR(64) NOT NULL DEFAULT '',
+		createdAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+		INDEX user_activity (userId, createdAt),
+		FOREIGN KEY (userId) REFERENCES Users(id) ON DELETE CASCADE
+	);`
+
+	// Create the EmailVerifications table holding pending email changes
+	createEmailVerificationTable := `
+	CREATE TABLE IF NOT EXISTS EmailVerifications (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		userId INT NOT NULL,
+		email VARCHAR(255) NOT NULL,
+		tokenHash CHAR(64) NOT NULL UNIQUE,
+		expiresAt DATETIME NOT NULL,
+		FOREIGN KEY (userId) REFERENCES Users(id) ON DELETE CASCADE
+	);`
+
+	// Create the DataExports table holding archives of a user's data
+	createExportTable := `
+	CREATE TABLE IF NOT EXISTS DataExports (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		userId INT NOT NULL,
+		status VARCHAR(16) NOT NULL DEFAULT 'pending',
+		archive LONGBLOB NULL,
+		error VARCHAR(255) NOT NULL DEFAULT '',
+		createdAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+		completedAt DATETIME NULL,
+		INDEX export_status (status),
+		FOREIGN KEY (userId) REFERENCES Users(id) ON DELETE CASCADE
+	);`
+
+	// Create the UserAvatars table holding uploaded profile pictures
+	createAvatarTable := `
+	CREATE TABLE IF NOT EXISTS UserAvatars (
+		userId INT PRIMARY KEY,
+		contentType VARCHAR(32) NOT NULL,
+		data MEDIUMBLOB NOT NULL,
+		updatedAt DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		FOREIGN KEY (userId) REFERENCES Users(id) ON DELETE CASCADE
+	);`
+
+	// Create the Follows table holding who follows whom
+	createFollowTable := `
+	CREATE TABLE IF NOT EXISTS Follows (
+		followerId INT NOT NULL,
+		followeeId INT NOT NULL,
+		createdAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (followerId, followeeId),
+		INDEX followee_created (followeeId, createdAt),
+		FOREIGN KEY (followerId) REFERENCES Users(id) ON DELETE CASCADE,
+		FOREIGN KEY (followeeId) REFERENCES Users(id) ON DELETE CASCADE
+	);`
+
+	// Create the FeedItems table, each user's home feed. Published posts are
+	// copied to the feed of every follower when they are published, so
+	// reading a feed is a single index range scan however many authors the
+	// user follows.
+	createFeedTable := `
+	CREATE TABLE IF NOT EXISTS FeedItems (
+		userId INT NOT NULL,
+		postId INT NOT NULL,
+		authorId INT NOT NULL,
+		createdAt DATETIME NOT NULL,
+		PRIMARY KEY (userId, postId),
+		INDEX user_feed (userId, createdAt, postId),
+		INDEX user_author (userId, authorId),
+		FOREIGN KEY (userId) REFERENCES Users(id) ON DELETE CASCADE,
+		FOREIGN KEY (postId) REFERENCES Posts(id) ON DELETE CASCADE
+	);`
+
+	// Create the Bookmarks table holding posts users saved for later
+	createBookmarkTable := `
+	CREATE TABLE IF NOT EXISTS Bookmarks (
+		userId INT NOT NULL,
+		postId INT NOT NULL,
+		createdAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (userId, postId),
+		INDEX user_created (userId, createdAt),
+		FOREIGN KEY (userId) REFERENCES Users(id) ON DELETE CASCADE,
+		FOREIGN KEY (postId) REFERENCES Posts(id) ON DELETE CASCADE
+	);`
+
+	// Create the ReadingLists and ReadingListItems tables holding named,
+	// ordered collections of posts
+	createReadingListTable := `
+	CREATE TABLE IF NOT EXISTS ReadingLists (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		userId INT NOT NULL,
+		name VARCHAR(100) NOT NULL,
+		description VARCHAR(500) NOT NULL DEFAULT '',
+		public BOOLEAN NOT NULL DEFAULT FALSE,
+		createdAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updatedAt DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		UNIQUE KEY user_name (userId, name),
+		FOREIGN KEY (userId) REFERENCES Users(id) ON DELETE CASCADE
+	);`
+
+	createReadingListItemTable := `
+	CREATE TABLE IF NOT EXISTS ReadingListItems (
+		listId INT NOT NULL,
+		postId INT NOT NULL,
+		position INT NOT NULL,
+		addedAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (listId, postId),
+		INDEX list_position (listId, position),
+		FOREIGN KEY (listId) REFERENCES ReadingLists(id) ON DELETE CASCADE,
+		FOREIGN KEY (postId) REFERENCES Posts(id) ON DELETE CASCADE
+	);`
+
+	// Create the PostTags table holding the tags of each post
+	createPostTagTable := `
+	CREATE TABLE IF NOT EXISTS PostTags (
+		postId INT NOT NULL,
+		tag VARCHAR(32) NOT NULL,
+		PRIMARY KEY (postId, tag),
+		INDEX tag_post (tag, postId),
+		FOREIGN KEY (postId) REFERENCES Posts(id) ON DELETE CASCADE
+	);`
+
+	// Create the IdempotencyKeys table holding the responses replayed for
+	// retried requests
+	createIdempotencyKeyTable := `
+	CREATE TABLE IF NOT EXISTS IdempotencyKeys (
+		userId INT NOT NULL,
+		idempotencyKey VARCHAR(255) NOT NULL,
+		fingerprint CHAR(64) NOT NULL,
+		status INT NOT NULL DEFAULT 0,
+		headers TEXT NOT NULL,
+		body MEDIUMBLOB NOT NULL,
+		createdAt DATETIME NOT NULL,
+		expiresAt DATETIME NOT NULL,
+		PRIMARY KEY (userId, idempotencyKey),
+		INDEX expires (expiresAt),
+		FOREIGN KEY (userId) REFERENCES Users(id) ON DELETE CASCADE
+	);`
+
+	// Create the WebhookSubscriptions table holding the URLs content events
+	// are sent to
+	createWebhookTable := `
+	CREATE TABLE IF NOT EXISTS WebhookSubscriptions (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		userId INT NOT NULL,
+		url VARCHAR(2048) NOT NULL,
+		secret VARCHAR(255) NOT NULL,
+		events VARCHAR(255) NOT NULL,
+		active BOOLEAN NOT NULL DEFAULT TRUE,
+		createdAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+		INDEX user_webhooks (userId),
+		FOREIGN KEY (userId) REFERENCES Users(id) ON DELETE CASCADE
+	);`
+
+	// Create the WebhookDeliveries table, the queue and log of webhook
+	// deliveries
+	createWebhookDeliveryTable := `
+	CREATE TABLE IF NOT EXISTS WebhookDeliveries (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		subscriptionId INT NOT NULL,
+		event VARCHAR(32) NOT NULL,
+		payload MEDIUMTEXT NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		attempts INT NOT NULL DEFAULT 0,
+		responseStatus INT NOT NULL DEFAULT 0,
+		error VARCHAR(500) NOT NULL DEFAULT '',
+		nextAttemptAt DATETIME NOT NULL,
+		createdAt DATETIME NOT NULL,
+		completedAt DATETIME NULL,
+		INDEX status_due (status, nextAttemptAt),
+		INDEX subscription_created (subscriptionId, createdAt),
+		FOREIGN KEY (subscriptionId) REFERENCES WebhookSubscriptions(id) ON DELETE CASCADE
+	);`
+
+	// Create the StreamEvents table, through which replicas share live
+	// events
+	createStreamEventTable := `
+	CREATE TABLE IF NOT EXISTS StreamEvents (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		topic VARCHAR(64) NOT NULL,
+		type VARCHAR(32) NOT NULL,
+		data MEDIUMTEXT NOT NULL,
+		createdAt DATETIME NOT NULL,
+		INDEX created (createdAt)
+	);`
+
 	// Execute the table creation statements
-	_, err := dbConn.DB.Exec(createUserTable)
-	if err != nil {
-		return err
+	statements := []string{
+		createUserTable,
+		createPostTable,
+		createCommentTable,
+		createIdentityTable,
+		createActivityTable,
+		createEmailVerificationTable,
+		createExportTable,
+		createAvatarTable,
+		createFollowTable,
+		createFeedTable,
+		createBookmarkTable,
+		createReadingListTable,
+		createReadingListItemTable,
+		createPostTagTable,
+		createIdempotencyKeyTable,
+		createWebhookTable,
+		createWebhookDeliveryTable,
+		createStreamEventTable,
 	}
-
-	_, err = dbConn.DB.Exec(createPostTable)
-	if err != nil {
-		return err
+	for _, statement := range statements {
+		if _, err := dbConn.DB.Exec(statement); err != nil {
+			return err
+		}
 	}
 
-	_, err = dbConn.DB.Exec(createCommentTable)
-	if err != nil {
+	if err := dbConn.migrate(); err != nil {
 		return err
 	}
 
-	log.Println("Tables created successfully!")
+	slog.Info("tables created")
 	return nil
 }
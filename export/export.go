@@ -0,0 +1,322 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/models"
+)
+
+// Retention is how long a finished export can be downloaded.
+const Retention = 7 * 24 * time.Hour
+
+// Data is everything the blog holds about a user.
+type Data struct {
+	Profile    Profile                  `json:"profile"`
+	Identities []models.UserIdentity    `json:"identities"`
+	Following  []models.Follow          `json:"following"`
+	Bookmarks  []models.Post            `json:"bookmarks"`
+	Lists      []models.ReadingList     `json:"readingLists"`
+	Activity   []models.AccountActivity `json:"activity"`
+	Posts      []models.Post            `json:"posts"`
+	Comments   []models.Comment         `json:"comments"`
+	// Avatar is the uploaded profile picture, written as the file named in
+	// Profile.Avatar. It is empty when the user has none.
+	Avatar models.Avatar `json:"-"`
+}
+
+type Profile struct {
+	ID                  int               `json:"id"`
+	Username            string            `json:"username"`
+	Email               string            `json:"email"`
+	DisplayName         string            `json:"displayName"`
+	Bio                 string            `json:"bio"`
+	Website             string            `json:"website"`
+	SocialLinks         map[string]string `json:"socialLinks"`
+	DeletionScheduledAt string            `json:"deletionScheduledAt,omitempty"`
+	Avatar              string            `json:"avatar,omitempty"`
+	AvatarContentType   string            `json:"avatarContentType,omitempty"`
+}
+
+// avatarExtensions are the file extensions of the avatar content types
+// accepted on upload.
+var avatarExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+}
+
+// avatarFile names the avatar in the archive after its content type.
+func avatarFile(contentType string) string {
+	ext, ok := avatarExtensions[contentType]
+	if !ok {
+		ext = ".bin"
+	}
+	return "avatar" + ext
+}
+
+// Collect gathers a user's data from the database.
+func Collect(db *conn.DB, userID int) (Data, error) {
+	user, err := db.GetUser("id", userID)
+	if err != nil {
+		return Data{}, err
+	}
+
+	profile, err := db.GetProfile(user.Username)
+	if err != nil {
+		return Data{}, err
+	}
+
+	identities, err := db.GetIdentities(userID)
+	if err != nil {
+		return Data{}, err
+	}
+
+	following, _, err := db.GetFollowing(userID, models.ListOptions{})
+	if err != nil {
+		return Data{}, err
+	}
+
+	bookmarks, _, err := db.GetBookmarkedPosts(userID, models.ListOptions{}, "")
+	if err != nil {
+		return Data{}, err
+	}
+
+	lists, err := db.GetReadingLists(userID, false)
+	if err != nil {
+		return Data{}, err
+	}
+	for i := range lists {
+		if lists[i].Posts, err = db.GetReadingListPosts(lists[i].ID, userID); err != nil {
+			return Data{}, err
+		}
+	}
+
+	activity, err := db.GetActivity(userID, 100000, 0)
+	if err != nil {
+		return Data{}, err
+	}
+
+	posts, err := db.GetPostsByAuthor(userID)
+	if err != nil {
+		return Data{}, err
+	}
+
+	comments, err := db.GetCommentsByAuthor(userID)
+	if err != nil {
+		return Data{}, err
+	}
+
+	avatar, err := db.GetAvatar(userID)
+	if err != nil {
+		return Data{}, err
+	}
+
+	data := Data{
+		Profile: Profile{
+			ID:                  user.ID,
+			Username:            user.Username,
+			Email:               user.Email,
+			DisplayName:         profile.DisplayName,
+			Bio:                 profile.Bio,
+			Website:             profile.Website,
+			SocialLinks:         profile.SocialLinks,
+			DeletionScheduledAt: user.DeletionScheduledAt,
+		},
+		Identities: identities,
+		Following:  following,
+		Bookmarks:  bookmarks,
+		Lists:      lists,
+		Activity:   activity,
+		Posts:      posts,
+		Comments:   comments,
+	}
+	if len(avatar.Data) > 0 {
+		data.Avatar = avatar
+		data.Profile.Avatar = avatarFile(avatar.ContentType)
+		data.Profile.AvatarContentType = avatar.ContentType
+	}
+
+	return data, nil
+}
+
+var slugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Archive writes the data as a zip file with a JSON file per section and the
+// posts and comments rendered as Markdown.
+func Archive(data Data) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+
+	jsonFiles := []struct {
+		name  string
+		value interface{}
+	}{
+		{"profile.json", data.Profile},
+		{"identities.json", data.Identities},
+		{"following.json", data.Following},
+		{"bookmarks.json", data.Bookmarks},
+		{"reading-lists.json", data.Lists},
+		{"activity.json", data.Activity},
+		{"posts.json", data.Posts},
+		{"comments.json", data.Comments},
+	}
+	for _, file := range jsonFiles {
+		f, err := zw.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(file.value); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, post := range data.Posts {
+		slug := strings.Trim(slugChars.ReplaceAllString(strings.ToLower(post.Title), "-"), "-")
+		f, err := zw.Create(fmt.Sprintf("posts/%d-%s.md", post.ID, slug))
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(f, "# %s\n\n_Created %s, updated %s_\n\n%s\n", post.Title, post.CreatedAt, post.UpdatedAt, post.Content)
+	}
+
+	if len(data.Avatar.Data) > 0 {
+		f, err := zw.Create(data.Profile.Avatar)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(data.Avatar.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := zw.Create("comments.md")
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(f, "# Comments by %s\n", data.Profile.Username)
+	for _, comment := range data.Comments {
+		fmt.Fprintf(f, "\n## On post %d, %s\n\n%s\n", comment.Postid, comment.CreatedAt, comment.Content)
+	}
+
+	f, err = zw.Create("README.md")
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(f, "# Data export for %s\n\nGenerated %s.\n\n"+
+		"- `profile.json`: account details\n"+
+		"- `identities.json`: linked sign-in providers\n"+
+		"- `following.json`: authors you follow\n"+
+		"- `bookmarks.json` and `reading-lists.json`: posts you saved\n"+
+		"- `activity.json`: account activity log\n"+
+		"- `posts.json` and `posts/`: posts you wrote\n"+
+		"- `comments.json` and `comments.md`: comments you wrote\n",
+		data.Profile.Username, time.Now().UTC().Format(time.RFC3339))
+	if data.Profile.Avatar != "" {
+		fmt.Fprintf(f, "- `%s`: your profile picture\n", data.Profile.Avatar)
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Worker builds pending exports in the background and removes expired ones.
+type Worker struct {
+	db       *conn.DB
+	interval time.Duration
+	wake     chan struct{}
+	lastRun  atomic.Int64
+}
+
+func NewWorker(db *conn.DB) *Worker {
+	return &Worker{
+		db:       db,
+		interval: 30 * time.Second,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Trigger asks the worker to look for pending exports now instead of waiting
+// for the next tick.
+func (wk *Worker) Trigger() {
+	select {
+	case wk.wake <- struct{}{}:
+	default:
+	}
+}
+
+// LastRun returns when the worker last looked for pending exports, for the
+// liveness probe.
+func (wk *Worker) LastRun() time.Time {
+	if at := wk.lastRun.Load(); at != 0 {
+		return time.Unix(0, at)
+	}
+	return time.Time{}
+}
+
+// Run processes exports until the context is cancelled.
+func (wk *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(wk.interval)
+	defer ticker.Stop()
+
+	for {
+		wk.lastRun.Store(time.Now().UnixNano())
+		wk.process()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wk.wake:
+		}
+	}
+}
+
+func (wk *Worker) process() {
+	if _, err := wk.db.DeleteExpiredExports(time.Now().Add(-Retention)); err != nil {
+		slog.Error("failed to remove expired exports", "error", err)
+	}
+
+	pending, err := wk.db.GetPendingExports(10)
+	if err != nil {
+		slog.Error("failed to load pending exports", "error", err)
+		return
+	}
+
+	for _, job := range pending {
+		archive, err := build(wk.db, job.UserID)
+		if err != nil {
+			slog.Error("export failed", "export_id", job.ID, "error", err)
+			if _, err := wk.db.FailExport(job.ID, err.Error()); err != nil {
+				slog.Error("failed to mark export as failed", "export_id", job.ID, "error", err)
+			}
+			continue
+		}
+
+		if _, err := wk.db.CompleteExport(job.ID, archive); err != nil {
+			slog.Error("failed to store export", "export_id", job.ID, "error", err)
+		}
+	}
+}
+
+func build(db *conn.DB, userID int) ([]byte, error) {
+	data, err := Collect(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	return Archive(data)
+}
@@ -0,0 +1,460 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/A-Victory/blog/auth"
+	"github.com/A-Victory/blog/models"
+)
+
+// Account activity actions recorded for the user's activity log.
+const (
+	activityUsernameChanged     = "username_changed"
+	activityEmailChangeRequest  = "email_change_requested"
+	activityEmailChanged        = "email_changed"
+	activityPasswordChanged     = "password_changed"
+	activityDeletionScheduled   = "deletion_scheduled"
+	activityDeletionCancelled   = "deletion_cancelled"
+	emailVerificationExpiration = 24 * time.Hour
+)
+
+func (httpConfig *HttpHandler) ChangeUsername(w http.ResponseWriter, r *http.Request) {
+
+	change := models.UsernameChange{}
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "error", Data: map[string]interface{}{"message": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if err := httpConfig.va.Validate(change); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"message": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	// the profile of a reserved name would be shadowed by a route
+	if reservedUsernames[strings.ToLower(change.Username)] {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"msg": fmt.Sprintf("the username %q is reserved", change.Username)}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	user, err := httpConfig.getUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to retrieve user's details: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if change.Username == user.Username {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"msg": "new username is the same as the current one"}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	field, err := httpConfig.searchUser(r.Context(), models.User{Username: change.Username})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if field != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: fmt.Sprintf("%s in use", field), Data: map[string]interface{}{"msg": fmt.Sprintf("%s already exists, try again...", field)}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if _, err := httpConfig.db.WithContext(r.Context()).UpdateUsername(user.ID, change.Username); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	httpConfig.recordActivity(r, user.ID, activityUsernameChanged, fmt.Sprintf("%s -> %s", user.Username, change.Username))
+
+	// The session carries the username, so reissue it under the new name.
+	user.Username = change.Username
+	data, err := newSession(w, auth.RequestMode(r), user)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to generate token: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	data["user"] = newUserResponse(user)
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "username updated", Data: data}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+
+	user, err := httpConfig.getUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to retrieve user's details: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	change := models.EmailChange{}
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "error", Data: map[string]interface{}{"message": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if err := httpConfig.va.Validate(change); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"message": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	field, err := httpConfig.searchUser(r.Context(), models.User{Email: change.Email})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if field != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: fmt.Sprintf("%s in use", field), Data: map[string]interface{}{"msg": fmt.Sprintf("%s already exists, try again...", field)}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	token, tokenHash, err := newVerificationToken()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to generate verification token: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	_, err = httpConfig.db.WithContext(r.Context()).SaveEmailVerification(models.EmailVerification{
+		UserID:    user.ID,
+		Email:     change.Email,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(emailVerificationExpiration).Local().Format("2006-01-02 15:04:05"),
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	link := fmt.Sprintf("%s/api/users/email/verify?token=%s", httpConfig.baseURL, url.QueryEscape(token))
+	body := fmt.Sprintf("Hi %s,\n\nConfirm your new email address by opening the link below within 24 hours:\n\n%s\n", user.Username, link)
+	if err := httpConfig.mailer.Send(change.Email, "Confirm your new email address", body); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to send verification email: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	httpConfig.recordActivity(r, user.ID, activityEmailChangeRequest, change.Email)
+
+	w.WriteHeader(http.StatusAccepted)
+	response := customResponse{Status: http.StatusAccepted, Message: "verification sent", Data: map[string]interface{}{"msg": fmt.Sprintf("a verification link has been sent to %s, your email changes once it is confirmed", change.Email)}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "error", Data: map[string]interface{}{"msg": "no token provided"}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	verification, err := httpConfig.db.WithContext(r.Context()).GetEmailVerification(hex.EncodeToString(sum[:]))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	expiresAt, _ := time.ParseInLocation("2006-01-02 15:04:05", verification.ExpiresAt, time.Local)
+	if verification == (models.EmailVerification{}) || time.Now().After(expiresAt) {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"msg": "verification link is invalid or has expired"}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	user, err := httpConfig.db.WithContext(r.Context()).GetUser("id", verification.UserID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	// The address may have been taken since the change was requested.
+	field, err := httpConfig.searchUser(r.Context(), models.User{Email: verification.Email})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if field != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: fmt.Sprintf("%s in use", field), Data: map[string]interface{}{"msg": fmt.Sprintf("%s already exists, try again...", field)}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if _, err := httpConfig.db.WithContext(r.Context()).UpdateEmail(user.ID, verification.Email); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if _, err := httpConfig.db.WithContext(r.Context()).DeleteEmailVerification(verification.ID); err != nil {
+		httpConfig.logger.ErrorContext(r.Context(), "failed to remove email verification", "verification_id", verification.ID, "error", err)
+	}
+
+	httpConfig.recordActivity(r, user.ID, activityEmailChanged, fmt.Sprintf("%s -> %s", user.Email, verification.Email))
+
+	body := fmt.Sprintf("Hi %s,\n\nThe email address on your account was changed to %s. If you did not make this change, contact support immediately.\n", user.Username, verification.Email)
+	if err := httpConfig.mailer.Send(user.Email, "Your email address was changed", body); err != nil {
+		httpConfig.logger.ErrorContext(r.Context(), "failed to send email change notice", "error", err)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "email updated", Data: map[string]interface{}{"msg": fmt.Sprintf("email changed to %s", verification.Email)}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+
+	user, err := httpConfig.getUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to retrieve user's details: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	change := models.PasswordChange{}
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "error", Data: map[string]interface{}{"message": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if err := httpConfig.va.Validate(change); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"message": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if !comparePassword(r.Context(), change.CurrentPassword, user.Password) {
+		w.WriteHeader(http.StatusUnauthorized)
+		response := customResponse{Status: http.StatusUnauthorized, Message: "error", Data: map[string]interface{}{"message": "incorrect password"}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	hashedpass, err := hashpassword(r.Context(), change.NewPassword)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"message": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if _, err := httpConfig.db.WithContext(r.Context()).UpdatePassword(user.ID, hashedpass); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	httpConfig.recordActivity(r, user.ID, activityPasswordChanged, "")
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "password updated", Data: map[string]interface{}{"msg": "password changed successfully"}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+
+	user, err := httpConfig.getUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to retrieve user's details: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	deletion := models.AccountDeletion{}
+	if err := json.NewDecoder(r.Body).Decode(&deletion); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "error", Data: map[string]interface{}{"message": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if err := httpConfig.va.Validate(deletion); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"message": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if !comparePassword(r.Context(), deletion.Password, user.Password) {
+		w.WriteHeader(http.StatusUnauthorized)
+		response := customResponse{Status: http.StatusUnauthorized, Message: "error", Data: map[string]interface{}{"message": "incorrect password"}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if deletion.Mode == "" {
+		deletion.Mode = models.ErasureDelete
+	}
+
+	deleteAt := time.Now().Add(httpConfig.deletionGrace)
+	if _, err := httpConfig.db.WithContext(r.Context()).ScheduleDeletion(user.ID, deleteAt, deletion.Mode); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	scheduled := deleteAt.Local().Format("2006-01-02 15:04:05")
+	httpConfig.recordActivity(r, user.ID, activityDeletionScheduled, fmt.Sprintf("%s (%s)", scheduled, deletion.Mode))
+
+	w.WriteHeader(http.StatusAccepted)
+	response := customResponse{Status: http.StatusAccepted, Message: "account deletion scheduled", Data: map[string]interface{}{"deletionScheduledAt": scheduled, "mode": deletion.Mode, "msg": "your account will be erased at the scheduled time, restore it before then to cancel"}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) RestoreAccount(w http.ResponseWriter, r *http.Request) {
+
+	user, err := httpConfig.getUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to retrieve user's details: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if user.DeletionScheduledAt == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"msg": "account is not scheduled for deletion"}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if _, err := httpConfig.db.WithContext(r.Context()).CancelDeletion(user.ID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	httpConfig.recordActivity(r, user.ID, activityDeletionCancelled, "")
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "account restored", Data: map[string]interface{}{"msg": "account deletion cancelled"}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) Activity(w http.ResponseWriter, r *http.Request) {
+
+	user, err := httpConfig.getUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to retrieve user's details: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	query := r.URL.Query()
+
+	// Get pagination parameters
+	page, _ := strconv.Atoi(query.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit < 1 {
+		limit = 10
+	}
+	offset := (page - 1) * limit
+
+	activity, err := httpConfig.db.WithContext(r.Context()).GetActivity(user.ID, limit, offset)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"activity": activity}}
+	json.NewEncoder(w).Encode(response)
+}
+
+// recordActivity adds an entry to the user's account activity log. Failures
+// are logged rather than failing the change that was already applied.
+func (httpConfig *HttpHandler) recordActivity(r *http.Request, userID int, action, detail string) {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	_, err = httpConfig.db.WithContext(r.Context()).AddActivity(models.AccountActivity{
+		UserID:    userID,
+		Action:    action,
+		Detail:    detail,
+		IPAddress: ip,
+	})
+	if err != nil {
+		httpConfig.logger.ErrorContext(r.Context(), "failed to record account activity", "action", action, "user_id", userID, "error", err)
+	}
+}
+
+// newVerificationToken returns a random token to send to the user and the
+// hash of it to store.
+func newVerificationToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := hex.EncodeToString(b)
+	sum := sha256.Sum256([]byte(token))
+	return token, hex.EncodeToString(sum[:]), nil
+}
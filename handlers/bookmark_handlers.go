@@ -0,0 +1,511 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/models"
+	"github.com/go-chi/chi/v5"
+)
+
+func (httpConfig *HttpHandler) Bookmark(w http.ResponseWriter, r *http.Request) {
+
+	user, post, ok := httpConfig.visiblePost(w, r, "id")
+	if !ok {
+		return
+	}
+
+	if _, err := httpConfig.db.WithContext(r.Context()).AddBookmark(user.ID, post.ID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "post bookmarked", Data: map[string]interface{}{"post_id": post.ID, "bookmarked": true}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) RemoveBookmark(w http.ResponseWriter, r *http.Request) {
+
+	user, err := httpConfig.getUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to retrieve user's details: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	postID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"msg": "error converting string..."}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	// Removing works even if the post has since been unpublished.
+	if _, err := httpConfig.db.WithContext(r.Context()).RemoveBookmark(user.ID, postID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "bookmark removed", Data: map[string]interface{}{"post_id": postID, "bookmarked": false}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) Bookmarks(w http.ResponseWriter, r *http.Request) {
+
+	user, err := httpConfig.getUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to retrieve user's details: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	opts, ok := listRequest(w, r)
+	if !ok {
+		return
+	}
+
+	posts, page, err := httpConfig.db.WithContext(r.Context()).GetBookmarkedPosts(user.ID, opts, r.URL.Query().Get("search"))
+	if err != nil {
+		listError(w, err)
+		return
+	}
+
+	setNextLink(w, r, page.NextCursor)
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"posts": posts, "page": page}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) ReadingLists(w http.ResponseWriter, r *http.Request) {
+
+	user, err := httpConfig.getUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to retrieve user's details: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	lists, err := httpConfig.db.WithContext(r.Context()).GetReadingLists(user.ID, false)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"lists": lists}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) CreateReadingList(w http.ResponseWriter, r *http.Request) {
+
+	user, err := httpConfig.getUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to retrieve user's details: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	list := models.ReadingList{}
+	if !httpConfig.decodeReadingList(w, r, &list) {
+		return
+	}
+	list.UserID = user.ID
+
+	id, err := httpConfig.db.WithContext(r.Context()).CreateReadingList(list)
+	if err != nil {
+		httpConfig.readingListError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "reading list created", Data: map[string]interface{}{"list_id": id}}
+	json.NewEncoder(w).Encode(response)
+}
+
+// ReadingList returns one of the user's lists with its posts in order.
+// Public lists of other users can be read as well.
+func (httpConfig *HttpHandler) ReadingList(w http.ResponseWriter, r *http.Request) {
+
+	user, err := httpConfig.getUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to retrieve user's details: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	list, ok := httpConfig.findReadingList(w, r)
+	if !ok {
+		return
+	}
+
+	if list.UserID != user.ID && !list.Public {
+		readingListNotFound(w, list.ID)
+		return
+	}
+
+	httpConfig.writeReadingList(r.Context(), w, list, user.ID)
+}
+
+func (httpConfig *HttpHandler) UpdateReadingList(w http.ResponseWriter, r *http.Request) {
+
+	list, ok := httpConfig.ownReadingList(w, r)
+	if !ok {
+		return
+	}
+
+	update := models.ReadingList{}
+	if !httpConfig.decodeReadingList(w, r, &update) {
+		return
+	}
+	update.ID = list.ID
+	update.UserID = list.UserID
+
+	if _, err := httpConfig.db.WithContext(r.Context()).UpdateReadingList(update); err != nil {
+		httpConfig.readingListError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "reading list updated", Data: map[string]interface{}{"list_id": list.ID}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) DeleteReadingList(w http.ResponseWriter, r *http.Request) {
+
+	list, ok := httpConfig.ownReadingList(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := httpConfig.db.WithContext(r.Context()).DeleteReadingList(list.ID, list.UserID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "reading list deleted", Data: map[string]interface{}{"list_id": list.ID}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) AddToReadingList(w http.ResponseWriter, r *http.Request) {
+
+	list, ok := httpConfig.ownReadingList(w, r)
+	if !ok {
+		return
+	}
+
+	entry := models.ReadingListEntry{}
+	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "error", Data: map[string]interface{}{"message": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if err := httpConfig.va.Validate(entry); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"message": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	post, err := httpConfig.db.WithContext(r.Context()).GetPostByID(entry.PostID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if post.ID == 0 || (post.Status == models.PostDraft && post.AuthorID != list.UserID) {
+		w.WriteHeader(http.StatusNotFound)
+		response := customResponse{Status: http.StatusNotFound, Message: "post not found", Data: map[string]interface{}{"msg": fmt.Sprintf("no post found with id %d", entry.PostID)}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if _, err := httpConfig.db.WithContext(r.Context()).AddToReadingList(list.ID, post.ID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "post added to reading list", Data: map[string]interface{}{"list_id": list.ID, "post_id": post.ID}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) RemoveFromReadingList(w http.ResponseWriter, r *http.Request) {
+
+	list, ok := httpConfig.ownReadingList(w, r)
+	if !ok {
+		return
+	}
+
+	postID, err := strconv.Atoi(chi.URLParam(r, "postId"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"msg": "error converting string..."}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	rows, err := httpConfig.db.WithContext(r.Context()).RemoveFromReadingList(list.ID, postID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if rows == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		response := customResponse{Status: http.StatusNotFound, Message: "post not found", Data: map[string]interface{}{"msg": fmt.Sprintf("post %d is not in the reading list", postID)}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "post removed from reading list", Data: map[string]interface{}{"list_id": list.ID, "post_id": postID}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) ReorderReadingList(w http.ResponseWriter, r *http.Request) {
+
+	list, ok := httpConfig.ownReadingList(w, r)
+	if !ok {
+		return
+	}
+
+	order := models.ReadingListOrder{}
+	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "error", Data: map[string]interface{}{"message": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if err := httpConfig.va.Validate(order); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"message": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if err := httpConfig.db.WithContext(r.Context()).ReorderReadingList(list.ID, order.PostIDs); err != nil {
+		if errors.Is(err, conn.ErrInvalidOrder) {
+			w.WriteHeader(http.StatusBadRequest)
+			response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"message": err.Error()}}
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	httpConfig.writeReadingList(r.Context(), w, list, list.UserID)
+}
+
+func (httpConfig *HttpHandler) PublicReadingLists(w http.ResponseWriter, r *http.Request) {
+
+	profile, ok := httpConfig.findProfile(w, r)
+	if !ok {
+		return
+	}
+
+	lists, err := httpConfig.db.WithContext(r.Context()).GetReadingLists(profile.ID, true)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"lists": lists}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) PublicReadingList(w http.ResponseWriter, r *http.Request) {
+
+	profile, ok := httpConfig.findProfile(w, r)
+	if !ok {
+		return
+	}
+
+	list, ok := httpConfig.findReadingList(w, r)
+	if !ok {
+		return
+	}
+
+	if list.UserID != profile.ID || !list.Public {
+		readingListNotFound(w, list.ID)
+		return
+	}
+
+	httpConfig.writeReadingList(r.Context(), w, list, 0)
+}
+
+// visiblePost loads the signed in user and the post named by the URL param,
+// writing an error response and returning false if the post does not exist
+// or is a draft of another author.
+func (httpConfig *HttpHandler) visiblePost(w http.ResponseWriter, r *http.Request, param string) (models.User, models.Post, bool) {
+
+	user, err := httpConfig.getUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to retrieve user's details: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return models.User{}, models.Post{}, false
+	}
+
+	postID, err := strconv.Atoi(chi.URLParam(r, param))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"msg": "error converting string..."}}
+		json.NewEncoder(w).Encode(response)
+		return models.User{}, models.Post{}, false
+	}
+
+	post, err := httpConfig.db.WithContext(r.Context()).GetPostByID(postID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return models.User{}, models.Post{}, false
+	}
+	if post.ID == 0 || (post.Status == models.PostDraft && post.AuthorID != user.ID) {
+		w.WriteHeader(http.StatusNotFound)
+		response := customResponse{Status: http.StatusNotFound, Message: "post not found", Data: map[string]interface{}{"msg": fmt.Sprintf("no post found with id %d", postID)}}
+		json.NewEncoder(w).Encode(response)
+		return models.User{}, models.Post{}, false
+	}
+
+	return user, post, true
+}
+
+func (httpConfig *HttpHandler) findReadingList(w http.ResponseWriter, r *http.Request) (models.ReadingList, bool) {
+
+	listID, err := strconv.Atoi(chi.URLParam(r, "listId"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"msg": "error converting string..."}}
+		json.NewEncoder(w).Encode(response)
+		return models.ReadingList{}, false
+	}
+
+	list, err := httpConfig.db.WithContext(r.Context()).GetReadingList(listID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return models.ReadingList{}, false
+	}
+	if list.ID == 0 {
+		readingListNotFound(w, listID)
+		return models.ReadingList{}, false
+	}
+
+	return list, true
+}
+
+// ownReadingList loads the list named in the URL if it belongs to the signed
+// in user. Lists of other users are reported as missing.
+func (httpConfig *HttpHandler) ownReadingList(w http.ResponseWriter, r *http.Request) (models.ReadingList, bool) {
+
+	user, err := httpConfig.getUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to retrieve user's details: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return models.ReadingList{}, false
+	}
+
+	list, ok := httpConfig.findReadingList(w, r)
+	if !ok {
+		return models.ReadingList{}, false
+	}
+
+	if list.UserID != user.ID {
+		readingListNotFound(w, list.ID)
+		return models.ReadingList{}, false
+	}
+
+	return list, true
+}
+
+func (httpConfig *HttpHandler) decodeReadingList(w http.ResponseWriter, r *http.Request, list *models.ReadingList) bool {
+
+	if err := json.NewDecoder(r.Body).Decode(list); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "error", Data: map[string]interface{}{"message": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return false
+	}
+
+	if err := httpConfig.va.Validate(list); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"message": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return false
+	}
+
+	return true
+}
+
+func (httpConfig *HttpHandler) readingListError(w http.ResponseWriter, err error) {
+	if errors.Is(err, conn.ErrDuplicateList) {
+		w.WriteHeader(http.StatusConflict)
+		response := customResponse{Status: http.StatusConflict, Message: "name in use", Data: map[string]interface{}{"msg": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	w.WriteHeader(http.StatusInternalServerError)
+	response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) writeReadingList(ctx context.Context, w http.ResponseWriter, list models.ReadingList, viewerID int) {
+
+	posts, err := httpConfig.db.WithContext(ctx).GetReadingListPosts(list.ID, viewerID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	list.Posts = posts
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"list": list}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func readingListNotFound(w http.ResponseWriter, listID int) {
+	w.WriteHeader(http.StatusNotFound)
+	response := customResponse{Status: http.StatusNotFound, Message: "reading list not found", Data: map[string]interface{}{"msg": fmt.Sprintf("no reading list found with id %d", listID)}}
+	json.NewEncoder(w).Encode(response)
+}
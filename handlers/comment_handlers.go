@@ -33,20 +33,6 @@ func (httpConfig *HttpHandler) Comment(w http.ResponseWriter, r *http.Request) {
 
 		newComment := models.Comment{}
 
-		post, err := httpConfig.db.GetPostByID(postID)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
-			json.NewEncoder(w).Encode(response)
-			return
-		}
-		if post == (models.Post{}) {
-			w.WriteHeader(http.StatusNotFound)
-			response := customResponse{Status: http.StatusNotFound, Message: "post not found", Data: map[string]interface{}{"msg": fmt.Sprintf("no post found with id %d", postID)}}
-			json.NewEncoder(w).Encode(response)
-			return
-		}
-
 		if err := json.NewDecoder(r.Body).Decode(&newComment); err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			response := customResponse{Status: http.StatusBadRequest, Message: "error", Data: map[string]interface{}{"message": err.Error()}}
@@ -54,20 +40,8 @@ func (httpConfig *HttpHandler) Comment(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		newComment.AuthorID = user.ID
-		newComment.Postid = postID
-
-		id, err := httpConfig.db.AddComment(newComment)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
-			json.NewEncoder(w).Encode(response)
-			return
-		}
-		if id == 0 {
-			w.WriteHeader(http.StatusBadRequest)
-			response := customResponse{Status: http.StatusBadRequest, Message: "database error", Data: map[string]interface{}{"msg": fmt.Sprintf("failed to add comment to post with id: %d", postID)}}
-			json.NewEncoder(w).Encode(response)
+		if _, err := httpConfig.addComment(r.Context(), user, postID, newComment.Content); err != nil {
+			v1Fail(w, err)
 			return
 		}
 
@@ -76,7 +50,8 @@ func (httpConfig *HttpHandler) Comment(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(response)
 	}
 
-	if r.Method == "PUT" {
+	// PUT replaces the comment and PATCH merges a patch into it
+	if r.Method == "PUT" || r.Method == "PATCH" {
 
 		id := chi.URLParam(r, "id")
 		if id != "" {
@@ -87,54 +62,31 @@ func (httpConfig *HttpHandler) Comment(w http.ResponseWriter, r *http.Request) {
 				json.NewEncoder(w).Encode(response)
 				return
 			}
-			updateComment := models.Comment{}
 
-			if err := json.NewDecoder(r.Body).Decode(&updateComment); err != nil {
-				w.WriteHeader(http.StatusBadRequest)
-				response := customResponse{Status: http.StatusBadRequest, Message: "error", Data: map[string]interface{}{"message": err.Error()}}
-				json.NewEncoder(w).Encode(response)
-				return
-			}
-
-			comment, err := httpConfig.db.GetCommentByID(commentID)
+			// a patch is merged into the stored comment
+			comment, err := httpConfig.ownComment(r.Context(), user, commentID)
 			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
-				json.NewEncoder(w).Encode(response)
+				v1Fail(w, err)
 				return
 			}
-			if comment == (models.Comment{}) {
-				w.WriteHeader(http.StatusNotFound)
-				response := customResponse{Status: http.StatusNotFound, Message: "post not found", Data: map[string]interface{}{"msg": fmt.Sprintf("no comment found with id: %d", commentID)}}
-				json.NewEncoder(w).Encode(response)
+
+			updateComment := models.Comment{}
+			if !decodeUpdate(w, r, comment, &updateComment) {
 				return
 			}
 
-			if comment.AuthorID != user.ID {
-				w.WriteHeader(http.StatusBadRequest)
-				response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"msg": fmt.Sprintf("not the author of the comment on post with id: %d", comment.Postid)}}
-				json.NewEncoder(w).Encode(response)
+			version, ok := httpConfig.ifMatch(w, r, comment.Version)
+			if !ok {
 				return
 			}
 
-			updateComment.ID = commentID
-			updateComment.Postid = comment.Postid
-			updateComment.AuthorID = user.ID
-
-			id, err := httpConfig.db.EditComment(updateComment)
+			updated, err := httpConfig.editComment(r.Context(), user, commentID, updateComment.Content, v1Version(version))
 			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
-				json.NewEncoder(w).Encode(response)
-				return
-			}
-			if id == 0 {
-				w.WriteHeader(http.StatusBadRequest)
-				response := customResponse{Status: http.StatusBadRequest, Message: "database error", Data: map[string]interface{}{"msg": fmt.Sprintf("failed to update comment with id: %d", commentID)}}
-				json.NewEncoder(w).Encode(response)
+				v1Fail(w, err)
 				return
 			}
 
+			w.Header().Set("ETag", etag(updated.Version))
 			w.WriteHeader(http.StatusOK)
 			response := customResponse{Status: http.StatusOK, Message: "successfully updated comment", Data: map[string]interface{}{"msg": fmt.Sprintf("successfully updated comment with id %d", commentID)}}
 			json.NewEncoder(w).Encode(response)
@@ -149,6 +101,32 @@ func (httpConfig *HttpHandler) Comment(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method == "GET" {
 
+		if id := chi.URLParam(r, "id"); id != "" {
+			commentID, err := strconv.Atoi(id)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"msg": "invalid comment id"}}
+				json.NewEncoder(w).Encode(response)
+				return
+			}
+
+			// comments on drafts are only visible to the post's author
+			comment, err := httpConfig.readableComment(r.Context(), user, commentID)
+			if err != nil {
+				v1Fail(w, err)
+				return
+			}
+
+			if notModified(w, r, comment.Version) {
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+			response := customResponse{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"comment": comment}}
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
 		id := chi.URLParam(r, "postId")
 		postID, err := strconv.Atoi(id)
 		if err != nil {
@@ -158,43 +136,26 @@ func (httpConfig *HttpHandler) Comment(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		query := r.URL.Query()
-
-		// Get pagination parameters
-		page, _ := strconv.Atoi(query.Get("page"))
-		if page < 1 {
-			page = 1
-		}
-		limit, _ := strconv.Atoi(query.Get("limit"))
-		if limit < 1 {
-			limit = 10
-		}
-		offset := (page - 1) * limit
-
-		post, err := httpConfig.db.GetPostByID(postID)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
-			json.NewEncoder(w).Encode(response)
+		opts, ok := listRequest(w, r)
+		if !ok {
 			return
 		}
-		if post == (models.Post{}) {
-			w.WriteHeader(http.StatusNotFound)
-			response := customResponse{Status: http.StatusNotFound, Message: "post not found", Data: map[string]interface{}{"msg": fmt.Sprintf("no post found with id %d", postID)}}
-			json.NewEncoder(w).Encode(response)
+
+		// drafts are only visible to their author
+		if _, err := httpConfig.readablePost(r.Context(), user, postID); err != nil {
+			v1Fail(w, err)
 			return
 		}
 
-		comments, err := httpConfig.db.GetComments(postID, limit, offset)
+		comments, page, err := httpConfig.db.WithContext(r.Context()).GetComments(postID, opts)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
-			json.NewEncoder(w).Encode(response)
+			listError(w, err)
 			return
 		}
 
+		setNextLink(w, r, page.NextCursor)
 		w.WriteHeader(http.StatusOK)
-		response := customResponse{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"comments": comments}}
+		response := customResponse{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"comments": comments, "page": page}}
 		json.NewEncoder(w).Encode(response)
 
 		// here retrieve all comments associated to a particular post
@@ -214,39 +175,19 @@ func (httpConfig *HttpHandler) Comment(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-			comment, err := httpConfig.db.GetCommentByID(commentID)
+			comment, err := httpConfig.ownComment(r.Context(), user, commentID)
 			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
-				json.NewEncoder(w).Encode(response)
-				return
-			}
-			if comment == (models.Comment{}) {
-				w.WriteHeader(http.StatusNotFound)
-				response := customResponse{Status: http.StatusNotFound, Message: "post not found", Data: map[string]interface{}{"msg": fmt.Sprintf("no comment found with id: %d", commentID)}}
-				json.NewEncoder(w).Encode(response)
-				return
-			}
-
-			if comment.AuthorID != user.ID {
-				w.WriteHeader(http.StatusBadRequest)
-				response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"msg": fmt.Sprintf("not the author of the comment on post with id: %d", comment.Postid)}}
-				json.NewEncoder(w).Encode(response)
+				v1Fail(w, err)
 				return
 			}
 
-			id, err := httpConfig.db.DeleteComment(commentID)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
-				json.NewEncoder(w).Encode(response)
+			version, ok := httpConfig.ifMatch(w, r, comment.Version)
+			if !ok {
 				return
 			}
 
-			if id <= 0 {
-				w.WriteHeader(http.StatusOK)
-				response := customResponse{Status: http.StatusOK, Message: "no post found", Data: map[string]interface{}{"msg": fmt.Sprintf("no comment found with id: %d", commentID)}}
-				json.NewEncoder(w).Encode(response)
+			if err := httpConfig.deleteComment(r.Context(), user, commentID, v1Version(version)); err != nil {
+				v1Fail(w, err)
 				return
 			}
 
@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/metrics"
+	"github.com/A-Victory/blog/models"
+)
+
+// The content operations below are shared by the GraphQL and gRPC APIs. They
+// apply the checks of the REST handlers and trigger the same reindexing,
+// webhooks and live events. Their errors are *apiError, which carries the
+// HTTP status of the failure so that each API can pick its own code.
+
+// apiError is an error with the HTTP status it corresponds to.
+type apiError struct {
+	status int
+	msg    string
+}
+
+func (e *apiError) Error() string {
+	return e.msg
+}
+
+func newAPIError(status int, format string, args ...interface{}) error {
+	return &apiError{status: status, msg: fmt.Sprintf(format, args...)}
+}
+
+// errorStatus returns the HTTP status of an error from the content
+// operations. Errors that are not *apiError are server errors.
+func errorStatus(err error) int {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.status
+	}
+	return http.StatusInternalServerError
+}
+
+func databaseError(err error) error {
+	return &apiError{status: http.StatusInternalServerError, msg: "database connection error: " + err.Error()}
+}
+
+// errStaleVersion is returned when a write names a version that is no longer
+// current, the counterpart of a failed If-Match.
+var errStaleVersion = &apiError{status: http.StatusPreconditionFailed, msg: "the resource was modified since it was read"}
+
+// writeError maps the error of a versioned write.
+func writeError(err error) error {
+	if errors.Is(err, conn.ErrVersionConflict) {
+		return errStaleVersion
+	}
+	return databaseError(err)
+}
+
+// listQueryError keeps the sort and cursor errors, which are the client's,
+// and reports any other as a database error.
+func listQueryError(err error) error {
+	if errors.Is(err, conn.ErrInvalidSort) || errors.Is(err, conn.ErrInvalidCursor) {
+		return &apiError{status: http.StatusBadRequest, msg: err.Error()}
+	}
+	return databaseError(err)
+}
+
+func invalid(err error) error {
+	return &apiError{status: http.StatusBadRequest, msg: err.Error()}
+}
+
+// checkVersion checks the version a write was sent with against the current
+// one, as ifMatch checks If-Match. A nil version means none was sent. It
+// returns the version the write must still find, or 0 for none.
+func (httpConfig *HttpHandler) checkVersion(version *int, current int) (int, error) {
+	if version == nil {
+		if httpConfig.requireIfMatch {
+			return 0, newAPIError(http.StatusPreconditionRequired, "version is required: send the version being changed")
+		}
+		return 0, nil
+	}
+	if *version != current {
+		return 0, errStaleVersion
+	}
+	return *version, nil
+}
+
+// readablePost loads a post the viewer may read. Drafts are only visible to
+// their author.
+func (httpConfig *HttpHandler) readablePost(ctx context.Context, viewer models.User, postID int) (models.Post, error) {
+	post, err := httpConfig.db.WithContext(ctx).GetPostByID(postID)
+	if err != nil {
+		return models.Post{}, databaseError(err)
+	}
+	if post.ID == 0 || (post.Status == models.PostDraft && post.AuthorID != viewer.ID) {
+		return models.Post{}, newAPIError(http.StatusNotFound, "no post found with id %d", postID)
+	}
+	return post, nil
+}
+
+// readableComment loads a comment the viewer may read, which is any comment
+// on a post they may read.
+func (httpConfig *HttpHandler) readableComment(ctx context.Context, viewer models.User, commentID int) (models.Comment, error) {
+	comment, err := httpConfig.db.WithContext(ctx).GetCommentByID(commentID)
+	if err != nil {
+		return models.Comment{}, databaseError(err)
+	}
+	if comment.ID == 0 {
+		return models.Comment{}, newAPIError(http.StatusNotFound, "no comment found with id: %d", commentID)
+	}
+	if _, err := httpConfig.readablePost(ctx, viewer, comment.Postid); err != nil {
+		if errorStatus(err) == http.StatusNotFound {
+			return models.Comment{}, newAPIError(http.StatusNotFound, "no comment found with id: %d", commentID)
+		}
+		return models.Comment{}, err
+	}
+	return comment, nil
+}
+
+// ownPost loads a post the viewer wrote, for a write.
+func (httpConfig *HttpHandler) ownPost(ctx context.Context, viewer models.User, postID int) (models.Post, error) {
+	post, err := httpConfig.db.WithContext(ctx).GetPostByID(postID)
+	if err != nil {
+		return models.Post{}, databaseError(err)
+	}
+	if post.ID == 0 {
+		return models.Post{}, newAPIError(http.StatusNotFound, "no post found with id %d", postID)
+	}
+	if post.AuthorID != viewer.ID {
+		return models.Post{}, newAPIError(http.StatusForbidden, "not the author of post with id: %d", postID)
+	}
+	return post, nil
+}
+
+// ownComment loads a comment the viewer wrote, for a write.
+func (httpConfig *HttpHandler) ownComment(ctx context.Context, viewer models.User, commentID int) (models.Comment, error) {
+	comment, err := httpConfig.db.WithContext(ctx).GetCommentByID(commentID)
+	if err != nil {
+		return models.Comment{}, databaseError(err)
+	}
+	if comment.ID == 0 {
+		return models.Comment{}, newAPIError(http.StatusNotFound, "no comment found with id: %d", commentID)
+	}
+	if comment.AuthorID != viewer.ID {
+		return models.Comment{}, newAPIError(http.StatusForbidden, "not the author of the comment on post with id: %d", comment.Postid)
+	}
+	return comment, nil
+}
+
+// createPost saves a new post by the viewer and returns it as stored.
+func (httpConfig *HttpHandler) createPost(ctx context.Context, viewer models.User, newPost models.Post) (models.Post, error) {
+	newPost.Tags = models.NormalizeTags(newPost.Tags)
+	if err := httpConfig.va.Validate(newPost); err != nil {
+		return models.Post{}, invalid(err)
+	}
+	newPost.AuthorID = viewer.ID
+
+	id, err := httpConfig.db.WithContext(ctx).CreatePost(newPost)
+	if err != nil {
+		return models.Post{}, databaseError(err)
+	}
+
+	metrics.PostsCreated.Inc()
+	httpConfig.reindexPost(ctx, id)
+	created, err := httpConfig.db.WithContext(ctx).GetPostByID(id)
+	if err != nil {
+		return models.Post{}, databaseError(err)
+	}
+	httpConfig.emitPost(ctx, models.EventPostCreated, created, false)
+
+	return created, nil
+}
+
+// updatePost applies change to one of the viewer's posts and saves the
+// result, which is validated as a whole like a PUT body.
+func (httpConfig *HttpHandler) updatePost(ctx context.Context, viewer models.User, postID int, version *int, change func(post *models.Post)) (models.Post, error) {
+	post, err := httpConfig.ownPost(ctx, viewer, postID)
+	if err != nil {
+		return models.Post{}, err
+	}
+
+	postToUpdate := post
+	change(&postToUpdate)
+	postToUpdate.Tags = models.NormalizeTags(postToUpdate.Tags)
+	if postToUpdate.Tags == nil {
+		postToUpdate.Tags = []string{}
+	}
+	if postToUpdate.Status == "" {
+		postToUpdate.Status = models.PostPublished
+	}
+	if err := httpConfig.va.Validate(postToUpdate); err != nil {
+		return models.Post{}, invalid(err)
+	}
+
+	postToUpdate.Version, err = httpConfig.checkVersion(version, post.Version)
+	if err != nil {
+		return models.Post{}, err
+	}
+
+	n, err := httpConfig.db.WithContext(ctx).UpdatePost(postToUpdate)
+	if err != nil {
+		return models.Post{}, writeError(err)
+	}
+	if n == 0 {
+		return models.Post{}, newAPIError(http.StatusBadRequest, "failed to update post with id: %d", postID)
+	}
+
+	httpConfig.reindexPost(ctx, postID)
+	updated, err := httpConfig.db.WithContext(ctx).GetPostByID(postID)
+	if err != nil {
+		return models.Post{}, databaseError(err)
+	}
+	httpConfig.emitPost(ctx, models.EventPostUpdated, updated, post.Status == models.PostPublished)
+
+	return updated, nil
+}
+
+// deletePost deletes one of the viewer's posts.
+func (httpConfig *HttpHandler) deletePost(ctx context.Context, viewer models.User, postID int, version *int) error {
+	post, err := httpConfig.ownPost(ctx, viewer, postID)
+	if err != nil {
+		return err
+	}
+
+	expected, err := httpConfig.checkVersion(version, post.Version)
+	if err != nil {
+		return err
+	}
+
+	n, err := httpConfig.db.WithContext(ctx).DeletePost(postID, expected)
+	if err != nil {
+		return writeError(err)
+	}
+	if n == 0 {
+		return newAPIError(http.StatusBadRequest, "failed to delete post with id: %d", postID)
+	}
+
+	httpConfig.reindexPost(ctx, postID)
+	httpConfig.emitPost(ctx, models.EventPostDeleted, post, false)
+
+	return nil
+}
+
+// addComment adds a comment by the viewer to a post they may read.
+func (httpConfig *HttpHandler) addComment(ctx context.Context, viewer models.User, postID int, content string) (models.Comment, error) {
+	if _, err := httpConfig.readablePost(ctx, viewer, postID); err != nil {
+		return models.Comment{}, err
+	}
+
+	newComment := models.Comment{Postid: postID, AuthorID: viewer.ID, Content: content}
+	if err := httpConfig.va.Validate(newComment); err != nil {
+		return models.Comment{}, invalid(err)
+	}
+
+	id, err := httpConfig.db.WithContext(ctx).AddComment(newComment)
+	if err != nil {
+		return models.Comment{}, databaseError(err)
+	}
+	if id == 0 {
+		return models.Comment{}, newAPIError(http.StatusBadRequest, "failed to add comment to post with id: %d", postID)
+	}
+
+	metrics.CommentsCreated.Inc()
+	httpConfig.reindexComment(ctx, id)
+	created, err := httpConfig.db.WithContext(ctx).GetCommentByID(id)
+	if err != nil {
+		return models.Comment{}, databaseError(err)
+	}
+	httpConfig.emitComment(ctx, models.EventCommentCreated, created)
+	httpConfig.publishComment(ctx, models.EventCommentCreated, created)
+
+	return created, nil
+}
+
+// editComment replaces the content of one of the viewer's comments.
+func (httpConfig *HttpHandler) editComment(ctx context.Context, viewer models.User, commentID int, content string, version *int) (models.Comment, error) {
+	comment, err := httpConfig.ownComment(ctx, viewer, commentID)
+	if err != nil {
+		return models.Comment{}, err
+	}
+
+	updateComment := comment
+	updateComment.Content = content
+	if err := httpConfig.va.Validate(updateComment); err != nil {
+		return models.Comment{}, invalid(err)
+	}
+
+	updateComment.Version, err = httpConfig.checkVersion(version, comment.Version)
+	if err != nil {
+		return models.Comment{}, err
+	}
+
+	n, err := httpConfig.db.WithContext(ctx).EditComment(updateComment)
+	if err != nil {
+		return models.Comment{}, writeError(err)
+	}
+	if n == 0 {
+		return models.Comment{}, newAPIError(http.StatusBadRequest, "failed to update comment with id: %d", commentID)
+	}
+
+	httpConfig.reindexComment(ctx, commentID)
+	updated, err := httpConfig.db.WithContext(ctx).GetCommentByID(commentID)
+	if err != nil {
+		return models.Comment{}, databaseError(err)
+	}
+	httpConfig.emitComment(ctx, models.EventCommentUpdated, updated)
+	httpConfig.publishComment(ctx, models.EventCommentUpdated, updated)
+
+	return updated, nil
+}
+
+// deleteComment deletes one of the viewer's comments.
+func (httpConfig *HttpHandler) deleteComment(ctx context.Context, viewer models.User, commentID int, version *int) error {
+	comment, err := httpConfig.ownComment(ctx, viewer, commentID)
+	if err != nil {
+		return err
+	}
+
+	expected, err := httpConfig.checkVersion(version, comment.Version)
+	if err != nil {
+		return err
+	}
+
+	n, err := httpConfig.db.WithContext(ctx).DeleteComment(commentID, expected)
+	if err != nil {
+		return writeError(err)
+	}
+	if n <= 0 {
+		return newAPIError(http.StatusNotFound, "no comment found with id: %d", commentID)
+	}
+
+	httpConfig.reindexComment(ctx, commentID)
+	httpConfig.emitComment(ctx, models.EventCommentDeleted, comment)
+	httpConfig.publishComment(ctx, models.EventCommentDeleted, comment)
+
+	return nil
+}
+
+// setFollow makes the viewer follow or stop following a user and returns the
+// user's profile with the new follower count.
+func (httpConfig *HttpHandler) setFollow(ctx context.Context, viewer models.User, username string, follow bool) (models.Profile, error) {
+	author, err := httpConfig.profile(ctx, username)
+	if err != nil {
+		return models.Profile{}, databaseError(err)
+	}
+	if author.ID == 0 {
+		return models.Profile{}, newAPIError(http.StatusNotFound, "no user found with username: %s", username)
+	}
+	if author.ID == viewer.ID || author.Username == models.DeletedUsername {
+		return models.Profile{}, newAPIError(http.StatusBadRequest, "you cannot follow this user")
+	}
+
+	if follow {
+		_, err = httpConfig.db.WithContext(ctx).Follow(viewer.ID, author.ID)
+	} else {
+		_, err = httpConfig.db.WithContext(ctx).Unfollow(viewer.ID, author.ID)
+	}
+	if err != nil {
+		return models.Profile{}, databaseError(err)
+	}
+
+	profile, err := httpConfig.profile(ctx, username)
+	if err != nil {
+		return models.Profile{}, databaseError(err)
+	}
+	return profile, nil
+}
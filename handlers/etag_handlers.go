@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// etag returns the entity tag of a post or comment version.
+func etag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// matchesETag reports whether an If-Match or If-None-Match header names tag.
+// If-None-Match compares weakly, ignoring the W/ prefix.
+func matchesETag(header, tag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatch checks the If-Match header of an update or delete against the
+// current version. It returns the version the write must still find, or 0
+// when the request has no precondition, and writes a 412 or 428 response and
+// returns false when the write must not go ahead.
+func (httpConfig *HttpHandler) ifMatch(w http.ResponseWriter, r *http.Request, version int) (int, bool) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if httpConfig.requireIfMatch {
+			w.WriteHeader(http.StatusPreconditionRequired)
+			response := customResponse{Status: http.StatusPreconditionRequired, Message: "precondition required", Data: map[string]interface{}{"msg": "send the ETag of the version being changed in If-Match"}}
+			json.NewEncoder(w).Encode(response)
+			return 0, false
+		}
+		return 0, true
+	}
+
+	if !matchesETag(header, etag(version), false) {
+		versionConflict(w, version)
+		return 0, false
+	}
+
+	return version, true
+}
+
+// v1Version turns the result of ifMatch into the version the content
+// operations take, nil when the request has no precondition.
+func v1Version(version int) *int {
+	if version == 0 {
+		return nil
+	}
+	return &version
+}
+
+// versionConflict writes the 412 response for a stale If-Match, with the
+// current ETag so the client can fetch the new version.
+func versionConflict(w http.ResponseWriter, version int) {
+	if version > 0 {
+		w.Header().Set("ETag", etag(version))
+	}
+	w.WriteHeader(http.StatusPreconditionFailed)
+	response := customResponse{Status: http.StatusPreconditionFailed, Message: "precondition failed", Data: map[string]interface{}{"msg": "the resource was modified since it was read"}}
+	json.NewEncoder(w).Encode(response)
+}
+
+// notModified sets the ETag of a read and writes 304 when the If-None-Match
+// header names it, in which case the caller sends no body.
+func notModified(w http.ResponseWriter, r *http.Request, version int) bool {
+	tag := etag(version)
+	w.Header().Set("ETag", tag)
+
+	if header := r.Header.Get("If-None-Match"); header != "" && matchesETag(header, tag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/A-Victory/blog/models"
+	"github.com/go-chi/chi/v5"
+)
+
+func (httpConfig *HttpHandler) RequestExport(w http.ResponseWriter, r *http.Request) {
+
+	user, err := httpConfig.getUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to retrieve user's details: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	id, err := httpConfig.db.WithContext(r.Context()).CreateExport(user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if httpConfig.exports != nil {
+		httpConfig.exports.Trigger()
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/users/exports/%d", id))
+	w.WriteHeader(http.StatusAccepted)
+	response := customResponse{Status: http.StatusAccepted, Message: "export requested", Data: map[string]interface{}{"export_id": id, "msg": "your archive is being prepared, check its status to download it once ready"}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) ExportStatus(w http.ResponseWriter, r *http.Request) {
+
+	export, ok := httpConfig.ownExport(w, r)
+	if !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"export": export}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) DownloadExport(w http.ResponseWriter, r *http.Request) {
+
+	export, ok := httpConfig.ownExport(w, r)
+	if !ok {
+		return
+	}
+
+	if export.Status != models.ExportReady {
+		w.WriteHeader(http.StatusConflict)
+		response := customResponse{Status: http.StatusConflict, Message: "export not ready", Data: map[string]interface{}{"msg": fmt.Sprintf("export %d is %s", export.ID, export.Status)}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	archive, err := httpConfig.db.WithContext(r.Context()).GetExportArchive(export.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"blog-export-%d.zip\"", export.ID))
+	w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(archive)
+}
+
+// ownExport loads the export named in the URL, writing an error response and
+// returning false when it does not exist or belongs to someone else.
+func (httpConfig *HttpHandler) ownExport(w http.ResponseWriter, r *http.Request) (models.DataExport, bool) {
+
+	user, err := httpConfig.getUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to retrieve user's details: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return models.DataExport{}, false
+	}
+
+	exportID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "error", Data: map[string]interface{}{"msg": "error converting string..."}}
+		json.NewEncoder(w).Encode(response)
+		return models.DataExport{}, false
+	}
+
+	export, err := httpConfig.db.WithContext(r.Context()).GetExport(exportID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return models.DataExport{}, false
+	}
+
+	if export.ID == 0 || export.UserID != user.ID {
+		w.WriteHeader(http.StatusNotFound)
+		response := customResponse{Status: http.StatusNotFound, Message: "export not found", Data: map[string]interface{}{"msg": fmt.Sprintf("no export found with id: %d", exportID)}}
+		json.NewEncoder(w).Encode(response)
+		return models.DataExport{}, false
+	}
+
+	return export, true
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/A-Victory/blog/models"
+)
+
+func (httpConfig *HttpHandler) Follow(w http.ResponseWriter, r *http.Request) {
+
+	user, author, ok := httpConfig.followTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := httpConfig.db.WithContext(r.Context()).Follow(user.ID, author.ID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "following " + author.Username, Data: map[string]interface{}{"following": true}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) Unfollow(w http.ResponseWriter, r *http.Request) {
+
+	user, author, ok := httpConfig.followTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := httpConfig.db.WithContext(r.Context()).Unfollow(user.ID, author.ID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "unfollowed " + author.Username, Data: map[string]interface{}{"following": false}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) Followers(w http.ResponseWriter, r *http.Request) {
+	httpConfig.followList(w, r, httpConfig.db.WithContext(r.Context()).GetFollowers, "followers")
+}
+
+func (httpConfig *HttpHandler) Following(w http.ResponseWriter, r *http.Request) {
+	httpConfig.followList(w, r, httpConfig.db.WithContext(r.Context()).GetFollowing, "following")
+}
+
+// Feed returns the recent published posts of the authors the user follows.
+// Pages are linked with an opaque cursor instead of an offset so that new
+// posts do not shift the pages a client is reading.
+func (httpConfig *HttpHandler) Feed(w http.ResponseWriter, r *http.Request) {
+
+	user, err := httpConfig.getUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to retrieve user's details: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	opts, ok := listRequest(w, r)
+	if !ok {
+		return
+	}
+
+	posts, page, err := httpConfig.db.WithContext(r.Context()).GetFeed(user.ID, opts)
+	if err != nil {
+		listError(w, err)
+		return
+	}
+
+	setNextLink(w, r, page.NextCursor)
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"posts": posts, "page": page}}
+	json.NewEncoder(w).Encode(response)
+}
+
+// followTarget loads the signed in user and the author named in the URL,
+// writing an error response and returning false when the follow is invalid.
+func (httpConfig *HttpHandler) followTarget(w http.ResponseWriter, r *http.Request) (models.User, models.Profile, bool) {
+
+	user, err := httpConfig.getUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to retrieve user's details: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return models.User{}, models.Profile{}, false
+	}
+
+	author, ok := httpConfig.findProfile(w, r)
+	if !ok {
+		return models.User{}, models.Profile{}, false
+	}
+
+	if author.ID == user.ID || author.Username == models.DeletedUsername {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"msg": "you cannot follow this user"}}
+		json.NewEncoder(w).Encode(response)
+		return models.User{}, models.Profile{}, false
+	}
+
+	return user, author, true
+}
+
+func (httpConfig *HttpHandler) followList(w http.ResponseWriter, r *http.Request, list func(userID int, opts models.ListOptions) ([]models.Follow, models.Page, error), key string) {
+
+	profile, ok := httpConfig.findProfile(w, r)
+	if !ok {
+		return
+	}
+
+	opts, ok := listRequest(w, r)
+	if !ok {
+		return
+	}
+
+	follows, page, err := list(profile.ID, opts)
+	if err != nil {
+		listError(w, err)
+		return
+	}
+
+	setNextLink(w, r, page.NextCursor)
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{key: follows, "count": page.Total, "page": page}}
+	json.NewEncoder(w).Encode(response)
+}
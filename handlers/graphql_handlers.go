@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+const (
+	// maxQueryDepth is how deeply the fields of a GraphQL query may nest.
+	maxQueryDepth = 10
+	// maxQueryComplexity bounds the estimated number of fields a query
+	// resolves, counting the fields under a list once per item asked for.
+	maxQueryComplexity = 5000
+)
+
+// graphqlParams is a GraphQL request, sent as the JSON body of a POST or as
+// the query parameters of a GET.
+type graphqlParams struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// GraphQL runs a GraphQL query or mutation over the posts, comments and
+// users. GET requests may only run queries. Queries nesting deeper than
+// maxQueryDepth or estimated to cost more than maxQueryComplexity are
+// rejected before they touch the database.
+func (httpConfig *HttpHandler) GraphQL(w http.ResponseWriter, r *http.Request) {
+
+	params, err := readGraphQLParams(r)
+	if err != nil {
+		graphqlError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: params.Query})
+	if err != nil {
+		graphqlError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// an unknown or ambiguous operation is reported by graphql.Do
+	if op := selectOperation(doc, params.OperationName); op != nil {
+		if r.Method == "GET" && op.Operation != ast.OperationTypeQuery {
+			w.Header().Set("Allow", "POST")
+			graphqlError(w, http.StatusMethodNotAllowed, "mutations must be sent with POST")
+			return
+		}
+
+		depth, complexity := queryCost(doc, op, params.Variables)
+		if depth > maxQueryDepth {
+			graphqlError(w, http.StatusBadRequest, fmt.Sprintf("query is nested %d levels deep, more than the limit of %d", depth, maxQueryDepth))
+			return
+		}
+		if complexity > maxQueryComplexity {
+			graphqlError(w, http.StatusBadRequest, fmt.Sprintf("query complexity %d is more than the limit of %d, ask for fewer items", complexity, maxQueryComplexity))
+			return
+		}
+	}
+
+	user, err := httpConfig.getUser(r)
+	if err != nil {
+		graphqlError(w, http.StatusInternalServerError, "failed to retrieve user's details: "+err.Error())
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), graphqlContextKey{}, &graphqlRequest{
+		handler: httpConfig,
+		viewer:  user,
+		loader:  newGraphQLLoader(httpConfig.db.WithContext(r.Context())),
+	})
+
+	result := graphql.Do(graphql.Params{
+		Schema:         graphqlSchema,
+		RequestString:  params.Query,
+		VariableValues: params.Variables,
+		OperationName:  params.OperationName,
+		Context:        ctx,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
+func readGraphQLParams(r *http.Request) (graphqlParams, error) {
+	var params graphqlParams
+
+	if r.Method == "GET" {
+		query := r.URL.Query()
+		params.Query = query.Get("query")
+		params.OperationName = query.Get("operationName")
+		if variables := query.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &params.Variables); err != nil {
+				return graphqlParams{}, fmt.Errorf("variables must be a JSON object")
+			}
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		return graphqlParams{}, err
+	}
+
+	if params.Query == "" {
+		return graphqlParams{}, fmt.Errorf("no query provided")
+	}
+	return params, nil
+}
+
+// graphqlError writes a request error in the GraphQL response format.
+func graphqlError(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"errors": []map[string]interface{}{{"message": message}}})
+}
+
+// selectOperation returns the operation a request runs: the one named, or
+// the only one in the document.
+func selectOperation(doc *ast.Document, name string) *ast.OperationDefinition {
+	var selected *ast.OperationDefinition
+	for _, definition := range doc.Definitions {
+		op, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if name != "" {
+			if op.Name != nil && op.Name.Value == name {
+				return op
+			}
+			continue
+		}
+		if selected != nil {
+			return nil
+		}
+		selected = op
+	}
+	return selected
+}
+
+// queryCost measures an operation. depth is the longest chain of nested
+// fields. complexity counts every field, with the fields under a list
+// counted once per item of the page size asked for. Introspection fields are
+// not counted.
+func queryCost(doc *ast.Document, op *ast.OperationDefinition, variables map[string]interface{}) (depth, complexity int) {
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, definition := range doc.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok && fragment.Name != nil {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	// variables that are not sent take their default values
+	values := map[string]interface{}{}
+	for _, definition := range op.VariableDefinitions {
+		if value, ok := definition.DefaultValue.(*ast.IntValue); ok && definition.Variable != nil {
+			values[definition.Variable.Name.Value], _ = strconv.Atoi(value.Value)
+		}
+	}
+	for name, value := range variables {
+		values[name] = value
+	}
+
+	c := costCounter{fragments: fragments, variables: values, spreading: map[string]bool{}}
+	return c.selections(op.SelectionSet)
+}
+
+type costCounter struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	// spreading holds the fragments being expanded, so that a fragment that
+	// spreads itself, which validation rejects later, does not loop here.
+	spreading map[string]bool
+}
+
+func (c costCounter) selections(set *ast.SelectionSet) (depth, complexity int) {
+	if set == nil {
+		return 0, 0
+	}
+
+	for _, selection := range set.Selections {
+		var d, n int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			d, n = c.field(selection)
+		case *ast.InlineFragment:
+			d, n = c.selections(selection.SelectionSet)
+		case *ast.FragmentSpread:
+			name := selection.Name.Value
+			fragment, ok := c.fragments[name]
+			if !ok || c.spreading[name] {
+				continue
+			}
+			c.spreading[name] = true
+			d, n = c.selections(fragment.SelectionSet)
+			delete(c.spreading, name)
+		}
+		if d > depth {
+			depth = d
+		}
+		complexity += n
+	}
+	return depth, complexity
+}
+
+func (c costCounter) field(field *ast.Field) (depth, complexity int) {
+	if strings.HasPrefix(field.Name.Value, "__") {
+		return 0, 0
+	}
+
+	depth, complexity = c.selections(field.SelectionSet)
+	return depth + 1, 1 + c.pageSize(field)*complexity
+}
+
+// pageSize is the number of items a field asks for: its first argument for
+// the list fields, and one for every other field.
+func (c costCounter) pageSize(field *ast.Field) int {
+	name := field.Name.Value
+	if name != "posts" && name != "comments" {
+		return 1
+	}
+
+	first := defaultGraphQLPage
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "first" {
+			continue
+		}
+		switch value := arg.Value.(type) {
+		case *ast.IntValue:
+			first, _ = strconv.Atoi(value.Value)
+		case *ast.Variable:
+			switch v := c.variables[value.Name.Value].(type) {
+			case float64:
+				first = int(v)
+			case int:
+				first = v
+			}
+		}
+	}
+
+	if first < 1 {
+		first = defaultGraphQLPage
+	}
+	if first > maxListLimit {
+		first = maxListLimit
+	}
+	return first
+}
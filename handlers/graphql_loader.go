@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/models"
+)
+
+// graphqlLoader batches the lookups of one GraphQL request. Every post and
+// comment a resolver returns is primed here, noting the authors and posts it
+// refers to. The first lookup of any of them then loads all that are pending
+// in one query, so a page of posts with their authors, comment counts and
+// latest comments costs a handful of queries rather than several per post.
+type graphqlLoader struct {
+	db *conn.DB
+
+	mu sync.Mutex
+	// profiles and posts hold nil for ids that were looked up and not found.
+	profiles        map[int]*models.Profile
+	posts           map[int]*models.Post
+	pendingProfiles map[int]bool
+	pendingPosts    map[int]bool
+	// seenPosts are the posts resolved so far, in order. Their comment counts
+	// and latest comments are loaded together.
+	seenPosts []int
+	counts    map[int]int
+	// comments is keyed by the sort order and page size asked for.
+	comments map[string]map[int][]models.Comment
+}
+
+func newGraphQLLoader(db *conn.DB) *graphqlLoader {
+	return &graphqlLoader{
+		db:              db,
+		profiles:        map[int]*models.Profile{},
+		posts:           map[int]*models.Post{},
+		pendingProfiles: map[int]bool{},
+		pendingPosts:    map[int]bool{},
+		counts:          map[int]int{},
+		comments:        map[string]map[int][]models.Comment{},
+	}
+}
+
+// primeProfile caches a profile that was loaded by other means.
+func (l *graphqlLoader) primeProfile(profile models.Profile) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.profiles[profile.ID] = &profile
+	delete(l.pendingProfiles, profile.ID)
+}
+
+// primePosts caches posts and queues their authors.
+func (l *graphqlLoader) primePosts(posts ...models.Post) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, post := range posts {
+		l.addPost(post)
+	}
+}
+
+// primeComments queues the authors and posts of comments.
+func (l *graphqlLoader) primeComments(comments ...models.Comment) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, comment := range comments {
+		l.wantProfile(comment.AuthorID)
+		if _, ok := l.posts[comment.Postid]; !ok {
+			l.pendingPosts[comment.Postid] = true
+		}
+	}
+}
+
+// profile returns the profile of the user with the given id, or nil if there
+// is none.
+func (l *graphqlLoader) profile(id int) (*models.Profile, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if profile, ok := l.profiles[id]; ok {
+		return profile, nil
+	}
+
+	l.pendingProfiles[id] = true
+	ids := setIDs(l.pendingProfiles)
+	l.pendingProfiles = map[int]bool{}
+
+	found, err := l.db.GetProfilesByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		profile, ok := found[id]
+		if !ok {
+			l.profiles[id] = nil
+			continue
+		}
+		profile.AvatarURL = avatarURL(profile.Username)
+		l.profiles[id] = &profile
+	}
+
+	return l.profiles[id], nil
+}
+
+// post returns the post with the given id, or nil if there is none.
+func (l *graphqlLoader) post(id int) (*models.Post, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if post, ok := l.posts[id]; ok {
+		return post, nil
+	}
+
+	l.pendingPosts[id] = true
+	ids := setIDs(l.pendingPosts)
+	l.pendingPosts = map[int]bool{}
+
+	found, err := l.db.GetPostsByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if post, ok := found[id]; ok {
+			l.addPost(post)
+		} else {
+			l.posts[id] = nil
+		}
+	}
+
+	return l.posts[id], nil
+}
+
+// commentCount returns the number of comments on a post.
+func (l *graphqlLoader) commentCount(postID int) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if count, ok := l.counts[postID]; ok {
+		return count, nil
+	}
+
+	ids := l.unseen(postID, func(id int) bool {
+		_, ok := l.counts[id]
+		return ok
+	})
+
+	found, err := l.db.CountComments(ids)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		l.counts[id] = found[id]
+	}
+
+	return l.counts[postID], nil
+}
+
+// recentComments returns the first comments of a post in the sort order.
+func (l *graphqlLoader) recentComments(postID int, sort string, first int) ([]models.Comment, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := fmt.Sprintf("%s:%d", sort, first)
+	loaded, ok := l.comments[key]
+	if !ok {
+		loaded = map[int][]models.Comment{}
+		l.comments[key] = loaded
+	}
+	if comments, ok := loaded[postID]; ok {
+		return comments, nil
+	}
+
+	ids := l.unseen(postID, func(id int) bool {
+		_, ok := loaded[id]
+		return ok
+	})
+
+	found, err := l.db.GetRecentComments(ids, sort, first)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		comments := found[id]
+		if comments == nil {
+			comments = []models.Comment{}
+		}
+		loaded[id] = comments
+		for _, comment := range comments {
+			l.wantProfile(comment.AuthorID)
+		}
+	}
+
+	return loaded[postID], nil
+}
+
+// addPost caches a post and queues its author. The caller holds the lock.
+func (l *graphqlLoader) addPost(post models.Post) {
+	if _, ok := l.posts[post.ID]; !ok {
+		l.seenPosts = append(l.seenPosts, post.ID)
+	}
+	l.posts[post.ID] = &post
+	delete(l.pendingPosts, post.ID)
+	l.wantProfile(post.AuthorID)
+}
+
+// wantProfile queues a profile unless it is cached. The caller holds the
+// lock.
+func (l *graphqlLoader) wantProfile(id int) {
+	if _, ok := l.profiles[id]; !ok {
+		l.pendingProfiles[id] = true
+	}
+}
+
+// unseen returns postID and the seen posts that are not loaded yet. The
+// caller holds the lock.
+func (l *graphqlLoader) unseen(postID int, loaded func(id int) bool) []int {
+	ids := []int{postID}
+	for _, id := range l.seenPosts {
+		if id != postID && !loaded(id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func setIDs(set map[int]bool) []int {
+	ids := make([]int, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	return ids
+}
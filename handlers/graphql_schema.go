@@ -0,0 +1,591 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/A-Victory/blog/models"
+	"github.com/graphql-go/graphql"
+)
+
+// graphqlRequest is what the resolvers of one GraphQL request share.
+type graphqlRequest struct {
+	handler *HttpHandler
+	viewer  models.User
+	loader  *graphqlLoader
+}
+
+type graphqlContextKey struct{}
+
+func graphqlFrom(ctx context.Context) *graphqlRequest {
+	return ctx.Value(graphqlContextKey{}).(*graphqlRequest)
+}
+
+// graphqlSchema is built once; its resolvers find the handler and the
+// signed in user in the request context.
+var graphqlSchema = mustGraphQLSchema()
+
+func mustGraphQLSchema() graphql.Schema {
+	schema, err := newGraphQLSchema()
+	if err != nil {
+		panic("handlers: invalid GraphQL schema: " + err.Error())
+	}
+	return schema
+}
+
+func newGraphQLSchema() (graphql.Schema, error) {
+	nonNullInt := graphql.NewNonNull(graphql.Int)
+	nonNullString := graphql.NewNonNull(graphql.String)
+	stringList := graphql.NewList(graphql.NewNonNull(graphql.String))
+
+	socialLinkType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "SocialLink",
+		Fields: graphql.Fields{
+			"name": &graphql.Field{Type: nonNullString},
+			"url":  &graphql.Field{Type: nonNullString},
+		},
+	})
+
+	userType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "User",
+		Description: "The public profile of an author.",
+		Fields: graphql.Fields{
+			"id":          &graphql.Field{Type: nonNullInt},
+			"username":    &graphql.Field{Type: nonNullString},
+			"displayName": &graphql.Field{Type: nonNullString},
+			"bio":         &graphql.Field{Type: nonNullString},
+			"website":     &graphql.Field{Type: nonNullString},
+			"avatarUrl":   &graphql.Field{Type: nonNullString},
+			"hasAvatar":   &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"followers":   &graphql.Field{Type: nonNullInt},
+			"following":   &graphql.Field{Type: nonNullInt},
+			"socialLinks": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(socialLinkType))),
+				Resolve: resolveSocialLinks,
+			},
+		},
+	})
+
+	postType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Post",
+		Fields: graphql.Fields{
+			"id":        &graphql.Field{Type: nonNullInt},
+			"title":     &graphql.Field{Type: nonNullString},
+			"content":   &graphql.Field{Type: nonNullString},
+			"status":    &graphql.Field{Type: nonNullString},
+			"tags":      &graphql.Field{Type: graphql.NewNonNull(stringList)},
+			"createdAt": &graphql.Field{Type: nonNullString},
+			"updatedAt": &graphql.Field{Type: nonNullString},
+			"version":   &graphql.Field{Type: nonNullInt, Description: "Goes up by one with every change. Pass it to updatePost and deletePost to guard against lost updates."},
+		},
+	})
+
+	commentType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Comment",
+		Fields: graphql.Fields{
+			"id":        &graphql.Field{Type: nonNullInt},
+			"content":   &graphql.Field{Type: nonNullString},
+			"createdAt": &graphql.Field{Type: nonNullString},
+			"updatedAt": &graphql.Field{Type: nonNullString},
+			"version":   &graphql.Field{Type: nonNullInt},
+		},
+	})
+
+	postConnectionType := connectionType("PostConnection", postType)
+	commentConnectionType := connectionType("CommentConnection", commentType)
+
+	// the relationships are added once every type exists, as they refer to
+	// each other
+	userType.AddFieldConfig("posts", &graphql.Field{
+		Type:        graphql.NewNonNull(postConnectionType),
+		Description: "The user's published posts, and your drafts on your own profile.",
+		Args:        listArgs(),
+		Resolve:     resolveUserPosts,
+	})
+	postType.AddFieldConfig("author", &graphql.Field{Type: userType, Resolve: resolvePostAuthor})
+	postType.AddFieldConfig("commentCount", &graphql.Field{Type: nonNullInt, Resolve: resolveCommentCount})
+	postType.AddFieldConfig("comments", &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(commentType))),
+		Description: "The first comments on the post. Page through the rest with Query.comments.",
+		Args: graphql.FieldConfigArgument{
+			"first": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultGraphQLPage},
+			"sort":  &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: models.SortNewest},
+		},
+		Resolve: resolvePostComments,
+	})
+	commentType.AddFieldConfig("author", &graphql.Field{Type: userType, Resolve: resolveCommentAuthor})
+	commentType.AddFieldConfig("post", &graphql.Field{Type: postType, Resolve: resolveCommentPost})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"me": &graphql.Field{Type: userType, Resolve: resolveMe},
+			"user": &graphql.Field{
+				Type:    userType,
+				Args:    graphql.FieldConfigArgument{"username": &graphql.ArgumentConfig{Type: nonNullString}},
+				Resolve: resolveUser,
+			},
+			"post": &graphql.Field{
+				Type:    postType,
+				Args:    graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: nonNullInt}},
+				Resolve: resolvePost,
+			},
+			"posts": &graphql.Field{
+				Type: graphql.NewNonNull(postConnectionType),
+				Args: withArgs(listArgs(), graphql.FieldConfigArgument{
+					"search": &graphql.ArgumentConfig{Type: graphql.String},
+					"author": &graphql.ArgumentConfig{Type: graphql.String},
+					"tags":   &graphql.ArgumentConfig{Type: stringList, Description: "Posts tagged with any of the tags."},
+					"status": &graphql.ArgumentConfig{Type: graphql.String, Description: "published, draft or all. Drafts are only ever your own."},
+				}),
+				Resolve: resolvePosts,
+			},
+			"comments": &graphql.Field{
+				Type: graphql.NewNonNull(commentConnectionType),
+				Args: withArgs(listArgs(), graphql.FieldConfigArgument{
+					"postId": &graphql.ArgumentConfig{Type: nonNullInt},
+				}),
+				Resolve: resolveComments,
+			},
+		},
+	})
+
+	postInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:        "PostInput",
+		Description: "The fields of a post. updatePost changes only the fields that are given.",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"title":   &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"content": &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"status":  &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"tags":    &graphql.InputObjectFieldConfig{Type: stringList},
+		},
+	})
+
+	version := &graphql.ArgumentConfig{Type: graphql.Int, Description: "The version being changed; the write fails if the resource has changed since."}
+
+	mutationType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createPost": &graphql.Field{
+				Type:    postType,
+				Args:    graphql.FieldConfigArgument{"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(postInputType)}},
+				Resolve: resolveCreatePost,
+			},
+			"updatePost": &graphql.Field{
+				Type: postType,
+				Args: graphql.FieldConfigArgument{
+					"id":      &graphql.ArgumentConfig{Type: nonNullInt},
+					"input":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(postInputType)},
+					"version": version,
+				},
+				Resolve: resolveUpdatePost,
+			},
+			"deletePost": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: graphql.FieldConfigArgument{
+					"id":      &graphql.ArgumentConfig{Type: nonNullInt},
+					"version": version,
+				},
+				Resolve: resolveDeletePost,
+			},
+			"addComment": &graphql.Field{
+				Type: commentType,
+				Args: graphql.FieldConfigArgument{
+					"postId":  &graphql.ArgumentConfig{Type: nonNullInt},
+					"content": &graphql.ArgumentConfig{Type: nonNullString},
+				},
+				Resolve: resolveAddComment,
+			},
+			"editComment": &graphql.Field{
+				Type: commentType,
+				Args: graphql.FieldConfigArgument{
+					"id":      &graphql.ArgumentConfig{Type: nonNullInt},
+					"content": &graphql.ArgumentConfig{Type: nonNullString},
+					"version": version,
+				},
+				Resolve: resolveEditComment,
+			},
+			"deleteComment": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: graphql.FieldConfigArgument{
+					"id":      &graphql.ArgumentConfig{Type: nonNullInt},
+					"version": version,
+				},
+				Resolve: resolveDeleteComment,
+			},
+			"follow": &graphql.Field{
+				Type:    userType,
+				Args:    graphql.FieldConfigArgument{"username": &graphql.ArgumentConfig{Type: nonNullString}},
+				Resolve: resolveFollow(true),
+			},
+			"unfollow": &graphql.Field{
+				Type:    userType,
+				Args:    graphql.FieldConfigArgument{"username": &graphql.ArgumentConfig{Type: nonNullString}},
+				Resolve: resolveFollow(false),
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType, Mutation: mutationType})
+}
+
+// defaultGraphQLPage is the page size of list fields without a first
+// argument.
+const defaultGraphQLPage = 10
+
+func connectionType(name string, node *graphql.Object) *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: name,
+		Fields: graphql.Fields{
+			"nodes":      &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(node)))},
+			"totalCount": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"nextCursor": &graphql.Field{Type: graphql.String, Description: "Pass as after to get the next page. Null on the last page."},
+		},
+	})
+}
+
+func listArgs() graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"first": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultGraphQLPage},
+		"after": &graphql.ArgumentConfig{Type: graphql.String},
+		"sort":  &graphql.ArgumentConfig{Type: graphql.String},
+	}
+}
+
+func withArgs(args, more graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	for name, arg := range more {
+		args[name] = arg
+	}
+	return args
+}
+
+// connection is the source of the connection types.
+func connection(nodes interface{}, page models.Page) map[string]interface{} {
+	var next interface{}
+	if page.NextCursor != "" {
+		next = page.NextCursor
+	}
+	return map[string]interface{}{"nodes": nodes, "totalCount": page.Total, "nextCursor": next}
+}
+
+// graphqlListOptions reads the first, after and sort arguments the way
+// listOptions reads the query parameters of the list endpoints.
+func graphqlListOptions(args map[string]interface{}) (models.ListOptions, error) {
+	opts := models.ListOptions{Limit: pageSize(args)}
+	if sort, ok := args["sort"].(string); ok {
+		opts.Sort = strings.ToLower(sort)
+	}
+	if after, ok := args["after"].(string); ok && after != "" {
+		cursor, err := models.ParseCursor(after)
+		if err != nil {
+			return models.ListOptions{}, err
+		}
+		opts.Cursor = &cursor
+	}
+	return opts, nil
+}
+
+func pageSize(args map[string]interface{}) int {
+	first, _ := args["first"].(int)
+	if first < 1 {
+		first = defaultGraphQLPage
+	}
+	if first > maxListLimit {
+		first = maxListLimit
+	}
+	return first
+}
+
+// visiblePost loads a post the signed in user may see. Drafts are only
+// visible to their author.
+func (req *graphqlRequest) visiblePost(id int) (*models.Post, error) {
+	post, err := req.loader.post(id)
+	if err != nil {
+		return nil, databaseError(err)
+	}
+	if post == nil || (post.Status == models.PostDraft && post.AuthorID != req.viewer.ID) {
+		return nil, nil
+	}
+	return post, nil
+}
+
+func resolveSocialLinks(p graphql.ResolveParams) (interface{}, error) {
+	profile := p.Source.(models.Profile)
+
+	names := make([]string, 0, len(profile.SocialLinks))
+	for name := range profile.SocialLinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	links := make([]map[string]interface{}, len(names))
+	for i, name := range names {
+		links[i] = map[string]interface{}{"name": name, "url": profile.SocialLinks[name]}
+	}
+	return links, nil
+}
+
+func resolveUserPosts(p graphql.ResolveParams) (interface{}, error) {
+	req := graphqlFrom(p.Context)
+	profile := p.Source.(models.Profile)
+
+	opts, err := graphqlListOptions(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	posts, page, err := req.handler.db.WithContext(p.Context).GetPosts(opts, models.PostFilter{Author: profile.Username, Status: "all", ViewerID: req.viewer.ID})
+	if err != nil {
+		return nil, listQueryError(err)
+	}
+	req.loader.primePosts(posts...)
+
+	return connection(posts, page), nil
+}
+
+func resolvePostAuthor(p graphql.ResolveParams) (interface{}, error) {
+	return resolveProfile(p.Context, p.Source.(models.Post).AuthorID)
+}
+
+func resolveCommentAuthor(p graphql.ResolveParams) (interface{}, error) {
+	return resolveProfile(p.Context, p.Source.(models.Comment).AuthorID)
+}
+
+func resolveProfile(ctx context.Context, id int) (interface{}, error) {
+	profile, err := graphqlFrom(ctx).loader.profile(id)
+	if err != nil {
+		return nil, databaseError(err)
+	}
+	if profile == nil {
+		return nil, nil
+	}
+	return *profile, nil
+}
+
+func resolveCommentCount(p graphql.ResolveParams) (interface{}, error) {
+	count, err := graphqlFrom(p.Context).loader.commentCount(p.Source.(models.Post).ID)
+	if err != nil {
+		return nil, databaseError(err)
+	}
+	return count, nil
+}
+
+func resolvePostComments(p graphql.ResolveParams) (interface{}, error) {
+	sort, _ := p.Args["sort"].(string)
+	comments, err := graphqlFrom(p.Context).loader.recentComments(p.Source.(models.Post).ID, strings.ToLower(sort), pageSize(p.Args))
+	if err != nil {
+		return nil, listQueryError(err)
+	}
+	return comments, nil
+}
+
+func resolveCommentPost(p graphql.ResolveParams) (interface{}, error) {
+	post, err := graphqlFrom(p.Context).visiblePost(p.Source.(models.Comment).Postid)
+	if err != nil || post == nil {
+		return nil, err
+	}
+	return *post, nil
+}
+
+func resolveMe(p graphql.ResolveParams) (interface{}, error) {
+	req := graphqlFrom(p.Context)
+	return resolveProfile(p.Context, req.viewer.ID)
+}
+
+func resolveUser(p graphql.ResolveParams) (interface{}, error) {
+	req := graphqlFrom(p.Context)
+
+	profile, err := req.handler.profile(p.Context, p.Args["username"].(string))
+	if err != nil {
+		return nil, databaseError(err)
+	}
+	if profile.ID == 0 {
+		return nil, nil
+	}
+	req.loader.primeProfile(profile)
+
+	return profile, nil
+}
+
+func resolvePost(p graphql.ResolveParams) (interface{}, error) {
+	post, err := graphqlFrom(p.Context).visiblePost(p.Args["id"].(int))
+	if err != nil || post == nil {
+		return nil, err
+	}
+	return *post, nil
+}
+
+func resolvePosts(p graphql.ResolveParams) (interface{}, error) {
+	req := graphqlFrom(p.Context)
+
+	opts, err := graphqlListOptions(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := models.PostFilter{ViewerID: req.viewer.ID}
+	filter.Search, _ = p.Args["search"].(string)
+	if author, ok := p.Args["author"].(string); ok {
+		filter.Author = strings.TrimSpace(author)
+	}
+	if status, ok := p.Args["status"].(string); ok {
+		filter.Status = strings.ToLower(status)
+	}
+	if tags, ok := p.Args["tags"].([]interface{}); ok {
+		filter.Tags = models.NormalizeTags(stringArgs(tags))
+	}
+	if err := req.handler.va.Validate(filter); err != nil {
+		return nil, err
+	}
+
+	posts, page, err := req.handler.db.WithContext(p.Context).GetPosts(opts, filter)
+	if err != nil {
+		return nil, listQueryError(err)
+	}
+	req.loader.primePosts(posts...)
+
+	return connection(posts, page), nil
+}
+
+func resolveComments(p graphql.ResolveParams) (interface{}, error) {
+	req := graphqlFrom(p.Context)
+	postID := p.Args["postId"].(int)
+
+	opts, err := graphqlListOptions(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	post, err := req.visiblePost(postID)
+	if err != nil {
+		return nil, err
+	}
+	if post == nil {
+		return nil, fmt.Errorf("no post found with id %d", postID)
+	}
+
+	comments, page, err := req.handler.db.WithContext(p.Context).GetComments(postID, opts)
+	if err != nil {
+		return nil, listQueryError(err)
+	}
+	req.loader.primeComments(comments...)
+
+	return connection(comments, page), nil
+}
+
+func resolveCreatePost(p graphql.ResolveParams) (interface{}, error) {
+	req := graphqlFrom(p.Context)
+
+	created, err := req.handler.createPost(p.Context, req.viewer, applyPostInput(models.Post{}, p.Args["input"].(map[string]interface{})))
+	if err != nil {
+		return nil, err
+	}
+	req.loader.primePosts(created)
+
+	return created, nil
+}
+
+func resolveUpdatePost(p graphql.ResolveParams) (interface{}, error) {
+	req := graphqlFrom(p.Context)
+
+	input := p.Args["input"].(map[string]interface{})
+	updated, err := req.handler.updatePost(p.Context, req.viewer, p.Args["id"].(int), versionArg(p.Args), func(post *models.Post) {
+		*post = applyPostInput(*post, input)
+	})
+	if err != nil {
+		return nil, err
+	}
+	req.loader.primePosts(updated)
+
+	return updated, nil
+}
+
+func resolveDeletePost(p graphql.ResolveParams) (interface{}, error) {
+	req := graphqlFrom(p.Context)
+
+	if err := req.handler.deletePost(p.Context, req.viewer, p.Args["id"].(int), versionArg(p.Args)); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func resolveAddComment(p graphql.ResolveParams) (interface{}, error) {
+	req := graphqlFrom(p.Context)
+
+	created, err := req.handler.addComment(p.Context, req.viewer, p.Args["postId"].(int), p.Args["content"].(string))
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func resolveEditComment(p graphql.ResolveParams) (interface{}, error) {
+	req := graphqlFrom(p.Context)
+
+	updated, err := req.handler.editComment(p.Context, req.viewer, p.Args["id"].(int), p.Args["content"].(string), versionArg(p.Args))
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func resolveDeleteComment(p graphql.ResolveParams) (interface{}, error) {
+	req := graphqlFrom(p.Context)
+
+	if err := req.handler.deleteComment(p.Context, req.viewer, p.Args["id"].(int), versionArg(p.Args)); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+// resolveFollow follows or unfollows a user and returns their profile with
+// the new follower count.
+func resolveFollow(follow bool) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		req := graphqlFrom(p.Context)
+
+		profile, err := req.handler.setFollow(p.Context, req.viewer, p.Args["username"].(string), follow)
+		if err != nil {
+			return nil, err
+		}
+		return profile, nil
+	}
+}
+
+// versionArg returns the version argument of a write, or nil if there is
+// none.
+func versionArg(args map[string]interface{}) *int {
+	if version, ok := args["version"].(int); ok {
+		return &version
+	}
+	return nil
+}
+
+// applyPostInput sets the fields given in a PostInput on the post.
+func applyPostInput(post models.Post, input map[string]interface{}) models.Post {
+	if title, ok := input["title"].(string); ok {
+		post.Title = title
+	}
+	if content, ok := input["content"].(string); ok {
+		post.Content = content
+	}
+	if status, ok := input["status"].(string); ok {
+		post.Status = status
+	}
+	if tags, ok := input["tags"].([]interface{}); ok {
+		post.Tags = models.NormalizeTags(stringArgs(tags))
+	}
+	return post
+}
+
+func stringArgs(values []interface{}) []string {
+	strs := make([]string, 0, len(values))
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
@@ -0,0 +1,456 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/A-Victory/blog/auth"
+	"github.com/A-Victory/blog/metrics"
+	"github.com/A-Victory/blog/models"
+	blogv1 "github.com/A-Victory/blog/proto/blog/v1"
+	"github.com/A-Victory/blog/stream"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCPublicMethods are the gRPC methods that need no token.
+var GRPCPublicMethods = []string{blogv1.UserService_Login_FullMethodName}
+
+// RegisterGRPC registers the user, post and comment services on a gRPC
+// server. They share the store, validation and side effects of the HTTP
+// handlers; the server must authenticate calls with the auth interceptors.
+func (httpConfig *HttpHandler) RegisterGRPC(server *grpc.Server) {
+	blogv1.RegisterUserServiceServer(server, &userService{h: httpConfig})
+	blogv1.RegisterPostServiceServer(server, &postService{h: httpConfig})
+	blogv1.RegisterCommentServiceServer(server, &commentService{h: httpConfig})
+}
+
+type userService struct {
+	blogv1.UnimplementedUserServiceServer
+	h *HttpHandler
+}
+
+type postService struct {
+	blogv1.UnimplementedPostServiceServer
+	h *HttpHandler
+}
+
+type commentService struct {
+	blogv1.UnimplementedCommentServiceServer
+	h *HttpHandler
+}
+
+// grpcError converts an error of the content operations to a gRPC status.
+func grpcError(err error) error {
+	code := codes.Internal
+	switch errorStatus(err) {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusPreconditionFailed:
+		code = codes.Aborted
+	case http.StatusPreconditionRequired:
+		code = codes.FailedPrecondition
+	case http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	}
+	return status.Error(code, err.Error())
+}
+
+// viewer loads the user the interceptors authenticated.
+func (httpConfig *HttpHandler) viewer(ctx context.Context) (models.User, error) {
+	user, err := httpConfig.contextUser(ctx)
+	if err != nil {
+		return models.User{}, status.Error(codes.Internal, "failed to retrieve user's details: "+err.Error())
+	}
+	return user, nil
+}
+
+func (s *userService) Login(ctx context.Context, req *blogv1.LoginRequest) (*blogv1.LoginResponse, error) {
+	// an unknown email is a failed login like a wrong password
+	user, err := s.h.db.WithContext(ctx).GetUser("email", req.GetEmail())
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Error(codes.Internal, "database connection error: "+err.Error())
+	}
+	valid := err == nil && comparePassword(ctx, req.GetPassword(), user.Password)
+	metrics.Login(metrics.LoginPassword, valid)
+	if !valid {
+		return nil, status.Error(codes.Unauthenticated, "incorrect email or password")
+	}
+
+	token, err := auth.GenerateJWT(user.ID, user.Username)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to generate token: "+err.Error())
+	}
+
+	profile, err := s.h.profile(ctx, user.Username)
+	if err != nil {
+		return nil, grpcError(databaseError(err))
+	}
+
+	return &blogv1.LoginResponse{Token: token, User: userMessage(profile)}, nil
+}
+
+func (s *userService) GetMe(ctx context.Context, req *blogv1.GetMeRequest) (*blogv1.User, error) {
+	viewer, err := s.h.viewer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.getUser(ctx, viewer.Username)
+}
+
+func (s *userService) GetUser(ctx context.Context, req *blogv1.GetUserRequest) (*blogv1.User, error) {
+	return s.getUser(ctx, req.GetUsername())
+}
+
+func (s *userService) getUser(ctx context.Context, username string) (*blogv1.User, error) {
+	profile, err := s.h.profile(ctx, username)
+	if err != nil {
+		return nil, grpcError(databaseError(err))
+	}
+	if profile.ID == 0 {
+		return nil, status.Errorf(codes.NotFound, "no user found with username: %s", username)
+	}
+	return userMessage(profile), nil
+}
+
+func (s *userService) Follow(ctx context.Context, req *blogv1.FollowRequest) (*blogv1.User, error) {
+	return s.setFollow(ctx, req.GetUsername(), true)
+}
+
+func (s *userService) Unfollow(ctx context.Context, req *blogv1.FollowRequest) (*blogv1.User, error) {
+	return s.setFollow(ctx, req.GetUsername(), false)
+}
+
+func (s *userService) setFollow(ctx context.Context, username string, follow bool) (*blogv1.User, error) {
+	viewer, err := s.h.viewer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := s.h.setFollow(ctx, viewer, username, follow)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return userMessage(profile), nil
+}
+
+func (s *postService) ListPosts(ctx context.Context, req *blogv1.ListPostsRequest) (*blogv1.ListPostsResponse, error) {
+	viewer, err := s.h.viewer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := pageRequest(req.GetPage())
+	if err != nil {
+		return nil, err
+	}
+
+	filter := models.PostFilter{
+		Search:   req.GetSearch(),
+		Author:   strings.TrimSpace(req.GetAuthor()),
+		Status:   strings.ToLower(req.GetStatus()),
+		ViewerID: viewer.ID,
+	}
+	if len(req.GetTags()) > 0 {
+		filter.Tags = models.NormalizeTags(req.GetTags())
+	}
+	if err := s.h.va.Validate(filter); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	posts, page, err := s.h.db.WithContext(ctx).GetPosts(opts, filter)
+	if err != nil {
+		return nil, grpcError(listQueryError(err))
+	}
+
+	resp := &blogv1.ListPostsResponse{Posts: make([]*blogv1.Post, len(posts)), Page: pageMessage(page)}
+	for i, post := range posts {
+		resp.Posts[i] = postMessage(post)
+	}
+	return resp, nil
+}
+
+func (s *postService) GetPost(ctx context.Context, req *blogv1.GetPostRequest) (*blogv1.Post, error) {
+	viewer, err := s.h.viewer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	post, err := s.h.readablePost(ctx, viewer, int(req.GetId()))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return postMessage(post), nil
+}
+
+func (s *postService) CreatePost(ctx context.Context, req *blogv1.CreatePostRequest) (*blogv1.Post, error) {
+	viewer, err := s.h.viewer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := s.h.createPost(ctx, viewer, models.Post{
+		Title:   req.GetTitle(),
+		Content: req.GetContent(),
+		Status:  req.GetStatus(),
+		Tags:    req.GetTags(),
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return postMessage(created), nil
+}
+
+func (s *postService) UpdatePost(ctx context.Context, req *blogv1.UpdatePostRequest) (*blogv1.Post, error) {
+	viewer, err := s.h.viewer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := s.h.updatePost(ctx, viewer, int(req.GetId()), versionField(req.GetVersion()), func(post *models.Post) {
+		if req.Title != nil {
+			post.Title = req.GetTitle()
+		}
+		if req.Content != nil {
+			post.Content = req.GetContent()
+		}
+		if req.Status != nil {
+			post.Status = req.GetStatus()
+		}
+		if req.Tags != nil {
+			post.Tags = append([]string{}, req.GetTags().GetValues()...)
+		}
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return postMessage(updated), nil
+}
+
+func (s *postService) DeletePost(ctx context.Context, req *blogv1.DeletePostRequest) (*blogv1.DeletePostResponse, error) {
+	viewer, err := s.h.viewer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.h.deletePost(ctx, viewer, int(req.GetId()), versionField(req.GetVersion())); err != nil {
+		return nil, grpcError(err)
+	}
+	return &blogv1.DeletePostResponse{}, nil
+}
+
+func (s *commentService) ListComments(ctx context.Context, req *blogv1.ListCommentsRequest) (*blogv1.ListCommentsResponse, error) {
+	viewer, err := s.h.viewer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := pageRequest(req.GetPage())
+	if err != nil {
+		return nil, err
+	}
+
+	postID := int(req.GetPostId())
+	if _, err := s.h.readablePost(ctx, viewer, postID); err != nil {
+		return nil, grpcError(err)
+	}
+
+	comments, page, err := s.h.db.WithContext(ctx).GetComments(postID, opts)
+	if err != nil {
+		return nil, grpcError(listQueryError(err))
+	}
+
+	resp := &blogv1.ListCommentsResponse{Comments: make([]*blogv1.Comment, len(comments)), Page: pageMessage(page)}
+	for i, comment := range comments {
+		resp.Comments[i] = commentMessage(comment)
+	}
+	return resp, nil
+}
+
+func (s *commentService) GetComment(ctx context.Context, req *blogv1.GetCommentRequest) (*blogv1.Comment, error) {
+	viewer, err := s.h.viewer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	comment, err := s.h.readableComment(ctx, viewer, int(req.GetId()))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return commentMessage(comment), nil
+}
+
+func (s *commentService) AddComment(ctx context.Context, req *blogv1.AddCommentRequest) (*blogv1.Comment, error) {
+	viewer, err := s.h.viewer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := s.h.addComment(ctx, viewer, int(req.GetPostId()), req.GetContent())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return commentMessage(created), nil
+}
+
+func (s *commentService) EditComment(ctx context.Context, req *blogv1.EditCommentRequest) (*blogv1.Comment, error) {
+	viewer, err := s.h.viewer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := s.h.editComment(ctx, viewer, int(req.GetId()), req.GetContent(), versionField(req.GetVersion()))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return commentMessage(updated), nil
+}
+
+func (s *commentService) DeleteComment(ctx context.Context, req *blogv1.DeleteCommentRequest) (*blogv1.DeleteCommentResponse, error) {
+	viewer, err := s.h.viewer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.h.deleteComment(ctx, viewer, int(req.GetId()), versionField(req.GetVersion())); err != nil {
+		return nil, grpcError(err)
+	}
+	return &blogv1.DeleteCommentResponse{}, nil
+}
+
+// WatchComments streams the comment events of a post from the same hub as
+// the Server-Sent Events stream, starting with the events missed since
+// last_event_id.
+func (s *commentService) WatchComments(req *blogv1.WatchCommentsRequest, server blogv1.CommentService_WatchCommentsServer) error {
+	ctx := server.Context()
+
+	viewer, err := s.h.viewer(ctx)
+	if err != nil {
+		return err
+	}
+	if s.h.stream == nil {
+		return status.Error(codes.Unavailable, "live updates are not available")
+	}
+
+	postID := int(req.GetPostId())
+	if _, err := s.h.readablePost(ctx, viewer, postID); err != nil {
+		return grpcError(err)
+	}
+
+	sub, backlog := s.h.stream.Subscribe(stream.CommentTopic(postID), req.GetLastEventId())
+	defer sub.Close()
+
+	for _, event := range backlog {
+		if err := sendCommentEvent(server, event); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-sub.Events():
+			if !ok {
+				return status.Error(codes.Unavailable, "the stream ended, reconnect with the last event id to resume")
+			}
+			if err := sendCommentEvent(server, event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func sendCommentEvent(server blogv1.CommentService_WatchCommentsServer, event stream.Event) error {
+	var comment models.Comment
+	if err := json.Unmarshal(event.Data, &comment); err != nil {
+		return status.Error(codes.Internal, "invalid comment event: "+err.Error())
+	}
+	return server.Send(&blogv1.CommentEvent{Id: event.ID, Type: event.Type, Comment: commentMessage(comment)})
+}
+
+// pageRequest reads a PageRequest the way listOptions reads the query
+// parameters of the list endpoints.
+func pageRequest(page *blogv1.PageRequest) (models.ListOptions, error) {
+	limit := int(page.GetLimit())
+	if limit < 1 {
+		limit = 10
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	opts := models.ListOptions{Sort: strings.ToLower(page.GetSort()), Limit: limit}
+	if page.GetCursor() != "" {
+		cursor, err := models.ParseCursor(page.GetCursor())
+		if err != nil {
+			return models.ListOptions{}, status.Error(codes.InvalidArgument, err.Error())
+		}
+		opts.Cursor = &cursor
+	}
+	return opts, nil
+}
+
+// versionField returns the version of a write, where 0 means none was sent.
+func versionField(version int64) *int {
+	if version == 0 {
+		return nil
+	}
+	v := int(version)
+	return &v
+}
+
+func userMessage(profile models.Profile) *blogv1.User {
+	return &blogv1.User{
+		Id:          int64(profile.ID),
+		Username:    profile.Username,
+		DisplayName: profile.DisplayName,
+		Bio:         profile.Bio,
+		Website:     profile.Website,
+		SocialLinks: profile.SocialLinks,
+		AvatarUrl:   profile.AvatarURL,
+		Followers:   int32(profile.Followers),
+		Following:   int32(profile.Following),
+	}
+}
+
+func postMessage(post models.Post) *blogv1.Post {
+	return &blogv1.Post{
+		Id:        int64(post.ID),
+		Title:     post.Title,
+		Content:   post.Content,
+		AuthorId:  int64(post.AuthorID),
+		Status:    post.Status,
+		Tags:      post.Tags,
+		CreatedAt: post.CreatedAt,
+		UpdatedAt: post.UpdatedAt,
+		Version:   int64(post.Version),
+	}
+}
+
+func commentMessage(comment models.Comment) *blogv1.Comment {
+	return &blogv1.Comment{
+		Id:        int64(comment.ID),
+		PostId:    int64(comment.Postid),
+		AuthorId:  int64(comment.AuthorID),
+		Content:   comment.Content,
+		CreatedAt: comment.CreatedAt,
+		UpdatedAt: comment.UpdatedAt,
+		Version:   int64(comment.Version),
+	}
+}
+
+func pageMessage(page models.Page) *blogv1.Page {
+	return &blogv1.Page{Total: int32(page.Total), Sort: page.Sort, NextCursor: page.NextCursor}
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/A-Victory/blog/models"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// replayedHeaders are the response headers stored with an idempotency key.
+// Content-Type is always JSON and the rest describe the single request.
+// Authorization, which carries refreshed tokens, is left out so that tokens
+// are never stored.
+var replayedHeaders = []string{"ETag", "Link", "Location"}
+
+// Idempotent makes POST requests that carry an Idempotency-Key header safe
+// to retry. The first response for a user's key is stored for the
+// idempotency window and sent again for retries of the same request. A key
+// still in use by a running request gets a 409 and a key reused for a
+// different request a 422. Server errors are not stored, so those retries
+// run again. It must run after auth.Verify, so it only covers authenticated
+// routes: login and register are left out, as their responses carry
+// credentials that must not be stored, and a repeated registration is
+// refused anyway because the username is taken.
+func (httpConfig *HttpHandler) Idempotent(next http.Handler) http.Handler {
+	return httpConfig.idempotent(next, writeResponse)
+}
+
+// Idempotent is the /api/v2 counterpart of HttpHandler.Idempotent.
+func (v *V2) Idempotent(next http.Handler) http.Handler {
+	return v.h.idempotent(next, func(w http.ResponseWriter, response customResponse) {
+		msg, ok := response.Data["msg"].(string)
+		if !ok {
+			msg, _ = response.Data["message"].(string)
+		}
+		V2Error(w, response.Status, msg)
+	})
+}
+
+// writeResponse writes a customResponse with its status.
+func writeResponse(w http.ResponseWriter, response customResponse) {
+	w.WriteHeader(response.Status)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) idempotent(next http.Handler, fail func(w http.ResponseWriter, response customResponse)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if r.Method != "POST" || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			fail(w, customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"msg": "the Idempotency-Key header must be at most 255 characters"}})
+			return
+		}
+
+		user, err := httpConfig.getUser(r)
+		if err != nil {
+			fail(w, customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to retrieve user's details: " + err.Error()}})
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			fail(w, customResponse{Status: http.StatusBadRequest, Message: "error", Data: map[string]interface{}{"message": err.Error()}})
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		record := models.IdempotencyRecord{
+			UserID:      user.ID,
+			Key:         key,
+			Fingerprint: requestFingerprint(r, body),
+			ExpiresAt:   time.Now().UTC().Add(httpConfig.idempotencyWindow).Format("2006-01-02 15:04:05"),
+		}
+
+		stored, reserved, err := httpConfig.db.WithContext(r.Context()).ReserveIdempotencyKey(record)
+		if err != nil {
+			fail(w, customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}})
+			return
+		}
+
+		if !reserved {
+			switch {
+			case stored.Fingerprint != record.Fingerprint:
+				fail(w, customResponse{Status: http.StatusUnprocessableEntity, Message: "invalid request", Data: map[string]interface{}{"msg": "the idempotency key was already used for a different request"}})
+			case stored.Status == 0:
+				fail(w, customResponse{Status: http.StatusConflict, Message: "request in progress", Data: map[string]interface{}{"msg": "a request with this idempotency key is still being handled"}})
+			default:
+				for name, values := range stored.Headers {
+					w.Header()[name] = values
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(stored.Status)
+				w.Write(stored.Body)
+			}
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w}
+		completed := false
+		// a handler that panics leaves the key free for the retry
+		defer func() {
+			if !completed {
+				if err := httpConfig.db.WithContext(r.Context()).ReleaseIdempotencyKey(user.ID, key); err != nil {
+					httpConfig.logger.ErrorContext(r.Context(), "failed to release idempotency key", "error", err)
+				}
+			}
+		}()
+
+		next.ServeHTTP(recorder, r)
+
+		if recorder.status == 0 || recorder.status >= http.StatusInternalServerError {
+			return
+		}
+
+		record.Status = recorder.status
+		record.Body = recorder.body.Bytes()
+		record.Headers = map[string][]string{}
+		for _, name := range replayedHeaders {
+			if values := w.Header().Values(name); len(values) > 0 {
+				record.Headers[name] = values
+			}
+		}
+		if err := httpConfig.db.WithContext(r.Context()).CompleteIdempotencyKey(record); err != nil {
+			httpConfig.logger.ErrorContext(r.Context(), "failed to store idempotent response", "error", err)
+			return
+		}
+		completed = true
+	})
+}
+
+// requestFingerprint hashes what makes a request the same request: its
+// method, URL and body.
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	io.WriteString(hash, r.Method+" "+r.URL.RequestURI()+"\n")
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder passes a response through while keeping a copy of its
+// status and body.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
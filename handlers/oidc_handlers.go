@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/A-Victory/blog/auth"
+	"github.com/A-Victory/blog/metrics"
+	"github.com/A-Victory/blog/models"
+	"github.com/go-chi/chi/v5"
+)
+
+var usernameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// oidcModeCookie carries the session mode requested on login through the
+// round trip to the identity provider.
+const oidcModeCookie = "oidc_mode"
+
+// oidcCookiePath scopes the login cookies to every API version, as the
+// callback may be served under /api/v1 as well as the unversioned /api.
+const oidcCookiePath = "/api"
+
+func (httpConfig *HttpHandler) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+
+	provider, ok := httpConfig.oidc[chi.URLParam(r, "provider")]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		response := customResponse{Status: http.StatusNotFound, Message: "provider not found", Data: map[string]interface{}{"msg": fmt.Sprintf("no identity provider named %s", chi.URLParam(r, "provider"))}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	url, state, err := provider.AuthCodeURL()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to start login: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.OIDCStateCookie,
+		Value:    state,
+		Path:     oidcCookiePath,
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcModeCookie,
+		Value:    auth.SessionMode(r),
+		Path:     oidcCookiePath,
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+func (httpConfig *HttpHandler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+
+	provider, ok := httpConfig.oidc[chi.URLParam(r, "provider")]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		response := customResponse{Status: http.StatusNotFound, Message: "provider not found", Data: map[string]interface{}{"msg": fmt.Sprintf("no identity provider named %s", chi.URLParam(r, "provider"))}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	query := r.URL.Query()
+	if errCode := query.Get("error"); errCode != "" {
+		metrics.Login(metrics.LoginOIDC, false)
+		w.WriteHeader(http.StatusUnauthorized)
+		response := customResponse{Status: http.StatusUnauthorized, Message: "error", Data: map[string]interface{}{"message": fmt.Sprintf("identity provider returned %s: %s", errCode, query.Get("error_description"))}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	cookie, err := r.Cookie(auth.OIDCStateCookie)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"msg": "missing login state, restart the login"}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: auth.OIDCStateCookie, Path: oidcCookiePath, MaxAge: -1})
+
+	identity, err := provider.Exchange(r.Context(), query.Get("code"), query.Get("state"), cookie.Value)
+	if err != nil {
+		metrics.Login(metrics.LoginOIDC, false)
+		w.WriteHeader(http.StatusUnauthorized)
+		response := customResponse{Status: http.StatusUnauthorized, Message: "error", Data: map[string]interface{}{"message": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	user, err := httpConfig.resolveIdentity(r.Context(), provider, identity)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if user == (models.User{}) {
+		metrics.Login(metrics.LoginOIDC, false)
+		w.WriteHeader(http.StatusForbidden)
+		response := customResponse{Status: http.StatusForbidden, Message: "account not linked", Data: map[string]interface{}{"msg": "no account is associated with this identity, a verified email matching an existing account is required"}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	mode := auth.ModeToken
+	if modeCookie, err := r.Cookie(oidcModeCookie); err == nil {
+		mode = modeCookie.Value
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcModeCookie, Path: oidcCookiePath, MaxAge: -1})
+
+	metrics.Login(metrics.LoginOIDC, true)
+	httpConfig.issueSession(w, mode, user)
+}
+
+// resolveIdentity finds the local user for an external identity. Existing
+// links win, then accounts with the same verified email are linked, and
+// finally a new account is provisioned if the provider allows it. An empty
+// user is returned when none of these apply.
+func (httpConfig *HttpHandler) resolveIdentity(ctx context.Context, provider *auth.OIDCProvider, identity auth.OIDCIdentity) (models.User, error) {
+
+	link, err := httpConfig.db.WithContext(ctx).GetIdentity(identity.Issuer, identity.Subject)
+	if err != nil {
+		return models.User{}, err
+	}
+	if link != (models.UserIdentity{}) {
+		return httpConfig.db.WithContext(ctx).GetUser("id", link.UserID)
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return models.User{}, nil
+	}
+
+	user, err := httpConfig.db.WithContext(ctx).GetUser("email", identity.Email)
+	if err != nil && err != sql.ErrNoRows {
+		return models.User{}, err
+	}
+
+	if err == sql.ErrNoRows {
+		if !provider.AutoProvision {
+			return models.User{}, nil
+		}
+		user, err = httpConfig.provisionUser(ctx, identity)
+		if err != nil {
+			return models.User{}, err
+		}
+	}
+
+	_, err = httpConfig.db.WithContext(ctx).LinkIdentity(models.UserIdentity{
+		UserID:  user.ID,
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+		Email:   identity.Email,
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+// provisionUser creates a local account for an identity. The account gets an
+// unusable random password so it can only sign in through the provider.
+func (httpConfig *HttpHandler) provisionUser(ctx context.Context, identity auth.OIDCIdentity) (models.User, error) {
+
+	base := identity.PreferredUsername
+	if base == "" {
+		base = strings.Split(identity.Email, "@")[0]
+	}
+	base = usernameChars.ReplaceAllString(base, "")
+	if base == "" {
+		base = "user"
+	}
+
+	username := base
+	for i := 1; ; i++ {
+		if reservedUsernames[strings.ToLower(username)] {
+			username = fmt.Sprintf("%s%d", base, i)
+			continue
+		}
+		_, err := httpConfig.db.WithContext(ctx).GetUser("username", username)
+		if err == sql.ErrNoRows {
+			break
+		}
+		if err != nil {
+			return models.User{}, err
+		}
+		username = fmt.Sprintf("%s%d", base, i)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return models.User{}, err
+	}
+	hashedpass, err := hashpassword(ctx, hex.EncodeToString(secret))
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user := models.User{
+		Username: username,
+		Email:    identity.Email,
+		Password: hashedpass,
+	}
+
+	id, err := httpConfig.db.WithContext(ctx).SaveUser(user)
+	if err != nil {
+		return models.User{}, err
+	}
+	user.ID = id
+
+	return user, nil
+}
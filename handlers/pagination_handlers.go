@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/models"
+)
+
+const maxListLimit = 100
+
+// listOptions reads the sort, cursor and limit query parameters shared by the
+// list endpoints. The page parameter is still accepted for older clients, but
+// it is ignored once a cursor is given.
+func listOptions(r *http.Request) (models.ListOptions, error) {
+	query := r.URL.Query()
+
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit < 1 {
+		limit = 10
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	opts := models.ListOptions{Sort: strings.ToLower(query.Get("sort")), Limit: limit}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := models.ParseCursor(value)
+		if err != nil {
+			return models.ListOptions{}, err
+		}
+		opts.Cursor = &cursor
+		return opts, nil
+	}
+
+	page, _ := strconv.Atoi(query.Get("page"))
+	if page > 1 {
+		opts.Offset = (page - 1) * limit
+	}
+
+	return opts, nil
+}
+
+// listRequest reads the list options, writing an error response and returning
+// false when they are invalid.
+func listRequest(w http.ResponseWriter, r *http.Request) (models.ListOptions, bool) {
+	opts, err := listOptions(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"msg": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return models.ListOptions{}, false
+	}
+	return opts, true
+}
+
+// listError writes the response for a list query that failed. Sort orders
+// and cursors are checked by the query, so those errors are the client's.
+func listError(w http.ResponseWriter, err error) {
+	if errors.Is(err, conn.ErrInvalidSort) || errors.Is(err, conn.ErrInvalidCursor) {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"msg": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	w.WriteHeader(http.StatusInternalServerError)
+	response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+	json.NewEncoder(w).Encode(response)
+}
+
+// setNextLink adds a Link header pointing at the next page, made from the
+// request URL with the cursor replaced. It must be called before the status
+// is written.
+func setNextLink(w http.ResponseWriter, r *http.Request, nextCursor string) {
+	if nextCursor == "" {
+		return
+	}
+
+	next := *r.URL
+	query := next.Query()
+	query.Set("cursor", nextCursor)
+	query.Del("page")
+	next.RawQuery = query.Encode()
+
+	w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/A-Victory/blog/mergepatch"
+)
+
+// decodeUpdate reads the new state of a resource into dst. A PUT body is the
+// whole replacement; a PATCH body is a JSON merge patch applied to current,
+// so members it leaves out keep their value and null clears them. It writes
+// an error response and returns false when the body cannot be used.
+func decodeUpdate(w http.ResponseWriter, r *http.Request, current, dst interface{}) bool {
+	if r.Method != "PATCH" {
+		if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			response := customResponse{Status: http.StatusBadRequest, Message: "error", Data: map[string]interface{}{"message": err.Error()}}
+			json.NewEncoder(w).Encode(response)
+			return false
+		}
+		return true
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != mergepatch.MediaType {
+		w.Header().Set("Accept-Patch", mergepatch.MediaType)
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		response := customResponse{Status: http.StatusUnsupportedMediaType, Message: "unsupported media type", Data: map[string]interface{}{"msg": "PATCH requests must be sent as " + mergepatch.MediaType}}
+		json.NewEncoder(w).Encode(response)
+		return false
+	}
+
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "error", Data: map[string]interface{}{"message": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return false
+	}
+
+	doc, err := json.Marshal(current)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to encode the current state: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return false
+	}
+
+	merged, err := mergepatch.Apply(doc, patch)
+	if err == nil {
+		err = json.Unmarshal(merged, dst)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "error", Data: map[string]interface{}{"message": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return false
+	}
+	return true
+}
@@ -3,9 +3,10 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/A-Victory/blog/models"
 	"github.com/go-chi/chi/v5"
@@ -32,24 +33,20 @@ func (httpConfig *HttpHandler) Post(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		newPost.AuthorID = user.ID
-
-		id, err := httpConfig.db.CreatePost(newPost)
+		// save the post to the database and return a successful response
+		created, err := httpConfig.createPost(r.Context(), user, newPost)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
-			json.NewEncoder(w).Encode(response)
+			v1Fail(w, err)
 			return
 		}
 
 		w.WriteHeader(http.StatusOK)
-		response := customResponse{Status: http.StatusOK, Message: "successfully created post", Data: map[string]interface{}{"post_id": id}}
+		response := customResponse{Status: http.StatusOK, Message: "successfully created post", Data: map[string]interface{}{"post_id": created.ID}}
 		json.NewEncoder(w).Encode(response)
-
-		// save the post to the database and return a successful response
 	}
 
-	if r.Method == "PUT" {
+	// PUT replaces the post and PATCH merges a patch into it
+	if r.Method == "PUT" || r.Method == "PATCH" {
 		id := chi.URLParam(r, "id")
 		if id != "" {
 
@@ -60,55 +57,38 @@ func (httpConfig *HttpHandler) Post(w http.ResponseWriter, r *http.Request) {
 				json.NewEncoder(w).Encode(response)
 				return
 			}
-			log.Println(postID)
 
-			postToUpdate := models.Post{}
-
-			if err := json.NewDecoder(r.Body).Decode(&postToUpdate); err != nil {
-				w.WriteHeader(http.StatusBadRequest)
-				response := customResponse{Status: http.StatusBadRequest, Message: "error", Data: map[string]interface{}{"message": err.Error()}}
-				json.NewEncoder(w).Encode(response)
-			}
-
-			post, err := httpConfig.db.GetPostByID(postID)
+			// a patch is merged into the stored post
+			post, err := httpConfig.ownPost(r.Context(), user, postID)
 			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
-				json.NewEncoder(w).Encode(response)
-				return
-			}
-			if post == (models.Post{}) {
-				w.WriteHeader(http.StatusNotFound)
-				response := customResponse{Status: http.StatusNotFound, Message: "post not found", Data: map[string]interface{}{"msg": fmt.Sprintf("no post found with id: %d", postID)}}
-				json.NewEncoder(w).Encode(response)
+				v1Fail(w, err)
 				return
 			}
 
-			if post.AuthorID != user.ID {
-				w.WriteHeader(http.StatusBadRequest)
-				response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"msg": fmt.Sprintf("not the author of post with id: %d", postID)}}
-				json.NewEncoder(w).Encode(response)
+			postToUpdate := models.Post{}
+			if !decodeUpdate(w, r, post, &postToUpdate) {
 				return
 			}
 
-			postToUpdate.AuthorID = post.AuthorID
-			postToUpdate.ID = postID
-
-			id, err := httpConfig.db.UpdatePost(postToUpdate)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
-				json.NewEncoder(w).Encode(response)
+			version, ok := httpConfig.ifMatch(w, r, post.Version)
+			if !ok {
 				return
 			}
 
-			if id == 0 {
-				w.WriteHeader(http.StatusBadRequest)
-				response := customResponse{Status: http.StatusBadRequest, Message: "database error", Data: map[string]interface{}{"msg": fmt.Sprintf("failed to update post with id: %d", post.ID)}}
-				json.NewEncoder(w).Encode(response)
+			// the result is the whole post, so missing fields take their
+			// defaults rather than keeping the stored value
+			updated, err := httpConfig.updatePost(r.Context(), user, postID, v1Version(version), func(post *models.Post) {
+				post.Title = postToUpdate.Title
+				post.Content = postToUpdate.Content
+				post.Status = postToUpdate.Status
+				post.Tags = postToUpdate.Tags
+			})
+			if err != nil {
+				v1Fail(w, err)
 				return
 			}
 
+			w.Header().Set("ETag", etag(updated.Version))
 			w.WriteHeader(http.StatusOK)
 			response := customResponse{Status: http.StatusOK, Message: "successfully updated post", Data: map[string]interface{}{"post_id": postID}}
 			json.NewEncoder(w).Encode(response)
@@ -118,8 +98,6 @@ func (httpConfig *HttpHandler) Post(w http.ResponseWriter, r *http.Request) {
 			json.NewEncoder(w).Encode(response)
 			return
 		}
-
-		// update the post in the database after which you return the id of the post updated
 	}
 
 	if r.Method == "GET" {
@@ -135,17 +113,13 @@ func (httpConfig *HttpHandler) Post(w http.ResponseWriter, r *http.Request) {
 				json.NewEncoder(w).Encode(response)
 				return
 			}
-			post, err := httpConfig.db.GetPostByID(postID)
+			post, err := httpConfig.readablePost(r.Context(), user, postID)
 			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
-				json.NewEncoder(w).Encode(response)
+				v1Fail(w, err)
 				return
 			}
-			if post == (models.Post{}) {
-				w.WriteHeader(http.StatusNotFound)
-				response := customResponse{Status: http.StatusNotFound, Message: "post not found", Data: map[string]interface{}{"msg": fmt.Sprintf("no post found with id %d", postID)}}
-				json.NewEncoder(w).Encode(response)
+
+			if notModified(w, r, post.Version) {
 				return
 			}
 
@@ -154,32 +128,32 @@ func (httpConfig *HttpHandler) Post(w http.ResponseWriter, r *http.Request) {
 			json.NewEncoder(w).Encode(response)
 
 		} else {
-			query := r.URL.Query()
+			opts, ok := listRequest(w, r)
+			if !ok {
+				return
+			}
 
-			// Get pagination parameters
-			page, _ := strconv.Atoi(query.Get("page"))
-			if page < 1 {
-				page = 1
+			filter, err := postFilter(r, user.ID)
+			if err == nil {
+				err = httpConfig.va.Validate(filter)
 			}
-			limit, _ := strconv.Atoi(query.Get("limit"))
-			if limit < 1 {
-				limit = 10
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"msg": err.Error()}}
+				json.NewEncoder(w).Encode(response)
+				return
 			}
-			offset := (page - 1) * limit
 
-			// Get search parameter
-			search := query.Get("search")
-			// return all the posts taking into account the pagination and search parameters
-			posts, err := httpConfig.db.GetPosts(&limit, &offset, &search)
+			// return the posts taking into account the pagination, sort and filter parameters
+			posts, page, err := httpConfig.db.WithContext(r.Context()).GetPosts(opts, filter)
 			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
-				json.NewEncoder(w).Encode(response)
+				listError(w, err)
 				return
 			}
 
+			setNextLink(w, r, page.NextCursor)
 			w.WriteHeader(http.StatusOK)
-			response := customResponse{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"posts": posts}}
+			response := customResponse{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"posts": posts, "page": page}}
 			json.NewEncoder(w).Encode(response)
 		}
 	}
@@ -189,7 +163,6 @@ func (httpConfig *HttpHandler) Post(w http.ResponseWriter, r *http.Request) {
 		id := chi.URLParam(r, "id")
 
 		if id != "" {
-			// return an error specificing that the user needs to include the id of the post
 			postID, err := strconv.Atoi(id)
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
@@ -198,44 +171,24 @@ func (httpConfig *HttpHandler) Post(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-			post, err := httpConfig.db.GetPostByID(postID)
+			post, err := httpConfig.ownPost(r.Context(), user, postID)
 			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
-				json.NewEncoder(w).Encode(response)
-				return
-			}
-			if post == (models.Post{}) {
-				w.WriteHeader(http.StatusNotFound)
-				response := customResponse{Status: http.StatusNotFound, Message: "post not found", Data: map[string]interface{}{"msg": fmt.Sprintf("no post found with id %d", postID)}}
-				json.NewEncoder(w).Encode(response)
+				v1Fail(w, err)
 				return
 			}
 
-			if post.AuthorID != user.ID {
-				w.WriteHeader(http.StatusBadRequest)
-				response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"msg": fmt.Sprintf("not the author of post with id: %d", postID)}}
-				json.NewEncoder(w).Encode(response)
+			version, ok := httpConfig.ifMatch(w, r, post.Version)
+			if !ok {
 				return
 			}
 
-			id, err := httpConfig.db.DeletePost(postID)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
-				json.NewEncoder(w).Encode(response)
-				return
-			}
-
-			if id == 0 {
-				w.WriteHeader(http.StatusBadRequest)
-				response := customResponse{Status: http.StatusBadRequest, Message: "database error", Data: map[string]interface{}{"msg": fmt.Sprintf("failed to update post with id: %d", post.ID)}}
-				json.NewEncoder(w).Encode(response)
+			if err := httpConfig.deletePost(r.Context(), user, postID, v1Version(version)); err != nil {
+				v1Fail(w, err)
 				return
 			}
 
 			w.WriteHeader(http.StatusOK)
-			response := customResponse{Status: http.StatusOK, Message: "successfully deleted post", Data: map[string]interface{}{"post_id": id}}
+			response := customResponse{Status: http.StatusOK, Message: "successfully deleted post", Data: map[string]interface{}{"post_id": postID}}
 			json.NewEncoder(w).Encode(response)
 
 		} else {
@@ -247,3 +200,81 @@ func (httpConfig *HttpHandler) Post(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 }
+
+// filterTimeLayouts are the accepted formats of the date filters.
+var filterTimeLayouts = []string{"2006-01-02", "2006-01-02T15:04:05"}
+
+// postFilter reads the filter parameters of the posts listing:
+//
+//	search=text                        title or content contains text
+//	author=username                    written by the user
+//	createdAfter=date, createdBefore=date
+//	updatedAfter=date, updatedBefore=date
+//	                                   date is YYYY-MM-DD or YYYY-MM-DDTHH:MM:SS;
+//	                                   After is inclusive, Before exclusive
+//	tag=go,web                         tagged with any of the tags
+//	status=published|draft|all         drafts are only your own
+//	hasComments=true|false
+//
+// Every parameter is optional and they are combined with AND.
+func postFilter(r *http.Request, viewerID int) (models.PostFilter, error) {
+	query := r.URL.Query()
+
+	filter := models.PostFilter{
+		Search:   query.Get("search"),
+		Author:   strings.TrimSpace(query.Get("author")),
+		Status:   strings.ToLower(query.Get("status")),
+		ViewerID: viewerID,
+	}
+
+	for _, bound := range []struct {
+		param string
+		value *string
+	}{
+		{"createdAfter", &filter.CreatedAfter},
+		{"createdBefore", &filter.CreatedBefore},
+		{"updatedAfter", &filter.UpdatedAfter},
+		{"updatedBefore", &filter.UpdatedBefore},
+	} {
+		value := query.Get(bound.param)
+		if value == "" {
+			continue
+		}
+		parsed, err := parseFilterTime(value)
+		if err != nil {
+			return models.PostFilter{}, fmt.Errorf("%s must be a date as YYYY-MM-DD or YYYY-MM-DDTHH:MM:SS", bound.param)
+		}
+		*bound.value = parsed.Format("2006-01-02 15:04:05")
+	}
+	if filter.CreatedAfter != "" && filter.CreatedBefore != "" && filter.CreatedAfter >= filter.CreatedBefore {
+		return models.PostFilter{}, fmt.Errorf("createdAfter must be before createdBefore")
+	}
+	if filter.UpdatedAfter != "" && filter.UpdatedBefore != "" && filter.UpdatedAfter >= filter.UpdatedBefore {
+		return models.PostFilter{}, fmt.Errorf("updatedAfter must be before updatedBefore")
+	}
+
+	if value := query.Get("tag"); value != "" {
+		filter.Tags = models.NormalizeTags(strings.Split(value, ","))
+	}
+
+	if value := query.Get("hasComments"); value != "" {
+		hasComments, err := strconv.ParseBool(value)
+		if err != nil {
+			return models.PostFilter{}, fmt.Errorf("hasComments must be true or false")
+		}
+		filter.HasComments = &hasComments
+	}
+
+	return filter, nil
+}
+
+func parseFilterTime(value string) (time.Time, error) {
+	var err error
+	for _, layout := range filterTimeLayouts {
+		var parsed time.Time
+		if parsed, err = time.Parse(layout, value); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, err
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/A-Victory/blog/avatar"
+	"github.com/A-Victory/blog/models"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	activityProfileUpdated = "profile_updated"
+	activityAvatarUpdated  = "avatar_updated"
+	activityAvatarRemoved  = "avatar_removed"
+)
+
+// reservedUsernames cannot be registered because they would collide with
+// routes under /api/users or with system accounts.
+var reservedUsernames = map[string]bool{
+	"profile":              true,
+	"activity":             true,
+	"exports":              true,
+	"login":                true,
+	"logout":               true,
+	"register":             true,
+	"email":                true,
+	"username":             true,
+	"password":             true,
+	"me":                   true,
+	models.DeletedUsername: true,
+}
+
+func (httpConfig *HttpHandler) PublicProfile(w http.ResponseWriter, r *http.Request) {
+
+	profile, ok := httpConfig.findProfile(w, r)
+	if !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "author's profile", Data: map[string]interface{}{"profile": profile}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) AuthorPosts(w http.ResponseWriter, r *http.Request) {
+
+	profile, ok := httpConfig.findProfile(w, r)
+	if !ok {
+		return
+	}
+
+	opts, ok := listRequest(w, r)
+	if !ok {
+		return
+	}
+
+	posts, page, err := httpConfig.db.WithContext(r.Context()).GetPublishedPostsByAuthor(profile.ID, opts)
+	if err != nil {
+		listError(w, err)
+		return
+	}
+
+	setNextLink(w, r, page.NextCursor)
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"author": profile, "posts": posts, "page": page}}
+	json.NewEncoder(w).Encode(response)
+}
+
+// Avatar serves the uploaded avatar, or a generated identicon when the user
+// has not uploaded one.
+func (httpConfig *HttpHandler) Avatar(w http.ResponseWriter, r *http.Request) {
+
+	profile, ok := httpConfig.findProfile(w, r)
+	if !ok {
+		return
+	}
+
+	image := models.Avatar{}
+	if profile.HasAvatar {
+		var err error
+		image, err = httpConfig.db.WithContext(r.Context()).GetAvatar(profile.ID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+	}
+
+	if len(image.Data) == 0 {
+		identicon, err := avatar.Identicon(profile.Username)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to render avatar: " + err.Error()}}
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		image = models.Avatar{ContentType: "image/png", Data: identicon}
+	}
+
+	w.Header().Set("Content-Type", image.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(image.Data)))
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	w.Write(image.Data)
+}
+
+// UpdateProfile replaces the editable profile fields on PUT and merges a
+// JSON merge patch into them on PATCH.
+func (httpConfig *HttpHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+
+	user, err := httpConfig.getUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to retrieve user's details: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	current, err := httpConfig.profile(r.Context(), user.Username)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	update := models.ProfileUpdate{}
+	editable := models.ProfileUpdate{DisplayName: current.DisplayName, Bio: current.Bio, Website: current.Website, SocialLinks: current.SocialLinks}
+	if !decodeUpdate(w, r, editable, &update) {
+		return
+	}
+
+	if err := httpConfig.va.Validate(update); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"message": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if _, err := httpConfig.db.WithContext(r.Context()).UpdateProfile(user.ID, update); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	httpConfig.recordActivity(r, user.ID, activityProfileUpdated, "")
+
+	profile, err := httpConfig.profile(r.Context(), user.Username)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "profile updated", Data: map[string]interface{}{"profile": profile}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
+
+	user, err := httpConfig.getUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to retrieve user's details: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, avatar.MaxUploadSize+1<<10)
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "error", Data: map[string]interface{}{"message": "expected a multipart form with an avatar file: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, avatar.MaxUploadSize+1))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "error", Data: map[string]interface{}{"message": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	contentType, err := avatar.Validate(data)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"message": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if err := httpConfig.db.WithContext(r.Context()).SaveAvatar(user.ID, models.Avatar{ContentType: contentType, Data: data}); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	httpConfig.recordActivity(r, user.ID, activityAvatarUpdated, contentType)
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "avatar updated", Data: map[string]interface{}{"avatarUrl": avatarURL(user.Username)}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) DeleteAvatar(w http.ResponseWriter, r *http.Request) {
+
+	user, err := httpConfig.getUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to retrieve user's details: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if _, err := httpConfig.db.WithContext(r.Context()).DeleteAvatar(user.ID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	httpConfig.recordActivity(r, user.ID, activityAvatarRemoved, "")
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "avatar removed", Data: map[string]interface{}{"avatarUrl": avatarURL(user.Username)}}
+	json.NewEncoder(w).Encode(response)
+}
+
+// findProfile loads the profile named in the URL, writing an error response
+// and returning false when there is none.
+func (httpConfig *HttpHandler) findProfile(w http.ResponseWriter, r *http.Request) (models.Profile, bool) {
+
+	username := chi.URLParam(r, "username")
+	if decoded, err := url.PathUnescape(username); err == nil {
+		username = decoded
+	}
+
+	profile, err := httpConfig.profile(r.Context(), username)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return models.Profile{}, false
+	}
+
+	if profile.ID == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		response := customResponse{Status: http.StatusNotFound, Message: "user not found", Data: map[string]interface{}{"msg": fmt.Sprintf("no user found with username: %s", username)}}
+		json.NewEncoder(w).Encode(response)
+		return models.Profile{}, false
+	}
+
+	return profile, true
+}
+
+func (httpConfig *HttpHandler) profile(ctx context.Context, username string) (models.Profile, error) {
+	profile, err := httpConfig.db.WithContext(ctx).GetProfile(username)
+	if err != nil {
+		return models.Profile{}, err
+	}
+	if profile.ID != 0 {
+		profile.AvatarURL = avatarURL(profile.Username)
+	}
+	return profile, nil
+}
+
+func avatarURL(username string) string {
+	return fmt.Sprintf("/api/users/%s/avatar", url.PathEscape(username))
+}
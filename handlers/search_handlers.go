@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/A-Victory/blog/models"
+	"github.com/A-Victory/blog/search"
+)
+
+const maxSearchLimit = 50
+
+// Search finds published posts and comments. See search.Parse for the query
+// syntax.
+func (httpConfig *HttpHandler) Search(w http.ResponseWriter, r *http.Request) {
+
+	query := r.URL.Query()
+
+	terms, err := search.Parse(query.Get("q"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"msg": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	var types []string
+	switch kind := strings.ToLower(query.Get("type")); kind {
+	case "", "all":
+	case "post", "posts":
+		types = []string{search.TypePost}
+	case "comment", "comments":
+		types = []string{search.TypeComment}
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"msg": "type must be posts, comments or all"}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	// Get pagination parameters
+	page, _ := strconv.Atoi(query.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit < 1 {
+		limit = 10
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+	offset := (page - 1) * limit
+
+	results, err := httpConfig.search.Search(r.Context(), search.Query{Terms: terms, Types: types, Limit: limit, Offset: offset})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "search failed: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"results": results}}
+	json.NewEncoder(w).Encode(response)
+}
+
+// reindexPost brings the search index up to date after a post changed. A
+// stale index only affects search results, so failures are logged rather
+// than failing the request.
+func (httpConfig *HttpHandler) reindexPost(ctx context.Context, postID int) {
+	post, err := httpConfig.db.WithContext(ctx).GetPostByID(postID)
+	if err == nil {
+		if post.ID == 0 {
+			err = httpConfig.search.RemovePost(postID)
+		} else {
+			err = httpConfig.search.IndexPost(post)
+		}
+	}
+	if err != nil {
+		httpConfig.logger.ErrorContext(ctx, "failed to index post", "post_id", postID, "error", err)
+	}
+}
+
+func (httpConfig *HttpHandler) reindexComment(ctx context.Context, commentID int) {
+	comment, err := httpConfig.db.WithContext(ctx).GetCommentByID(commentID)
+	if err == nil {
+		if comment == (models.Comment{}) {
+			err = httpConfig.search.RemoveComment(commentID)
+		} else {
+			err = httpConfig.search.IndexComment(comment)
+		}
+	}
+	if err != nil {
+		httpConfig.logger.ErrorContext(ctx, "failed to index comment", "comment_id", commentID, "error", err)
+	}
+}
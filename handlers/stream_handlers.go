@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/A-Victory/blog/models"
+	"github.com/A-Victory/blog/stream"
+	"github.com/go-chi/chi/v5"
+)
+
+const streamHeartbeat = 15 * time.Second
+
+// CommentStream pushes the comment events of a post as Server-Sent Events.
+// A client that reconnects with Last-Event-ID, or the lastEventId query
+// parameter for clients that cannot set headers, first receives the events
+// it missed.
+func (httpConfig *HttpHandler) CommentStream(w http.ResponseWriter, r *http.Request) {
+
+	user, err := httpConfig.getUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to retrieve user's details: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if httpConfig.stream == nil || !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		response := customResponse{Status: http.StatusServiceUnavailable, Message: "unavailable", Data: map[string]interface{}{"msg": "live updates are not available"}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	postID, err := strconv.Atoi(chi.URLParam(r, "postId"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"msg": "invalid post id"}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	post, err := httpConfig.db.WithContext(r.Context()).GetPostByID(postID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if post.ID == 0 || (post.Status == models.PostDraft && post.AuthorID != user.ID) {
+		w.WriteHeader(http.StatusNotFound)
+		response := customResponse{Status: http.StatusNotFound, Message: "post not found", Data: map[string]interface{}{"msg": fmt.Sprintf("no post found with id %d", postID)}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	last, _ := strconv.ParseInt(lastEventID, 10, 64)
+
+	sub, backlog := httpConfig.stream.Subscribe(stream.CommentTopic(postID), last)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// keeps proxies such as nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	// the stream outlives the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	w.WriteHeader(http.StatusOK)
+
+	io.WriteString(w, "retry: 3000\n\n")
+	for _, event := range backlog {
+		if err := stream.Write(w, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-sub.Events():
+			if !ok {
+				// the client fell behind or the server is shutting down; it
+				// reconnects and resumes
+				return
+			}
+			if err := stream.Write(w, event); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// publishComment pushes a comment event to the post's live stream.
+func (httpConfig *HttpHandler) publishComment(ctx context.Context, event string, comment models.Comment) {
+	if httpConfig.stream == nil {
+		return
+	}
+	if err := httpConfig.stream.Publish(context.WithoutCancel(ctx), stream.CommentTopic(comment.Postid), event, comment); err != nil {
+		httpConfig.logger.ErrorContext(ctx, "failed to publish comment event", "event", event, "comment_id", comment.ID, "error", err)
+	}
+}
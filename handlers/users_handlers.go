@@ -1,25 +1,78 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/A-Victory/blog/auth"
 	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/export"
+	"github.com/A-Victory/blog/mailer"
+	"github.com/A-Victory/blog/metrics"
 	"github.com/A-Victory/blog/models"
+	"github.com/A-Victory/blog/search"
+	"github.com/A-Victory/blog/stream"
+	"github.com/A-Victory/blog/webhook"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type HttpHandler struct {
-	db *conn.DB
-	va *auth.Validation
+	db                *conn.DB
+	va                *auth.Validation
+	oidc              map[string]*auth.OIDCProvider
+	mailer            mailer.Mailer
+	baseURL           string
+	deletionGrace     time.Duration
+	exports           *export.Worker
+	search            search.Searcher
+	webhooks          *webhook.Worker
+	allowHTTPWebhooks bool
+	stream            *stream.Hub
+	requireIfMatch    bool
+	// idempotencyWindow is how long the responses of POST requests sent
+	// with an Idempotency-Key are kept for retries.
+	idempotencyWindow time.Duration
+	logger            *slog.Logger
 }
 
 type Config struct {
-	Database  *conn.DB
-	Validator *auth.Validation
+	Database      *conn.DB
+	Validator     *auth.Validation
+	OIDCProviders []*auth.OIDCProvider
+	Mailer        mailer.Mailer
+	// BaseURL is the public address of the API, used in links sent by email.
+	BaseURL string
+	// DeletionGrace is how long a deleted account can still be restored.
+	DeletionGrace time.Duration
+	// Exports builds requested data exports in the background.
+	Exports *export.Worker
+	// Search answers search queries. It defaults to MySQL full-text search.
+	Search search.Searcher
+	// Webhooks delivers queued webhook deliveries in the background.
+	Webhooks *webhook.Worker
+	// AllowHTTPWebhooks accepts subscriptions to plain http URLs. Only https
+	// is accepted otherwise.
+	AllowHTTPWebhooks bool
+	// Stream pushes live comment events. Without it the comment stream is
+	// unavailable.
+	Stream *stream.Hub
+	// RequireIfMatch rejects updates and deletes of posts and comments that
+	// do not send an If-Match header. Without it the header is honored when
+	// present.
+	RequireIfMatch bool
+	// IdempotencyWindow is how long a response is replayed for retries
+	// with the same Idempotency-Key. It defaults to 24 hours.
+	IdempotencyWindow time.Duration
+	// Logger is the logger of the handlers. It defaults to slog.Default().
+	Logger *slog.Logger
 }
 
 type customResponse struct {
@@ -28,10 +81,72 @@ type customResponse struct {
 	Data    map[string]interface{} `json:"data"`
 }
 
+// V1Error writes a v1 error body, for the middlewares answering on behalf of
+// the handlers.
+func V1Error(w http.ResponseWriter, status int, msg string) {
+	w.WriteHeader(status)
+	response := customResponse{Status: status, Message: "error", Data: map[string]interface{}{"message": msg}}
+	json.NewEncoder(w).Encode(response)
+}
+
+// v1Fail writes the v1 error for an error of the content operations.
+func v1Fail(w http.ResponseWriter, err error) {
+	status := errorStatus(err)
+	message := strings.ToLower(http.StatusText(status))
+	switch status {
+	case http.StatusBadRequest:
+		message = "invalid request"
+	case http.StatusInternalServerError:
+		message = "server error"
+	}
+
+	w.WriteHeader(status)
+	response := customResponse{Status: status, Message: message, Data: map[string]interface{}{"msg": err.Error()}}
+	json.NewEncoder(w).Encode(response)
+}
+
 func NewHttpHandler(opt *Config) *HttpHandler {
+	providers := make(map[string]*auth.OIDCProvider, len(opt.OIDCProviders))
+	for _, provider := range opt.OIDCProviders {
+		providers[provider.Name] = provider
+	}
+
+	mail := opt.Mailer
+	if mail == nil {
+		mail = mailer.LogMailer{}
+	}
+	grace := opt.DeletionGrace
+	if grace == 0 {
+		grace = 14 * 24 * time.Hour
+	}
+	window := opt.IdempotencyWindow
+	if window == 0 {
+		window = 24 * time.Hour
+	}
+	logger := opt.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	searcher := opt.Search
+	if searcher == nil && opt.Database != nil {
+		searcher = search.NewMySQL(opt.Database.Conn.DB)
+	}
+
 	return &HttpHandler{
-		db: opt.Database,
-		va: opt.Validator,
+		db:                opt.Database,
+		va:                opt.Validator,
+		oidc:              providers,
+		mailer:            mail,
+		baseURL:           opt.BaseURL,
+		deletionGrace:     grace,
+		exports:           opt.Exports,
+		search:            searcher,
+		webhooks:          opt.Webhooks,
+		allowHTTPWebhooks: opt.AllowHTTPWebhooks,
+		stream:            opt.Stream,
+		requireIfMatch:    opt.RequireIfMatch,
+		idempotencyWindow: window,
+		logger:            logger,
 	}
 }
 
@@ -45,7 +160,7 @@ func (httpConfig *HttpHandler) CreateUser(w http.ResponseWriter, r *http.Request
 		json.NewEncoder(w).Encode(response)
 	}
 
-	hashedpass, err := hashpassword(newUser.Password)
+	hashedpass, err := hashpassword(r.Context(), newUser.Password)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		response := customResponse{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"message": err.Error()}}
@@ -60,7 +175,7 @@ func (httpConfig *HttpHandler) CreateUser(w http.ResponseWriter, r *http.Request
 
 	newUser.Password = hashedpass
 
-	field, err := httpConfig.searchUser(newUser)
+	field, err := httpConfig.searchUser(r.Context(), newUser)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
@@ -68,7 +183,7 @@ func (httpConfig *HttpHandler) CreateUser(w http.ResponseWriter, r *http.Request
 		return
 	}
 	if field == "" {
-		id, err := httpConfig.db.SaveUser(newUser)
+		id, err := httpConfig.db.WithContext(r.Context()).SaveUser(newUser)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
@@ -114,7 +229,7 @@ func (httpConfig *HttpHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 	// write another for when the email is not found in the database
 
-	user, err := httpConfig.db.GetUser("email", login.Email)
+	user, err := httpConfig.db.WithContext(r.Context()).GetUser("email", login.Email)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
@@ -123,13 +238,15 @@ func (httpConfig *HttpHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if user == (models.User{}) {
+		metrics.Login(metrics.LoginPassword, false)
 		w.WriteHeader(http.StatusNotFound)
 		response := customResponse{Status: http.StatusNotFound, Message: "email not registered", Data: map[string]interface{}{"msg": "email not associated to a user, proceed to register page to signup..."}}
 		json.NewEncoder(w).Encode(response)
 		return
 	}
 
-	valid := comparePassword(login.Password, user.Password)
+	valid := comparePassword(r.Context(), login.Password, user.Password)
+	metrics.Login(metrics.LoginPassword, valid)
 	if !valid {
 		w.WriteHeader(http.StatusUnauthorized)
 		response := customResponse{Status: http.StatusUnauthorized, Message: "error", Data: map[string]interface{}{"message": "incorrect password"}}
@@ -137,7 +254,25 @@ func (httpConfig *HttpHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := auth.GenerateJWT(user.Username)
+	httpConfig.issueSession(w, auth.SessionMode(r), user)
+
+}
+
+func (httpConfig *HttpHandler) Logout(w http.ResponseWriter, r *http.Request) {
+
+	auth.EndSession(w)
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "logout successful", Data: map[string]interface{}{"msg": "session cookies cleared"}}
+	json.NewEncoder(w).Encode(response)
+
+}
+
+// issueSession completes a login. Cookie mode sets the session and CSRF
+// cookies and returns the CSRF token; token mode returns a bearer token.
+func (httpConfig *HttpHandler) issueSession(w http.ResponseWriter, mode string, user models.User) {
+
+	data, err := newSession(w, mode, user)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to generate token: " + err.Error()}}
@@ -145,13 +280,31 @@ func (httpConfig *HttpHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Authorization", token)
 	w.WriteHeader(http.StatusOK)
-	response := customResponse{Status: http.StatusOK, Message: "login successful", Data: map[string]interface{}{"authorization": fmt.Sprintf("your generated token is %s attach to subsequest request with the header %s", token, "Authorization")}}
+	response := customResponse{Status: http.StatusOK, Message: "login successful", Data: data}
 	json.NewEncoder(w).Encode(response)
 
-	// if successful, add the authorization header to response and return token as json response as well
+}
+
+// newSession issues credentials for the user in the given mode and returns
+// the fields describing them for the response body.
+func newSession(w http.ResponseWriter, mode string, user models.User) (map[string]interface{}, error) {
+
+	if mode == auth.ModeCookie {
+		csrf, err := auth.StartSession(w, user.ID, user.Username)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"csrf_token": csrf, "msg": fmt.Sprintf("session cookie set, send the csrf token in the %s header on unsafe requests", auth.CSRFHeader)}, nil
+	}
+
+	token, err := auth.GenerateJWT(user.ID, user.Username)
+	if err != nil {
+		return nil, err
+	}
 
+	w.Header().Set("Authorization", token)
+	return map[string]interface{}{"authorization": fmt.Sprintf("your generated token is %s attach to subsequest request with the header %s", token, "Authorization: Bearer")}, nil
 }
 
 func (httpConfig *HttpHandler) Profile(w http.ResponseWriter, r *http.Request) {
@@ -170,16 +323,27 @@ func (httpConfig *HttpHandler) Profile(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func hashpassword(password string) (string, error) {
+var tracer = otel.Tracer("github.com/A-Victory/blog/handlers")
+
+// hashpassword and comparePassword are traced: bcrypt is slow on purpose, and
+// is often most of the time spent handling a signup or a login.
+func hashpassword(ctx context.Context, password string) (string, error) {
+	_, span := tracer.Start(ctx, "bcrypt.GenerateFromPassword")
+	defer span.End()
+
 	encrytedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 10)
 	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
 		return "", err
 	}
 
 	return string(encrytedPassword), nil
 }
 
-func comparePassword(inputPassword, dbPassword string) bool {
+func comparePassword(ctx context.Context, inputPassword, dbPassword string) bool {
+	_, span := tracer.Start(ctx, "bcrypt.CompareHashAndPassword")
+	defer span.End()
+
 	if err := bcrypt.CompareHashAndPassword([]byte(dbPassword), []byte(inputPassword)); err != nil {
 		return false
 	}
@@ -188,13 +352,22 @@ func comparePassword(inputPassword, dbPassword string) bool {
 }
 
 func (httpConfig *HttpHandler) getUser(r *http.Request) (models.User, error) {
-	token := r.Header.Get("Authorization")
-	username, err := auth.GetUser(token)
-	if err != nil {
-		return models.User{}, err
+	return httpConfig.contextUser(r.Context())
+}
+
+// contextUser loads the user that auth.Verify, or the gRPC interceptors,
+// stored in the context.
+func (httpConfig *HttpHandler) contextUser(ctx context.Context) (models.User, error) {
+	if userID := auth.UserID(ctx); userID != 0 {
+		return httpConfig.db.WithContext(ctx).GetUser("id", userID)
+	}
+
+	username := auth.Username(ctx)
+	if username == "" {
+		return models.User{}, fmt.Errorf("no authenticated user on request")
 	}
 
-	user, err := httpConfig.db.GetUser("username", username)
+	user, err := httpConfig.db.WithContext(ctx).GetUser("username", username)
 	if err != nil {
 		return models.User{}, err
 	}
@@ -202,7 +375,11 @@ func (httpConfig *HttpHandler) getUser(r *http.Request) (models.User, error) {
 	return user, nil
 }
 
-func (httpConfig *HttpHandler) searchUser(newUser models.User) (field string, err error) {
+func (httpConfig *HttpHandler) searchUser(ctx context.Context, newUser models.User) (field string, err error) {
+	if reservedUsernames[strings.ToLower(newUser.Username)] {
+		return "username", nil
+	}
+
 	checks := []struct {
 		field string
 		value string
@@ -212,7 +389,7 @@ func (httpConfig *HttpHandler) searchUser(newUser models.User) (field string, er
 	}
 
 	for _, check := range checks {
-		user, err := httpConfig.db.GetUser(check.field, check.value)
+		user, err := httpConfig.db.WithContext(ctx).GetUser(check.field, check.value)
 		if err != nil {
 			if err != sql.ErrNoRows {
 				return "", nil
@@ -232,15 +409,17 @@ func (httpConfig *HttpHandler) searchUser(newUser models.User) (field string, er
 }
 
 type userResponse struct {
-	ID       int    `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
+	ID                  int    `json:"id"`
+	Username            string `json:"username"`
+	Email               string `json:"email"`
+	DeletionScheduledAt string `json:"deletionScheduledAt,omitempty"`
 }
 
 func newUserResponse(user models.User) userResponse {
 	return userResponse{
-		ID:       user.ID,
-		Username: user.Username,
-		Email:    user.Email,
+		ID:                  user.ID,
+		Username:            user.Username,
+		Email:               user.Email,
+		DeletionScheduledAt: user.DeletionScheduledAt,
 	}
 }
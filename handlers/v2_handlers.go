@@ -0,0 +1,466 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/A-Victory/blog/auth"
+	"github.com/A-Victory/blog/metrics"
+	"github.com/A-Victory/blog/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// V2 serves the /api/v2 endpoints. They run the same operations as the
+// GraphQL and gRPC APIs but answer with typed bodies: a resource is sent as
+// {"data": ...}, a list as {"data": [...], "page": {...}} and an error as
+// {"error": {"status": ..., "code": ..., "message": ...}}.
+type V2 struct {
+	h *HttpHandler
+}
+
+// V2 returns the /api/v2 handlers backed by httpConfig.
+func (httpConfig *HttpHandler) V2() *V2 {
+	return &V2{h: httpConfig}
+}
+
+type v2Item[T any] struct {
+	Data T `json:"data"`
+}
+
+type v2List[T any] struct {
+	Data []T         `json:"data"`
+	Page models.Page `json:"page"`
+}
+
+type v2Session struct {
+	Token     string         `json:"token,omitempty"`
+	CSRFToken string         `json:"csrfToken,omitempty"`
+	User      models.Profile `json:"user"`
+}
+
+type v2Problem struct {
+	Error v2ProblemDetail `json:"error"`
+}
+
+type v2ProblemDetail struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// postChange is the body of a post PATCH. Only the fields sent change.
+type postChange struct {
+	Title   *string   `json:"title"`
+	Content *string   `json:"content"`
+	Status  *string   `json:"status"`
+	Tags    *[]string `json:"tags"`
+}
+
+type commentChange struct {
+	Content string `json:"content"`
+}
+
+// v2Write writes a v2 body with the given status.
+func v2Write(w http.ResponseWriter, status int, body interface{}) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// V2Error writes a v2 error body. The code is the status text in snake case,
+// e.g. "not_found".
+func V2Error(w http.ResponseWriter, status int, msg string) {
+	code := strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+	v2Write(w, status, v2Problem{Error: v2ProblemDetail{Status: status, Code: code, Message: msg}})
+}
+
+// v2Fail writes the v2 error for an error of the content operations.
+func v2Fail(w http.ResponseWriter, err error) {
+	V2Error(w, errorStatus(err), err.Error())
+}
+
+func (v *V2) viewer(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	user, err := v.h.getUser(r)
+	if err != nil {
+		V2Error(w, http.StatusInternalServerError, "failed to retrieve user's details: "+err.Error())
+		return models.User{}, false
+	}
+	return user, true
+}
+
+func v2Decode(w http.ResponseWriter, r *http.Request, body interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		V2Error(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func v2ID(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, name))
+	if err != nil || id < 1 {
+		V2Error(w, http.StatusBadRequest, "invalid "+name)
+		return 0, false
+	}
+	return id, true
+}
+
+// ifMatchVersion reads the version an If-Match header names. v2 takes the
+// ETag of a single version; nil means the header was not sent.
+func ifMatchVersion(w http.ResponseWriter, r *http.Request) (*int, bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return nil, true
+	}
+	version, err := strconv.Atoi(strings.Trim(header, `"`))
+	if err != nil || header != etag(version) {
+		V2Error(w, http.StatusBadRequest, "If-Match must be the ETag of one version, e.g. \"3\"")
+		return nil, false
+	}
+	return &version, true
+}
+
+// v2Written answers a write with the changed resource and its ETag, or with
+// the error of the write.
+func v2Written(w http.ResponseWriter, status int, version int, resource interface{}, err error) {
+	if err != nil {
+		v2Fail(w, err)
+		return
+	}
+	w.Header().Set("ETag", etag(version))
+	v2Write(w, status, v2Item[interface{}]{Data: resource})
+}
+
+func (v *V2) Login(w http.ResponseWriter, r *http.Request) {
+	login := models.LoginDetails{}
+	if !v2Decode(w, r, &login) {
+		return
+	}
+
+	// an unknown email is a failed login like a wrong password
+	user, err := v.h.db.WithContext(r.Context()).GetUser("email", login.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		v2Fail(w, databaseError(err))
+		return
+	}
+	valid := err == nil && comparePassword(r.Context(), login.Password, user.Password)
+	metrics.Login(metrics.LoginPassword, valid)
+	if !valid {
+		V2Error(w, http.StatusUnauthorized, "incorrect email or password")
+		return
+	}
+
+	profile, err := v.h.profile(r.Context(), user.Username)
+	if err != nil {
+		v2Fail(w, databaseError(err))
+		return
+	}
+
+	result := v2Session{User: profile}
+	if auth.SessionMode(r) == auth.ModeCookie {
+		result.CSRFToken, err = auth.StartSession(w, user.ID, user.Username)
+	} else {
+		result.Token, err = auth.GenerateJWT(user.ID, user.Username)
+	}
+	if err != nil {
+		V2Error(w, http.StatusInternalServerError, "failed to generate token: "+err.Error())
+		return
+	}
+
+	v2Write(w, http.StatusOK, v2Item[v2Session]{Data: result})
+}
+
+func (v *V2) Me(w http.ResponseWriter, r *http.Request) {
+	viewer, ok := v.viewer(w, r)
+	if !ok {
+		return
+	}
+	v.writeUser(w, r, viewer.Username)
+}
+
+func (v *V2) User(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+	if decoded, err := url.PathUnescape(username); err == nil {
+		username = decoded
+	}
+	v.writeUser(w, r, username)
+}
+
+func (v *V2) writeUser(w http.ResponseWriter, r *http.Request, username string) {
+	profile, err := v.h.profile(r.Context(), username)
+	if err != nil {
+		v2Fail(w, databaseError(err))
+		return
+	}
+	if profile.ID == 0 {
+		V2Error(w, http.StatusNotFound, fmt.Sprintf("no user found with username: %s", username))
+		return
+	}
+	v2Write(w, http.StatusOK, v2Item[models.Profile]{Data: profile})
+}
+
+func (v *V2) Follow(w http.ResponseWriter, r *http.Request) {
+	v.setFollow(w, r, true)
+}
+
+func (v *V2) Unfollow(w http.ResponseWriter, r *http.Request) {
+	v.setFollow(w, r, false)
+}
+
+func (v *V2) setFollow(w http.ResponseWriter, r *http.Request, follow bool) {
+	viewer, ok := v.viewer(w, r)
+	if !ok {
+		return
+	}
+
+	profile, err := v.h.setFollow(r.Context(), viewer, chi.URLParam(r, "username"), follow)
+	if err != nil {
+		v2Fail(w, err)
+		return
+	}
+	v2Write(w, http.StatusOK, v2Item[models.Profile]{Data: profile})
+}
+
+func (v *V2) Posts(w http.ResponseWriter, r *http.Request) {
+	viewer, ok := v.viewer(w, r)
+	if !ok {
+		return
+	}
+
+	opts, err := listOptions(r)
+	if err != nil {
+		V2Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter, err := postFilter(r, viewer.ID)
+	if err == nil {
+		err = v.h.va.Validate(filter)
+	}
+	if err != nil {
+		V2Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	posts, page, err := v.h.db.WithContext(r.Context()).GetPosts(opts, filter)
+	if err != nil {
+		v2Fail(w, listQueryError(err))
+		return
+	}
+
+	setNextLink(w, r, page.NextCursor)
+	v2Write(w, http.StatusOK, v2List[models.Post]{Data: posts, Page: page})
+}
+
+func (v *V2) GetPost(w http.ResponseWriter, r *http.Request) {
+	viewer, ok := v.viewer(w, r)
+	if !ok {
+		return
+	}
+	postID, ok := v2ID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	post, err := v.h.readablePost(r.Context(), viewer, postID)
+	if err != nil {
+		v2Fail(w, err)
+		return
+	}
+	if notModified(w, r, post.Version) {
+		return
+	}
+	v2Write(w, http.StatusOK, v2Item[models.Post]{Data: post})
+}
+
+func (v *V2) CreatePost(w http.ResponseWriter, r *http.Request) {
+	viewer, ok := v.viewer(w, r)
+	if !ok {
+		return
+	}
+	newPost := models.Post{}
+	if !v2Decode(w, r, &newPost) {
+		return
+	}
+
+	created, err := v.h.createPost(r.Context(), viewer, newPost)
+	if err == nil {
+		w.Header().Set("Location", fmt.Sprintf("/api/v2/posts/%d", created.ID))
+	}
+	v2Written(w, http.StatusCreated, created.Version, created, err)
+}
+
+func (v *V2) UpdatePost(w http.ResponseWriter, r *http.Request) {
+	viewer, ok := v.viewer(w, r)
+	if !ok {
+		return
+	}
+	postID, ok := v2ID(w, r, "id")
+	if !ok {
+		return
+	}
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	change := postChange{}
+	if !v2Decode(w, r, &change) {
+		return
+	}
+
+	updated, err := v.h.updatePost(r.Context(), viewer, postID, version, func(post *models.Post) {
+		if change.Title != nil {
+			post.Title = *change.Title
+		}
+		if change.Content != nil {
+			post.Content = *change.Content
+		}
+		if change.Status != nil {
+			post.Status = *change.Status
+		}
+		if change.Tags != nil {
+			post.Tags = *change.Tags
+		}
+	})
+	v2Written(w, http.StatusOK, updated.Version, updated, err)
+}
+
+func (v *V2) DeletePost(w http.ResponseWriter, r *http.Request) {
+	viewer, ok := v.viewer(w, r)
+	if !ok {
+		return
+	}
+	postID, ok := v2ID(w, r, "id")
+	if !ok {
+		return
+	}
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+
+	if err := v.h.deletePost(r.Context(), viewer, postID, version); err != nil {
+		v2Fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (v *V2) Comments(w http.ResponseWriter, r *http.Request) {
+	viewer, ok := v.viewer(w, r)
+	if !ok {
+		return
+	}
+	postID, ok := v2ID(w, r, "postId")
+	if !ok {
+		return
+	}
+	opts, err := listOptions(r)
+	if err != nil {
+		V2Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, err := v.h.readablePost(r.Context(), viewer, postID); err != nil {
+		v2Fail(w, err)
+		return
+	}
+
+	comments, page, err := v.h.db.WithContext(r.Context()).GetComments(postID, opts)
+	if err != nil {
+		v2Fail(w, listQueryError(err))
+		return
+	}
+
+	setNextLink(w, r, page.NextCursor)
+	v2Write(w, http.StatusOK, v2List[models.Comment]{Data: comments, Page: page})
+}
+
+func (v *V2) GetComment(w http.ResponseWriter, r *http.Request) {
+	viewer, ok := v.viewer(w, r)
+	if !ok {
+		return
+	}
+	commentID, ok := v2ID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	comment, err := v.h.readableComment(r.Context(), viewer, commentID)
+	if err != nil {
+		v2Fail(w, err)
+		return
+	}
+	if notModified(w, r, comment.Version) {
+		return
+	}
+	v2Write(w, http.StatusOK, v2Item[models.Comment]{Data: comment})
+}
+
+func (v *V2) AddComment(w http.ResponseWriter, r *http.Request) {
+	viewer, ok := v.viewer(w, r)
+	if !ok {
+		return
+	}
+	postID, ok := v2ID(w, r, "postId")
+	if !ok {
+		return
+	}
+	body := commentChange{}
+	if !v2Decode(w, r, &body) {
+		return
+	}
+
+	created, err := v.h.addComment(r.Context(), viewer, postID, body.Content)
+	if err == nil {
+		w.Header().Set("Location", fmt.Sprintf("/api/v2/comments/%d", created.ID))
+	}
+	v2Written(w, http.StatusCreated, created.Version, created, err)
+}
+
+func (v *V2) UpdateComment(w http.ResponseWriter, r *http.Request) {
+	viewer, ok := v.viewer(w, r)
+	if !ok {
+		return
+	}
+	commentID, ok := v2ID(w, r, "id")
+	if !ok {
+		return
+	}
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	body := commentChange{}
+	if !v2Decode(w, r, &body) {
+		return
+	}
+
+	updated, err := v.h.editComment(r.Context(), viewer, commentID, body.Content, version)
+	v2Written(w, http.StatusOK, updated.Version, updated, err)
+}
+
+func (v *V2) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	viewer, ok := v.viewer(w, r)
+	if !ok {
+		return
+	}
+	commentID, ok := v2ID(w, r, "id")
+	if !ok {
+		return
+	}
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+
+	if err := v.h.deleteComment(r.Context(), viewer, commentID, version); err != nil {
+		v2Fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/A-Victory/blog/models"
+	"github.com/A-Victory/blog/webhook"
+	"github.com/go-chi/chi/v5"
+)
+
+func (httpConfig *HttpHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+
+	sub, ok := httpConfig.webhookRequest(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := httpConfig.getUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to retrieve user's details: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	sub.UserID = user.ID
+
+	if sub.Secret == "" {
+		if sub.Secret, err = webhook.NewSecret(); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to generate a secret: " + err.Error()}}
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+	}
+
+	id, err := httpConfig.db.WithContext(r.Context()).CreateWebhook(sub)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	sub.ID = id
+
+	w.Header().Set("Location", fmt.Sprintf("/api/webhooks/%d", id))
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "webhook created", Data: map[string]interface{}{"webhook": sub, "secret": sub.Secret, "msg": "keep the secret to verify the X-Webhook-Signature header, it is not shown again"}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) Webhooks(w http.ResponseWriter, r *http.Request) {
+
+	user, err := httpConfig.getUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to retrieve user's details: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	subs, err := httpConfig.db.WithContext(r.Context()).GetWebhooks(user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"webhooks": subs, "events": models.WebhookEvents}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) Webhook(w http.ResponseWriter, r *http.Request) {
+
+	sub, ok := httpConfig.ownWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"webhook": sub}}
+	json.NewEncoder(w).Encode(response)
+}
+
+// UpdateWebhook replaces a subscription. The secret is kept unless a new one
+// is sent.
+func (httpConfig *HttpHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+
+	current, ok := httpConfig.ownWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	sub, ok := httpConfig.webhookRequest(w, r)
+	if !ok {
+		return
+	}
+	sub.ID = current.ID
+	sub.UserID = current.UserID
+
+	if _, err := httpConfig.db.WithContext(r.Context()).UpdateWebhook(sub); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	sub.CreatedAt = current.CreatedAt
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "webhook updated", Data: map[string]interface{}{"webhook": sub}}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (httpConfig *HttpHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+
+	sub, ok := httpConfig.ownWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := httpConfig.db.WithContext(r.Context()).DeleteWebhook(sub.ID, sub.UserID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "webhook deleted", Data: map[string]interface{}{"msg": fmt.Sprintf("deleted webhook with id: %d", sub.ID)}}
+	json.NewEncoder(w).Encode(response)
+}
+
+// WebhookDeliveries returns the delivery log of a subscription, newest first.
+// The status query parameter keeps only pending, delivered or dead
+// deliveries.
+func (httpConfig *HttpHandler) WebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+
+	sub, ok := httpConfig.ownWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead:
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"msg": "status must be pending, delivered or dead"}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	opts, ok := listRequest(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, page, err := httpConfig.db.WithContext(r.Context()).GetWebhookDeliveries(sub.ID, status, opts)
+	if err != nil {
+		listError(w, err)
+		return
+	}
+
+	setNextLink(w, r, page.NextCursor)
+	w.WriteHeader(http.StatusOK)
+	response := customResponse{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"deliveries": deliveries, "page": page}}
+	json.NewEncoder(w).Encode(response)
+}
+
+// RetryWebhookDelivery queues a delivery again, typically a dead-lettered
+// one, with a fresh set of attempts.
+func (httpConfig *HttpHandler) RetryWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+
+	sub, ok := httpConfig.ownWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	deliveryID, err := strconv.Atoi(chi.URLParam(r, "deliveryId"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "error", Data: map[string]interface{}{"msg": "error converting string..."}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	delivery, err := httpConfig.db.WithContext(r.Context()).GetWebhookDelivery(deliveryID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if delivery.ID == 0 || delivery.SubscriptionID != sub.ID {
+		w.WriteHeader(http.StatusNotFound)
+		response := customResponse{Status: http.StatusNotFound, Message: "delivery not found", Data: map[string]interface{}{"msg": fmt.Sprintf("no delivery found with id: %d", deliveryID)}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if delivery.Status == models.DeliveryPending {
+		w.WriteHeader(http.StatusConflict)
+		response := customResponse{Status: http.StatusConflict, Message: "delivery pending", Data: map[string]interface{}{"msg": fmt.Sprintf("delivery %d is already queued", deliveryID)}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if _, err := httpConfig.db.WithContext(r.Context()).RetryWebhookDelivery(deliveryID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if httpConfig.webhooks != nil {
+		httpConfig.webhooks.Trigger()
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	response := customResponse{Status: http.StatusAccepted, Message: "delivery queued", Data: map[string]interface{}{"msg": fmt.Sprintf("delivery %d will be sent again", deliveryID)}}
+	json.NewEncoder(w).Encode(response)
+}
+
+// webhookRequest reads and validates a subscription from the request body,
+// writing an error response and returning false when it is invalid.
+func (httpConfig *HttpHandler) webhookRequest(w http.ResponseWriter, r *http.Request) (models.WebhookSubscription, bool) {
+
+	request := models.WebhookRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "error", Data: map[string]interface{}{"message": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return models.WebhookSubscription{}, false
+	}
+
+	if err := httpConfig.va.Validate(request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"message": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return models.WebhookSubscription{}, false
+	}
+
+	if err := webhook.CheckURL(request.URL, httpConfig.allowHTTPWebhooks); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "invalid request", Data: map[string]interface{}{"message": err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return models.WebhookSubscription{}, false
+	}
+
+	active := request.Active == nil || *request.Active
+	return models.WebhookSubscription{URL: request.URL, Secret: request.Secret, Events: request.Events, Active: active}, true
+}
+
+// ownWebhook loads the subscription named in the URL, writing an error
+// response and returning false when it does not exist or belongs to someone
+// else.
+func (httpConfig *HttpHandler) ownWebhook(w http.ResponseWriter, r *http.Request) (models.WebhookSubscription, bool) {
+
+	user, err := httpConfig.getUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "failed to retrieve user's details: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return models.WebhookSubscription{}, false
+	}
+
+	subscriptionID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := customResponse{Status: http.StatusBadRequest, Message: "error", Data: map[string]interface{}{"msg": "error converting string..."}}
+		json.NewEncoder(w).Encode(response)
+		return models.WebhookSubscription{}, false
+	}
+
+	sub, err := httpConfig.db.WithContext(r.Context()).GetWebhook(subscriptionID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := customResponse{Status: http.StatusInternalServerError, Message: "server error", Data: map[string]interface{}{"msg": "database connection error: " + err.Error()}}
+		json.NewEncoder(w).Encode(response)
+		return models.WebhookSubscription{}, false
+	}
+
+	if sub.ID == 0 || sub.UserID != user.ID {
+		w.WriteHeader(http.StatusNotFound)
+		response := customResponse{Status: http.StatusNotFound, Message: "webhook not found", Data: map[string]interface{}{"msg": fmt.Sprintf("no webhook found with id: %d", subscriptionID)}}
+		json.NewEncoder(w).Encode(response)
+		return models.WebhookSubscription{}, false
+	}
+
+	return sub, true
+}
+
+// unpublishedPost is the event data of a post taken back to draft, which
+// leaves out the text that is no longer public.
+type unpublishedPost struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+}
+
+// emitPost queues a post event. Drafts are private, so only posts that are
+// or were published are sent, and a post that went back to draft is sent
+// without its content.
+func (httpConfig *HttpHandler) emitPost(ctx context.Context, event string, post models.Post, wasPublished bool) {
+	switch {
+	case post.Status == models.PostPublished:
+		httpConfig.emit(ctx, event, post)
+	case wasPublished:
+		httpConfig.emit(ctx, event, unpublishedPost{ID: post.ID, Status: post.Status})
+	}
+}
+
+// emitComment queues a comment event unless the comment is on a draft.
+func (httpConfig *HttpHandler) emitComment(ctx context.Context, event string, comment models.Comment) {
+	post, err := httpConfig.db.WithContext(ctx).GetPostByID(comment.Postid)
+	if err != nil {
+		httpConfig.logger.ErrorContext(ctx, "failed to queue webhooks", "event", event, "error", err)
+		return
+	}
+	if post.Status != models.PostPublished {
+		return
+	}
+	httpConfig.emit(ctx, event, comment)
+}
+
+// emit queues a delivery of the event for every subscription that wants it.
+// Failing to queue is logged rather than failing the request, which has
+// already been written to the database.
+func (httpConfig *HttpHandler) emit(ctx context.Context, event string, data interface{}) {
+	subs, err := httpConfig.db.WithContext(ctx).GetWebhooksForEvent(event)
+	if err == nil && len(subs) == 0 {
+		return
+	}
+
+	var payload []byte
+	if err == nil {
+		payload, err = json.Marshal(data)
+	}
+	if err == nil {
+		ids := make([]int, len(subs))
+		for i, sub := range subs {
+			ids[i] = sub.ID
+		}
+		err = httpConfig.db.WithContext(ctx).EnqueueWebhookDeliveries(ids, event, string(payload))
+	}
+	if err != nil {
+		httpConfig.logger.ErrorContext(ctx, "failed to queue webhooks", "event", event, "error", err)
+		return
+	}
+
+	if httpConfig.webhooks != nil {
+		httpConfig.webhooks.Trigger()
+	}
+}
@@ -0,0 +1,203 @@
+// Package health serves the liveness and readiness probes. Subsystems
+// register checks in a Registry: liveness checks tell whether the process
+// must be restarted, readiness checks whether it can take traffic.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check reports a problem with a subsystem. It must return once ctx is done.
+type Check func(ctx context.Context) error
+
+// DefaultTimeout bounds each check.
+const DefaultTimeout = 2 * time.Second
+
+// Statuses of the probes and their checks.
+const (
+	StatusOK      = "ok"
+	StatusFailing = "failing"
+)
+
+// ErrShuttingDown fails readiness once the server is shutting down.
+var ErrShuttingDown = errors.New("the server is shutting down")
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Registry holds the checks of the probes.
+type Registry struct {
+	// Timeout bounds each check. It defaults to DefaultTimeout.
+	Timeout time.Duration
+
+	mu           sync.RWMutex
+	liveness     []namedCheck
+	readiness    []namedCheck
+	shuttingDown atomic.Bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{Timeout: DefaultTimeout}
+}
+
+// AddLivenessCheck adds a check to /livez. Only problems a restart fixes,
+// such as a stuck worker, belong there: a database outage would otherwise
+// restart every replica at once.
+func (reg *Registry) AddLivenessCheck(name string, check Check) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.liveness = append(reg.liveness, namedCheck{name, check})
+}
+
+// AddReadinessCheck adds a check to /readyz.
+func (reg *Registry) AddReadinessCheck(name string, check Check) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.readiness = append(reg.readiness, namedCheck{name, check})
+}
+
+// Shutdown makes readiness fail, so that load balancers stop sending
+// requests before the server stops accepting them.
+func (reg *Registry) Shutdown() {
+	reg.shuttingDown.Store(true)
+}
+
+// Result is the outcome of a check.
+type Result struct {
+	Status   string  `json:"status"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"durationMs"`
+}
+
+// Report is the body of a probe.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Live runs the liveness checks.
+func (reg *Registry) Live(ctx context.Context) Report {
+	reg.mu.RLock()
+	checks := append([]namedCheck(nil), reg.liveness...)
+	reg.mu.RUnlock()
+	return reg.run(ctx, checks)
+}
+
+// Ready runs the readiness checks, which all fail once the server is
+// shutting down.
+func (reg *Registry) Ready(ctx context.Context) Report {
+	reg.mu.RLock()
+	checks := append([]namedCheck(nil), reg.readiness...)
+	reg.mu.RUnlock()
+
+	if reg.shuttingDown.Load() {
+		checks = append(checks, namedCheck{"shutdown", func(context.Context) error { return ErrShuttingDown }})
+	}
+	return reg.run(ctx, checks)
+}
+
+// run runs the checks concurrently.
+func (reg *Registry) run(ctx context.Context, checks []namedCheck) Report {
+	timeout := reg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c namedCheck) {
+			defer wg.Done()
+			results[i] = runCheck(ctx, c.check, timeout)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: map[string]Result{}}
+	for i, c := range checks {
+		report.Checks[c.name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusFailing
+		}
+	}
+	return report
+}
+
+func runCheck(ctx context.Context, check Check, timeout time.Duration) Result {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	errs := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				errs <- fmt.Errorf("check panicked: %v", p)
+			}
+		}()
+		errs <- check(ctx)
+	}()
+
+	result := Result{Status: StatusOK}
+	select {
+	case err := <-errs:
+		if err != nil {
+			result = Result{Status: StatusFailing, Error: err.Error()}
+		}
+	case <-ctx.Done():
+		result = Result{Status: StatusFailing, Error: fmt.Sprintf("timed out after %s", timeout)}
+	}
+	result.Duration = float64(time.Since(start).Microseconds()) / 1000
+	return result
+}
+
+// LivenessHandler serves /livez: 200 while every liveness check passes, 503
+// otherwise, with the result of each check.
+func (reg *Registry) LivenessHandler() http.Handler {
+	return handler(reg.Live)
+}
+
+// ReadinessHandler serves /readyz like LivenessHandler.
+func (reg *Registry) ReadinessHandler() http.Handler {
+	return handler(reg.Ready)
+}
+
+func handler(probe func(context.Context) Report) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := probe(r.Context())
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if report.Status != StatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+}
+
+// Recent returns a check failing when last, the time a loop last ran, is
+// older than maxAge, which catches workers that are stuck or stopped.
+func Recent(last func() time.Time, maxAge time.Duration) Check {
+	return func(context.Context) error {
+		at := last()
+		if at.IsZero() {
+			return errors.New("has not run yet")
+		}
+		if age := time.Since(at); age > maxAge {
+			return fmt.Errorf("last ran %s ago", age.Round(time.Second))
+		}
+		return nil
+	}
+}
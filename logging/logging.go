@@ -0,0 +1,149 @@
+// Package logging builds the structured logger of the server. Lines logged
+// with a request context carry the attributes of the request, and secrets,
+// tokens and passwords are redacted before they are written.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Formats of the log output.
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Redacted replaces the values that must not be logged.
+const Redacted = "[REDACTED]"
+
+type Config struct {
+	// Format is FormatJSON, the default, or FormatText.
+	Format string
+	Level  slog.Level
+	Output io.Writer
+}
+
+// New returns a logger writing to config.Output that adds the attributes of
+// the request scope to every line logged with its context.
+func New(config Config) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: config.Level, ReplaceAttr: redact}
+
+	var handler slog.Handler
+	switch config.Format {
+	case "", FormatJSON:
+		handler = slog.NewJSONHandler(config.Output, opts)
+	case FormatText:
+		handler = slog.NewTextHandler(config.Output, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", config.Format)
+	}
+
+	return slog.New(&scopeHandler{Handler: handler}), nil
+}
+
+// ParseLevel reads a level such as "debug", "info", "warn" or "error". An
+// empty string is info.
+func ParseLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	if value == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", value)
+	}
+	return level, nil
+}
+
+type scopeKey struct{}
+
+// scope holds the attributes of a request. Attributes are added as the
+// request goes through the middlewares, so it is shared by pointer.
+type scope struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+// NewScope returns a context starting a request scope with attrs.
+func NewScope(ctx context.Context, attrs ...slog.Attr) context.Context {
+	return context.WithValue(ctx, scopeKey{}, &scope{attrs: attrs})
+}
+
+// Add adds attributes to the request scope of ctx, including for the lines
+// logged with the contexts it was derived from. It does nothing outside a
+// scope.
+func Add(ctx context.Context, attrs ...slog.Attr) {
+	s, ok := ctx.Value(scopeKey{}).(*scope)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	s.attrs = append(s.attrs, attrs...)
+	s.mu.Unlock()
+}
+
+func scopeAttrs(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	s, ok := ctx.Value(scopeKey{}).(*scope)
+	if !ok {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]slog.Attr(nil), s.attrs...)
+}
+
+// scopeHandler adds the attributes of the request scope to each record.
+type scopeHandler struct {
+	slog.Handler
+}
+
+func (h *scopeHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs := scopeAttrs(ctx); len(attrs) > 0 {
+		record = record.Clone()
+		record.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *scopeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &scopeHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *scopeHandler) WithGroup(name string) slog.Handler {
+	return &scopeHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// sensitiveKeys are the parts of attribute names whose values are redacted.
+var sensitiveKeys = []string{"password", "token", "secret", "authorization", "cookie", "signingkey", "csrf", "apikey", "api_key"}
+
+// tokenPattern finds JWTs and bearer credentials inside other values, such as
+// error messages.
+var tokenPattern = regexp.MustCompile(`(?i)bearer\s+\S+|eyJ[\w-]*\.[\w-]+\.[\w-]+`)
+
+// redact is the ReplaceAttr of the handlers.
+func redact(groups []string, attr slog.Attr) slog.Attr {
+	key := strings.ToLower(attr.Key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return slog.String(attr.Key, Redacted)
+		}
+	}
+
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		attr.Value = slog.StringValue(tokenPattern.ReplaceAllString(attr.Value.String(), Redacted))
+	case slog.KindAny:
+		if err, ok := attr.Value.Any().(error); ok {
+			attr.Value = slog.StringValue(tokenPattern.ReplaceAllString(err.Error(), Redacted))
+		}
+	}
+	return attr
+}
@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"fmt"
+	"log/slog"
+	"net/smtp"
+	"strings"
+)
+
+// Mailer delivers plain-text emails to users.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// LogMailer writes emails to the log instead of sending them. It is used when
+// no SMTP server is configured.
+type LogMailer struct{}
+
+func (LogMailer) Send(to, subject, body string) error {
+	slog.Info("email not sent, no SMTP server configured", "to", to, "subject", subject, "body", body)
+	return nil
+}
+
+// SMTPMailer sends emails through an SMTP server using PLAIN auth.
+type SMTPMailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (m SMTPMailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host := strings.Split(m.Addr, ":")[0]
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n", m.From, to, subject, body)
+
+	if err := smtp.SendMail(m.Addr, auth, m.From, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("failed to send email to %s: %w", to, err)
+	}
+	return nil
+}
@@ -1,49 +1,433 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/A-Victory/blog/auth"
+	"github.com/A-Victory/blog/config"
 	"github.com/A-Victory/blog/database"
 	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/export"
+	"github.com/A-Victory/blog/health"
+	"github.com/A-Victory/blog/logging"
+	"github.com/A-Victory/blog/mailer"
+	"github.com/A-Victory/blog/metrics"
+	"github.com/A-Victory/blog/models"
+	"github.com/A-Victory/blog/ratelimit"
 	"github.com/A-Victory/blog/routes"
-	"github.com/joho/godotenv"
+	"github.com/A-Victory/blog/search"
+	"github.com/A-Victory/blog/server"
+	"github.com/A-Victory/blog/stream"
+	"github.com/A-Victory/blog/tracing"
+	"github.com/A-Victory/blog/webhook"
 )
 
 func main() {
 
-	err := godotenv.Load()
+	settings, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fatal("invalid configuration", "error", err)
+	}
+	auth.SetSigningKey([]byte(settings.Auth.SigningKey))
+
+	logger, err := loadLogger(settings.Log)
+	if err != nil {
+		fatal("failed to configure logging", "error", err)
+	}
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    settings.Tracing.Exporter,
+		ServiceName: settings.Tracing.ServiceName,
+	})
 	if err != nil {
-		log.Fatalf("failed to load godotenv: %v", err)
+		fatal("failed to configure tracing", "error", err)
 	}
 
-	dbConfig := os.Getenv("DB_URI")
-	dbName := os.Getenv("DB_NAME")
+	// signals is cancelled on SIGINT or SIGTERM, which starts the shutdown,
+	// and ctx once the servers are to stop accepting connections
+	signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, stopServing := context.WithCancel(context.Background())
+	defer stopServing()
 
-	dbConnection := database.NewDBConn(dbConfig, dbName)
+	dbName := settings.Database.Name
+	dbConnection := database.NewDBConn(settings.Database.URI, dbName)
 	if err := dbConnection.Initialize(); err != nil {
-		log.Fatalf("failed to initialize tables: %v", err)
+		fatal("failed to initialize tables", "error", err)
 	}
 	conn := conn.NewConn(dbConnection)
+	if err := metrics.RegisterDB(dbName, dbConnection.DB); err != nil {
+		fatal("failed to register database metrics", "error", err)
+	}
 	validator := auth.NewValidator()
 
+	// the workers outlive ctx, so that they keep serving the requests
+	// being drained, and are stopped once the servers are down
+	workers, stopWorkers := context.WithCancel(context.Background())
+	var running sync.WaitGroup
+	work := func(run func(context.Context)) {
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			run(workers)
+		}()
+	}
+
+	exports := export.NewWorker(conn)
+	work(exports.Run)
+
+	webhooks := webhook.NewWorker(conn, settings.Webhooks.AllowHTTP)
+	work(webhooks.Run)
+
+	hub := stream.NewHub(loadStreamBroker(settings.Stream.Broker, conn))
+	var hubStopped atomic.Bool
+	work(func(ctx context.Context) {
+		if err := hub.Run(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("comment stream stopped", "error", err)
+			hubStopped.Store(true)
+		}
+	})
+
+	searcher := loadSearch(settings.Search.Backend, conn)
+	work(func(ctx context.Context) { purgeDeletedAccounts(ctx, conn, searcher) })
+	work(func(ctx context.Context) { purgeIdempotencyKeys(ctx, conn) })
+
+	probes := health.NewRegistry()
+	probes.AddReadinessCheck("database", dbConnection.DB.PingContext)
+	probes.AddReadinessCheck("migrations", func(ctx context.Context) error {
+		pending, err := dbConnection.PendingMigrations(ctx)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("migrations %v are not applied", pending)
+		}
+		return nil
+	})
+	probes.AddLivenessCheck("exports", health.Recent(exports.LastRun, workerMaxAge))
+	probes.AddLivenessCheck("webhooks", health.Recent(webhooks.LastRun, workerMaxAge))
+	probes.AddLivenessCheck("stream", func(context.Context) error {
+		if hubStopped.Load() {
+			return errors.New("the comment stream stopped receiving events")
+		}
+		return nil
+	})
+
 	serverConfig := routes.ServerConfig{
-		DB: conn,
-		VA: validator,
+		DB:                conn,
+		VA:                validator,
+		OIDC:              loadOIDCProviders(settings.OIDC),
+		Mailer:            loadMailer(settings.SMTP),
+		BaseURL:           settings.API.BaseURL,
+		DeletionGrace:     settings.API.DeletionGrace(),
+		Exports:           exports,
+		Search:            searcher,
+		Webhooks:          webhooks,
+		AllowHTTPWebhooks: settings.Webhooks.AllowHTTP,
+		Stream:            hub,
+		RequireIfMatch:    settings.API.RequireIfMatch,
+		IdempotencyWindow: settings.API.IdempotencyWindow(),
+		V1Sunset:          settings.API.V1Sunset.Time,
+		Logger:            logger,
+		ServeMetrics:      settings.Metrics.Port == "",
+		Health:            probes,
+		RateLimits:        loadRateLimits(settings.RateLimit),
+	}
+
+	httpConfig := loadHTTPConfig(settings.HTTP)
+	if httpConfig.Certificate != nil {
+		serverConfig.TLS = httpConfig.Certificate.TLSConfig()
+		work(func(ctx context.Context) { httpConfig.Certificate.Watch(ctx, time.Minute) })
+	}
+	shutdownTimeout := settings.HTTP.ShutdownTimeout
+	shutdownDelay := settings.HTTP.ShutdownDelay
+
+	// a server that fails stops the others, and the process exits with an
+	// error once everything is shut down
+	var servers sync.WaitGroup
+	var failed atomic.Bool
+	serve := func(name string, run func() error) {
+		servers.Add(1)
+		go func() {
+			defer servers.Done()
+			if err := run(); err != nil {
+				slog.Error("server stopped", "server", name, "error", err)
+				failed.Store(true)
+				stop()
+			}
+		}()
+	}
+
+	api := server.New(httpConfig, routes.NewServer(serverConfig))
+	// live streams end first, so that their clients reconnect elsewhere
+	// instead of holding the shutdown until the timeout
+	api.RegisterOnShutdown(hub.Close)
+	serve("api", func() error {
+		slog.Info("starting server", "address", api.Addr, "tls", api.TLSConfig != nil)
+		return server.Run(ctx, api, shutdownTimeout)
+	})
+
+	grpcAddress := fmt.Sprintf(":%s", settings.GRPC.Port)
+	grpcServer := routes.NewGRPCServer(serverConfig)
+	serve("grpc", func() error {
+		slog.Info("starting gRPC server", "address", grpcAddress)
+		return server.RunGRPC(ctx, grpcServer, grpcAddress, shutdownTimeout)
+	})
+
+	if port := settings.Metrics.Port; port != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		mux.Handle("/livez", probes.LivenessHandler())
+		mux.Handle("/readyz", probes.ReadinessHandler())
+		admin := server.New(server.Config{Addr: fmt.Sprintf(":%s", port)}, mux)
+		serve("metrics", func() error {
+			slog.Info("starting metrics server", "address", admin.Addr)
+			return server.Run(ctx, admin, shutdownTimeout)
+		})
+	}
+
+	<-signals.Done()
+	// readiness fails first, so that load balancers stop sending requests
+	// before the listeners close
+	probes.Shutdown()
+	slog.Info("shutting down", "delay", shutdownDelay)
+	if !failed.Load() {
+		time.Sleep(shutdownDelay)
+	}
+	stopServing()
+	servers.Wait()
+
+	stopWorkers()
+	if !waitTimeout(&running, shutdownTimeout) {
+		slog.Warn("background workers still running after the shutdown timeout")
+	}
+
+	flush, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := shutdownTracing(flush); err != nil {
+		slog.Error("failed to flush traces", "error", err)
+	}
+	if err := dbConnection.DB.Close(); err != nil {
+		slog.Error("failed to close the database", "error", err)
 	}
 
-	server := routes.NewServer(serverConfig)
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	if failed.Load() {
+		os.Exit(1)
 	}
-	address := fmt.Sprintf(":%s", port)
-	log.Printf("starting server on port %s", address)
-	if err := http.ListenAndServe(address, server); err != nil {
-		log.Fatal("failed to start server on port " + address)
+	slog.Info("shut down")
+}
+
+// workerMaxAge is how long a worker may go without looking for work before
+// the liveness probe fails. It leaves room for a slow batch of exports; a
+// batch of webhooks can take longer, 50 deliveries timing out after 10s,
+// so the webhook worker also counts each delivery it finishes.
+const workerMaxAge = 5 * time.Minute
+
+// waitTimeout waits for wg up to timeout, and reports whether it is done.
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// loadHTTPConfig builds the API server settings, loading the certificate
+// when TLS is configured.
+func loadHTTPConfig(settings config.HTTP) server.Config {
+	httpConfig := server.Config{
+		Addr:              fmt.Sprintf(":%s", settings.Port),
+		ReadHeaderTimeout: settings.ReadHeaderTimeout,
+		ReadTimeout:       settings.ReadTimeout,
+		WriteTimeout:      settings.WriteTimeout,
+		IdleTimeout:       settings.IdleTimeout,
 	}
 
+	if settings.TLSCertFile != "" {
+		cert, err := server.LoadCertificate(settings.TLSCertFile, settings.TLSKeyFile)
+		if err != nil {
+			fatal("failed to load the TLS certificate", "error", err)
+		}
+		httpConfig.Certificate = cert
+	}
+	return httpConfig
+}
+
+// loadRateLimits builds the rate limits, keeping the buckets in memory.
+func loadRateLimits(settings config.RateLimit) routes.RateLimits {
+	if !settings.Enabled {
+		return routes.RateLimits{}
+	}
+	// checked by config.Validate
+	proxies, _ := ratelimit.ParseProxies(settings.TrustedProxies)
+	return routes.RateLimits{
+		Limiter: ratelimit.NewLimiter(ratelimit.NewMemoryStore(), proxies),
+		Auth:    settings.Auth,
+		Read:    settings.Read,
+		Write:   settings.Write,
+	}
+}
+
+// loadLogger builds the logger from the log settings.
+func loadLogger(settings config.Log) (*slog.Logger, error) {
+	level, err := logging.ParseLevel(settings.Level)
+	if err != nil {
+		return nil, err
+	}
+	return logging.New(logging.Config{
+		Format: settings.Format,
+		Level:  level,
+		Output: os.Stderr,
+	})
+}
+
+// fatal logs an error and exits.
+func fatal(msg string, args ...interface{}) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// loadOIDCProviders builds the identity providers. Those that cannot be
+// reached are skipped.
+func loadOIDCProviders(settings []config.OIDCProvider) []*auth.OIDCProvider {
+	var providers []*auth.OIDCProvider
+
+	for _, p := range settings {
+		provider, err := auth.NewOIDCProvider(context.Background(), auth.OIDCConfig{
+			Name:          p.Name,
+			Issuer:        p.Issuer,
+			ClientID:      p.ClientID,
+			ClientSecret:  p.ClientSecret,
+			RedirectURL:   p.RedirectURL,
+			AutoProvision: p.AutoProvision,
+		})
+		if err != nil {
+			slog.Warn("skipping identity provider", "provider", p.Name, "error", err)
+			continue
+		}
+		providers = append(providers, provider)
+	}
+
+	return providers
+}
+
+// loadMailer returns an SMTP mailer when an SMTP server is set and falls back
+// to logging emails otherwise.
+func loadMailer(settings config.SMTP) mailer.Mailer {
+	if settings.Addr == "" {
+		return mailer.LogMailer{}
+	}
+
+	return mailer.SMTPMailer{
+		Addr:     settings.Addr,
+		From:     settings.From,
+		Username: settings.Username,
+		Password: settings.Password,
+	}
+}
+
+// loadStreamBroker picks how live events travel. "local", the default, keeps
+// them in the process; "mysql" shares them between replicas through the
+// database.
+func loadStreamBroker(broker string, db *conn.DB) stream.Broker {
+	if broker == "mysql" {
+		return stream.NewMySQLBroker(db.Conn.DB)
+	}
+	return stream.NewLocalBroker()
+}
+
+// loadSearch picks the search backend. "mysql", the default, uses the
+// FULLTEXT indexes; "memory" builds an in-process index from the published
+// posts and their comments.
+func loadSearch(backend string, db *conn.DB) search.Searcher {
+	if backend != "memory" {
+		return search.NewMySQL(db.Conn.DB)
+	}
+	index := search.NewMemoryIndex()
+	if err := loadIndex(db, index); err != nil {
+		fatal("failed to build the search index", "error", err)
+	}
+	return index
+}
+
+func loadIndex(db *conn.DB, index *search.MemoryIndex) error {
+	posts, _, err := db.GetPosts(models.ListOptions{}, models.PostFilter{})
+	if err != nil {
+		return err
+	}
+	comments, err := db.GetPublishedComments()
+	if err != nil {
+		return err
+	}
+	index.Load(posts, comments)
+	return nil
+}
+
+// purgeDeletedAccounts removes accounts whose deletion grace period is over,
+// every hour until ctx is cancelled. An in-memory search index is rebuilt
+// afterwards since the erased posts and comments never pass through the
+// handlers.
+func purgeDeletedAccounts(ctx context.Context, db *conn.DB, searcher search.Searcher) {
+	every(ctx, time.Hour, func() {
+		purged, err := db.PurgeDeletedUsers()
+		if err != nil {
+			slog.Error("failed to purge deleted accounts", "error", err)
+			return
+		}
+		if purged > 0 {
+			slog.Info("purged deleted accounts", "count", purged)
+			if index, ok := searcher.(*search.MemoryIndex); ok {
+				if err := loadIndex(db, index); err != nil {
+					slog.Error("failed to rebuild the search index", "error", err)
+				}
+			}
+		}
+	})
+}
+
+// purgeIdempotencyKeys removes the stored responses of idempotency keys
+// whose window is over, every hour until ctx is cancelled.
+func purgeIdempotencyKeys(ctx context.Context, db *conn.DB) {
+	every(ctx, time.Hour, func() {
+		if _, err := db.PurgeIdempotencyKeys(); err != nil {
+			slog.Error("failed to purge idempotency keys", "error", err)
+		}
+	})
+}
+
+// every runs task now and then at each interval until ctx is cancelled.
+func every(ctx context.Context, interval time.Duration, task func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		task()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
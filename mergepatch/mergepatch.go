@@ -0,0 +1,54 @@
+// Package mergepatch applies JSON Merge Patch documents (RFC 7396). A patch
+// mirrors the document it changes: members it names replace the document's,
+// nested objects are merged recursively and null removes a member.
+package mergepatch
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// MediaType is the content type of a merge patch request body.
+const MediaType = "application/merge-patch+json"
+
+// ErrInvalidPatch is returned when the patch is not valid JSON.
+var ErrInvalidPatch = errors.New("the merge patch is not valid JSON")
+
+// Apply returns doc with patch applied. An empty doc is treated as null.
+func Apply(doc, patch []byte) ([]byte, error) {
+	var p interface{}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, ErrInvalidPatch
+	}
+
+	var target interface{}
+	if len(doc) > 0 {
+		if err := json.Unmarshal(doc, &target); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(merge(target, p))
+}
+
+// merge is the MergePatch function of RFC 7396, section 2.
+func merge(target, patch interface{}) interface{} {
+	members, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	object, ok := target.(map[string]interface{})
+	if !ok {
+		object = map[string]interface{}{}
+	}
+
+	for name, value := range members {
+		if value == nil {
+			delete(object, name)
+			continue
+		}
+		object[name] = merge(object[name], value)
+	}
+	return object
+}
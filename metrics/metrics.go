@@ -0,0 +1,150 @@
+// Package metrics exposes the Prometheus metrics of the server: HTTP request
+// rates and latencies per route, database pool stats, authentication
+// failures, business counters and the Go runtime.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "blog"
+
+// Registry holds every metric of the server.
+var Registry = prometheus.NewRegistry()
+
+var (
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route pattern and status.",
+	}, []string{"method", "route", "status"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time to handle HTTP requests by method and route pattern.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	inFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_requests_in_flight",
+		Help:      "HTTP requests being handled.",
+	})
+
+	// AuthFailures counts requests refused for their credentials, by reason:
+	// "missing_token", "invalid_token" or "csrf".
+	AuthFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_failures_total",
+		Help:      "Requests refused for missing or invalid credentials, by reason.",
+	}, []string{"reason"})
+
+	// Logins counts login attempts by method, "password" or "oidc", and
+	// result, "success" or "failure".
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Login attempts by method and result.",
+	}, []string{"method", "result"})
+
+	PostsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "posts_created_total",
+		Help:      "Posts created.",
+	})
+
+	CommentsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "comments_created_total",
+		Help:      "Comments created.",
+	})
+
+	// RateLimited counts requests refused for going over the rate of their
+	// policy, such as "auth" or "write".
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests refused for going over their rate limit, by policy.",
+	}, []string{"policy"})
+)
+
+// Reasons of AuthFailures.
+const (
+	ReasonMissingToken = "missing_token"
+	ReasonInvalidToken = "invalid_token"
+	ReasonCSRF         = "csrf"
+)
+
+// Methods and results of Logins.
+const (
+	LoginPassword = "password"
+	LoginOIDC     = "oidc"
+	LoginSuccess  = "success"
+	LoginFailure  = "failure"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requests, requestDuration, inFlight,
+		AuthFailures, Logins, PostsCreated, CommentsCreated, RateLimited,
+	)
+}
+
+// Login records a login attempt.
+func Login(method string, ok bool) {
+	result := LoginSuccess
+	if !ok {
+		result = LoginFailure
+	}
+	Logins.WithLabelValues(method, result).Inc()
+}
+
+// RegisterDB adds the connection pool stats of db, labeled with its name.
+func RegisterDB(name string, db *sql.DB) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Middleware records the rate and latency of requests by route pattern, such
+// as /api/posts/{id}, so that ids in paths do not make a series each.
+// Requests refused by a middleware before their route is fully matched, such
+// as those without a token, are recorded under the partial pattern, e.g.
+// /api/posts/*, and requests that match no route as "unmatched".
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		requests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		requestDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,18 @@
+package models
+
+type AccountActivity struct {
+	ID        int    `json:"id"`
+	UserID    int    `json:"userId"`
+	Action    string `json:"action"`
+	Detail    string `json:"detail"`
+	IPAddress string `json:"ipAddress"`
+	CreatedAt string `json:"createdAt"`
+}
+
+type EmailVerification struct {
+	ID        int    `json:"id"`
+	UserID    int    `json:"userId"`
+	Email     string `json:"email"`
+	TokenHash string `json:"-"`
+	ExpiresAt string `json:"expiresAt"`
+}
@@ -0,0 +1,24 @@
+package models
+
+// ReadingList is a named, ordered collection of posts owned by a user.
+type ReadingList struct {
+	ID          int    `json:"id"`
+	UserID      int    `json:"userId"`
+	Name        string `json:"name" validate:"required,max=100"`
+	Description string `json:"description" validate:"max=500"`
+	Public      bool   `json:"public"`
+	PostCount   int    `json:"postCount"`
+	CreatedAt   string `json:"createdAt"`
+	UpdatedAt   string `json:"updatedAt"`
+	Posts       []Post `json:"posts,omitempty"`
+}
+
+// ReadingListEntry adds a post to a reading list.
+type ReadingListEntry struct {
+	PostID int `json:"postId" validate:"required"`
+}
+
+// ReadingListOrder lists every post of a reading list in its new order.
+type ReadingListOrder struct {
+	PostIDs []int `json:"postIds" validate:"required,unique"`
+}
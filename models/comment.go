@@ -4,7 +4,9 @@ type Comment struct {
 	ID        int    `json:"id"`
 	Postid    int    `json:"postId"`
 	AuthorID  int    `json:"authorId"`
-	Content   string `json:"content"`
+	Content   string `json:"content" validate:"required"`
 	CreatedAt string `json:"createdAt"`
 	UpdatedAt string `json:"updatedAt"`
+	// Version goes up by one with every change and is the comment's ETag.
+	Version int `json:"version"`
 }
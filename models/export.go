@@ -0,0 +1,27 @@
+package models
+
+// Data export statuses.
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// Erasure modes applied when a deleted account is purged.
+const (
+	ErasureDelete    = "delete"
+	ErasureAnonymize = "anonymize"
+)
+
+// DeletedUsername is the account anonymized content is reassigned to.
+const DeletedUsername = "deleted user"
+
+type DataExport struct {
+	ID          int    `json:"id"`
+	UserID      int    `json:"userId"`
+	Status      string `json:"status"`
+	Error       string `json:"error,omitempty"`
+	CreatedAt   string `json:"createdAt"`
+	CompletedAt string `json:"completedAt,omitempty"`
+	Archive     []byte `json:"-"`
+}
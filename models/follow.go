@@ -0,0 +1,9 @@
+package models
+
+// Follow is an entry in a follower or following list.
+type Follow struct {
+	UserID      int    `json:"userId"`
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName"`
+	FollowedAt  string `json:"followedAt"`
+}
@@ -0,0 +1,17 @@
+package models
+
+// IdempotencyRecord is the stored outcome of a request sent with an
+// Idempotency-Key header. Status is 0 while the first request is still
+// being handled.
+type IdempotencyRecord struct {
+	UserID int
+	Key    string
+	// Fingerprint is a hash of the method, URL and body, so a key reused for
+	// a different request can be told apart from a retry.
+	Fingerprint string
+	Status      int
+	Headers     map[string][]string
+	Body        []byte
+	CreatedAt   string
+	ExpiresAt   string
+}
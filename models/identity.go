@@ -0,0 +1,10 @@
+package models
+
+type UserIdentity struct {
+	ID        int    `json:"id"`
+	UserID    int    `json:"userId"`
+	Issuer    string `json:"issuer"`
+	Subject   string `json:"subject"`
+	Email     string `json:"email"`
+	CreatedAt string `json:"createdAt"`
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Sort orders for the list endpoints. Not every list supports every order.
+const (
+	SortNewest   = "newest"
+	SortOldest   = "oldest"
+	SortUpdated  = "updated"
+	SortComments = "comments"
+)
+
+// Cursor marks the last item of a page: the value it was sorted by and its
+// id. The next page starts with the items that sort after it.
+type Cursor struct {
+	Sort  string
+	Value string
+	ID    int
+}
+
+// Encode returns the cursor as an opaque string for clients.
+func (c Cursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s|%d|%s", c.Sort, c.ID, c.Value)))
+}
+
+// ParseCursor decodes a cursor produced by Encode.
+func ParseCursor(s string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor")
+	}
+
+	parts := strings.SplitN(string(raw), "|", 3)
+	if len(parts) != 3 || parts[0] == "" {
+		return Cursor{}, fmt.Errorf("invalid cursor")
+	}
+
+	id, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor")
+	}
+
+	return Cursor{Sort: parts[0], ID: id, Value: parts[2]}, nil
+}
+
+// ListOptions selects a page of a list. A zero Limit returns every item.
+// Offset is only used when there is no cursor.
+type ListOptions struct {
+	Sort   string
+	Cursor *Cursor
+	Limit  int
+	Offset int
+}
+
+// Page describes the page of a list that was returned.
+type Page struct {
+	Total      int    `json:"total"`
+	Sort       string `json:"sort"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
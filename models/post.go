@@ -1,10 +1,62 @@
 package models
 
+import "strings"
+
+// Post statuses. Only published posts are listed publicly.
+const (
+	PostDraft     = "draft"
+	PostPublished = "published"
+)
+
 type Post struct {
 	ID        int    `json:"id"`
-	Title     string `json:"title"`
-	Content   string `json:"content"`
+	Title     string `json:"title" validate:"required"`
+	Content   string `json:"content" validate:"required"`
 	AuthorID  int    `json:"authorId"`
+	Status    string `json:"status" validate:"omitempty,oneof=draft published"`
 	CreatedAt string `json:"createdAt"`
 	UpdatedAt string `json:"updatedAt"`
+	// Version goes up by one with every change and is the post's ETag.
+	Version int `json:"version"`
+	// Tags replace the post's tags when set; an empty list removes them.
+	Tags []string `json:"tags" validate:"max=10,dive,min=1,max=32,excludesall=0x2C"`
+}
+
+// NormalizeTags lower cases tags, joins the words of each with hyphens and
+// drops empty and repeated tags.
+func NormalizeTags(tags []string) []string {
+	if tags == nil {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.Join(strings.Fields(strings.ToLower(tag)), "-")
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// PostFilter narrows the posts listing. Zero fields do not filter. Dates are
+// in the database's "2006-01-02 15:04:05" format; the After bounds are
+// inclusive and the Before bounds exclusive.
+type PostFilter struct {
+	Search        string
+	Author        string
+	CreatedAfter  string
+	CreatedBefore string
+	UpdatedAfter  string
+	UpdatedBefore string
+	// Tags matches posts with any of the tags.
+	Tags []string `validate:"max=10,dive,min=1,max=32"`
+	// Status is published, draft or all. Drafts are only ever listed for
+	// ViewerID, their author.
+	Status      string `validate:"omitempty,oneof=published draft all"`
+	HasComments *bool
+	ViewerID    int
 }
@@ -0,0 +1,28 @@
+package models
+
+// Profile is the public view of an author. It never carries the email.
+type Profile struct {
+	ID          int               `json:"id"`
+	Username    string            `json:"username"`
+	DisplayName string            `json:"displayName"`
+	Bio         string            `json:"bio"`
+	Website     string            `json:"website"`
+	SocialLinks map[string]string `json:"socialLinks"`
+	AvatarURL   string            `json:"avatarUrl"`
+	HasAvatar   bool              `json:"hasAvatar"`
+	Followers   int               `json:"followers"`
+	Following   int               `json:"following"`
+}
+
+type ProfileUpdate struct {
+	DisplayName string            `json:"displayName" validate:"max=64"`
+	Bio         string            `json:"bio" validate:"max=500"`
+	Website     string            `json:"website" validate:"omitempty,url,max=255"`
+	SocialLinks map[string]string `json:"socialLinks" validate:"max=10,dive,keys,alphanum,max=32,endkeys,url,max=255"`
+}
+
+type Avatar struct {
+	ContentType string
+	Data        []byte
+	UpdatedAt   string
+}
@@ -1,13 +1,33 @@
 package models
 
 type User struct {
-	ID       int    `json:"id"`
-	Username string `json:"username" validate:"required"`
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8"`
+	ID                  int    `json:"id"`
+	Username            string `json:"username" validate:"required"`
+	Email               string `json:"email" validate:"required,email"`
+	Password            string `json:"password" validate:"required,min=8"`
+	DeletionScheduledAt string `json:"deletionScheduledAt,omitempty"`
 }
 
 type LoginDetails struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required,min=8"`
 }
+
+type UsernameChange struct {
+	Username string `json:"username" validate:"required"`
+}
+
+type EmailChange struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type PasswordChange struct {
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+	NewPassword     string `json:"newPassword" validate:"required,min=8"`
+}
+
+type AccountDeletion struct {
+	Password string `json:"password" validate:"required"`
+	// Mode is either "delete" (the default) or "anonymize".
+	Mode string `json:"mode" validate:"omitempty,oneof=delete anonymize"`
+}
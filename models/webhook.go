@@ -0,0 +1,67 @@
+package models
+
+// Webhook events.
+const (
+	EventPostCreated    = "post.created"
+	EventPostUpdated    = "post.updated"
+	EventPostDeleted    = "post.deleted"
+	EventCommentCreated = "comment.created"
+	EventCommentUpdated = "comment.updated"
+	EventCommentDeleted = "comment.deleted"
+)
+
+// WebhookEvents lists every event a subscription can ask for.
+var WebhookEvents = []string{EventPostCreated, EventPostUpdated, EventPostDeleted, EventCommentCreated, EventCommentUpdated, EventCommentDeleted}
+
+// Webhook delivery statuses. A delivery that keeps failing is moved to dead
+// once its attempts run out and is only sent again on request.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+type WebhookSubscription struct {
+	ID     int    `json:"id"`
+	UserID int    `json:"userId"`
+	URL    string `json:"url"`
+	// Secret signs the deliveries. It is only shown when the subscription
+	// is created.
+	Secret    string   `json:"-"`
+	Events    []string `json:"events"`
+	Active    bool     `json:"active"`
+	CreatedAt string   `json:"createdAt"`
+}
+
+// Wants reports whether the subscription receives the event.
+func (sub WebhookSubscription) Wants(event string) bool {
+	for _, e := range sub.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookRequest creates or replaces a subscription. A secret is generated
+// when none is given.
+type WebhookRequest struct {
+	URL    string   `json:"url" validate:"required,url,max=2048"`
+	Secret string   `json:"secret" validate:"omitempty,min=16,max=255"`
+	Events []string `json:"events" validate:"required,min=1,dive,oneof=post.created post.updated post.deleted comment.created comment.updated comment.deleted"`
+	Active *bool    `json:"active"`
+}
+
+type WebhookDelivery struct {
+	ID             int    `json:"id"`
+	SubscriptionID int    `json:"subscriptionId"`
+	Event          string `json:"event"`
+	Payload        string `json:"payload"`
+	Status         string `json:"status"`
+	Attempts       int    `json:"attempts"`
+	ResponseStatus int    `json:"responseStatus"`
+	Error          string `json:"error,omitempty"`
+	NextAttemptAt  string `json:"nextAttemptAt,omitempty"`
+	CreatedAt      string `json:"createdAt"`
+	CompletedAt    string `json:"completedAt,omitempty"`
+}
@@ -0,0 +1,5 @@
+// Package blogv1 holds the protobuf messages and gRPC services of the blog
+// API, generated from blog.proto.
+package blogv1
+
+//go:generate protoc -I ../.. --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative blog/v1/blog.proto
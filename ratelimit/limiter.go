@@ -0,0 +1,228 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/A-Victory/blog/auth"
+	"github.com/A-Victory/blog/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Limiter limits the requests of each client: the user for authenticated
+// requests, the client IP otherwise.
+type Limiter struct {
+	store   Store
+	proxies []netip.Prefix
+}
+
+// NewLimiter returns a limiter keeping its buckets in store. X-Forwarded-For
+// is only trusted from the proxies listed, as any client can send it.
+func NewLimiter(store Store, trustedProxies []netip.Prefix) *Limiter {
+	return &Limiter{store: store, proxies: trustedProxies}
+}
+
+// ParseProxies reads a comma-separated list of IPs and CIDRs, such as
+// "10.0.0.0/8, 192.168.1.10".
+func ParseProxies(list string) ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, value := range strings.Split(list, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid proxy %q: %w", value, err)
+			}
+			proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %q: %w", value, err)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+func (l *Limiter) trusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range l.proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP of the client of r. When the request comes from a
+// trusted proxy, it is the last address of X-Forwarded-For that is not a
+// trusted proxy itself: the addresses before it were set by the client and
+// prove nothing.
+func (l *Limiter) ClientIP(r *http.Request) string {
+	addr, err := parseAddr(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	if !l.trusted(addr) {
+		return addr.String()
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !l.trusted(addr) {
+			break
+		}
+	}
+	return addr.String()
+}
+
+// parseAddr reads an address with or without its port.
+func parseAddr(value string) (netip.Addr, error) {
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	addr, err := netip.ParseAddr(value)
+	return addr.Unmap(), err
+}
+
+// userKey identifies the user authenticated on ctx, if any.
+func userKey(ctx context.Context) (string, bool) {
+	if id := auth.UserID(ctx); id != 0 {
+		return "user:" + strconv.Itoa(id), true
+	}
+	if username := auth.Username(ctx); username != "" {
+		return "user:" + username, true
+	}
+	return "", false
+}
+
+// Key identifies the client of r. Behind auth.Verify it is the user, so that
+// they keep their requests when their IP changes and users sharing an IP do
+// not use up each other's.
+func (l *Limiter) Key(r *http.Request) string {
+	if key, ok := userKey(r.Context()); ok {
+		return key
+	}
+	return "ip:" + l.ClientIP(r)
+}
+
+// take takes a token of policy for key. A store that fails lets the request
+// through: an outage of a shared store must not take the API down with it.
+func (l *Limiter) take(ctx context.Context, policy Policy, key string) Result {
+	result, err := l.store.Take(ctx, policy.Name+":"+key, policy.Rate, time.Now())
+	if err != nil {
+		slog.WarnContext(ctx, "rate limit store failed, letting the request through", "policy", policy.Name, "error", err)
+		return Result{Allowed: true, Remaining: policy.Rate.Limit}
+	}
+	if !result.Allowed {
+		metrics.RateLimited.WithLabelValues(policy.Name).Inc()
+	}
+	return result
+}
+
+// Limit returns a middleware refusing the requests over the rate of policy
+// with 429 Too Many Requests, written by fail. Every response carries the
+// RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy
+// headers, and refusals Retry-After. A nil Limiter, or a policy without a
+// valid rate, limits nothing.
+func (l *Limiter) Limit(policy Policy, fail func(w http.ResponseWriter, status int, msg string)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if l == nil || !policy.Rate.Valid() {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result := l.take(r.Context(), policy, l.Key(r))
+
+			header := w.Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(policy.Rate.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			header.Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+			header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Rate.Limit, seconds(policy.Rate.Period)))
+			if !result.Allowed {
+				retry := seconds(result.RetryAfter)
+				header.Set("Retry-After", strconv.Itoa(retry))
+				fail(w, http.StatusTooManyRequests, fmt.Sprintf("Too many requests, retry in %d seconds", retry))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// seconds rounds d up to whole seconds, so that clients waiting for it are
+// not refused again.
+func seconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// grpcKey is the gRPC counterpart of Key. Calls reach the API directly, so
+// the peer address is the client IP.
+func grpcKey(ctx context.Context) string {
+	if key, ok := userKey(ctx); ok {
+		return key
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if addr, err := parseAddr(p.Addr.String()); err == nil {
+			return "ip:" + addr.String()
+		}
+		return "ip:" + p.Addr.String()
+	}
+	return "ip:unknown"
+}
+
+func (l *Limiter) grpcTake(ctx context.Context, policy Policy) error {
+	if !policy.Rate.Valid() {
+		return nil
+	}
+	result := l.take(ctx, policy, grpcKey(ctx))
+	if !result.Allowed {
+		return status.Errorf(codes.ResourceExhausted, "too many requests, retry in %d seconds", seconds(result.RetryAfter))
+	}
+	return nil
+}
+
+// UnaryServerInterceptor is the gRPC counterpart of Limit, limiting each
+// method with the policy returned by policyOf. It must run after the auth
+// interceptor to key the calls by user.
+func (l *Limiter) UnaryServerInterceptor(policyOf func(method string) Policy) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if l != nil {
+			if err := l.grpcTake(ctx, policyOf(info.FullMethod)); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of
+// UnaryServerInterceptor. A stream takes a single token when it opens.
+func (l *Limiter) StreamServerInterceptor(policyOf func(method string) Policy) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if l != nil {
+			if err := l.grpcTake(ss.Context(), policyOf(info.FullMethod)); err != nil {
+				return err
+			}
+		}
+		return handler(srv, ss)
+	}
+}
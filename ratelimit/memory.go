@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often MemoryStore drops the buckets that are full.
+const sweepInterval = time.Minute
+
+type memoryBucket struct {
+	Bucket
+	full time.Time
+}
+
+// MemoryStore keeps the buckets in the process. Use it when the API runs as
+// one replica; with more, each replica lets a client through at the full
+// rate.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+	swept   time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*memoryBucket{}}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, rate Rate, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// a full bucket is the same as none, so they are dropped rather than
+	// kept for every client ever seen
+	if now.Sub(s.swept) >= sweepInterval {
+		for k, b := range s.buckets {
+			if !now.Before(b.full) {
+				delete(s.buckets, k)
+			}
+		}
+		s.swept = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{}
+		s.buckets[key] = b
+	}
+	result := b.Take(rate, now)
+	b.full = b.Full(rate)
+	return result, nil
+}
+
+// Len returns the number of buckets kept.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buckets)
+}
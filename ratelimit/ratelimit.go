@@ -0,0 +1,123 @@
+// Package ratelimit limits the request rate of each client with token
+// buckets. A bucket holds up to Limit tokens and refills at Limit tokens per
+// Period; each request takes one. Buckets live in a Store: MemoryStore keeps
+// them in the process, and a store shared by the replicas makes the limits
+// hold across them.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rate is a number of requests per period, written as "10/1m". The period
+// may leave out its count, as in "10/m".
+type Rate struct {
+	Limit  int
+	Period time.Duration
+}
+
+func (rate *Rate) UnmarshalText(text []byte) error {
+	limit, period, ok := strings.Cut(string(text), "/")
+	if !ok {
+		return fmt.Errorf("invalid rate %q, expected requests/period such as 10/1m", text)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(limit))
+	if err != nil {
+		return fmt.Errorf("invalid rate %q: %w", text, err)
+	}
+	period = strings.TrimSpace(period)
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil {
+		return fmt.Errorf("invalid rate %q: %w", text, err)
+	}
+	*rate = Rate{Limit: n, Period: d}
+	return nil
+}
+
+func (rate Rate) MarshalText() ([]byte, error) {
+	return []byte(rate.String()), nil
+}
+
+func (rate Rate) String() string {
+	return strconv.Itoa(rate.Limit) + "/" + rate.Period.String()
+}
+
+// Valid reports whether the rate lets requests through.
+func (rate Rate) Valid() bool {
+	return rate.Limit > 0 && rate.Period > 0
+}
+
+// interval is the time to refill one token.
+func (rate Rate) interval() time.Duration {
+	return rate.Period / time.Duration(rate.Limit)
+}
+
+// Policy is the rate of a group of routes. Each policy has its own buckets,
+// so that reading does not use up the requests left for writing.
+type Policy struct {
+	Name string
+	Rate Rate
+}
+
+// Result is the state of a bucket after a request.
+type Result struct {
+	// Allowed reports whether the request took a token.
+	Allowed bool
+	// Remaining is the number of requests left.
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed. It is zero
+	// when the request was allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets of the clients.
+type Store interface {
+	// Take takes a token from the bucket of key, if it has one, at the
+	// given rate.
+	Take(ctx context.Context, key string, rate Rate, now time.Time) (Result, error)
+}
+
+// Bucket is the state of a token bucket, for stores to keep.
+type Bucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// Take refills the bucket for the time elapsed since it was last updated and
+// takes a token from it, if it has one. A zero Bucket is full.
+func (b *Bucket) Take(rate Rate, now time.Time) Result {
+	limit := float64(rate.Limit)
+	interval := rate.interval()
+	if b.Updated.IsZero() {
+		b.Tokens = limit
+	} else if elapsed := now.Sub(b.Updated); elapsed > 0 {
+		b.Tokens = math.Min(limit, b.Tokens+float64(elapsed)/float64(interval))
+	}
+	b.Updated = now
+
+	result := Result{Allowed: b.Tokens >= 1}
+	if result.Allowed {
+		b.Tokens--
+	} else {
+		result.RetryAfter = time.Duration((1 - b.Tokens) * float64(interval))
+	}
+	result.Remaining = int(b.Tokens)
+	result.Reset = time.Duration((limit - b.Tokens) * float64(interval))
+	return result
+}
+
+// Full returns when the bucket is full again, after which it can be dropped.
+func (b *Bucket) Full(rate Rate) time.Time {
+	missing := float64(rate.Limit) - b.Tokens
+	return b.Updated.Add(time.Duration(missing * float64(rate.interval())))
+}
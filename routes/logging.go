@@ -0,0 +1,110 @@
+package routes
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/A-Victory/blog/logging"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// requestLogger starts the log scope of a request, so that the lines logged
+// while handling it carry its id, method, path and route, and logs the
+// request once it is done. It must run after middleware.RequestID.
+func requestLogger(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ctx := logging.NewScope(r.Context(),
+				slog.String("request_id", middleware.GetReqID(r.Context())),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Any("route", routePattern{chi.RouteContext(r.Context())}),
+			)
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			code := ww.Status()
+			if code == 0 {
+				code = http.StatusOK
+			}
+			level := slog.LevelInfo
+			if code >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+			logger.LogAttrs(ctx, level, "request completed",
+				slog.Int("status", code),
+				slog.Int("bytes", ww.BytesWritten()),
+				slog.Duration("duration", time.Since(start)),
+			)
+		})
+	}
+}
+
+// routePattern logs the route a request matched, such as /api/posts/{id}.
+// The pattern is complete once routing is done, so it is read when a line
+// is logged.
+type routePattern struct {
+	rctx *chi.Context
+}
+
+func (p routePattern) LogValue() slog.Value {
+	if p.rctx == nil {
+		return slog.StringValue("")
+	}
+	return slog.StringValue(p.rctx.RoutePattern())
+}
+
+// unaryLogger is the gRPC counterpart of requestLogger.
+func unaryLogger(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		ctx = logging.NewScope(ctx, slog.String("grpc_method", info.FullMethod))
+
+		resp, err := handler(ctx, req)
+		logCall(ctx, logger, start, err)
+		return resp, err
+	}
+}
+
+// streamLogger is the gRPC counterpart of requestLogger for streams.
+func streamLogger(logger *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx := logging.NewScope(ss.Context(), slog.String("grpc_method", info.FullMethod))
+
+		err := handler(srv, &scopedStream{ServerStream: ss, ctx: ctx})
+		logCall(ctx, logger, start, err)
+		return err
+	}
+}
+
+func logCall(ctx context.Context, logger *slog.Logger, start time.Time, err error) {
+	code := status.Code(err)
+	level := slog.LevelInfo
+	switch code {
+	case codes.Unknown, codes.Internal, codes.Unavailable, codes.DataLoss:
+		level = slog.LevelError
+	}
+	logger.LogAttrs(ctx, level, "call completed",
+		slog.String("grpc_code", code.String()),
+		slog.Duration("duration", time.Since(start)),
+	)
+}
+
+// scopedStream replaces the context of a server stream.
+type scopedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *scopedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,65 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/A-Victory/blog/handlers"
+	"github.com/A-Victory/blog/ratelimit"
+)
+
+// RateLimits are the rates of the route groups. Without a Limiter nothing is
+// limited.
+type RateLimits struct {
+	Limiter *ratelimit.Limiter
+	// Auth is the rate of logins, registrations and email verifications,
+	// per client IP.
+	Auth ratelimit.Rate
+	// Read is the rate of the other reads, per user or client IP.
+	Read ratelimit.Rate
+	// Write is the rate of the requests creating, changing or deleting, per
+	// user.
+	Write ratelimit.Rate
+}
+
+type failFunc = func(w http.ResponseWriter, status int, msg string)
+
+// auth limits the routes signing users in, which are what password guessing
+// hammers.
+func (limits RateLimits) auth(fail failFunc) func(http.Handler) http.Handler {
+	return limits.Limiter.Limit(ratelimit.Policy{Name: "auth", Rate: limits.Auth}, fail)
+}
+
+// content limits the reads and the writes of a route group separately.
+func (limits RateLimits) content(fail failFunc) func(http.Handler) http.Handler {
+	read := limits.Limiter.Limit(ratelimit.Policy{Name: "read", Rate: limits.Read}, fail)
+	write := limits.Limiter.Limit(ratelimit.Policy{Name: "write", Rate: limits.Write}, fail)
+	return func(next http.Handler) http.Handler {
+		reads, writes := read(next), write(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				reads.ServeHTTP(w, r)
+			default:
+				writes.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// grpcPolicy picks the policy of a gRPC method from its name: the public
+// methods sign users in, and the Get, List and Watch methods read.
+func (limits RateLimits) grpcPolicy(method string) ratelimit.Policy {
+	for _, public := range handlers.GRPCPublicMethods {
+		if method == public {
+			return ratelimit.Policy{Name: "auth", Rate: limits.Auth}
+		}
+	}
+	name := method[strings.LastIndex(method, "/")+1:]
+	for _, prefix := range []string{"Get", "List", "Watch"} {
+		if strings.HasPrefix(name, prefix) {
+			return ratelimit.Policy{Name: "read", Rate: limits.Read}
+		}
+	}
+	return ratelimit.Policy{Name: "write", Rate: limits.Write}
+}
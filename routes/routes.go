@@ -1,20 +1,115 @@
 package routes
 
 import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/A-Victory/blog/auth"
 	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/export"
 	"github.com/A-Victory/blog/handlers"
+	"github.com/A-Victory/blog/health"
+	"github.com/A-Victory/blog/mailer"
+	"github.com/A-Victory/blog/metrics"
+	"github.com/A-Victory/blog/search"
+	"github.com/A-Victory/blog/stream"
+	"github.com/A-Victory/blog/tracing"
+	"github.com/A-Victory/blog/webhook"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/render"
 	"github.com/rs/cors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 type ServerConfig struct {
-	DB *conn.DB
-	VA *auth.Validation
+	DB            *conn.DB
+	VA            *auth.Validation
+	OIDC          []*auth.OIDCProvider
+	Mailer        mailer.Mailer
+	BaseURL       string
+	DeletionGrace time.Duration
+	Exports       *export.Worker
+	Search        search.Searcher
+	Webhooks      *webhook.Worker
+	Stream        *stream.Hub
+	// AllowHTTPWebhooks accepts plain http webhook URLs.
+	AllowHTTPWebhooks bool
+	// RequireIfMatch makes If-Match mandatory on post and comment writes.
+	RequireIfMatch bool
+	// IdempotencyWindow is how long Idempotency-Key responses are kept.
+	IdempotencyWindow time.Duration
+	// V1Sunset is when /api/v1 is to be removed, sent in its Sunset header.
+	V1Sunset time.Time
+	// ServeMetrics serves the Prometheus metrics at /metrics. Leave it off
+	// when they are served on an admin port instead.
+	ServeMetrics bool
+	// Logger logs the requests and what the handlers report. It defaults to
+	// slog.Default().
+	Logger *slog.Logger
+	// TLS, when set, makes the gRPC server serve TLS.
+	TLS *tls.Config
+	// Health holds the checks of /livez and /readyz. Without it both always
+	// pass.
+	Health *health.Registry
+	// RateLimits limits the requests of each client.
+	RateLimits RateLimits
+}
+
+// NewGRPCServer returns a gRPC server with the user, post and comment
+// services, backed by the same handler as the HTTP server. Every method but
+// Login needs a token in the "authorization" metadata.
+func NewGRPCServer(config ServerConfig) *grpc.Server {
+	options := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			unaryLogger(config.logger()),
+			tracing.UnaryServerInterceptor(),
+			auth.UnaryServerInterceptor(handlers.GRPCPublicMethods...),
+			config.RateLimits.Limiter.UnaryServerInterceptor(config.RateLimits.grpcPolicy),
+		),
+		grpc.ChainStreamInterceptor(
+			streamLogger(config.logger()),
+			tracing.StreamServerInterceptor(),
+			auth.StreamServerInterceptor(handlers.GRPCPublicMethods...),
+			config.RateLimits.Limiter.StreamServerInterceptor(config.RateLimits.grpcPolicy),
+		),
+	}
+	if config.TLS != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(config.TLS)))
+	}
+
+	server := grpc.NewServer(options...)
+	newHandler(config).RegisterGRPC(server)
+	return server
+}
+
+func newHandler(config ServerConfig) *handlers.HttpHandler {
+	return handlers.NewHttpHandler(&handlers.Config{
+		Database:          config.DB,
+		Validator:         config.VA,
+		OIDCProviders:     config.OIDC,
+		Mailer:            config.Mailer,
+		BaseURL:           config.BaseURL,
+		DeletionGrace:     config.DeletionGrace,
+		Exports:           config.Exports,
+		Search:            config.Search,
+		Webhooks:          config.Webhooks,
+		AllowHTTPWebhooks: config.AllowHTTPWebhooks,
+		Stream:            config.Stream,
+		RequireIfMatch:    config.RequireIfMatch,
+		IdempotencyWindow: config.IdempotencyWindow,
+		Logger:            config.logger(),
+	})
+}
+
+func (config ServerConfig) logger() *slog.Logger {
+	if config.Logger == nil {
+		return slog.Default()
+	}
+	return config.Logger
 }
 
 func NewServer(config ServerConfig) *chi.Mux {
@@ -24,45 +119,52 @@ func NewServer(config ServerConfig) *chi.Mux {
 	router.Use(cors.New(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
 		AllowCredentials: false,
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Authorization"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Session-Mode", "If-Match", "If-None-Match", "Idempotency-Key", "Last-Event-ID", "Traceparent", "Tracestate"},
+		ExposedHeaders:   []string{"Authorization", "Link", "ETag", "Idempotent-Replayed", "Deprecation", "Sunset", "Location", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"},
 		Debug:            true,
 	}).Handler)
 	router.Use(setJSONContentType)
-	router.Use(middleware.Recoverer)
 	router.Use(middleware.RequestID)
-	router.Use(middleware.Logger)
+	router.Use(requestLogger(config.logger()))
+	router.Use(tracing.Middleware)
+	router.Use(metrics.Middleware)
+	router.Use(middleware.Recoverer)
 
-	handler := handlers.NewHttpHandler(&handlers.Config{
-		Database:  config.DB,
-		Validator: config.VA,
-	})
+	handler := newHandler(config)
 
-	router.Get("/health", healthCheck)
+	probes := config.Health
+	if probes == nil {
+		probes = health.NewRegistry()
+	}
+	router.Method(http.MethodGet, "/livez", probes.LivenessHandler())
+	router.Method(http.MethodGet, "/readyz", probes.ReadinessHandler())
+	// kept for the monitors set up before the probes
+	router.Method(http.MethodGet, "/health", probes.LivenessHandler())
+	if config.ServeMetrics {
+		router.Handle("/metrics", metrics.Handler())
+	}
 
 	router.Route("/api", func(r chi.Router) {
+		r.Route("/v2", func(r chi.Router) {
+			v2Routes(r, handler, config.RateLimits)
+		})
 
-		registerRoutes(r, handler)
-
-		authRouter := r.With(auth.Verify)
-
-		authRouter.Get("/users/profile", handler.Profile)
-
-		postRoutes(authRouter, handler)
-
-		commentRoutes(authRouter, handler)
-
+		// the unversioned routes are kept as an alias of v1 for the clients
+		// that predate versioning
+		v1 := deprecated(config.V1Sunset)
+		r.With(v1).Route("/v1", func(r chi.Router) {
+			v1Routes(r, handler, config.RateLimits)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(v1)
+			v1Routes(r, handler, config.RateLimits)
+		})
 	})
 
 	return router
 }
 
-func healthCheck(w http.ResponseWriter, r *http.Request) {
-	render.Status(r, http.StatusOK)
-	render.Data(w, r, []byte("Ok"))
-}
-
 func setJSONContentType(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -70,20 +172,154 @@ func setJSONContentType(next http.Handler) http.Handler {
 	})
 }
 
-func registerRoutes(r chi.Router, httpHandler *handlers.HttpHandler) {
+// v1Routes registers the original API, which answers with customResponse
+// bodies.
+func v1Routes(r chi.Router, handler *handlers.HttpHandler, limits RateLimits) {
+	registerRoutes(r, handler, limits)
+
+	authRouter := r.With(auth.Verify, limits.content(handlers.V1Error), handler.Idempotent)
+
+	authRouter.Get("/users/profile", handler.Profile)
+	authRouter.Post("/users/logout", handler.Logout)
+
+	accountRoutes(authRouter, handler)
+
+	followRoutes(authRouter, handler)
+
+	postRoutes(authRouter, handler)
+
+	bookmarkRoutes(authRouter, handler)
+
+	commentRoutes(authRouter, handler)
+
+	authRouter.Get("/search", handler.Search)
+
+	authRouter.Get("/graphql", handler.GraphQL)
+	authRouter.Post("/graphql", handler.GraphQL)
+
+	webhookRoutes(authRouter, handler)
+}
+
+// v2Routes registers the typed API. It covers users, posts and comments;
+// the rest of the API is only served by v1 for now.
+func v2Routes(r chi.Router, handler *handlers.HttpHandler, limits RateLimits) {
+	v2 := handler.V2()
+
+	r.With(limits.auth(handlers.V2Error)).Post("/users/login", v2.Login)
+	r.With(limits.content(handlers.V2Error)).Get("/users/{username}", v2.User)
+
+	authRouter := r.With(auth.VerifyWith(handlers.V2Error), limits.content(handlers.V2Error), v2.Idempotent)
+
+	authRouter.Get("/users/me", v2.Me)
+	authRouter.Post("/users/{username}/follow", v2.Follow)
+	authRouter.Delete("/users/{username}/follow", v2.Unfollow)
+
+	authRouter.Route("/posts", func(router chi.Router) {
+		router.Get("/", v2.Posts)
+		router.Post("/", v2.CreatePost)
+		router.Get("/{id}", v2.GetPost)
+		router.Patch("/{id}", v2.UpdatePost)
+		router.Delete("/{id}", v2.DeletePost)
+		router.Get("/{postId}/comments", v2.Comments)
+		router.Post("/{postId}/comments", v2.AddComment)
+		router.Get("/{postId}/comments/stream", handler.CommentStream)
+	})
+	authRouter.Route("/comments", func(router chi.Router) {
+		router.Get("/{id}", v2.GetComment)
+		router.Patch("/{id}", v2.UpdateComment)
+		router.Delete("/{id}", v2.DeleteComment)
+	})
+
+	authRouter.Get("/graphql", handler.GraphQL)
+	authRouter.Post("/graphql", handler.GraphQL)
+}
+
+// v1DeprecatedAt is when v2 was released and v1 deprecated.
+var v1DeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
+// deprecated marks the responses of v1 with the Deprecation header, a Link
+// to the successor version and, once a date is set, the Sunset header.
+func deprecated(sunset time.Time) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", v1DeprecatedAt.Unix()))
+			if !sunset.IsZero() {
+				w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			}
+			w.Header().Add("Link", `</api/v2>; rel="successor-version"`)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func registerRoutes(r chi.Router, httpHandler *handlers.HttpHandler, limits RateLimits) {
 	r.Route("/users", func(router chi.Router) {
-		router.Post("/register", httpHandler.CreateUser)
-		router.Post("/login", httpHandler.Login)
+		signIn := router.With(limits.auth(handlers.V1Error))
+		signIn.Post("/register", httpHandler.CreateUser)
+		signIn.Post("/login", httpHandler.Login)
+		signIn.Get("/email/verify", httpHandler.VerifyEmail)
+
+		public := router.With(limits.content(handlers.V1Error))
+		public.Get("/{username}", httpHandler.PublicProfile)
+		public.Get("/{username}/posts", httpHandler.AuthorPosts)
+		public.Get("/{username}/avatar", httpHandler.Avatar)
+		public.Get("/{username}/followers", httpHandler.Followers)
+		public.Get("/{username}/following", httpHandler.Following)
+		public.Get("/{username}/lists", httpHandler.PublicReadingLists)
+		public.Get("/{username}/lists/{listId}", httpHandler.PublicReadingList)
+	})
+	r.With(limits.auth(handlers.V1Error)).Route("/auth/oidc/{provider}", func(router chi.Router) {
+		router.Get("/login", httpHandler.OIDCLogin)
+		router.Get("/callback", httpHandler.OIDCCallback)
 	})
 }
 
+func accountRoutes(r chi.Router, httpHandler *handlers.HttpHandler) {
+	r.Put("/users/username", httpHandler.ChangeUsername)
+	r.Put("/users/email", httpHandler.ChangeEmail)
+	r.Put("/users/password", httpHandler.ChangePassword)
+	r.Delete("/users/profile", httpHandler.DeleteAccount)
+	r.Post("/users/profile/restore", httpHandler.RestoreAccount)
+	r.Put("/users/profile", httpHandler.UpdateProfile)
+	r.Patch("/users/profile", httpHandler.UpdateProfile)
+	r.Put("/users/profile/avatar", httpHandler.UploadAvatar)
+	r.Delete("/users/profile/avatar", httpHandler.DeleteAvatar)
+	r.Get("/users/activity", httpHandler.Activity)
+	r.Post("/users/exports", httpHandler.RequestExport)
+	r.Get("/users/exports/{id}", httpHandler.ExportStatus)
+	r.Get("/users/exports/{id}/download", httpHandler.DownloadExport)
+}
+
+func followRoutes(r chi.Router, httpHandler *handlers.HttpHandler) {
+	r.Post("/users/{username}/follow", httpHandler.Follow)
+	r.Delete("/users/{username}/follow", httpHandler.Unfollow)
+	r.Get("/feed", httpHandler.Feed)
+}
+
 func postRoutes(r chi.Router, httpHandler *handlers.HttpHandler) {
 	r.Route("/posts", func(router chi.Router) {
 		router.Get("/", httpHandler.Post)
 		router.Get("/{id}", httpHandler.Post)
 		router.Put("/{id}", httpHandler.Post)
+		router.Patch("/{id}", httpHandler.Post)
 		router.Delete("/{id}", httpHandler.Post)
 		router.Post("/", httpHandler.Post)
+		router.Put("/{id}/bookmark", httpHandler.Bookmark)
+		router.Delete("/{id}/bookmark", httpHandler.RemoveBookmark)
+	})
+}
+
+func bookmarkRoutes(r chi.Router, httpHandler *handlers.HttpHandler) {
+	r.Get("/bookmarks", httpHandler.Bookmarks)
+	r.Route("/lists", func(router chi.Router) {
+		router.Get("/", httpHandler.ReadingLists)
+		router.Post("/", httpHandler.CreateReadingList)
+		router.Get("/{listId}", httpHandler.ReadingList)
+		router.Put("/{listId}", httpHandler.UpdateReadingList)
+		router.Delete("/{listId}", httpHandler.DeleteReadingList)
+		router.Post("/{listId}/posts", httpHandler.AddToReadingList)
+		router.Delete("/{listId}/posts/{postId}", httpHandler.RemoveFromReadingList)
+		router.Put("/{listId}/order", httpHandler.ReorderReadingList)
 	})
 }
 
@@ -93,9 +329,24 @@ func commentRoutes(r chi.Router, httpHandler *handlers.HttpHandler) {
 			route.Get("/", httpHandler.Comment)
 			route.Post("/", httpHandler.Comment)
 		})
+		router.Get("/stream", httpHandler.CommentStream)
 	})
 	r.Route("/comments", func(route chi.Router) {
+		route.Get("/{id}", httpHandler.Comment)
 		route.Put("/{id}", httpHandler.Comment)
+		route.Patch("/{id}", httpHandler.Comment)
 		route.Delete("/{id}", httpHandler.Comment)
 	})
 }
+
+func webhookRoutes(r chi.Router, httpHandler *handlers.HttpHandler) {
+	r.Route("/webhooks", func(router chi.Router) {
+		router.Get("/", httpHandler.Webhooks)
+		router.Post("/", httpHandler.CreateWebhook)
+		router.Get("/{id}", httpHandler.Webhook)
+		router.Put("/{id}", httpHandler.UpdateWebhook)
+		router.Delete("/{id}", httpHandler.DeleteWebhook)
+		router.Get("/{id}/deliveries", httpHandler.WebhookDeliveries)
+		router.Post("/{id}/deliveries/{deliveryId}/retry", httpHandler.RetryWebhookDelivery)
+	})
+}
@@ -0,0 +1,114 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// SnippetLength is roughly how many characters of text a snippet shows.
+const SnippetLength = 160
+
+type span struct {
+	start, end int
+}
+
+// Highlight returns an HTML-escaped excerpt of text around the first match of
+// words, with every matched word wrapped in <mark>. The excerpt is cut at
+// word boundaries and marked with an ellipsis where text was left out.
+func Highlight(text string, words []string, length int) string {
+	wanted := map[string]bool{}
+	for _, word := range words {
+		wanted[word] = true
+	}
+
+	runes := []rune(text)
+	var matches []span
+	for _, w := range wordSpans(runes) {
+		if wanted[strings.ToLower(string(runes[w.start:w.end]))] {
+			matches = append(matches, w)
+		}
+	}
+
+	start, end := 0, len(runes)
+	if len(runes) > length {
+		if len(matches) > 0 {
+			start = matches[0].start - length/4
+		}
+		if start < 0 {
+			start = 0
+		}
+		end = start + length
+		if end > len(runes) {
+			end = len(runes)
+			start = end - length
+		}
+		start = wordStart(runes, start)
+		end = wordEnd(runes, end)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for _, m := range matches {
+		if m.start < start || m.end > end {
+			continue
+		}
+		b.WriteString(html.EscapeString(string(runes[pos:m.start])))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(string(runes[m.start:m.end])))
+		b.WriteString("</mark>")
+		pos = m.end
+	}
+	b.WriteString(html.EscapeString(string(runes[pos:end])))
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+
+	return strings.TrimSpace(b.String())
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+func wordSpans(runes []rune) []span {
+	var spans []span
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && isWordRune(runes[j]) {
+			j++
+		}
+		spans = append(spans, span{i, j})
+		i = j
+	}
+	return spans
+}
+
+// wordStart moves i forward to the start of a word unless it already is one.
+func wordStart(runes []rune, i int) int {
+	if i == 0 || !isWordRune(runes[i-1]) {
+		return i
+	}
+	for i < len(runes) && isWordRune(runes[i]) {
+		i++
+	}
+	return i
+}
+
+// wordEnd moves i back to the end of a word unless it already is one.
+func wordEnd(runes []rune, i int) int {
+	if i == len(runes) || !isWordRune(runes[i]) {
+		return i
+	}
+	for i > 0 && isWordRune(runes[i-1]) {
+		i--
+	}
+	return i
+}
@@ -0,0 +1,297 @@
+package search
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/A-Victory/blog/models"
+)
+
+type docKey struct {
+	kind string
+	id   int
+}
+
+type document struct {
+	result  Result
+	content string
+	title   []string
+	body    []string
+	counts  map[string]int
+	inTitle map[string]int
+}
+
+// MemoryIndex is an inverted index held in memory. It keeps published posts
+// and the comments on them; comments on posts that are not in the index are
+// never returned.
+type MemoryIndex struct {
+	mu       sync.RWMutex
+	docs     map[docKey]*document
+	postings map[string]map[docKey]bool
+}
+
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{
+		docs:     map[docKey]*document{},
+		postings: map[string]map[docKey]bool{},
+	}
+}
+
+// Load replaces the contents of the index.
+func (idx *MemoryIndex) Load(posts []models.Post, comments []models.Comment) {
+	idx.mu.Lock()
+	idx.docs = map[docKey]*document{}
+	idx.postings = map[string]map[docKey]bool{}
+	idx.mu.Unlock()
+
+	for _, post := range posts {
+		idx.IndexPost(post)
+	}
+	for _, comment := range comments {
+		idx.IndexComment(comment)
+	}
+}
+
+// IndexPost adds or replaces a post. Posts that are not published are
+// removed, which also hides their comments until they are published again.
+func (idx *MemoryIndex) IndexPost(post models.Post) error {
+	key := docKey{TypePost, post.ID}
+	if post.Status != "" && post.Status != models.PostPublished {
+		idx.mu.Lock()
+		idx.remove(key)
+		idx.mu.Unlock()
+		return nil
+	}
+
+	idx.add(key, Result{
+		Type:      TypePost,
+		ID:        post.ID,
+		PostID:    post.ID,
+		AuthorID:  post.AuthorID,
+		Title:     post.Title,
+		CreatedAt: post.CreatedAt,
+	}, post.Title, post.Content)
+	return nil
+}
+
+func (idx *MemoryIndex) IndexComment(comment models.Comment) error {
+	idx.add(docKey{TypeComment, comment.ID}, Result{
+		Type:      TypeComment,
+		ID:        comment.ID,
+		PostID:    comment.Postid,
+		AuthorID:  comment.AuthorID,
+		CreatedAt: comment.CreatedAt,
+	}, "", comment.Content)
+	return nil
+}
+
+// RemovePost removes a post and its comments.
+func (idx *MemoryIndex) RemovePost(postID int) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(docKey{TypePost, postID})
+	for key, doc := range idx.docs {
+		if key.kind == TypeComment && doc.result.PostID == postID {
+			idx.remove(key)
+		}
+	}
+	return nil
+}
+
+func (idx *MemoryIndex) RemoveComment(commentID int) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(docKey{TypeComment, commentID})
+	return nil
+}
+
+func (idx *MemoryIndex) add(key docKey, result Result, title, content string) {
+	doc := &document{
+		result:  result,
+		content: content,
+		title:   Tokenize(title),
+		body:    Tokenize(content),
+		counts:  map[string]int{},
+		inTitle: map[string]int{},
+	}
+	for _, word := range doc.title {
+		doc.inTitle[word]++
+		doc.counts[word]++
+	}
+	for _, word := range doc.body {
+		doc.counts[word]++
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(key)
+	idx.docs[key] = doc
+	for word := range doc.counts {
+		if idx.postings[word] == nil {
+			idx.postings[word] = map[docKey]bool{}
+		}
+		idx.postings[word][key] = true
+	}
+}
+
+// remove deletes a document. The caller holds the write lock.
+func (idx *MemoryIndex) remove(key docKey) {
+	doc, ok := idx.docs[key]
+	if !ok {
+		return
+	}
+	for word := range doc.counts {
+		delete(idx.postings[word], key)
+		if len(idx.postings[word]) == 0 {
+			delete(idx.postings, word)
+		}
+	}
+	delete(idx.docs, key)
+}
+
+func (idx *MemoryIndex) Search(ctx context.Context, q Query) ([]Result, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	candidates := idx.candidates(q.Terms)
+	words := q.Terms.Words()
+
+	var results []Result
+	for key := range candidates {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !q.wants(key.kind) {
+			continue
+		}
+
+		doc := idx.docs[key]
+		result := doc.result
+		if key.kind == TypeComment {
+			post, ok := idx.docs[docKey{TypePost, result.PostID}]
+			if !ok {
+				continue
+			}
+			result.Title = post.result.Title
+		}
+		if !doc.matches(q.Terms) {
+			continue
+		}
+
+		result.Score = idx.score(doc, words)
+		result.Snippet = Highlight(doc.content, words, SnippetLength)
+		results = append(results, result)
+	}
+
+	sortResults(results)
+	return paginate(results, q.Limit, q.Offset), nil
+}
+
+// candidates returns the documents containing every word of the rarest
+// required clause, a superset of the matches that avoids scanning the whole
+// index.
+func (idx *MemoryIndex) candidates(terms Terms) map[docKey]bool {
+	var best map[docKey]bool
+	for _, clause := range terms {
+		if clause.Negated {
+			continue
+		}
+		union := map[docKey]bool{}
+		for _, term := range clause.Alternatives {
+			for key := range idx.postings[term[0]] {
+				union[key] = true
+			}
+		}
+		if best == nil || len(union) < len(best) {
+			best = union
+		}
+	}
+	return best
+}
+
+// score ranks a document with TF-IDF, counting title matches TitleBoost
+// times.
+func (idx *MemoryIndex) score(doc *document, words []string) float64 {
+	total := float64(len(idx.docs))
+	score := 0.0
+	for _, word := range words {
+		tf := float64(doc.counts[word]-doc.inTitle[word]) + TitleBoost*float64(doc.inTitle[word])
+		if tf == 0 {
+			continue
+		}
+		idf := math.Log(1 + total/float64(len(idx.postings[word])))
+		score += (1 + math.Log(tf)) * idf
+	}
+	return math.Round(score*1000) / 1000
+}
+
+func (doc *document) matches(terms Terms) bool {
+	for _, clause := range terms {
+		matched := false
+		for _, term := range clause.Alternatives {
+			if doc.has(term) {
+				matched = true
+				break
+			}
+		}
+		if matched == clause.Negated {
+			return false
+		}
+	}
+	return true
+}
+
+func (doc *document) has(term Term) bool {
+	if !term.isPhrase() {
+		return doc.counts[term[0]] > 0
+	}
+	return containsPhrase(doc.title, term) || containsPhrase(doc.body, term)
+}
+
+func containsPhrase(words []string, phrase Term) bool {
+	for i := 0; i+len(phrase) <= len(words); i++ {
+		found := true
+		for j, word := range phrase {
+			if words[i+j] != word {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// sortResults orders results by score, then newest first.
+func sortResults(results []Result) {
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if results[i].CreatedAt != results[j].CreatedAt {
+			return results[i].CreatedAt > results[j].CreatedAt
+		}
+		if results[i].Type != results[j].Type {
+			return results[i].Type == TypePost
+		}
+		return results[i].ID > results[j].ID
+	})
+}
+
+func paginate(results []Result, limit, offset int) []Result {
+	if offset >= len(results) {
+		return []Result{}
+	}
+	results = results[offset:]
+	if limit > 0 && limit < len(results) {
+		results = results[:limit]
+	}
+	return results
+}
@@ -0,0 +1,199 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/A-Victory/blog/models"
+)
+
+// MySQL searches with the FULLTEXT indexes on posts and comments in boolean
+// mode. MySQL keeps the indexes up to date itself, so the index methods do
+// nothing.
+type MySQL struct {
+	db *sql.DB
+	// MinTokenSize matches the server's innodb_ft_min_token_size. Words
+	// shorter than this are not in the FULLTEXT index, so clauses using
+	// them fall back to a LIKE filter.
+	MinTokenSize int
+}
+
+func NewMySQL(db *sql.DB) *MySQL {
+	return &MySQL{db: db, MinTokenSize: 3}
+}
+
+func (m *MySQL) IndexPost(post models.Post) error          { return nil }
+func (m *MySQL) IndexComment(comment models.Comment) error { return nil }
+func (m *MySQL) RemovePost(postID int) error               { return nil }
+func (m *MySQL) RemoveComment(commentID int) error         { return nil }
+
+func (m *MySQL) Search(ctx context.Context, q Query) ([]Result, error) {
+	// Each type is fetched up to the end of the requested page, then the
+	// two lists are merged by score.
+	window := q.Offset + q.Limit
+	words := q.Terms.Words()
+
+	var results []Result
+	if q.wants(TypePost) {
+		posts, err := m.searchPosts(ctx, q.Terms, window)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, posts...)
+	}
+	if q.wants(TypeComment) {
+		comments, err := m.searchComments(ctx, q.Terms, window)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, comments...)
+	}
+
+	sortResults(results)
+	results = paginate(results, q.Limit, q.Offset)
+	for i := range results {
+		results[i].Snippet = Highlight(results[i].Snippet, words, SnippetLength)
+	}
+	return results, nil
+}
+
+func (m *MySQL) searchPosts(ctx context.Context, terms Terms, limit int) ([]Result, error) {
+	against, filter, filterParams := m.build(terms, "title", "content")
+
+	query := "SELECT id, id, authorId, title, content, createdAt, "
+	params := []interface{}{}
+	if against != "" {
+		query += fmt.Sprintf("%g * MATCH(title) AGAINST(? IN BOOLEAN MODE) + MATCH(content) AGAINST(? IN BOOLEAN MODE)", TitleBoost)
+		params = append(params, against, against)
+	} else {
+		query += "0"
+	}
+	query += " AS score FROM posts WHERE status = ?"
+	params = append(params, models.PostPublished)
+	if against != "" {
+		query += " AND MATCH(title, content) AGAINST(? IN BOOLEAN MODE)"
+		params = append(params, against)
+	}
+	query += filter + " ORDER BY score DESC, createdAt DESC, id DESC LIMIT ?"
+	params = append(params, filterParams...)
+	params = append(params, limit)
+
+	return m.query(ctx, TypePost, query, params...)
+}
+
+func (m *MySQL) searchComments(ctx context.Context, terms Terms, limit int) ([]Result, error) {
+	against, filter, filterParams := m.build(terms, "c.content")
+
+	query := "SELECT c.id, c.postId, c.authorId, p.title, c.content, c.createdAt, "
+	params := []interface{}{}
+	if against != "" {
+		query += "MATCH(c.content) AGAINST(? IN BOOLEAN MODE)"
+		params = append(params, against)
+	} else {
+		query += "0"
+	}
+	query += " AS score FROM comments c JOIN posts p ON p.id = c.postId WHERE p.status = ?"
+	params = append(params, models.PostPublished)
+	if against != "" {
+		query += " AND MATCH(c.content) AGAINST(? IN BOOLEAN MODE)"
+		params = append(params, against)
+	}
+	query += filter + " ORDER BY score DESC, c.createdAt DESC, c.id DESC LIMIT ?"
+	params = append(params, filterParams...)
+	params = append(params, limit)
+
+	return m.query(ctx, TypeComment, query, params...)
+}
+
+// query runs a search query. The content column is returned in Snippet and
+// highlighted once the page is known.
+func (m *MySQL) query(ctx context.Context, kind, query string, params ...interface{}) ([]Result, error) {
+	rows, err := m.db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []Result
+	for rows.Next() {
+		result := Result{Type: kind}
+		if err := rows.Scan(&result.ID, &result.PostID, &result.AuthorID, &result.Title, &result.Snippet, &result.CreatedAt, &result.Score); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// build turns the query into a boolean mode AGAINST string and a LIKE filter
+// for the clauses the FULLTEXT index cannot answer. Negations alone match
+// nothing in boolean mode, so without a required indexed clause every clause
+// becomes a filter.
+func (m *MySQL) build(terms Terms, columns ...string) (string, string, []interface{}) {
+	useMatch := false
+	for _, clause := range terms {
+		if !clause.Negated && m.indexed(clause) {
+			useMatch = true
+		}
+	}
+
+	var against []string
+	var filter strings.Builder
+	var params []interface{}
+
+	for _, clause := range terms {
+		if useMatch && m.indexed(clause) {
+			var alternatives []string
+			for _, term := range clause.Alternatives {
+				alternatives = append(alternatives, booleanTerm(term))
+			}
+			if clause.Negated {
+				for _, alternative := range alternatives {
+					against = append(against, "-"+alternative)
+				}
+			} else {
+				against = append(against, "+("+strings.Join(alternatives, " ")+")")
+			}
+			continue
+		}
+
+		var likes []string
+		for _, term := range clause.Alternatives {
+			for _, column := range columns {
+				likes = append(likes, column+" LIKE ?")
+				params = append(params, "%"+strings.Join(term, " ")+"%")
+			}
+		}
+		if clause.Negated {
+			filter.WriteString(" AND NOT (" + strings.Join(likes, " OR ") + ")")
+		} else {
+			filter.WriteString(" AND (" + strings.Join(likes, " OR ") + ")")
+		}
+	}
+
+	return strings.Join(against, " "), filter.String(), params
+}
+
+// indexed reports whether every word of the clause is in the FULLTEXT index.
+func (m *MySQL) indexed(clause Clause) bool {
+	for _, term := range clause.Alternatives {
+		for _, word := range term {
+			if len([]rune(word)) < m.MinTokenSize {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// booleanTerm quotes phrases. Words only hold letters and digits, so they
+// cannot carry boolean operators.
+func booleanTerm(term Term) string {
+	if term.isPhrase() {
+		return `"` + strings.Join(term, " ") + `"`
+	}
+	return term[0]
+}
@@ -0,0 +1,148 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Term is a single word or, when it holds more than one word, a phrase.
+type Term []string
+
+func (t Term) isPhrase() bool {
+	return len(t) > 1
+}
+
+// Clause is satisfied when any of its alternatives matches. A negated clause
+// excludes the documents that match it.
+type Clause struct {
+	Alternatives []Term
+	Negated      bool
+}
+
+// Terms is a parsed query string. A document matches when it satisfies every
+// clause that is not negated and none of those that are.
+type Terms []Clause
+
+// Parse reads a query string. Words must all match, "quoted words" must match
+// as a phrase, OR between two words or phrases accepts either, and a leading
+// - excludes a word or phrase. A leading + is accepted and ignored.
+func Parse(text string) (Terms, error) {
+	var terms Terms
+	pendingOr := false
+
+	for _, token := range lex(text) {
+		if token.or {
+			if len(terms) == 0 || terms[len(terms)-1].Negated {
+				continue
+			}
+			pendingOr = true
+			continue
+		}
+
+		term := Term(Tokenize(token.text))
+		if len(term) == 0 {
+			continue
+		}
+		if !token.phrase && len(term) > 1 {
+			// Punctuation inside a word, such as "e-mail", splits it
+			// into a phrase.
+			token.phrase = true
+		}
+
+		if pendingOr && !token.negated {
+			last := &terms[len(terms)-1]
+			last.Alternatives = append(last.Alternatives, term)
+			pendingOr = false
+			continue
+		}
+		pendingOr = false
+
+		terms = append(terms, Clause{Alternatives: []Term{term}, Negated: token.negated})
+	}
+
+	for _, clause := range terms {
+		if !clause.Negated {
+			return terms, nil
+		}
+	}
+	return nil, fmt.Errorf("the query must contain at least one word to search for")
+}
+
+// Words returns the distinct words the query looks for, used to rank and
+// highlight results.
+func (terms Terms) Words() []string {
+	seen := map[string]bool{}
+	var words []string
+	for _, clause := range terms {
+		if clause.Negated {
+			continue
+		}
+		for _, term := range clause.Alternatives {
+			for _, word := range term {
+				if !seen[word] {
+					seen[word] = true
+					words = append(words, word)
+				}
+			}
+		}
+	}
+	return words
+}
+
+type lexeme struct {
+	text    string
+	phrase  bool
+	negated bool
+	or      bool
+}
+
+func lex(text string) []lexeme {
+	var tokens []lexeme
+	runes := []rune(text)
+
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		token := lexeme{}
+		for i < len(runes) && (runes[i] == '-' || runes[i] == '+') {
+			token.negated = runes[i] == '-'
+			i++
+		}
+		if i >= len(runes) {
+			break
+		}
+
+		if runes[i] == '"' {
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			token.text = string(runes[i+1 : end])
+			token.phrase = true
+			i = end + 1
+		} else {
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != '"' {
+				end++
+			}
+			token.text = string(runes[i:end])
+			token.or = token.text == "OR" && !token.negated
+			i = end
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	return tokens
+}
+
+// Tokenize splits text into lower case words of letters and digits.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
@@ -0,0 +1,67 @@
+// Package search finds posts and comments matching a query. Searcher has a
+// MySQL FULLTEXT implementation for production and an in-memory inverted
+// index for tests and setups without MySQL; both accept the same query
+// syntax (see Parse) and rank title matches above content matches.
+package search
+
+import (
+	"context"
+
+	"github.com/A-Victory/blog/models"
+)
+
+// Result types.
+const (
+	TypePost    = "post"
+	TypeComment = "comment"
+)
+
+// TitleBoost is how much more a match in a post title counts than a match in
+// its content.
+const TitleBoost = 3.0
+
+// Query is a parsed search request.
+type Query struct {
+	Terms  Terms
+	Types  []string
+	Limit  int
+	Offset int
+}
+
+// wants reports whether results of the given type were requested.
+func (q Query) wants(kind string) bool {
+	if len(q.Types) == 0 {
+		return true
+	}
+	for _, t := range q.Types {
+		if t == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Result is a matching post or comment. Title is the post title, also for
+// comments, and Snippet is an HTML-escaped excerpt with the matched words
+// wrapped in <mark>.
+type Result struct {
+	Type      string  `json:"type"`
+	ID        int     `json:"id"`
+	PostID    int     `json:"postId"`
+	AuthorID  int     `json:"authorId"`
+	Title     string  `json:"title"`
+	Snippet   string  `json:"snippet"`
+	Score     float64 `json:"score"`
+	CreatedAt string  `json:"createdAt"`
+}
+
+// Searcher searches published posts and the comments on them. The index
+// methods keep an index up to date after writes; implementations backed by
+// the database itself may treat them as no-ops.
+type Searcher interface {
+	Search(ctx context.Context, q Query) ([]Result, error)
+	IndexPost(post models.Post) error
+	IndexComment(comment models.Comment) error
+	RemovePost(postID int) error
+	RemoveComment(commentID int) error
+}
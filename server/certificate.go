@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Certificate is a TLS certificate read from disk and reloaded when its files
+// change, so renewed certificates are picked up without a restart.
+type Certificate struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modified time.Time
+}
+
+// LoadCertificate reads the PEM encoded certificate and key.
+func LoadCertificate(certFile, keyFile string) (*Certificate, error) {
+	c := &Certificate{certFile: certFile, keyFile: keyFile}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload reads the files again. The current certificate is kept if they
+// cannot be loaded.
+func (c *Certificate) Reload() error {
+	modified, err := c.lastModified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.modified = modified
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Certificate) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// Watch reloads the certificate whenever its files change, checking every
+// interval until ctx is cancelled.
+func (c *Certificate) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		modified, err := c.lastModified()
+		if err != nil {
+			slog.Error("failed to check the TLS certificate", "error", err)
+			continue
+		}
+		c.mu.RLock()
+		changed := !modified.Equal(c.modified)
+		c.mu.RUnlock()
+		if !changed {
+			continue
+		}
+
+		if err := c.Reload(); err != nil {
+			slog.Error("failed to reload the TLS certificate", "error", err)
+			continue
+		}
+		slog.Info("reloaded the TLS certificate", "cert_file", c.certFile)
+	}
+}
+
+// GetCertificate returns the current certificate, for tls.Config.
+func (c *Certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// TLSConfig returns a TLS configuration serving the current certificate.
+func (c *Certificate) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: c.GetCertificate,
+	}
+}
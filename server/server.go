@@ -0,0 +1,129 @@
+// Package server runs the listeners of the API: HTTP servers with timeouts
+// that keep slow clients from holding connections, TLS with certificates
+// reloaded from disk, and graceful shutdown for HTTP and gRPC.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// Default timeouts.
+const (
+	DefaultReadHeaderTimeout = 5 * time.Second
+	DefaultReadTimeout       = 15 * time.Second
+	DefaultWriteTimeout      = 30 * time.Second
+	DefaultIdleTimeout       = 2 * time.Minute
+	DefaultShutdownTimeout   = 30 * time.Second
+)
+
+type Config struct {
+	Addr string
+	// ReadHeaderTimeout bounds reading the request headers, which is what
+	// slowloris clients drag out.
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout bounds reading the whole request, body included.
+	ReadTimeout time.Duration
+	// WriteTimeout bounds handling the request and writing the response.
+	// Streams lift it for themselves.
+	WriteTimeout time.Duration
+	// IdleTimeout closes keep-alive connections left unused.
+	IdleTimeout time.Duration
+	// Certificate serves TLS when set.
+	Certificate *Certificate
+}
+
+// New returns an HTTP server for handler. Zero timeouts take the defaults.
+func New(config Config, handler http.Handler) *http.Server {
+	srv := &http.Server{
+		Addr:              config.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: orDefault(config.ReadHeaderTimeout, DefaultReadHeaderTimeout),
+		ReadTimeout:       orDefault(config.ReadTimeout, DefaultReadTimeout),
+		WriteTimeout:      orDefault(config.WriteTimeout, DefaultWriteTimeout),
+		IdleTimeout:       orDefault(config.IdleTimeout, DefaultIdleTimeout),
+		MaxHeaderBytes:    1 << 20,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+	if config.Certificate != nil {
+		srv.TLSConfig = config.Certificate.TLSConfig()
+	}
+	return srv
+}
+
+func orDefault(value, fallback time.Duration) time.Duration {
+	if value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// Run serves until ctx is cancelled, then stops accepting connections and
+// waits up to timeout for the requests in flight before closing the ones
+// left. It returns early if the server fails.
+func Run(ctx context.Context, srv *http.Server, timeout time.Duration) error {
+	errs := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			errs <- srv.ListenAndServeTLS("", "")
+		} else {
+			errs <- srv.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdown, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdown); err != nil {
+		srv.Close()
+		return fmt.Errorf("requests still in flight after %s: %w", timeout, err)
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// RunGRPC is the gRPC counterpart of Run, serving on addr.
+func RunGRPC(ctx context.Context, srv *grpc.Server, addr string, timeout time.Duration) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.Serve(listener)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-time.After(timeout):
+		srv.Stop()
+		return fmt.Errorf("calls still in flight after %s", timeout)
+	}
+}
@@ -0,0 +1,49 @@
+package stream
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// LocalBroker passes events within a single process. Use it when the API
+// runs as one replica.
+type LocalBroker struct {
+	mu       sync.Mutex
+	next     int64
+	delivers map[int]func(Event)
+	nextSub  int
+}
+
+// NewLocalBroker returns a broker whose IDs start from the current time in
+// milliseconds, so they keep growing across restarts.
+func NewLocalBroker() *LocalBroker {
+	return &LocalBroker{next: time.Now().UnixMilli(), delivers: map[int]func(Event){}}
+}
+
+func (b *LocalBroker) Publish(ctx context.Context, event Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.next++
+	event.ID = b.next
+	for _, deliver := range b.delivers {
+		deliver(event)
+	}
+	return nil
+}
+
+func (b *LocalBroker) Subscribe(ctx context.Context, deliver func(Event)) error {
+	b.mu.Lock()
+	id := b.nextSub
+	b.nextSub++
+	b.delivers[id] = deliver
+	b.mu.Unlock()
+
+	<-ctx.Done()
+
+	b.mu.Lock()
+	delete(b.delivers, id)
+	b.mu.Unlock()
+	return ctx.Err()
+}
@@ -0,0 +1,84 @@
+package stream
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+// MySQLBroker shares events between replicas through the StreamEvents
+// table. Every replica polls the table for rows it has not seen yet, so the
+// row IDs are the event IDs everywhere. A row committed after a later one was
+// read is skipped; live comments tolerate that, and clients refetching the
+// list after a reconnect see every comment.
+type MySQLBroker struct {
+	db       *sql.DB
+	interval time.Duration
+	// retention is how long rows are kept before they are pruned.
+	retention time.Duration
+}
+
+func NewMySQLBroker(db *sql.DB) *MySQLBroker {
+	return &MySQLBroker{db: db, interval: 500 * time.Millisecond, retention: time.Hour}
+}
+
+func (b *MySQLBroker) Publish(ctx context.Context, event Event) error {
+	createdAt := time.Now().UTC().Format("2006-01-02 15:04:05")
+	_, err := b.db.ExecContext(ctx, "INSERT INTO StreamEvents (topic, type, data, createdAt) VALUES (?, ?, ?, ?)", event.Topic, event.Type, string(event.Data), createdAt)
+	return err
+}
+
+func (b *MySQLBroker) Subscribe(ctx context.Context, deliver func(Event)) error {
+	var last int64
+	if err := b.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM StreamEvents").Scan(&last); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	lastPrune := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		var err error
+		if last, err = b.poll(ctx, last, deliver); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "failed to read stream events", "error", err)
+		}
+
+		if time.Since(lastPrune) > time.Minute {
+			lastPrune = time.Now()
+			cutoff := time.Now().UTC().Add(-b.retention).Format("2006-01-02 15:04:05")
+			if _, err := b.db.ExecContext(ctx, "DELETE FROM StreamEvents WHERE createdAt < ?", cutoff); err != nil && ctx.Err() == nil {
+				slog.ErrorContext(ctx, "failed to prune stream events", "error", err)
+			}
+		}
+	}
+}
+
+// poll delivers the events after last and returns the ID of the last one.
+func (b *MySQLBroker) poll(ctx context.Context, last int64, deliver func(Event)) (int64, error) {
+	rows, err := b.db.QueryContext(ctx, "SELECT id, topic, type, data FROM StreamEvents WHERE id > ? ORDER BY id LIMIT 500", last)
+	if err != nil {
+		return last, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event Event
+		var data string
+		if err := rows.Scan(&event.ID, &event.Topic, &event.Type, &data); err != nil {
+			return last, err
+		}
+		event.Data = []byte(data)
+		deliver(event)
+		last = event.ID
+	}
+
+	return last, rows.Err()
+}
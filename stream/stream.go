@@ -0,0 +1,225 @@
+// Package stream pushes live events to clients over Server-Sent Events. A Hub
+// fans the events of a topic out to the clients in this process and keeps
+// the recent ones so a reconnecting client can resume from its Last-Event-ID.
+// Events travel through a Broker, so with a shared broker every replica sees
+// the events published by the others.
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is one message of a topic. IDs are assigned by the broker and grow
+// with every event.
+type Event struct {
+	ID    int64
+	Topic string
+	Type  string
+	Data  json.RawMessage
+}
+
+// Broker carries events between the replicas of the API.
+type Broker interface {
+	// Publish sends an event to every replica, this one included, and
+	// assigns its ID.
+	Publish(ctx context.Context, event Event) error
+	// Subscribe calls deliver, in order, with the events published from now
+	// on until the context is cancelled.
+	Subscribe(ctx context.Context, deliver func(Event)) error
+}
+
+const (
+	// buffer is how many events a slow client may fall behind before it is
+	// disconnected to resume with Last-Event-ID.
+	buffer = 32
+	// replayWindow is how long events are kept for resuming clients.
+	replayWindow = 5 * time.Minute
+	// replayLimit caps the events kept per topic.
+	replayLimit = 100
+)
+
+// CommentTopic is the topic of a post's comment events.
+func CommentTopic(postID int) string {
+	return "post:" + strconv.Itoa(postID) + ":comments"
+}
+
+type recentEvent struct {
+	event Event
+	at    time.Time
+}
+
+// Hub fans events out to the clients of this process.
+type Hub struct {
+	broker Broker
+
+	mu        sync.Mutex
+	subs      map[string]map[*Subscription]struct{}
+	recent    map[string][]recentEvent
+	lastSweep time.Time
+	closed    bool
+}
+
+func NewHub(broker Broker) *Hub {
+	return &Hub{
+		broker: broker,
+		subs:   map[string]map[*Subscription]struct{}{},
+		recent: map[string][]recentEvent{},
+	}
+}
+
+// Run receives the events of every replica from the broker until the context
+// is cancelled.
+func (h *Hub) Run(ctx context.Context) error {
+	return h.broker.Subscribe(ctx, h.dispatch)
+}
+
+// Publish sends an event with data encoded as JSON.
+func (h *Hub) Publish(ctx context.Context, topic, eventType string, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return h.broker.Publish(ctx, Event{Topic: topic, Type: eventType, Data: encoded})
+}
+
+// Subscribe starts listening to a topic. It returns the recent events after
+// lastEventID, which is 0 for a new client; any later event arrives on the
+// subscription.
+func (h *Hub) Subscribe(topic string, lastEventID int64) (*Subscription, []Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var backlog []Event
+	if lastEventID > 0 {
+		for _, recent := range h.recent[topic] {
+			if recent.event.ID > lastEventID {
+				backlog = append(backlog, recent.event)
+			}
+		}
+	}
+
+	sub := &Subscription{hub: h, topic: topic, events: make(chan Event, buffer)}
+	if h.closed {
+		close(sub.events)
+		return sub, backlog
+	}
+	if h.subs[topic] == nil {
+		h.subs[topic] = map[*Subscription]struct{}{}
+	}
+	h.subs[topic][sub] = struct{}{}
+
+	return sub, backlog
+}
+
+// Close ends every subscription, so that during a shutdown the clients
+// reconnect, to another replica, and resume from their last event. Later
+// subscriptions end at once.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for _, subs := range h.subs {
+		for sub := range subs {
+			h.remove(sub)
+		}
+	}
+}
+
+func (h *Hub) dispatch(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	recent := append(h.recent[event.Topic], recentEvent{event: event, at: now})
+	if len(recent) > replayLimit {
+		recent = recent[len(recent)-replayLimit:]
+	}
+	h.recent[event.Topic] = recent
+	h.sweep(now)
+
+	for sub := range h.subs[event.Topic] {
+		select {
+		case sub.events <- event:
+		default:
+			h.remove(sub)
+		}
+	}
+}
+
+// sweep drops the events that are too old to resume from, at most once a
+// minute.
+func (h *Hub) sweep(now time.Time) {
+	if now.Sub(h.lastSweep) < time.Minute {
+		return
+	}
+	h.lastSweep = now
+
+	for topic, recent := range h.recent {
+		i := 0
+		for i < len(recent) && now.Sub(recent[i].at) > replayWindow {
+			i++
+		}
+		if i == len(recent) {
+			delete(h.recent, topic)
+		} else {
+			h.recent[topic] = recent[i:]
+		}
+	}
+}
+
+// remove unregisters a subscription and closes its channel. The caller
+// holds the lock.
+func (h *Hub) remove(sub *Subscription) {
+	if _, ok := h.subs[sub.topic][sub]; !ok {
+		return
+	}
+	delete(h.subs[sub.topic], sub)
+	if len(h.subs[sub.topic]) == 0 {
+		delete(h.subs, sub.topic)
+	}
+	close(sub.events)
+}
+
+// Subscription receives the events of a topic.
+type Subscription struct {
+	hub    *Hub
+	topic  string
+	events chan Event
+}
+
+// Events returns the channel of new events. It is closed when the client
+// falls too far behind or the hub is closed.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Close stops the subscription.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// Write encodes an event in the text/event-stream format.
+func Write(w io.Writer, event Event) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "id: %d\n", event.ID)
+	if event.Type != "" {
+		fmt.Fprintf(&b, "event: %s\n", event.Type)
+	}
+	for _, line := range strings.Split(string(event.Data), "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
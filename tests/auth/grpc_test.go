@@ -0,0 +1,97 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/A-Victory/blog/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TestUnaryServerInterceptor tests token checks on gRPC calls.
+func TestUnaryServerInterceptor(t *testing.T) {
+	auth.SetSigningKey([]byte("test-signing-key"))
+
+	token, err := auth.GenerateJWT(7, "testuser")
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	interceptor := auth.UnaryServerInterceptor("/blog.v1.UserService/Login")
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return auth.Username(ctx), nil
+	}
+	call := func(ctx context.Context, method string) (interface{}, error) {
+		return interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+	}
+
+	for _, value := range []string{token, "Bearer " + token} {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(auth.AuthorizationMetadata, value))
+		username, err := call(ctx, "/blog.v1.PostService/ListPosts")
+		if err != nil {
+			t.Fatalf("Expected the call to pass with a valid token, got %v", err)
+		}
+		if username != "testuser" {
+			t.Fatalf("Expected username testuser, got %v", username)
+		}
+	}
+
+	for name, ctx := range map[string]context.Context{
+		"missing": context.Background(),
+		"invalid": metadata.NewIncomingContext(context.Background(), metadata.Pairs(auth.AuthorizationMetadata, "not-a-token")),
+	} {
+		_, err := call(ctx, "/blog.v1.PostService/ListPosts")
+		if status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("Expected Unauthenticated with a %s token, got %v", name, err)
+		}
+	}
+
+	if _, err := call(context.Background(), "/blog.v1.UserService/Login"); err != nil {
+		t.Fatalf("Expected public methods to need no token, got %v", err)
+	}
+}
+
+// fakeStream is a server stream that only has a context.
+type fakeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s fakeStream) Context() context.Context {
+	return s.ctx
+}
+
+// TestStreamServerInterceptor tests that streams see the authenticated user.
+func TestStreamServerInterceptor(t *testing.T) {
+	auth.SetSigningKey([]byte("test-signing-key"))
+
+	token, err := auth.GenerateJWT(7, "testuser")
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	interceptor := auth.StreamServerInterceptor()
+	info := &grpc.StreamServerInfo{FullMethod: "/blog.v1.CommentService/WatchComments", IsServerStream: true}
+
+	var username string
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		username = auth.Username(ss.Context())
+		return nil
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(auth.AuthorizationMetadata, token))
+	if err := interceptor(nil, fakeStream{ctx: ctx}, info, handler); err != nil {
+		t.Fatalf("Expected the stream to open with a valid token, got %v", err)
+	}
+	if username != "testuser" {
+		t.Fatalf("Expected username testuser, got %s", username)
+	}
+
+	err = interceptor(nil, fakeStream{ctx: context.Background()}, info, handler)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Expected Unauthenticated without a token, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/A-Victory/blog/auth"
+	"github.com/A-Victory/blog/tests/oidctest"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// staffClaims returns the claims of a verified staff account.
+func staffClaims() jwt.MapClaims {
+	return jwt.MapClaims{"sub": "user-123", "email": "staff@example.com", "email_verified": true}
+}
+
+// newTestProvider starts a mock provider signing in a verified staff
+// account and returns a client of it.
+func newTestProvider(t *testing.T) (*oidctest.Provider, *auth.OIDCProvider) {
+	auth.SetSigningKey([]byte("test-signing-key"))
+
+	mock := oidctest.New(t)
+	mock.SetClaims(staffClaims())
+	return mock, mock.Client(t, auth.OIDCConfig{Name: "corp", RedirectURL: "http://localhost/api/auth/oidc/corp/callback"})
+}
+
+// TestOIDCLoginFlow tests the full authorization code + PKCE flow against the mock provider.
+func TestOIDCLoginFlow(t *testing.T) {
+	mock, provider := newTestProvider(t)
+
+	authURL, stateToken, err := provider.AuthCodeURL()
+	if err != nil {
+		t.Fatalf("Failed to build authorization URL: %v", err)
+	}
+
+	code, state := mock.Authorize(t, authURL)
+
+	identity, err := provider.Exchange(context.Background(), code, state, stateToken)
+	if err != nil {
+		t.Fatalf("Failed to exchange code: %v", err)
+	}
+	if identity.Subject != "user-123" || identity.Issuer != mock.Issuer() {
+		t.Fatalf("Unexpected identity %+v", identity)
+	}
+	if identity.Email != "staff@example.com" || !identity.EmailVerified {
+		t.Fatalf("Expected verified email, got %+v", identity)
+	}
+}
+
+// TestOIDCStateMismatch tests that a callback with a forged state is rejected.
+func TestOIDCStateMismatch(t *testing.T) {
+	mock, provider := newTestProvider(t)
+
+	authURL, stateToken, err := provider.AuthCodeURL()
+	if err != nil {
+		t.Fatalf("Failed to build authorization URL: %v", err)
+	}
+	code, _ := mock.Authorize(t, authURL)
+
+	_, err = provider.Exchange(context.Background(), code, "forged", stateToken)
+	if err == nil {
+		t.Fatal("Expected error for mismatched state, got none")
+	}
+}
+
+// TestOIDCRejectsInvalidIDToken tests ID token validation of nonce and audience.
+func TestOIDCRejectsInvalidIDToken(t *testing.T) {
+	cases := map[string]jwt.MapClaims{
+		"nonce":    {"nonce": "other"},
+		"audience": {"aud": "someone-else"},
+		"expired":  {"exp": time.Now().Add(-time.Hour).Unix()},
+	}
+
+	for name, claims := range cases {
+		t.Run(name, func(t *testing.T) {
+			mock, provider := newTestProvider(t)
+			merged := staffClaims()
+			for k, v := range claims {
+				merged[k] = v
+			}
+			mock.SetClaims(merged)
+
+			authURL, stateToken, err := provider.AuthCodeURL()
+			if err != nil {
+				t.Fatalf("Failed to build authorization URL: %v", err)
+			}
+			code, state := mock.Authorize(t, authURL)
+
+			_, err = provider.Exchange(context.Background(), code, state, stateToken)
+			if err == nil {
+				t.Fatalf("Expected error for invalid %s, got none", name)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/A-Victory/blog/auth"
+)
+
+// protected returns a handler behind auth.Verify that echoes the username.
+func protected() http.Handler {
+	return auth.Verify(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(auth.Username(r.Context())))
+	}))
+}
+
+// TestVerifyAuthorizationHeader tests bare tokens and the Bearer scheme.
+func TestVerifyAuthorizationHeader(t *testing.T) {
+	auth.SetSigningKey([]byte("test-signing-key"))
+
+	token, err := auth.GenerateJWT(1, "testuser")
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	for _, header := range []string{token, "Bearer " + token, "bearer " + token} {
+		req := httptest.NewRequest(http.MethodPost, "/api/posts", nil)
+		req.Header.Set("Authorization", header)
+		rec := httptest.NewRecorder()
+
+		protected().ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for header %q, got %d", header[:10], rec.Code)
+		}
+		if rec.Body.String() != "testuser" {
+			t.Fatalf("Expected username testuser, got %s", rec.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/posts", nil)
+	rec := httptest.NewRecorder()
+	protected().ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 without credentials, got %d", rec.Code)
+	}
+}
+
+// TestVerifySessionCookie tests cookie sessions and the double-submit CSRF check.
+func TestVerifySessionCookie(t *testing.T) {
+	auth.SetSigningKey([]byte("test-signing-key"))
+
+	rec := httptest.NewRecorder()
+	csrf, err := auth.StartSession(rec, 1, "testuser")
+	if err != nil {
+		t.Fatalf("Failed to start session: %v", err)
+	}
+
+	cookies := rec.Result().Cookies()
+	for _, cookie := range cookies {
+		if !cookie.Secure || cookie.SameSite != http.SameSiteStrictMode {
+			t.Fatalf("Expected Secure SameSite=Strict cookie, got %+v", cookie)
+		}
+		if cookie.Name == auth.SessionCookie && !cookie.HttpOnly {
+			t.Fatal("Expected session cookie to be HttpOnly")
+		}
+	}
+
+	newRequest := func(method, csrfHeader string) *http.Request {
+		req := httptest.NewRequest(method, "/api/posts", nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		if csrfHeader != "" {
+			req.Header.Set(auth.CSRFHeader, csrfHeader)
+		}
+		return req
+	}
+
+	cases := []struct {
+		name   string
+		method string
+		csrf   string
+		status int
+	}{
+		{"safe method without csrf", http.MethodGet, "", http.StatusOK},
+		{"unsafe method without csrf", http.MethodPost, "", http.StatusForbidden},
+		{"unsafe method with wrong csrf", http.MethodDelete, "wrong", http.StatusForbidden},
+		{"unsafe method with csrf", http.MethodPost, csrf, http.StatusOK},
+	}
+
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		protected().ServeHTTP(rec, newRequest(c.method, c.csrf))
+		if rec.Code != c.status {
+			t.Fatalf("%s: expected status %d, got %d", c.name, c.status, rec.Code)
+		}
+	}
+}
+
+// TestSessionMode tests how clients select the session mode.
+func TestSessionMode(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/users/login", nil)
+	if mode := auth.SessionMode(req); mode != auth.ModeToken {
+		t.Fatalf("Expected default mode %s, got %s", auth.ModeToken, mode)
+	}
+
+	req.Header.Set(auth.ModeHeader, "cookie")
+	if mode := auth.SessionMode(req); mode != auth.ModeCookie {
+		t.Fatalf("Expected mode %s from header, got %s", auth.ModeCookie, mode)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/auth/oidc/corp/login?mode=cookie", nil)
+	if mode := auth.SessionMode(req); mode != auth.ModeCookie {
+		t.Fatalf("Expected mode %s from query, got %s", auth.ModeCookie, mode)
+	}
+}
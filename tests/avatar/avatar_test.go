@@ -0,0 +1,72 @@
+package avatar_test
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/A-Victory/blog/avatar"
+)
+
+// TestIdenticon tests that identicons are valid, deterministic PNGs.
+func TestIdenticon(t *testing.T) {
+	first, err := avatar.Identicon("testuser")
+	if err != nil {
+		t.Fatalf("Failed to render identicon: %v", err)
+	}
+
+	second, err := avatar.Identicon("testuser")
+	if err != nil {
+		t.Fatalf("Failed to render identicon: %v", err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Fatal("Expected the same seed to render the same identicon")
+	}
+
+	other, err := avatar.Identicon("otheruser")
+	if err != nil {
+		t.Fatalf("Failed to render identicon: %v", err)
+	}
+	if bytes.Equal(first, other) {
+		t.Fatal("Expected different seeds to render different identicons")
+	}
+
+	contentType, err := avatar.Validate(first)
+	if err != nil {
+		t.Fatalf("Expected identicon to pass validation: %v", err)
+	}
+	if contentType != "image/png" {
+		t.Fatalf("Expected image/png, got %s", contentType)
+	}
+}
+
+// TestValidate tests that only reasonably sized images are accepted.
+func TestValidate(t *testing.T) {
+	encode := func(size int) []byte {
+		buf := &bytes.Buffer{}
+		if err := png.Encode(buf, image.NewRGBA(image.Rect(0, 0, size, size))); err != nil {
+			t.Fatalf("Failed to encode image: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	cases := []struct {
+		name  string
+		data  []byte
+		valid bool
+	}{
+		{"small png", encode(64), true},
+		{"empty", nil, false},
+		{"text", []byte("definitely not an image"), false},
+		{"too large", encode(4096), false},
+		{"oversized body", make([]byte, avatar.MaxUploadSize+1), false},
+	}
+
+	for _, c := range cases {
+		_, err := avatar.Validate(c.data)
+		if (err == nil) != c.valid {
+			t.Fatalf("%s: expected valid=%t, got error %v", c.name, c.valid, err)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/A-Victory/blog/config"
+)
+
+// required sets the settings without defaults.
+func required(t *testing.T) {
+	t.Setenv("DB_URI", "root:secret@tcp(localhost:3306)/")
+	t.Setenv("DB_NAME", "blog")
+	t.Setenv("SIGNINGKEY", "test-signing-key")
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestDefaults(t *testing.T) {
+	required(t)
+
+	cfg, err := config.Load(nil)
+	if err != nil {
+		t.Fatalf("Failed to load the configuration: %v", err)
+	}
+	if cfg.HTTP.Port != "8080" || cfg.GRPC.Port != "9090" {
+		t.Errorf("Expected ports 8080 and 9090, got %s and %s", cfg.HTTP.Port, cfg.GRPC.Port)
+	}
+	if cfg.HTTP.ShutdownTimeout != 30*time.Second || cfg.HTTP.ShutdownDelay != 0 {
+		t.Errorf("Expected a 30s shutdown timeout without delay, got %s and %s", cfg.HTTP.ShutdownTimeout, cfg.HTTP.ShutdownDelay)
+	}
+	if cfg.API.DeletionGrace() != 14*24*time.Hour || cfg.API.IdempotencyWindow() != 24*time.Hour {
+		t.Errorf("Unexpected API defaults %+v", cfg.API)
+	}
+	if cfg.Log.Level != "info" || cfg.Log.Format != "json" || cfg.Stream.Broker != "local" || cfg.Search.Backend != "mysql" {
+		t.Errorf("Unexpected defaults %+v", cfg)
+	}
+	if cfg.Auth.SigningKey != "test-signing-key" || cfg.Database.Name != "blog" {
+		t.Errorf("Expected the required settings from the environment, got %+v %+v", cfg.Auth, cfg.Database)
+	}
+}
+
+func TestRequired(t *testing.T) {
+	for _, name := range []string{"DB_URI", "DB_NAME", "SIGNINGKEY"} {
+		t.Setenv(name, "")
+	}
+
+	_, err := config.Load(nil)
+	if err == nil {
+		t.Fatal("Expected missing settings to fail")
+	}
+	for _, name := range []string{"DB_URI", "DB_NAME", "SIGNINGKEY"} {
+		if !strings.Contains(err.Error(), name+" is required") {
+			t.Errorf("Expected %s to be reported missing, got %v", name, err)
+		}
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	required(t)
+	t.Setenv("PORT", "8081")
+	t.Setenv("HTTP_WRITE_TIMEOUT", "1m")
+	t.Setenv("REQUIRE_IF_MATCH", "true")
+	t.Setenv("ACCOUNT_DELETION_GRACE_DAYS", "30")
+	t.Setenv("API_V1_SUNSET", "2027-01-31")
+
+	cfg, err := config.Load(nil)
+	if err != nil {
+		t.Fatalf("Failed to load the configuration: %v", err)
+	}
+	if cfg.HTTP.Port != "8081" || cfg.HTTP.WriteTimeout != time.Minute {
+		t.Errorf("Expected port 8081 and a 1m write timeout, got %s and %s", cfg.HTTP.Port, cfg.HTTP.WriteTimeout)
+	}
+	if !cfg.API.RequireIfMatch || cfg.API.DeletionGrace() != 30*24*time.Hour {
+		t.Errorf("Unexpected API settings %+v", cfg.API)
+	}
+	if want := time.Date(2027, 1, 31, 0, 0, 0, 0, time.UTC); !cfg.API.V1Sunset.Equal(want) {
+		t.Errorf("Expected the sunset on %s, got %s", want, cfg.API.V1Sunset)
+	}
+}
+
+func TestSecretFiles(t *testing.T) {
+	required(t)
+	t.Setenv("SIGNINGKEY", "")
+	t.Setenv("SIGNINGKEY_FILE", writeFile(t, "signing_key", "from-file\n"))
+
+	cfg, err := config.Load(nil)
+	if err != nil {
+		t.Fatalf("Failed to load the configuration: %v", err)
+	}
+	if cfg.Auth.SigningKey != "from-file" {
+		t.Errorf("Expected the signing key from the file, got %q", cfg.Auth.SigningKey)
+	}
+
+	t.Setenv("SIGNINGKEY", "from-env")
+	if _, err := config.Load(nil); err == nil || !strings.Contains(err.Error(), "SIGNINGKEY and SIGNINGKEY_FILE are both set") {
+		t.Errorf("Expected setting both SIGNINGKEY and SIGNINGKEY_FILE to fail, got %v", err)
+	}
+
+	t.Setenv("SIGNINGKEY", "")
+	t.Setenv("SIGNINGKEY_FILE", filepath.Join(t.TempDir(), "missing"))
+	if _, err := config.Load(nil); err == nil {
+		t.Error("Expected a missing secret file to fail")
+	}
+}
+
+func TestFiles(t *testing.T) {
+	files := map[string]string{
+		"blog.yaml": `
+http:
+  port: "8082"
+  idleTimeout: 5m
+database:
+  name: from-file
+oidc:
+  - name: corp
+    issuer: https://id.example.com
+    clientId: blog
+    redirectUrl: https://blog.example.com/api/auth/oidc/corp/callback
+`,
+		"blog.toml": `
+[http]
+port = "8082"
+idleTimeout = "5m"
+
+[database]
+name = "from-file"
+
+[[oidc]]
+name = "corp"
+issuer = "https://id.example.com"
+clientId = "blog"
+redirectUrl = "https://blog.example.com/api/auth/oidc/corp/callback"
+`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			required(t)
+			t.Setenv("DB_NAME", "")
+			t.Setenv("CONFIG_FILE", writeFile(t, name, content))
+
+			cfg, err := config.Load(nil)
+			if err != nil {
+				t.Fatalf("Failed to load the configuration: %v", err)
+			}
+			if cfg.HTTP.Port != "8082" || cfg.HTTP.IdleTimeout != 5*time.Minute || cfg.Database.Name != "from-file" {
+				t.Errorf("Expected the settings of the file, got %+v %+v", cfg.HTTP, cfg.Database)
+			}
+			if cfg.HTTP.ReadTimeout != 15*time.Second {
+				t.Errorf("Expected the settings missing from the file to keep their defaults, got %s", cfg.HTTP.ReadTimeout)
+			}
+			if len(cfg.OIDC) != 1 || cfg.OIDC[0].Name != "corp" || cfg.OIDC[0].ClientID != "blog" {
+				t.Errorf("Expected the corp identity provider, got %+v", cfg.OIDC)
+			}
+		})
+	}
+}
+
+func TestUnknownFileSettings(t *testing.T) {
+	files := map[string]string{
+		"blog.yaml": "http:\n  prot: \"8082\"\n",
+		"blog.toml": "[http]\nprot = \"8082\"\n",
+		"blog.json": "{}",
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			required(t)
+			if _, err := config.Load([]string{"-config", writeFile(t, name, content)}); err == nil {
+				t.Error("Expected the settings file to be rejected")
+			}
+		})
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	required(t)
+	t.Setenv("CONFIG_FILE", writeFile(t, "blog.yaml", "log:\n  level: warn\n  format: text\nhttp:\n  port: \"8082\"\n"))
+	t.Setenv("LOG_LEVEL", "error")
+	t.Setenv("PORT", "8083")
+
+	cfg, err := config.Load([]string{"-port", "8084", "-require-if-match"})
+	if err != nil {
+		t.Fatalf("Failed to load the configuration: %v", err)
+	}
+	if cfg.Log.Format != "text" {
+		t.Errorf("Expected the file over the default, got %s", cfg.Log.Format)
+	}
+	if cfg.Log.Level != "error" {
+		t.Errorf("Expected the environment over the file, got %s", cfg.Log.Level)
+	}
+	if cfg.HTTP.Port != "8084" {
+		t.Errorf("Expected the flag over the environment, got %s", cfg.HTTP.Port)
+	}
+	if !cfg.API.RequireIfMatch {
+		t.Error("Expected a boolean flag without value to be true")
+	}
+}
+
+func TestOIDCEnvironment(t *testing.T) {
+	required(t)
+	t.Setenv("CONFIG_FILE", writeFile(t, "blog.yaml", "oidc:\n  - name: other\n    issuer: https://other.example.com\n    clientId: blog\n    redirectUrl: https://blog.example.com/cb\n"))
+	t.Setenv("OIDC_PROVIDERS", "corp")
+	t.Setenv("OIDC_CORP_ISSUER", "https://id.example.com")
+	t.Setenv("OIDC_CORP_CLIENT_ID", "blog")
+	t.Setenv("OIDC_CORP_CLIENT_SECRET_FILE", writeFile(t, "client_secret", "s3cret\n"))
+	t.Setenv("OIDC_CORP_REDIRECT_URL", "https://blog.example.com/api/auth/oidc/corp/callback")
+	t.Setenv("OIDC_CORP_AUTO_PROVISION", "true")
+
+	cfg, err := config.Load(nil)
+	if err != nil {
+		t.Fatalf("Failed to load the configuration: %v", err)
+	}
+	want := config.OIDCProvider{
+		Name:          "corp",
+		Issuer:        "https://id.example.com",
+		ClientID:      "blog",
+		ClientSecret:  "s3cret",
+		RedirectURL:   "https://blog.example.com/api/auth/oidc/corp/callback",
+		AutoProvision: true,
+	}
+	if len(cfg.OIDC) != 1 || cfg.OIDC[0] != want {
+		t.Errorf("Expected the providers of the environment to replace those of the file, got %+v", cfg.OIDC)
+	}
+
+	t.Setenv("OIDC_CORP_ISSUER", "")
+	if _, err := config.Load(nil); err == nil || !strings.Contains(err.Error(), "identity provider corp needs an issuer") {
+		t.Errorf("Expected a provider without issuer to fail, got %v", err)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	cases := map[string]struct {
+		env  map[string]string
+		args []string
+		want string
+	}{
+		"port":          {env: map[string]string{"PORT": "http"}, want: "PORT must be a port number"},
+		"duration":      {env: map[string]string{"HTTP_READ_TIMEOUT": "soon"}, want: "HTTP_READ_TIMEOUT"},
+		"zero timeout":  {env: map[string]string{"SHUTDOWN_TIMEOUT": "0s"}, want: "SHUTDOWN_TIMEOUT must be positive"},
+		"negative":      {env: map[string]string{"SHUTDOWN_DELAY": "-1s"}, want: "SHUTDOWN_DELAY cannot be negative"},
+		"tls":           {env: map[string]string{"TLS_CERT_FILE": "cert.pem"}, want: "TLS_CERT_FILE and TLS_KEY_FILE"},
+		"grace":         {env: map[string]string{"ACCOUNT_DELETION_GRACE_DAYS": "0"}, want: "ACCOUNT_DELETION_GRACE_DAYS must be at least 1"},
+		"window":        {env: map[string]string{"IDEMPOTENCY_WINDOW_HOURS": "0"}, want: "IDEMPOTENCY_WINDOW_HOURS must be at least 1"},
+		"date":          {env: map[string]string{"API_V1_SUNSET": "31/01/2027"}, want: "API_V1_SUNSET"},
+		"log level":     {env: map[string]string{"LOG_LEVEL": "loud"}, want: "LOG_LEVEL"},
+		"broker":        {env: map[string]string{"STREAM_BROKER": "kafka"}, want: "STREAM_BROKER must be local or mysql"},
+		"flag":          {args: []string{"-search-backend", "elastic"}, want: "SEARCH_BACKEND must be mysql or memory"},
+		"unknown flag":  {args: []string{"-prot", "8080"}, want: "-prot"},
+		"extra":         {args: []string{"serve"}, want: "unexpected arguments"},
+		"boolean value": {env: map[string]string{"REQUIRE_IF_MATCH": "yes"}, want: "REQUIRE_IF_MATCH"},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			required(t)
+			for key, value := range c.env {
+				t.Setenv(key, value)
+			}
+			_, err := config.Load(c.args)
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("Expected an error mentioning %q, got %v", c.want, err)
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	required(t)
+	t.Setenv("CONFIG_FILE", writeFile(t, "blog.yaml", "rateLimit:\n  auth: 5/m\n  trustedProxies: 10.0.0.0/8\n"))
+	t.Setenv("RATE_LIMIT_WRITE", "100/1h")
+
+	cfg, err := config.Load(nil)
+	if err != nil {
+		t.Fatalf("Failed to load the configuration: %v", err)
+	}
+	limits := cfg.RateLimit
+	if !limits.Enabled || limits.TrustedProxies != "10.0.0.0/8" {
+		t.Errorf("Unexpected rate limit settings %+v", limits)
+	}
+	if limits.Auth.String() != "5/1m0s" || limits.Read.String() != "300/1m0s" || limits.Write.String() != "100/1h0m0s" {
+		t.Errorf("Expected the rates of the file, the default and the environment, got %s, %s and %s", limits.Auth, limits.Read, limits.Write)
+	}
+
+	t.Setenv("RATE_LIMIT_READ", "0/1m")
+	if _, err := config.Load(nil); err == nil || !strings.Contains(err.Error(), "RATE_LIMIT_READ must allow requests") {
+		t.Errorf("Expected a zero rate to fail, got %v", err)
+	}
+	if _, err := config.Load([]string{"-rate-limit=false"}); err != nil {
+		t.Errorf("Expected the rates to be ignored when rate limiting is off, got %v", err)
+	}
+
+	t.Setenv("TRUSTED_PROXIES", "proxy.local")
+	if _, err := config.Load([]string{"-rate-limit=false"}); err == nil || !strings.Contains(err.Error(), "TRUSTED_PROXIES") {
+		t.Errorf("Expected an invalid proxy to fail, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package conn_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/models"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// TestActivityFunctions tests AddActivity, GetActivity and the email verification functions.
+func TestActivityFunctions(t *testing.T) {
+	// Setup test database
+	dbConn := setupTestDB(t)
+	defer cleanupTestDB(dbConn.DB, t, testDBName)
+
+	// Initialize database
+	err := dbConn.Initialize()
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	db := conn.NewConn(dbConn)
+
+	user := models.User{
+		Username: "testuser",
+		Email:    "test@example.com",
+		Password: "password123",
+	}
+	userID, err := db.SaveUser(user)
+	if err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+
+	// Test AddActivity
+	for _, action := range []string{"password_changed", "username_changed"} {
+		id, err := db.AddActivity(models.AccountActivity{UserID: userID, Action: action, IPAddress: "127.0.0.1"})
+		if err != nil {
+			t.Fatalf("Failed to add activity: %v", err)
+		}
+		if id <= 0 {
+			t.Fatalf("Invalid activity ID returned: %d", id)
+		}
+	}
+
+	// Test GetActivity returns the newest entry first
+	activity, err := db.GetActivity(userID, 10, 0)
+	if err != nil {
+		t.Fatalf("Failed to get activity: %v", err)
+	}
+	if len(activity) != 2 {
+		t.Fatalf("Expected 2 activity entries, got %d", len(activity))
+	}
+	if activity[0].Action != "username_changed" {
+		t.Fatalf("Expected newest entry first, got %s", activity[0].Action)
+	}
+
+	// Test SaveEmailVerification and GetEmailVerification
+	verification := models.EmailVerification{
+		UserID:    userID,
+		Email:     "new@example.com",
+		TokenHash: "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		ExpiresAt: time.Now().Add(time.Hour).Local().Format("2006-01-02 15:04:05"),
+	}
+	verificationID, err := db.SaveEmailVerification(verification)
+	if err != nil {
+		t.Fatalf("Failed to save email verification: %v", err)
+	}
+
+	saved, err := db.GetEmailVerification(verification.TokenHash)
+	if err != nil {
+		t.Fatalf("Failed to get email verification: %v", err)
+	}
+	if saved.ID != verificationID || saved.Email != verification.Email {
+		t.Fatalf("Expected verification %d for %s, got %+v", verificationID, verification.Email, saved)
+	}
+
+	// Test DeleteEmailVerification
+	if _, err := db.DeleteEmailVerification(verificationID); err != nil {
+		t.Fatalf("Failed to delete email verification: %v", err)
+	}
+	saved, err = db.GetEmailVerification(verification.TokenHash)
+	if err != nil {
+		t.Fatalf("Failed to get email verification: %v", err)
+	}
+	if saved.ID != 0 {
+		t.Fatal("Expected verification to be deleted, but it still exists")
+	}
+}
@@ -0,0 +1,88 @@
+package conn_test
+
+import (
+	"testing"
+
+	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/models"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// TestBatchLoading tests the lookups that load the authors, posts and
+// comments of many posts at once.
+func TestBatchLoading(t *testing.T) {
+	// Setup test database
+	dbConn := setupTestDB(t)
+	defer cleanupTestDB(dbConn.DB, t, testDBName)
+
+	// Initialize database
+	err := dbConn.Initialize()
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	db := conn.NewConn(dbConn)
+
+	writerID, err := db.SaveUser(models.User{Username: "writer", Email: "writer@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+	readerID, err := db.SaveUser(models.User{Username: "reader", Email: "reader@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+
+	profiles, err := db.GetProfilesByIDs([]int{writerID, readerID, 9999})
+	if err != nil {
+		t.Fatalf("Failed to get profiles: %v", err)
+	}
+	if len(profiles) != 2 || profiles[writerID].Username != "writer" || profiles[readerID].Username != "reader" {
+		t.Fatalf("Expected the writer and reader profiles, got %v", profiles)
+	}
+
+	first, err := db.CreatePost(models.Post{Title: "First", Content: "Content", AuthorID: writerID, Tags: []string{"go"}})
+	if err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+	second, err := db.CreatePost(models.Post{Title: "Second", Content: "Content", AuthorID: writerID})
+	if err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+
+	posts, err := db.GetPostsByIDs([]int{first, second, 9999})
+	if err != nil {
+		t.Fatalf("Failed to get posts: %v", err)
+	}
+	if len(posts) != 2 || posts[first].Title != "First" || len(posts[first].Tags) != 1 {
+		t.Fatalf("Expected both posts with their tags, got %v", posts)
+	}
+
+	for _, content := range []string{"one", "two", "three"} {
+		if _, err := db.AddComment(models.Comment{Postid: first, AuthorID: readerID, Content: content}); err != nil {
+			t.Fatalf("Failed to add comment: %v", err)
+		}
+	}
+
+	comments, err := db.GetRecentComments([]int{first, second}, models.SortOldest, 2)
+	if err != nil {
+		t.Fatalf("Failed to get recent comments: %v", err)
+	}
+	if len(comments[first]) != 2 || comments[first][0].Content != "one" || comments[first][1].Content != "two" {
+		t.Fatalf("Expected the two oldest comments, got %v", comments[first])
+	}
+	if len(comments[second]) != 0 {
+		t.Fatalf("Expected no comments on the second post, got %v", comments[second])
+	}
+
+	if _, err := db.GetRecentComments([]int{first}, "comments", 2); err != conn.ErrInvalidSort {
+		t.Fatalf("Expected ErrInvalidSort, got %v", err)
+	}
+
+	counts, err := db.CountComments([]int{first, second})
+	if err != nil {
+		t.Fatalf("Failed to count comments: %v", err)
+	}
+	if counts[first] != 3 || counts[second] != 0 {
+		t.Fatalf("Expected 3 and 0 comments, got %v", counts)
+	}
+}
@@ -0,0 +1,199 @@
+package conn_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/models"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// TestBookmarkFunctions tests AddBookmark, RemoveBookmark and GetBookmarkedPosts.
+func TestBookmarkFunctions(t *testing.T) {
+	// Setup test database
+	dbConn := setupTestDB(t)
+	defer cleanupTestDB(dbConn.DB, t, testDBName)
+
+	// Initialize database
+	err := dbConn.Initialize()
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	db := conn.NewConn(dbConn)
+
+	userID, err := db.SaveUser(models.User{Username: "testuser", Email: "test@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+
+	var postIDs []int
+	for _, title := range []string{"Go tips", "Rust tips", "Go generics"} {
+		id, err := db.CreatePost(models.Post{Title: title, Content: "Content", AuthorID: userID})
+		if err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+		postIDs = append(postIDs, id)
+
+		rows, err := db.AddBookmark(userID, id)
+		if err != nil {
+			t.Fatalf("Failed to add bookmark: %v", err)
+		}
+		if rows != 1 {
+			t.Fatalf("Expected 1 bookmark added, got %d", rows)
+		}
+	}
+
+	// Test bookmarking twice is a no-op
+	rows, err := db.AddBookmark(userID, postIDs[0])
+	if err != nil {
+		t.Fatalf("Failed to add bookmark again: %v", err)
+	}
+	if rows != 0 {
+		t.Fatalf("Expected repeated bookmark to be ignored, got %d", rows)
+	}
+
+	// Test GetBookmarkedPosts with search and pagination
+	search := "Go"
+	posts, page, err := db.GetBookmarkedPosts(userID, models.ListOptions{Limit: 10}, search)
+	if err != nil {
+		t.Fatalf("Failed to get bookmarks: %v", err)
+	}
+	if len(posts) != 2 {
+		t.Fatalf("Expected 2 bookmarked posts matching %q, got %d", search, len(posts))
+	}
+	if page.Total != 2 || page.NextCursor != "" {
+		t.Fatalf("Expected a single page of 2 posts, got %+v", page)
+	}
+
+	posts, page, err = db.GetBookmarkedPosts(userID, models.ListOptions{Limit: 1}, "")
+	if err != nil {
+		t.Fatalf("Failed to get bookmarks: %v", err)
+	}
+	if len(posts) != 1 {
+		t.Fatalf("Expected 1 bookmarked post on the page, got %d", len(posts))
+	}
+	if page.NextCursor == "" {
+		t.Fatal("Expected a cursor to the next page")
+	}
+
+	// Test RemoveBookmark
+	rows, err = db.RemoveBookmark(userID, postIDs[1])
+	if err != nil {
+		t.Fatalf("Failed to remove bookmark: %v", err)
+	}
+	if rows != 1 {
+		t.Fatalf("Expected 1 bookmark removed, got %d", rows)
+	}
+
+	posts, _, err = db.GetBookmarkedPosts(userID, models.ListOptions{}, "")
+	if err != nil {
+		t.Fatalf("Failed to get bookmarks: %v", err)
+	}
+	if len(posts) != 2 {
+		t.Fatalf("Expected 2 bookmarked posts, got %d", len(posts))
+	}
+}
+
+// TestReadingListFunctions tests the reading list functions.
+func TestReadingListFunctions(t *testing.T) {
+	// Setup test database
+	dbConn := setupTestDB(t)
+	defer cleanupTestDB(dbConn.DB, t, testDBName)
+
+	// Initialize database
+	err := dbConn.Initialize()
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	db := conn.NewConn(dbConn)
+
+	userID, err := db.SaveUser(models.User{Username: "testuser", Email: "test@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+
+	// Test CreateReadingList rejects duplicate names
+	listID, err := db.CreateReadingList(models.ReadingList{UserID: userID, Name: "Weekend", Public: true})
+	if err != nil {
+		t.Fatalf("Failed to create reading list: %v", err)
+	}
+	if _, err := db.CreateReadingList(models.ReadingList{UserID: userID, Name: "Weekend"}); !errors.Is(err, conn.ErrDuplicateList) {
+		t.Fatalf("Expected ErrDuplicateList, got %v", err)
+	}
+	if _, err := db.CreateReadingList(models.ReadingList{UserID: userID, Name: "Private"}); err != nil {
+		t.Fatalf("Failed to create reading list: %v", err)
+	}
+
+	// Test AddToReadingList appends in order
+	var postIDs []int
+	for _, title := range []string{"First", "Second", "Third"} {
+		id, err := db.CreatePost(models.Post{Title: title, Content: "Content", AuthorID: userID})
+		if err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+		postIDs = append(postIDs, id)
+		if _, err := db.AddToReadingList(listID, id); err != nil {
+			t.Fatalf("Failed to add to reading list: %v", err)
+		}
+	}
+
+	posts, err := db.GetReadingListPosts(listID, 0)
+	if err != nil {
+		t.Fatalf("Failed to get reading list posts: %v", err)
+	}
+	if len(posts) != 3 || posts[0].Title != "First" || posts[2].Title != "Third" {
+		t.Fatalf("Unexpected reading list order: %+v", posts)
+	}
+
+	// Test ReorderReadingList
+	if err := db.ReorderReadingList(listID, []int{postIDs[2], postIDs[0], postIDs[1]}); err != nil {
+		t.Fatalf("Failed to reorder reading list: %v", err)
+	}
+	posts, err = db.GetReadingListPosts(listID, 0)
+	if err != nil {
+		t.Fatalf("Failed to get reading list posts: %v", err)
+	}
+	if posts[0].Title != "Third" || posts[1].Title != "First" {
+		t.Fatalf("Unexpected reading list order after reorder: %+v", posts)
+	}
+	if err := db.ReorderReadingList(listID, []int{postIDs[0]}); !errors.Is(err, conn.ErrInvalidOrder) {
+		t.Fatalf("Expected ErrInvalidOrder for a partial order, got %v", err)
+	}
+
+	// Test GetReadingLists with and without private lists
+	lists, err := db.GetReadingLists(userID, true)
+	if err != nil {
+		t.Fatalf("Failed to get reading lists: %v", err)
+	}
+	if len(lists) != 1 || lists[0].PostCount != 3 {
+		t.Fatalf("Expected 1 public list with 3 posts, got %+v", lists)
+	}
+	lists, err = db.GetReadingLists(userID, false)
+	if err != nil {
+		t.Fatalf("Failed to get reading lists: %v", err)
+	}
+	if len(lists) != 2 {
+		t.Fatalf("Expected 2 lists, got %d", len(lists))
+	}
+
+	// Test RemoveFromReadingList, UpdateReadingList and DeleteReadingList
+	if rows, err := db.RemoveFromReadingList(listID, postIDs[1]); err != nil || rows != 1 {
+		t.Fatalf("Failed to remove from reading list: %v", err)
+	}
+	if rows, err := db.UpdateReadingList(models.ReadingList{ID: listID, UserID: userID, Name: "Someday"}); err != nil || rows != 1 {
+		t.Fatalf("Failed to update reading list: %v", err)
+	}
+	list, err := db.GetReadingList(listID)
+	if err != nil {
+		t.Fatalf("Failed to get reading list: %v", err)
+	}
+	if list.Name != "Someday" || list.Public || list.PostCount != 2 {
+		t.Fatalf("Unexpected reading list after update: %+v", list)
+	}
+	if rows, err := db.DeleteReadingList(listID, userID); err != nil || rows != 1 {
+		t.Fatalf("Failed to delete reading list: %v", err)
+	}
+}
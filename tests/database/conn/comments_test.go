@@ -66,7 +66,7 @@ func TestCommentFunctions(t *testing.T) {
 	}
 
 	// Test GetComments
-	comments, err := db.GetComments(postID, 10, 0)
+	comments, _, err := db.GetComments(postID, models.ListOptions{Limit: 10})
 	if err != nil {
 		t.Fatalf("Failed to get comments: %v", err)
 	}
@@ -104,7 +104,7 @@ func TestCommentFunctions(t *testing.T) {
 	}
 
 	// Test DeleteComment
-	deletedCommentID, err := db.DeleteComment(commentID)
+	deletedCommentID, err := db.DeleteComment(commentID, 0)
 	if err != nil {
 		t.Fatalf("Failed to delete comment: %v", err)
 	}
@@ -113,7 +113,7 @@ func TestCommentFunctions(t *testing.T) {
 	}
 
 	// Verify the comment is deleted
-	comments, err = db.GetComments(postID, 10, 0)
+	comments, _, err = db.GetComments(postID, models.ListOptions{Limit: 10})
 	if err != nil {
 		t.Fatalf("Failed to get comments: %v", err)
 	}
@@ -37,7 +37,7 @@ func cleanupTestDB(db *sql.DB, t *testing.T, dbName string) {
 		}
 	*/
 
-	_, err := db.Exec("DROP TABLE IF EXISTS comments, posts, users")
+	_, err := db.Exec("DROP TABLE IF EXISTS streamevents, webhookdeliveries, webhooksubscriptions, idempotencykeys, posttags, readinglistitems, readinglists, bookmarks, feeditems, follows, useravatars, dataexports, emailverifications, accountactivity, useridentities, comments, posts, users, schemamigrations")
 	if err != nil {
 		t.Fatalf("Failed to clean up test database tables: %v", err)
 	}
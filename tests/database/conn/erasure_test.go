@@ -0,0 +1,97 @@
+package conn_test
+
+import (
+	"testing"
+
+	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/models"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// TestEraseUser tests both erasure modes and the export functions.
+func TestEraseUser(t *testing.T) {
+	// Setup test database
+	dbConn := setupTestDB(t)
+	defer cleanupTestDB(dbConn.DB, t, testDBName)
+
+	// Initialize database
+	err := dbConn.Initialize()
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	db := conn.NewConn(dbConn)
+
+	deletedUser, err := db.GetUser("username", models.DeletedUsername)
+	if err != nil {
+		t.Fatalf("Expected the deleted user account to exist: %v", err)
+	}
+
+	newAuthor := func(name string) (int, int, int) {
+		userID, err := db.SaveUser(models.User{Username: name, Email: name + "@example.com", Password: "password123"})
+		if err != nil {
+			t.Fatalf("Failed to save user: %v", err)
+		}
+		postID, err := db.CreatePost(models.Post{Title: "Test Post", Content: "This is a test post.", AuthorID: userID})
+		if err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+		commentID, err := db.AddComment(models.Comment{Postid: postID, AuthorID: userID, Content: "This is a test comment."})
+		if err != nil {
+			t.Fatalf("Failed to add comment: %v", err)
+		}
+		return userID, postID, commentID
+	}
+
+	// Test export functions
+	userID, postID, commentID := newAuthor("anonymized")
+	exportID, err := db.CreateExport(userID)
+	if err != nil {
+		t.Fatalf("Failed to create export: %v", err)
+	}
+	pending, err := db.GetPendingExports(10)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("Expected 1 pending export, got %d (%v)", len(pending), err)
+	}
+	if _, err := db.CompleteExport(exportID, []byte("archive")); err != nil {
+		t.Fatalf("Failed to complete export: %v", err)
+	}
+	archive, err := db.GetExportArchive(exportID)
+	if err != nil || string(archive) != "archive" {
+		t.Fatalf("Expected stored archive, got %q (%v)", archive, err)
+	}
+
+	// Test anonymize mode keeps the content under the deleted user
+	if err := db.EraseUser(userID, models.ErasureAnonymize); err != nil {
+		t.Fatalf("Failed to erase user: %v", err)
+	}
+	post, _ := db.GetPostByID(postID)
+	if post.AuthorID != deletedUser.ID {
+		t.Fatalf("Expected post to belong to the deleted user, got author %d", post.AuthorID)
+	}
+	comment, _ := db.GetCommentByID(commentID)
+	if comment.AuthorID != deletedUser.ID {
+		t.Fatalf("Expected comment to belong to the deleted user, got author %d", comment.AuthorID)
+	}
+	export, _ := db.GetExport(exportID)
+	if export.ID != 0 {
+		t.Fatal("Expected export to be erased with the user")
+	}
+
+	// Test delete mode removes the content
+	userID, postID, commentID = newAuthor("deleted")
+	if err := db.EraseUser(userID, models.ErasureDelete); err != nil {
+		t.Fatalf("Failed to erase user: %v", err)
+	}
+	post, _ = db.GetPostByID(postID)
+	if post.ID != 0 {
+		t.Fatal("Expected post to be deleted")
+	}
+	comment, _ = db.GetCommentByID(commentID)
+	if comment.ID != 0 {
+		t.Fatal("Expected comment to be deleted")
+	}
+	if _, err := db.GetUser("id", userID); err == nil {
+		t.Fatal("Expected user to be deleted")
+	}
+}
@@ -0,0 +1,149 @@
+package conn_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/models"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// TestPostFilters tests post tags and the filters of GetPosts.
+func TestPostFilters(t *testing.T) {
+	// Setup test database
+	dbConn := setupTestDB(t)
+	defer cleanupTestDB(dbConn.DB, t, testDBName)
+
+	// Initialize database
+	err := dbConn.Initialize()
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	db := conn.NewConn(dbConn)
+
+	ids := map[string]int{}
+	for _, name := range []string{"alice", "bob"} {
+		id, err := db.SaveUser(models.User{Username: name, Email: name + "@example.com", Password: "password123"})
+		if err != nil {
+			t.Fatalf("Failed to save user: %v", err)
+		}
+		ids[name] = id
+	}
+
+	// The posts are created in order within the same second, so the
+	// listing returns them by descending id
+	posts := map[string]int{}
+	for _, post := range []models.Post{
+		{Title: "Go", Content: "Content", AuthorID: ids["alice"], Tags: []string{"go", "backend"}},
+		{Title: "Web", Content: "Content", AuthorID: ids["bob"], Tags: []string{"web"}},
+		{Title: "Plain", Content: "Content", AuthorID: ids["bob"]},
+		{Title: "Draft", Content: "Content", AuthorID: ids["alice"], Status: models.PostDraft, Tags: []string{"go"}},
+	} {
+		id, err := db.CreatePost(post)
+		if err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+		posts[strings.ToLower(post.Title)] = id
+	}
+	if _, err := db.AddComment(models.Comment{Postid: posts["web"], AuthorID: ids["alice"], Content: "Nice"}); err != nil {
+		t.Fatalf("Failed to add comment: %v", err)
+	}
+
+	// Test tags are stored and returned
+	post, err := db.GetPostByID(posts["go"])
+	if err != nil {
+		t.Fatalf("Failed to get post: %v", err)
+	}
+	if fmt.Sprint(post.Tags) != "[backend go]" {
+		t.Fatalf("Expected tags [backend go], got %v", post.Tags)
+	}
+
+	// Test UpdatePost with only tags replaces them
+	if _, err := db.UpdatePost(models.Post{ID: posts["go"], AuthorID: ids["alice"], Tags: []string{"golang"}}); err != nil {
+		t.Fatalf("Failed to update tags: %v", err)
+	}
+	post, _ = db.GetPostByID(posts["go"])
+	if fmt.Sprint(post.Tags) != "[golang]" {
+		t.Fatalf("Expected tags [golang], got %v", post.Tags)
+	}
+
+	yes, no := true, false
+	for _, test := range []struct {
+		name     string
+		filter   models.PostFilter
+		expected []int
+	}{
+		{"no filter", models.PostFilter{}, []int{posts["plain"], posts["web"], posts["go"]}},
+		{"author", models.PostFilter{Author: "bob"}, []int{posts["plain"], posts["web"]}},
+		{"unknown author", models.PostFilter{Author: "nobody"}, nil},
+		{"tags", models.PostFilter{Tags: []string{"golang", "web"}}, []int{posts["web"], posts["go"]}},
+		{"has comments", models.PostFilter{HasComments: &yes}, []int{posts["web"]}},
+		{"no comments", models.PostFilter{HasComments: &no}, []int{posts["plain"], posts["go"]}},
+		{"own drafts", models.PostFilter{Status: models.PostDraft, ViewerID: ids["alice"]}, []int{posts["draft"]}},
+		{"other drafts", models.PostFilter{Status: models.PostDraft, ViewerID: ids["bob"]}, nil},
+		{"all", models.PostFilter{Status: "all", ViewerID: ids["alice"], Author: "alice"}, []int{posts["draft"], posts["go"]}},
+		{"created before", models.PostFilter{CreatedBefore: "2000-01-01 00:00:00"}, nil},
+		{"created after", models.PostFilter{CreatedAfter: "2000-01-01 00:00:00", Search: "Web"}, []int{posts["web"]}},
+	} {
+		found, page, err := db.GetPosts(models.ListOptions{Limit: 10}, test.filter)
+		if err != nil {
+			t.Fatalf("%s: failed to get posts: %v", test.name, err)
+		}
+		var foundIDs []int
+		for _, post := range found {
+			foundIDs = append(foundIDs, post.ID)
+		}
+		if fmt.Sprint(foundIDs) != fmt.Sprint(test.expected) {
+			t.Fatalf("%s: expected posts %v, got %v", test.name, test.expected, foundIDs)
+		}
+		if page.Total != len(test.expected) {
+			t.Fatalf("%s: expected a total of %d, got %d", test.name, len(test.expected), page.Total)
+		}
+	}
+}
+
+// TestTagsRollBack tests that a post is not created or changed when its tags
+// cannot be stored.
+func TestTagsRollBack(t *testing.T) {
+	dbConn := setupTestDB(t)
+	defer cleanupTestDB(dbConn.DB, t, testDBName)
+	if err := dbConn.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	db := conn.NewConn(dbConn)
+
+	authorID, err := db.SaveUser(models.User{Username: "alice", Email: "alice@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+
+	// a duplicate tag breaks the primary key of PostTags
+	if _, err := db.CreatePost(models.Post{Title: "Go", Content: "Content", AuthorID: authorID, Tags: []string{"go", "go"}}); err == nil {
+		t.Fatal("Expected duplicate tags to fail")
+	}
+	posts, _, err := db.GetPosts(models.ListOptions{}, models.PostFilter{})
+	if err != nil {
+		t.Fatalf("Failed to get posts: %v", err)
+	}
+	if len(posts) != 0 {
+		t.Errorf("Expected the post to be rolled back, got %d posts", len(posts))
+	}
+
+	postID, err := db.CreatePost(models.Post{Title: "Go", Content: "Content", AuthorID: authorID, Tags: []string{"go"}})
+	if err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+	if _, err := db.UpdatePost(models.Post{ID: postID, AuthorID: authorID, Title: "Changed", Tags: []string{"web", "web"}}); err == nil {
+		t.Fatal("Expected duplicate tags to fail")
+	}
+	post, err := db.GetPostByID(postID)
+	if err != nil {
+		t.Fatalf("Failed to get post: %v", err)
+	}
+	if post.Title != "Go" || post.Version != 1 || fmt.Sprint(post.Tags) != "[go]" {
+		t.Errorf("Expected the post to be left as it was, got %q version %d tags %v", post.Title, post.Version, post.Tags)
+	}
+}
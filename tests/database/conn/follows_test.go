@@ -0,0 +1,139 @@
+package conn_test
+
+import (
+	"testing"
+
+	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/models"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// TestFollowFunctions tests Follow, Unfollow, the follow lists and GetFeed.
+func TestFollowFunctions(t *testing.T) {
+	// Setup test database
+	dbConn := setupTestDB(t)
+	defer cleanupTestDB(dbConn.DB, t, testDBName)
+
+	// Initialize database
+	err := dbConn.Initialize()
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	db := conn.NewConn(dbConn)
+
+	ids := map[string]int{}
+	for _, name := range []string{"reader", "alice", "bob"} {
+		id, err := db.SaveUser(models.User{Username: name, Email: name + "@example.com", Password: "password123"})
+		if err != nil {
+			t.Fatalf("Failed to save user: %v", err)
+		}
+		ids[name] = id
+	}
+
+	// A post published before the follow is backfilled into the feed
+	if _, err := db.CreatePost(models.Post{Title: "Alice before", Content: "Content", AuthorID: ids["alice"]}); err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+
+	// Test Follow, and that following twice is a no-op
+	for _, author := range []string{"alice", "bob"} {
+		rows, err := db.Follow(ids["reader"], ids[author])
+		if err != nil {
+			t.Fatalf("Failed to follow: %v", err)
+		}
+		if rows != 1 {
+			t.Fatalf("Expected 1 follow created, got %d", rows)
+		}
+	}
+	rows, err := db.Follow(ids["reader"], ids["alice"])
+	if err != nil {
+		t.Fatalf("Failed to follow again: %v", err)
+	}
+	if rows != 0 {
+		t.Fatalf("Expected repeated follow to be ignored, got %d", rows)
+	}
+
+	following, err := db.IsFollowing(ids["reader"], ids["alice"])
+	if err != nil || !following {
+		t.Fatalf("Expected reader to follow alice: %v", err)
+	}
+
+	// Test the follow lists and counts
+	followers, _, err := db.GetFollowers(ids["alice"], models.ListOptions{Limit: 10})
+	if err != nil {
+		t.Fatalf("Failed to get followers: %v", err)
+	}
+	if len(followers) != 1 || followers[0].Username != "reader" {
+		t.Fatalf("Expected reader to follow alice, got %+v", followers)
+	}
+
+	profile, err := db.GetProfile("reader")
+	if err != nil {
+		t.Fatalf("Failed to get profile: %v", err)
+	}
+	if profile.Following != 2 || profile.Followers != 0 {
+		t.Fatalf("Expected 2 following and 0 followers, got %d and %d", profile.Following, profile.Followers)
+	}
+
+	// Posts published after the follow are fanned out; drafts are not
+	for _, post := range []models.Post{
+		{Title: "Alice after", Content: "Content", AuthorID: ids["alice"]},
+		{Title: "Bob after", Content: "Content", AuthorID: ids["bob"]},
+		{Title: "Bob draft", Content: "Content", AuthorID: ids["bob"], Status: models.PostDraft},
+	} {
+		if _, err := db.CreatePost(post); err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+	}
+
+	// Test GetFeed pages through the posts with a cursor
+	first, page, err := db.GetFeed(ids["reader"], models.ListOptions{Limit: 2})
+	if err != nil {
+		t.Fatalf("Failed to get feed: %v", err)
+	}
+	if len(first) != 2 || page.Total != 3 || page.NextCursor == "" {
+		t.Fatalf("Expected 2 of 3 posts and a cursor on the first page, got %d, %+v", len(first), page)
+	}
+
+	cursor, err := models.ParseCursor(page.NextCursor)
+	if err != nil {
+		t.Fatalf("Failed to parse cursor: %v", err)
+	}
+	second, page, err := db.GetFeed(ids["reader"], models.ListOptions{Limit: 2, Cursor: &cursor})
+	if err != nil {
+		t.Fatalf("Failed to get feed: %v", err)
+	}
+	if len(second) != 1 || page.NextCursor != "" {
+		t.Fatalf("Expected 1 post and no cursor on the second page, got %d, %+v", len(second), page)
+	}
+
+	seen := map[string]bool{}
+	for _, post := range append(first, second...) {
+		if seen[post.Title] {
+			t.Fatalf("Post %q appeared on two pages", post.Title)
+		}
+		seen[post.Title] = true
+	}
+	if seen["Bob draft"] || !seen["Alice before"] {
+		t.Fatalf("Unexpected feed contents: %v", seen)
+	}
+
+	// Test Unfollow removes the author's posts from the feed
+	if _, err := db.Unfollow(ids["reader"], ids["bob"]); err != nil {
+		t.Fatalf("Failed to unfollow: %v", err)
+	}
+	feed, _, err := db.GetFeed(ids["reader"], models.ListOptions{Limit: 10})
+	if err != nil {
+		t.Fatalf("Failed to get feed: %v", err)
+	}
+	for _, post := range feed {
+		if post.AuthorID == ids["bob"] {
+			t.Fatalf("Expected bob's posts to leave the feed, found %q", post.Title)
+		}
+	}
+
+	if _, _, err := db.GetFeed(ids["reader"], models.ListOptions{Limit: 10, Cursor: &models.Cursor{Sort: models.SortUpdated}}); err == nil {
+		t.Fatal("Expected a cursor of another sort to be rejected")
+	}
+}
@@ -0,0 +1,96 @@
+package conn_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/models"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// TestIdempotencyKeys tests reserving, completing, releasing and expiring
+// idempotency keys.
+func TestIdempotencyKeys(t *testing.T) {
+	// Setup test database
+	dbConn := setupTestDB(t)
+	defer cleanupTestDB(dbConn.DB, t, testDBName)
+
+	// Initialize database
+	err := dbConn.Initialize()
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	db := conn.NewConn(dbConn)
+
+	userID, err := db.SaveUser(models.User{Username: "retrier", Email: "retrier@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+
+	expiresAt := time.Now().UTC().Add(time.Hour).Format("2006-01-02 15:04:05")
+	record := models.IdempotencyRecord{UserID: userID, Key: "key-1", Fingerprint: "fingerprint", ExpiresAt: expiresAt}
+
+	if _, reserved, err := db.ReserveIdempotencyKey(record); err != nil || !reserved {
+		t.Fatalf("Expected the key to be reserved, got %v and %v", reserved, err)
+	}
+
+	// Test a second reservation sees the pending request
+	stored, reserved, err := db.ReserveIdempotencyKey(record)
+	if err != nil {
+		t.Fatalf("Failed to reserve key: %v", err)
+	}
+	if reserved || stored.Status != 0 || stored.Fingerprint != "fingerprint" {
+		t.Fatalf("Expected the pending record, got %+v", stored)
+	}
+
+	// Test the stored response is returned once complete
+	record.Status = 200
+	record.Body = []byte(`{"status":200}`)
+	record.Headers = map[string][]string{"Location": {"/api/posts/1"}}
+	if err := db.CompleteIdempotencyKey(record); err != nil {
+		t.Fatalf("Failed to complete key: %v", err)
+	}
+	stored, reserved, err = db.ReserveIdempotencyKey(record)
+	if err != nil {
+		t.Fatalf("Failed to reserve key: %v", err)
+	}
+	if reserved || stored.Status != 200 || string(stored.Body) != `{"status":200}` || stored.Headers["Location"][0] != "/api/posts/1" {
+		t.Fatalf("Expected the stored response, got %+v", stored)
+	}
+
+	// Test keys are per user
+	otherID, err := db.SaveUser(models.User{Username: "other", Email: "other@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+	if _, reserved, err := db.ReserveIdempotencyKey(models.IdempotencyRecord{UserID: otherID, Key: "key-1", Fingerprint: "other", ExpiresAt: expiresAt}); err != nil || !reserved {
+		t.Fatalf("Expected the key to be free for another user, got %v and %v", reserved, err)
+	}
+
+	// Test a released key can be reserved again
+	if err := db.ReleaseIdempotencyKey(userID, "key-1"); err != nil {
+		t.Fatalf("Failed to release key: %v", err)
+	}
+	if _, reserved, err := db.ReserveIdempotencyKey(record); err != nil || !reserved {
+		t.Fatalf("Expected the released key to be reserved, got %v and %v", reserved, err)
+	}
+
+	// Test expired keys are replaced and purged
+	expired := models.IdempotencyRecord{UserID: userID, Key: "key-2", Fingerprint: "old", ExpiresAt: "2000-01-01 00:00:00"}
+	if _, reserved, err := db.ReserveIdempotencyKey(expired); err != nil || !reserved {
+		t.Fatalf("Expected the key to be reserved, got %v and %v", reserved, err)
+	}
+	expired.Fingerprint = "new"
+	if _, reserved, err := db.ReserveIdempotencyKey(expired); err != nil || !reserved {
+		t.Fatalf("Expected the expired key to be reserved again, got %v and %v", reserved, err)
+	}
+	purged, err := db.PurgeIdempotencyKeys()
+	if err != nil {
+		t.Fatalf("Failed to purge keys: %v", err)
+	}
+	if purged != 1 {
+		t.Fatalf("Expected 1 purged key, got %d", purged)
+	}
+}
@@ -0,0 +1,72 @@
+package conn_test
+
+import (
+	"testing"
+
+	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/models"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// TestIdentityFunctions tests LinkIdentity and GetIdentity functions.
+func TestIdentityFunctions(t *testing.T) {
+	// Setup test database
+	dbConn := setupTestDB(t)
+	defer cleanupTestDB(dbConn.DB, t, testDBName)
+
+	// Initialize database
+	err := dbConn.Initialize()
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	db := conn.NewConn(dbConn)
+
+	user := models.User{
+		Username: "testuser",
+		Email:    "test@example.com",
+		Password: "password123",
+	}
+	userID, err := db.SaveUser(user)
+	if err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+
+	// Test GetIdentity before linking
+	identity, err := db.GetIdentity("https://idp.example.com", "subject-1")
+	if err != nil {
+		t.Fatalf("Failed to get identity: %v", err)
+	}
+	if identity.ID != 0 {
+		t.Fatal("Expected no identity to be found, but found one")
+	}
+
+	// Test LinkIdentity
+	id, err := db.LinkIdentity(models.UserIdentity{
+		UserID:  userID,
+		Issuer:  "https://idp.example.com",
+		Subject: "subject-1",
+		Email:   user.Email,
+	})
+	if err != nil {
+		t.Fatalf("Failed to link identity: %v", err)
+	}
+	if id <= 0 {
+		t.Fatalf("Invalid identity ID returned: %d", id)
+	}
+
+	// Test GetIdentity after linking
+	identity, err = db.GetIdentity("https://idp.example.com", "subject-1")
+	if err != nil {
+		t.Fatalf("Failed to get identity: %v", err)
+	}
+	if identity.UserID != userID {
+		t.Fatalf("Expected identity for user %d, got %d", userID, identity.UserID)
+	}
+
+	// Linking the same subject twice must fail
+	_, err = db.LinkIdentity(models.UserIdentity{UserID: userID, Issuer: "https://idp.example.com", Subject: "subject-1"})
+	if err == nil {
+		t.Fatal("Expected error for duplicate identity, got none")
+	}
+}
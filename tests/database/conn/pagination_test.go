@@ -0,0 +1,129 @@
+package conn_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/models"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// TestPagination tests sorting and cursor pagination of the post and comment
+// lists.
+func TestPagination(t *testing.T) {
+	// Setup test database
+	dbConn := setupTestDB(t)
+	defer cleanupTestDB(dbConn.DB, t, testDBName)
+
+	// Initialize database
+	err := dbConn.Initialize()
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	db := conn.NewConn(dbConn)
+
+	userID, err := db.SaveUser(models.User{Username: "pager", Email: "pager@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+
+	// The posts are created within the same second, so the id decides
+	// their order
+	var postIDs []int
+	for i := 1; i <= 5; i++ {
+		id, err := db.CreatePost(models.Post{Title: fmt.Sprintf("Post %d", i), Content: "Content", AuthorID: userID})
+		if err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+		postIDs = append(postIDs, id)
+	}
+	for _, postID := range []int{postIDs[2], postIDs[2], postIDs[4]} {
+		if _, err := db.AddComment(models.Comment{Postid: postID, AuthorID: userID, Content: "Comment"}); err != nil {
+			t.Fatalf("Failed to add comment: %v", err)
+		}
+	}
+
+	// readAll follows the cursors until the last page
+	readAll := func(sort string) []int {
+		var ids []int
+		opts := models.ListOptions{Sort: sort, Limit: 2}
+		for pages := 0; pages < 10; pages++ {
+			posts, page, err := db.GetPosts(opts, models.PostFilter{})
+			if err != nil {
+				t.Fatalf("Failed to get posts sorted by %s: %v", sort, err)
+			}
+			if page.Total != 5 {
+				t.Fatalf("Expected a total of 5 posts, got %d", page.Total)
+			}
+			for _, post := range posts {
+				ids = append(ids, post.ID)
+			}
+			if page.NextCursor == "" {
+				return ids
+			}
+			cursor, err := models.ParseCursor(page.NextCursor)
+			if err != nil {
+				t.Fatalf("Failed to parse cursor: %v", err)
+			}
+			opts.Cursor = &cursor
+		}
+		t.Fatalf("Expected the pages to end")
+		return nil
+	}
+
+	p := postIDs
+	for sort, expected := range map[string][]int{
+		models.SortNewest:   {p[4], p[3], p[2], p[1], p[0]},
+		models.SortOldest:   {p[0], p[1], p[2], p[3], p[4]},
+		models.SortComments: {p[2], p[4], p[3], p[1], p[0]},
+	} {
+		ids := readAll(sort)
+		if fmt.Sprint(ids) != fmt.Sprint(expected) {
+			t.Fatalf("Expected posts %v sorted by %s, got %v", expected, sort, ids)
+		}
+	}
+
+	// Test offset pages for clients without cursors
+	posts, _, err := db.GetPosts(models.ListOptions{Limit: 2, Offset: 2}, models.PostFilter{})
+	if err != nil {
+		t.Fatalf("Failed to get posts: %v", err)
+	}
+	if len(posts) != 2 || posts[0].ID != p[2] || posts[1].ID != p[1] {
+		t.Fatalf("Expected the second page, got %+v", posts)
+	}
+
+	// Test invalid sort orders and cursors
+	if _, _, err := db.GetPosts(models.ListOptions{Sort: "random", Limit: 2}, models.PostFilter{}); !errors.Is(err, conn.ErrInvalidSort) {
+		t.Fatalf("Expected ErrInvalidSort, got %v", err)
+	}
+	if _, _, err := db.GetComments(p[2], models.ListOptions{Sort: models.SortComments, Limit: 2}); !errors.Is(err, conn.ErrInvalidSort) {
+		t.Fatalf("Expected ErrInvalidSort for comments, got %v", err)
+	}
+	cursor := models.Cursor{Sort: models.SortNewest, Value: "2024-01-01 00:00:00", ID: 1}
+	if _, _, err := db.GetPosts(models.ListOptions{Sort: models.SortOldest, Cursor: &cursor, Limit: 2}, models.PostFilter{}); !errors.Is(err, conn.ErrInvalidCursor) {
+		t.Fatalf("Expected ErrInvalidCursor, got %v", err)
+	}
+
+	// Test GetComments pages
+	comments, page, err := db.GetComments(p[2], models.ListOptions{Sort: models.SortOldest, Limit: 1})
+	if err != nil {
+		t.Fatalf("Failed to get comments: %v", err)
+	}
+	if len(comments) != 1 || page.Total != 2 || page.NextCursor == "" {
+		t.Fatalf("Expected the first of 2 comments, got %+v and %+v", comments, page)
+	}
+	next, err := models.ParseCursor(page.NextCursor)
+	if err != nil {
+		t.Fatalf("Failed to parse cursor: %v", err)
+	}
+	rest, page, err := db.GetComments(p[2], models.ListOptions{Sort: models.SortOldest, Cursor: &next, Limit: 1})
+	if err != nil {
+		t.Fatalf("Failed to get comments: %v", err)
+	}
+	if len(rest) != 1 || rest[0].ID <= comments[0].ID || page.NextCursor != "" {
+		t.Fatalf("Expected the last comment, got %+v and %+v", rest, page)
+	}
+}
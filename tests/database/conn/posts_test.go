@@ -72,10 +72,8 @@ func TestPostFunctions(t *testing.T) {
 	}
 
 	// Test GetPosts with pagination and search
-	limit := 10
-	offset := 0
 	searchTerm := "Updated"
-	posts, err := db.GetPosts(&limit, &offset, &searchTerm)
+	posts, _, err := db.GetPosts(models.ListOptions{Limit: 10}, models.PostFilter{Search: searchTerm})
 	if err != nil {
 		t.Fatalf("Failed to get posts with pagination and search: %v", err)
 	}
@@ -84,7 +82,7 @@ func TestPostFunctions(t *testing.T) {
 	}
 
 	// Test DeletePost
-	deletedPostID, err := db.DeletePost(postID)
+	deletedPostID, err := db.DeletePost(postID, 0)
 	if err != nil {
 		t.Fatalf("Failed to delete post: %v", err)
 	}
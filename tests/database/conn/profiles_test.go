@@ -0,0 +1,117 @@
+package conn_test
+
+import (
+	"testing"
+
+	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/models"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// TestProfileFunctions tests GetProfile, UpdateProfile, the avatar functions and GetPublishedPostsByAuthor.
+func TestProfileFunctions(t *testing.T) {
+	// Setup test database
+	dbConn := setupTestDB(t)
+	defer cleanupTestDB(dbConn.DB, t, testDBName)
+
+	// Initialize database
+	err := dbConn.Initialize()
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	db := conn.NewConn(dbConn)
+
+	user := models.User{
+		Username: "testuser",
+		Email:    "test@example.com",
+		Password: "password123",
+	}
+	userID, err := db.SaveUser(user)
+	if err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+
+	// Test UpdateProfile and GetProfile
+	update := models.ProfileUpdate{
+		DisplayName: "Test User",
+		Bio:         "Writes tests.",
+		Website:     "https://example.com",
+		SocialLinks: map[string]string{"github": "https://github.com/testuser"},
+	}
+	if _, err := db.UpdateProfile(userID, update); err != nil {
+		t.Fatalf("Failed to update profile: %v", err)
+	}
+
+	profile, err := db.GetProfile("testuser")
+	if err != nil {
+		t.Fatalf("Failed to get profile: %v", err)
+	}
+	if profile.ID != userID || profile.DisplayName != update.DisplayName || profile.Bio != update.Bio || profile.Website != update.Website {
+		t.Fatalf("Profile mismatch: %+v", profile)
+	}
+	if profile.SocialLinks["github"] != "https://github.com/testuser" {
+		t.Fatalf("Social links mismatch: %v", profile.SocialLinks)
+	}
+	if profile.HasAvatar {
+		t.Fatal("Expected no avatar before upload")
+	}
+
+	missing, err := db.GetProfile("nobody")
+	if err != nil {
+		t.Fatalf("Failed to get missing profile: %v", err)
+	}
+	if missing.ID != 0 {
+		t.Fatalf("Expected empty profile for unknown user, got %+v", missing)
+	}
+
+	// Test SaveAvatar replaces an existing avatar
+	for _, data := range [][]byte{[]byte("first"), []byte("second")} {
+		if err := db.SaveAvatar(userID, models.Avatar{ContentType: "image/png", Data: data}); err != nil {
+			t.Fatalf("Failed to save avatar: %v", err)
+		}
+	}
+
+	avatar, err := db.GetAvatar(userID)
+	if err != nil {
+		t.Fatalf("Failed to get avatar: %v", err)
+	}
+	if avatar.ContentType != "image/png" || string(avatar.Data) != "second" {
+		t.Fatalf("Avatar mismatch: %s %q", avatar.ContentType, avatar.Data)
+	}
+
+	profile, err = db.GetProfile("testuser")
+	if err != nil {
+		t.Fatalf("Failed to get profile: %v", err)
+	}
+	if !profile.HasAvatar {
+		t.Fatal("Expected profile to report an avatar")
+	}
+
+	// Test DeleteAvatar
+	rows, err := db.DeleteAvatar(userID)
+	if err != nil {
+		t.Fatalf("Failed to delete avatar: %v", err)
+	}
+	if rows != 1 {
+		t.Fatalf("Expected 1 avatar deleted, got %d", rows)
+	}
+
+	// Test GetPublishedPostsByAuthor skips drafts
+	for _, post := range []models.Post{
+		{Title: "Published", Content: "Content", AuthorID: userID},
+		{Title: "Draft", Content: "Content", AuthorID: userID, Status: models.PostDraft},
+	} {
+		if _, err := db.CreatePost(post); err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+	}
+
+	posts, _, err := db.GetPublishedPostsByAuthor(userID, models.ListOptions{Limit: 10})
+	if err != nil {
+		t.Fatalf("Failed to get published posts: %v", err)
+	}
+	if len(posts) != 1 || posts[0].Title != "Published" {
+		t.Fatalf("Expected only the published post, got %+v", posts)
+	}
+}
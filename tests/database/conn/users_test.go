@@ -2,6 +2,7 @@ package conn_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/A-Victory/blog/database/conn"
 	"github.com/A-Victory/blog/models"
@@ -75,3 +76,79 @@ func TestUserFunctions(t *testing.T) {
 
 	cleanupTestDB(dbConn.DB, t, testDBName)
 }
+
+// TestAccountUpdateFunctions tests the account update and deletion schedule functions.
+func TestAccountUpdateFunctions(t *testing.T) {
+	// Setup test database
+	dbConn := setupTestDB(t)
+	defer cleanupTestDB(dbConn.DB, t, testDBName)
+
+	err := dbConn.Initialize()
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	db := conn.NewConn(dbConn)
+
+	id, err := db.SaveUser(models.User{Username: "testuser", Email: "test@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+
+	// Test UpdateUsername, UpdateEmail and UpdatePassword
+	if _, err := db.UpdateUsername(id, "renamed"); err != nil {
+		t.Fatalf("Failed to update username: %v", err)
+	}
+	if _, err := db.UpdateEmail(id, "renamed@example.com"); err != nil {
+		t.Fatalf("Failed to update email: %v", err)
+	}
+	if _, err := db.UpdatePassword(id, "newpassword123"); err != nil {
+		t.Fatalf("Failed to update password: %v", err)
+	}
+
+	user, err := db.GetUser("id", id)
+	if err != nil {
+		t.Fatalf("Failed to get user by ID: %v", err)
+	}
+	if user.Username != "renamed" || user.Email != "renamed@example.com" || user.Password != "newpassword123" {
+		t.Fatalf("Expected updated account details, got %+v", user)
+	}
+
+	// Test ScheduleDeletion and CancelDeletion
+	if _, err := db.ScheduleDeletion(id, time.Now().Add(time.Hour), models.ErasureDelete); err != nil {
+		t.Fatalf("Failed to schedule deletion: %v", err)
+	}
+	user, _ = db.GetUser("id", id)
+	if user.DeletionScheduledAt == "" {
+		t.Fatal("Expected deletion to be scheduled")
+	}
+
+	// Not yet due, so nothing is purged
+	purged, err := db.PurgeDeletedUsers()
+	if err != nil {
+		t.Fatalf("Failed to purge users: %v", err)
+	}
+	if purged != 0 {
+		t.Fatalf("Expected no users to be purged, got %d", purged)
+	}
+
+	if _, err := db.CancelDeletion(id); err != nil {
+		t.Fatalf("Failed to cancel deletion: %v", err)
+	}
+	user, _ = db.GetUser("id", id)
+	if user.DeletionScheduledAt != "" {
+		t.Fatalf("Expected deletion to be cancelled, got %s", user.DeletionScheduledAt)
+	}
+
+	// Test PurgeDeletedUsers once the grace period has passed
+	if _, err := db.ScheduleDeletion(id, time.Now().Add(-time.Minute), models.ErasureDelete); err != nil {
+		t.Fatalf("Failed to schedule deletion: %v", err)
+	}
+	purged, err = db.PurgeDeletedUsers()
+	if err != nil {
+		t.Fatalf("Failed to purge users: %v", err)
+	}
+	if purged != 1 {
+		t.Fatalf("Expected 1 user to be purged, got %d", purged)
+	}
+}
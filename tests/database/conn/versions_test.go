@@ -0,0 +1,79 @@
+package conn_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/models"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// TestVersions tests that updates bump the version of posts and comments and
+// that writes against a stale version are rejected.
+func TestVersions(t *testing.T) {
+	// Setup test database
+	dbConn := setupTestDB(t)
+	defer cleanupTestDB(dbConn.DB, t, testDBName)
+
+	// Initialize database
+	err := dbConn.Initialize()
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	db := conn.NewConn(dbConn)
+
+	userID, err := db.SaveUser(models.User{Username: "writer", Email: "writer@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+
+	postID, err := db.CreatePost(models.Post{Title: "Title", Content: "Content", AuthorID: userID})
+	if err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+
+	post, err := db.GetPostByID(postID)
+	if err != nil {
+		t.Fatalf("Failed to get post: %v", err)
+	}
+	if post.Version != 1 {
+		t.Fatalf("Expected version 1, got %d", post.Version)
+	}
+
+	// Test an update with the current version bumps it
+	if _, err := db.UpdatePost(models.Post{ID: postID, AuthorID: userID, Title: "New title", Version: 1}); err != nil {
+		t.Fatalf("Failed to update post: %v", err)
+	}
+	post, _ = db.GetPostByID(postID)
+	if post.Version != 2 {
+		t.Fatalf("Expected version 2, got %d", post.Version)
+	}
+
+	// Test writes with a stale version are rejected
+	if _, err := db.UpdatePost(models.Post{ID: postID, AuthorID: userID, Title: "Stale", Version: 1}); !errors.Is(err, conn.ErrVersionConflict) {
+		t.Fatalf("Expected ErrVersionConflict, got %v", err)
+	}
+	if _, err := db.DeletePost(postID, 1); !errors.Is(err, conn.ErrVersionConflict) {
+		t.Fatalf("Expected ErrVersionConflict on delete, got %v", err)
+	}
+
+	commentID, err := db.AddComment(models.Comment{Postid: postID, AuthorID: userID, Content: "Comment"})
+	if err != nil {
+		t.Fatalf("Failed to add comment: %v", err)
+	}
+	if _, err := db.EditComment(models.Comment{ID: commentID, Postid: postID, AuthorID: userID, Content: "Edited", Version: 1}); err != nil {
+		t.Fatalf("Failed to edit comment: %v", err)
+	}
+	comment, _ := db.GetCommentByID(commentID)
+	if comment.Version != 2 {
+		t.Fatalf("Expected comment version 2, got %d", comment.Version)
+	}
+	if _, err := db.DeleteComment(commentID, 1); !errors.Is(err, conn.ErrVersionConflict) {
+		t.Fatalf("Expected ErrVersionConflict on comment delete, got %v", err)
+	}
+	if _, err := db.DeleteComment(commentID, 2); err != nil {
+		t.Fatalf("Failed to delete comment: %v", err)
+	}
+}
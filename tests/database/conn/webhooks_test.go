@@ -0,0 +1,105 @@
+package conn_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/models"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// TestWebhookDeliveries tests the webhook subscriptions and the delivery
+// queue.
+func TestWebhookDeliveries(t *testing.T) {
+	// Setup test database
+	dbConn := setupTestDB(t)
+	defer cleanupTestDB(dbConn.DB, t, testDBName)
+
+	// Initialize database
+	err := dbConn.Initialize()
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	db := conn.NewConn(dbConn)
+
+	userID, err := db.SaveUser(models.User{Username: "hooked", Email: "hooked@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+
+	postsID, err := db.CreateWebhook(models.WebhookSubscription{UserID: userID, URL: "http://127.0.0.1/posts", Secret: "secret", Events: []string{models.EventPostCreated, models.EventPostDeleted}, Active: true})
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+	if _, err := db.CreateWebhook(models.WebhookSubscription{UserID: userID, URL: "http://127.0.0.1/comments", Secret: "secret", Events: []string{models.EventCommentCreated}, Active: true}); err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+
+	// Test only the subscriptions for the event are returned
+	subs, err := db.GetWebhooksForEvent(models.EventPostDeleted)
+	if err != nil {
+		t.Fatalf("Failed to get webhooks: %v", err)
+	}
+	if len(subs) != 1 || subs[0].ID != postsID || subs[0].Secret != "secret" {
+		t.Fatalf("Expected the posts webhook, got %+v", subs)
+	}
+
+	if err := db.EnqueueWebhookDeliveries([]int{postsID}, models.EventPostCreated, `{"id":1}`); err != nil {
+		t.Fatalf("Failed to enqueue deliveries: %v", err)
+	}
+
+	due, err := db.GetDueWebhookDeliveries(10)
+	if err != nil {
+		t.Fatalf("Failed to get due deliveries: %v", err)
+	}
+	if len(due) != 1 || due[0].Payload != `{"id":1}` {
+		t.Fatalf("Expected one due delivery, got %+v", due)
+	}
+	deliveryID := due[0].ID
+
+	// Test a delivery is claimed once
+	if claimed, err := db.ClaimWebhookDelivery(deliveryID, time.Minute); err != nil || !claimed {
+		t.Fatalf("Expected to claim the delivery, got %v and %v", claimed, err)
+	}
+	if claimed, err := db.ClaimWebhookDelivery(deliveryID, time.Minute); err != nil || claimed {
+		t.Fatalf("Expected the delivery to be claimed already, got %v and %v", claimed, err)
+	}
+
+	// Test a failed attempt is retried later and a dead one is logged
+	if err := db.RecordWebhookAttempt(deliveryID, models.DeliveryPending, 503, "unavailable", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to record attempt: %v", err)
+	}
+	if due, _ := db.GetDueWebhookDeliveries(10); len(due) != 0 {
+		t.Fatalf("Expected no due deliveries, got %+v", due)
+	}
+	if err := db.RecordWebhookAttempt(deliveryID, models.DeliveryDead, 503, "unavailable", time.Now()); err != nil {
+		t.Fatalf("Failed to record attempt: %v", err)
+	}
+
+	deliveries, page, err := db.GetWebhookDeliveries(postsID, models.DeliveryDead, models.ListOptions{Limit: 10})
+	if err != nil {
+		t.Fatalf("Failed to get deliveries: %v", err)
+	}
+	if len(deliveries) != 1 || page.Total != 1 || deliveries[0].Attempts != 2 || deliveries[0].ResponseStatus != 503 || deliveries[0].CompletedAt == "" {
+		t.Fatalf("Expected the dead delivery, got %+v", deliveries)
+	}
+
+	// Test a dead delivery can be queued again
+	if n, err := db.RetryWebhookDelivery(deliveryID); err != nil || n != 1 {
+		t.Fatalf("Expected to retry the delivery, got %d and %v", n, err)
+	}
+	due, _ = db.GetDueWebhookDeliveries(10)
+	if len(due) != 1 || due[0].Attempts != 0 {
+		t.Fatalf("Expected the delivery to be due again, got %+v", due)
+	}
+
+	// Test deleting a webhook removes its deliveries
+	if _, err := db.DeleteWebhook(postsID, userID); err != nil {
+		t.Fatalf("Failed to delete webhook: %v", err)
+	}
+	if delivery, _ := db.GetWebhookDelivery(deliveryID); delivery.ID != 0 {
+		t.Fatalf("Expected the delivery to be removed, got %+v", delivery)
+	}
+}
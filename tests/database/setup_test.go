@@ -37,7 +37,7 @@ func TestNewDBConn(t *testing.T) {
 
 // cleanupTestDB cleans up the test database by dropping tables and the database itself.
 func cleanupTestDB(db *sql.DB, t *testing.T) {
-	_, err := db.Exec("DROP TABLE IF EXISTS comments, posts, users")
+	_, err := db.Exec("DROP TABLE IF EXISTS streamevents, webhookdeliveries, webhooksubscriptions, idempotencykeys, posttags, readinglistitems, readinglists, bookmarks, feeditems, follows, useravatars, dataexports, emailverifications, accountactivity, useridentities, comments, posts, users, schemamigrations")
 	if err != nil {
 		t.Fatalf("Failed to clean up test database tables: %v", err)
 	}
@@ -61,9 +61,25 @@ func TestInitialize(t *testing.T) {
 
 	// Expected table names
 	tables := map[string]bool{
-		"users":    false,
-		"posts":    false,
-		"comments": false,
+		"users":                false,
+		"posts":                false,
+		"comments":             false,
+		"useridentities":       false,
+		"accountactivity":      false,
+		"emailverifications":   false,
+		"schemamigrations":     false,
+		"dataexports":          false,
+		"useravatars":          false,
+		"follows":              false,
+		"feeditems":            false,
+		"bookmarks":            false,
+		"readinglists":         false,
+		"readinglistitems":     false,
+		"posttags":             false,
+		"idempotencykeys":      false,
+		"webhooksubscriptions": false,
+		"webhookdeliveries":    false,
+		"streamevents":         false,
 	}
 
 	// Iterate over the rows to check if the tables exist
@@ -201,3 +217,35 @@ func TestCommentConstraints(t *testing.T) {
 		t.Fatal("Expected error for insertion with non-existent user, got none")
 	}
 }
+
+// TestDeletedUserMigration tests that the migration creating the deleted
+// user account fails rather than adopt a user who already has the name.
+func TestDeletedUserMigration(t *testing.T) {
+	dbConn := setupTestDB(t)
+	defer cleanupTestDB(dbConn.DB, t)
+
+	err := dbConn.Initialize()
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	var password string
+	if err := dbConn.DB.QueryRow(`SELECT password FROM Users WHERE username = 'deleted user'`).Scan(&password); err != nil {
+		t.Fatalf("Expected the deleted user account to exist: %v", err)
+	}
+	if password != "!" {
+		t.Fatalf("Expected the deleted user account to have no usable password, got %q", password)
+	}
+
+	// Replay the migration on a database where a user took the name first
+	if _, err := dbConn.DB.Exec(`UPDATE Users SET email = 'someone@example.com', password = 'hash' WHERE username = 'deleted user'`); err != nil {
+		t.Fatalf("Failed to take over the username: %v", err)
+	}
+	if _, err := dbConn.DB.Exec(`DELETE FROM SchemaMigrations WHERE version = 3`); err != nil {
+		t.Fatalf("Failed to forget the migration: %v", err)
+	}
+
+	if err := dbConn.Initialize(); err == nil {
+		t.Fatal("Expected the migration to fail when the username is taken, got none")
+	}
+}
@@ -0,0 +1,123 @@
+package export_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/A-Victory/blog/export"
+	"github.com/A-Victory/blog/models"
+)
+
+// TestArchive tests that the archive holds the JSON and Markdown files.
+func TestArchive(t *testing.T) {
+	data := export.Data{
+		Profile: export.Profile{ID: 1, Username: "testuser", Email: "test@example.com"},
+		Posts: []models.Post{
+			{ID: 7, Title: "My First Post!", Content: "Once upon a time...", AuthorID: 1},
+		},
+		Comments: []models.Comment{
+			{ID: 3, Postid: 7, AuthorID: 1, Content: "Great post!"},
+		},
+	}
+
+	archive, err := export.Archive(data)
+	if err != nil {
+		t.Fatalf("Failed to build archive: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(content)
+	}
+
+	for _, name := range []string{"profile.json", "identities.json", "following.json", "bookmarks.json", "reading-lists.json", "activity.json", "posts.json", "comments.json", "comments.md", "README.md", "posts/7-my-first-post.md"} {
+		if _, ok := files[name]; !ok {
+			t.Fatalf("Expected %s in archive, got %v", name, files)
+		}
+	}
+
+	var profile export.Profile
+	if err := json.Unmarshal([]byte(files["profile.json"]), &profile); err != nil {
+		t.Fatalf("Failed to decode profile.json: %v", err)
+	}
+	if profile.Email != "test@example.com" {
+		t.Fatalf("Expected email in profile, got %+v", profile)
+	}
+
+	if !strings.Contains(files["posts/7-my-first-post.md"], "# My First Post!") {
+		t.Fatalf("Expected post title heading, got %s", files["posts/7-my-first-post.md"])
+	}
+	if !strings.Contains(files["comments.md"], "Great post!") {
+		t.Fatalf("Expected comment in comments.md, got %s", files["comments.md"])
+	}
+}
+
+// TestArchiveAvatar tests that an uploaded avatar is written as a file named
+// after its content type.
+func TestArchiveAvatar(t *testing.T) {
+	picture := []byte("\x89PNG\r\n\x1a\nnot really")
+	data := export.Data{
+		Profile: export.Profile{ID: 1, Username: "testuser", Avatar: "avatar.png", AvatarContentType: "image/png"},
+		Avatar:  models.Avatar{ContentType: "image/png", Data: picture},
+	}
+
+	archive, err := export.Archive(data)
+	if err != nil {
+		t.Fatalf("Failed to build archive: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+
+	var found bool
+	for _, f := range zr.File {
+		if f.Name != "avatar.png" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		if !bytes.Equal(content, picture) {
+			t.Fatalf("Expected the avatar bytes, got %q", content)
+		}
+		found = true
+	}
+	if !found {
+		t.Fatal("Expected avatar.png in archive")
+	}
+
+	// without an avatar there is no file
+	archive, err = export.Archive(export.Data{Profile: export.Profile{ID: 1, Username: "testuser"}})
+	if err != nil {
+		t.Fatalf("Failed to build archive: %v", err)
+	}
+	zr, err = zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+	for _, f := range zr.File {
+		if strings.HasPrefix(f.Name, "avatar") {
+			t.Fatalf("Expected no avatar in archive, got %s", f.Name)
+		}
+	}
+}
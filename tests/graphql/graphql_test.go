@@ -0,0 +1,117 @@
+package graphql_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/A-Victory/blog/auth"
+	"github.com/A-Victory/blog/handlers"
+)
+
+// graphqlErrors posts the query and returns the status and error messages.
+// The handler has no database, so only requests rejected before they reach
+// it get a useful answer.
+func graphqlErrors(t *testing.T, req *http.Request) (int, []string) {
+	t.Helper()
+
+	handler := handlers.NewHttpHandler(&handlers.Config{Validator: auth.NewValidator()})
+	rec := httptest.NewRecorder()
+	handler.GraphQL(rec, req)
+
+	var body struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	messages := make([]string, len(body.Errors))
+	for i, e := range body.Errors {
+		messages[i] = e.Message
+	}
+	return rec.Code, messages
+}
+
+func post(query string, variables map[string]interface{}) *http.Request {
+	body, _ := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	return httptest.NewRequest(http.MethodPost, "/api/graphql", strings.NewReader(string(body)))
+}
+
+// TestQueryDepthLimit tests that deeply nested queries are rejected.
+func TestQueryDepthLimit(t *testing.T) {
+	query := `{ me { posts { nodes { author { posts { nodes { author { posts { nodes { author { username } } } } } } } } } } }`
+
+	status, messages := graphqlErrors(t, post(query, nil))
+	if status != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", status)
+	}
+	if len(messages) != 1 || !strings.Contains(messages[0], "levels deep") {
+		t.Fatalf("Expected a depth error, got %v", messages)
+	}
+}
+
+// TestQueryComplexityLimit tests that lists are weighed by the page size
+// asked for, including through variables and fragments.
+func TestQueryComplexityLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+	}{
+		{
+			name:  "literal page sizes",
+			query: `{ posts(first: 100) { nodes { comments(first: 100) { id content } } } }`,
+		},
+		{
+			name:      "variable page size",
+			query:     `query($n: Int) { posts(first: $n) { nodes { comments(first: $n) { id content } } } }`,
+			variables: map[string]interface{}{"n": 100},
+		},
+		{
+			name:  "default variable",
+			query: `query($n: Int = 100) { posts(first: $n) { nodes { comments(first: $n) { id content } } } }`,
+		},
+		{
+			name:  "fragment",
+			query: `{ posts(first: 100) { nodes { ...withComments } } } fragment withComments on Post { comments(first: 100) { id content } }`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, messages := graphqlErrors(t, post(tt.query, tt.variables))
+			if status != http.StatusBadRequest {
+				t.Fatalf("Expected status 400, got %d", status)
+			}
+			if len(messages) != 1 || !strings.Contains(messages[0], "complexity") {
+				t.Fatalf("Expected a complexity error, got %v", messages)
+			}
+		})
+	}
+}
+
+// TestGraphQLRequestErrors tests requests rejected before they are run.
+func TestGraphQLRequestErrors(t *testing.T) {
+	status, _ := graphqlErrors(t, post("{ posts { nodes { id }", nil))
+	if status != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for a syntax error, got %d", status)
+	}
+
+	status, _ = graphqlErrors(t, post("", nil))
+	if status != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 without a query, got %d", status)
+	}
+
+	mutation := url.Values{"query": {`mutation { deletePost(id: 1) }`}}
+	req := httptest.NewRequest(http.MethodGet, "/api/graphql?"+mutation.Encode(), nil)
+	status, _ = graphqlErrors(t, req)
+	if status != http.StatusMethodNotAllowed {
+		t.Fatalf("Expected status 405 for a mutation over GET, got %d", status)
+	}
+}
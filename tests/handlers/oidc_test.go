@@ -0,0 +1,188 @@
+package handlers_test
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/A-Victory/blog/auth"
+	"github.com/A-Victory/blog/database"
+	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/models"
+	"github.com/A-Victory/blog/routes"
+	"github.com/A-Victory/blog/tests/oidctest"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testDBConfig = "root:password@tcp(127.0.0.1:3306)/"
+	testDBName   = "handlerstestdb"
+)
+
+// setupTestDB connects to the MySQL server and creates the tables in a
+// database of their own.
+func setupTestDB(t *testing.T) *database.DBconn {
+	dbConn := database.NewDBConn(testDBConfig, testDBName)
+	if dbConn == nil || dbConn.DB == nil {
+		t.Fatalf("Failed to create a new DB connection")
+	}
+	t.Cleanup(func() { cleanupTestDB(dbConn.DB, t) })
+
+	if err := dbConn.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	return dbConn
+}
+
+func cleanupTestDB(db *sql.DB, t *testing.T) {
+	if _, err := db.Exec("DROP DATABASE IF EXISTS " + testDBName); err != nil {
+		t.Fatalf("Failed to drop test database: %v", err)
+	}
+}
+
+// login runs the login through the named provider for the identity the
+// claims describe and returns the response of the callback.
+func login(t *testing.T, mock *oidctest.Provider, server http.Handler, name string, claims jwt.MapClaims) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/"+name+"/login", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("Expected status 302 for the login, got %d", rec.Code)
+	}
+
+	mock.SetClaims(claims)
+	code, state := mock.Authorize(t, rec.Header().Get("Location"))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/"+name+"/callback?code="+code+"&state="+url.QueryEscape(state), nil)
+	for _, cookie := range rec.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	callback := httptest.NewRecorder()
+	server.ServeHTTP(callback, req)
+	return callback
+}
+
+// signedIn returns the username of the token a successful login issued.
+func signedIn(t *testing.T, rec *httptest.ResponseRecorder) string {
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for the login, got %d: %s", rec.Code, rec.Body.String())
+	}
+	username, err := auth.GetUser(rec.Header().Get("Authorization"))
+	if err != nil {
+		t.Fatalf("Failed to read the issued token: %v", err)
+	}
+	return username
+}
+
+// TestOIDCCallback tests how the callback resolves an identity to an account:
+// an existing link, then a verified email, then a provisioned account.
+func TestOIDCCallback(t *testing.T) {
+	auth.SetSigningKey([]byte("test-signing-key"))
+
+	dbConn := setupTestDB(t)
+	db := conn.NewConn(dbConn)
+
+	mock := oidctest.New(t)
+	server := routes.NewServer(routes.ServerConfig{
+		DB: db,
+		VA: auth.NewValidator(),
+		OIDC: []*auth.OIDCProvider{
+			mock.Client(t, auth.OIDCConfig{Name: "corp", RedirectURL: "http://localhost/api/auth/oidc/corp/callback"}),
+			mock.Client(t, auth.OIDCConfig{Name: "auto", RedirectURL: "http://localhost/api/auth/oidc/auto/callback", AutoProvision: true}),
+		},
+	})
+
+	newUser := func(name string) int {
+		id, err := db.SaveUser(models.User{Username: name, Email: name + "@example.com", Password: "password123"})
+		if err != nil {
+			t.Fatalf("Failed to save user: %v", err)
+		}
+		return id
+	}
+	linkedTo := func(subject string) int {
+		link, err := db.GetIdentity(mock.Issuer(), subject)
+		if err != nil {
+			t.Fatalf("Failed to get identity: %v", err)
+		}
+		return link.UserID
+	}
+
+	// Test an existing link wins over the email, which need not be verified
+	aliceID := newUser("alice")
+	if _, err := db.LinkIdentity(models.UserIdentity{UserID: aliceID, Issuer: mock.Issuer(), Subject: "sub-alice", Email: "alice@example.com"}); err != nil {
+		t.Fatalf("Failed to link identity: %v", err)
+	}
+	rec := login(t, mock, server, "corp", jwt.MapClaims{"sub": "sub-alice", "email": "someone@example.com", "email_verified": false})
+	if username := signedIn(t, rec); username != "alice" {
+		t.Fatalf("Expected the linked account alice, got %s", username)
+	}
+
+	// Test a verified email matching an account links the identity to it
+	bobID := newUser("bob")
+	rec = login(t, mock, server, "corp", jwt.MapClaims{"sub": "sub-bob", "email": "bob@example.com", "email_verified": true})
+	if username := signedIn(t, rec); username != "bob" {
+		t.Fatalf("Expected the account with the email, got %s", username)
+	}
+	if linkedTo("sub-bob") != bobID {
+		t.Fatalf("Expected the identity to be linked to bob")
+	}
+
+	// Test an unverified email matching an account is neither signed in
+	// nor linked
+	newUser("carol")
+	rec = login(t, mock, server, "corp", jwt.MapClaims{"sub": "sub-carol", "email": "carol@example.com", "email_verified": false})
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "account not linked") {
+		t.Fatalf("Expected 403 for an unverified email, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if linkedTo("sub-carol") != 0 {
+		t.Fatalf("Expected no link for an unverified email")
+	}
+
+	// Test an unknown email is refused without auto provisioning
+	rec = login(t, mock, server, "corp", jwt.MapClaims{"sub": "sub-dave", "email": "dave@example.com", "email_verified": true})
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("Expected 403 without auto provisioning, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, err := db.GetUser("email", "dave@example.com"); err != sql.ErrNoRows {
+		t.Fatalf("Expected no account for dave, got error %v", err)
+	}
+
+	// Test auto provisioning creates an account named after the identity
+	rec = login(t, mock, server, "auto", jwt.MapClaims{"sub": "sub-dave", "email": "dave@example.com", "email_verified": true})
+	if username := signedIn(t, rec); username != "dave" {
+		t.Fatalf("Expected a provisioned account dave, got %s", username)
+	}
+	dave, err := db.GetUser("username", "dave")
+	if err != nil {
+		t.Fatalf("Failed to get provisioned user: %v", err)
+	}
+	if dave.Email != "dave@example.com" || linkedTo("sub-dave") != dave.ID {
+		t.Fatalf("Expected the provisioned account to hold the email and the link, got %+v", dave)
+	}
+
+	// Test provisioning skips taken and reserved usernames
+	for _, test := range []struct {
+		subject, preferred, email, want string
+	}{
+		{"sub-alice2", "alice", "alice2@example.com", "alice1"},
+		{"sub-me", "me", "me@example.com", "me1"},
+		{"sub-symbols", "!!!", "symbols@example.com", "user"},
+	} {
+		rec = login(t, mock, server, "auto", jwt.MapClaims{"sub": test.subject, "email": test.email, "email_verified": true, "preferred_username": test.preferred})
+		if username := signedIn(t, rec); username != test.want {
+			t.Fatalf("Expected preferred username %q to become %s, got %s", test.preferred, test.want, username)
+		}
+	}
+
+	// Test auto provisioning still needs a verified email
+	rec = login(t, mock, server, "auto", jwt.MapClaims{"sub": "sub-erin", "email": "erin@example.com", "email_verified": false})
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("Expected 403 for an unverified email, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, err := db.GetUser("email", "erin@example.com"); err != sql.ErrNoRows {
+		t.Fatalf("Expected no account for erin, got error %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/A-Victory/blog/auth"
+	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/models"
+	"github.com/A-Victory/blog/routes"
+)
+
+// TestUnpublishedPostEvent tests that a post moved back to draft is sent to
+// webhooks without its content.
+func TestUnpublishedPostEvent(t *testing.T) {
+	auth.SetSigningKey([]byte("test-signing-key"))
+
+	db := conn.NewConn(setupTestDB(t))
+	server := routes.NewServer(routes.ServerConfig{DB: db, VA: auth.NewValidator()})
+
+	userID, err := db.SaveUser(models.User{Username: "author", Email: "author@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+	token, err := auth.GenerateJWT(userID, "author")
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	subID, err := db.CreateWebhook(models.WebhookSubscription{UserID: userID, URL: "https://example.com/hook", Secret: "0123456789abcdef", Events: []string{models.EventPostUpdated}, Active: true})
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send(http.MethodPost, "/api/v2/posts/", `{"title":"Secret plans","content":"Not for everyone"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 for the post, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		Data models.Post `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	rec = send(http.MethodPatch, fmt.Sprintf("/api/v2/posts/%d", created.Data.ID), `{"title":"Secret plans, revised","status":"draft"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for the update, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	deliveries, _, err := db.GetWebhookDeliveries(subID, "", models.ListOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get deliveries: %v", err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("Expected 1 delivery, got %d", len(deliveries))
+	}
+	want := fmt.Sprintf(`{"id":%d,"status":"draft"}`, created.Data.ID)
+	if deliveries[0].Event != models.EventPostUpdated || deliveries[0].Payload != want {
+		t.Fatalf("Expected %s with %s, got %s with %s", models.EventPostUpdated, want, deliveries[0].Event, deliveries[0].Payload)
+	}
+}
@@ -0,0 +1,156 @@
+package health_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/A-Victory/blog/auth"
+	"github.com/A-Victory/blog/database"
+	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/health"
+	"github.com/A-Victory/blog/routes"
+)
+
+func probe(t *testing.T, handler http.Handler, path string) (int, health.Report) {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var report health.Report
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode %s: %v", path, err)
+	}
+	return rec.Code, report
+}
+
+func passing(context.Context) error { return nil }
+
+func TestEmptyRegistry(t *testing.T) {
+	reg := health.NewRegistry()
+
+	for path, handler := range map[string]http.Handler{"/livez": reg.LivenessHandler(), "/readyz": reg.ReadinessHandler()} {
+		code, report := probe(t, handler, path)
+		if code != http.StatusOK || report.Status != health.StatusOK {
+			t.Errorf("Expected %s to pass without checks, got %d %s", path, code, report.Status)
+		}
+	}
+}
+
+// TestFailingCheck tests that one failing check fails the probe, and that
+// every check is reported.
+func TestFailingCheck(t *testing.T) {
+	reg := health.NewRegistry()
+	reg.AddReadinessCheck("cache", passing)
+	reg.AddReadinessCheck("database", func(context.Context) error { return errors.New("connection refused") })
+
+	code, report := probe(t, reg.ReadinessHandler(), "/readyz")
+	if code != http.StatusServiceUnavailable || report.Status != health.StatusFailing {
+		t.Fatalf("Expected 503 failing, got %d %s", code, report.Status)
+	}
+	if result := report.Checks["database"]; result.Status != health.StatusFailing || result.Error != "connection refused" {
+		t.Errorf("Expected the database check to fail with its error, got %+v", result)
+	}
+	if result := report.Checks["cache"]; result.Status != health.StatusOK {
+		t.Errorf("Expected the cache check to pass, got %+v", result)
+	}
+
+	if code, _ := probe(t, reg.LivenessHandler(), "/livez"); code != http.StatusOK {
+		t.Errorf("Expected readiness checks to leave liveness alone, got %d", code)
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	reg := health.NewRegistry()
+	reg.Timeout = 20 * time.Millisecond
+	reg.AddLivenessCheck("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	start := time.Now()
+	report := reg.Live(context.Background())
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Expected the probe not to wait for a slow check, took %s", time.Since(start))
+	}
+	if result := report.Checks["slow"]; result.Status != health.StatusFailing || !strings.Contains(result.Error, "timed out") {
+		t.Errorf("Expected the slow check to time out, got %+v", result)
+	}
+}
+
+func TestCheckPanic(t *testing.T) {
+	reg := health.NewRegistry()
+	reg.AddLivenessCheck("broken", func(context.Context) error { panic("boom") })
+
+	if result := reg.Live(context.Background()).Checks["broken"]; result.Status != health.StatusFailing || !strings.Contains(result.Error, "boom") {
+		t.Errorf("Expected the panicking check to fail, got %+v", result)
+	}
+}
+
+// TestShutdown tests that readiness fails once the server is shutting down,
+// while liveness keeps passing.
+func TestShutdown(t *testing.T) {
+	reg := health.NewRegistry()
+	reg.AddReadinessCheck("database", passing)
+	reg.Shutdown()
+
+	code, report := probe(t, reg.ReadinessHandler(), "/readyz")
+	if code != http.StatusServiceUnavailable || report.Checks["shutdown"].Error != health.ErrShuttingDown.Error() {
+		t.Errorf("Expected readiness to fail for the shutdown, got %d %+v", code, report.Checks)
+	}
+	if code, _ := probe(t, reg.LivenessHandler(), "/livez"); code != http.StatusOK {
+		t.Errorf("Expected liveness to pass during the shutdown, got %d", code)
+	}
+}
+
+func TestRecent(t *testing.T) {
+	var last time.Time
+	check := health.Recent(func() time.Time { return last }, time.Minute)
+
+	if err := check(context.Background()); err == nil {
+		t.Error("Expected a worker that never ran to fail")
+	}
+	last = time.Now()
+	if err := check(context.Background()); err != nil {
+		t.Errorf("Expected a worker that just ran to pass, got %v", err)
+	}
+	last = time.Now().Add(-2 * time.Minute)
+	if err := check(context.Background()); err == nil {
+		t.Error("Expected a stuck worker to fail")
+	}
+}
+
+// TestRoutes tests the probes of the API, with a database that cannot be
+// reached.
+func TestRoutes(t *testing.T) {
+	db, err := sql.Open("mysql", "blog:blog@tcp(127.0.0.1:1)/blog?timeout=1s")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	reg := health.NewRegistry()
+	reg.AddReadinessCheck("database", db.PingContext)
+	server := routes.NewServer(routes.ServerConfig{
+		DB:     conn.NewConn(&database.DBconn{DB: db}),
+		VA:     auth.NewValidator(),
+		Health: reg,
+	})
+
+	if code, _ := probe(t, server, "/livez"); code != http.StatusOK {
+		t.Errorf("Expected /livez to pass, got %d", code)
+	}
+	if code, _ := probe(t, server, "/health"); code != http.StatusOK {
+		t.Errorf("Expected /health to pass, got %d", code)
+	}
+	code, report := probe(t, server, "/readyz")
+	if code != http.StatusServiceUnavailable || report.Checks["database"].Status != health.StatusFailing {
+		t.Errorf("Expected /readyz to fail on the database, got %d %+v", code, report.Checks)
+	}
+}
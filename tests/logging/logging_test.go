@@ -0,0 +1,116 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/A-Victory/blog/logging"
+)
+
+func newLogger(t *testing.T, format string, level slog.Level) (*slog.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	logger, err := logging.New(logging.Config{Format: format, Level: level, Output: &buf})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	return logger, &buf
+}
+
+func decodeLine(t *testing.T, buf *bytes.Buffer) map[string]interface{} {
+	line := map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("Failed to decode log line %q: %v", buf.String(), err)
+	}
+	buf.Reset()
+	return line
+}
+
+// TestRedaction tests that secrets are never written.
+func TestRedaction(t *testing.T) {
+	logger, buf := newLogger(t, logging.FormatJSON, slog.LevelInfo)
+
+	jwt := "eyJhbGciOiJIUzI1NiJ9.eyJ1aWQiOjF9.c2lnbmF0dXJl"
+	logger.Info("login with "+jwt,
+		"password", "hunter2",
+		"newPassword", "hunter3",
+		"Authorization", "Bearer abc",
+		"csrf_token", "xyz",
+		"client_secret", "shh",
+		"error", errors.New("rejected header Bearer abc.def"),
+		"user", "testuser",
+	)
+
+	line := decodeLine(t, buf)
+	for _, key := range []string{"password", "newPassword", "Authorization", "csrf_token", "client_secret"} {
+		if line[key] != logging.Redacted {
+			t.Fatalf("Expected %s to be redacted, got %v", key, line[key])
+		}
+	}
+	if line["msg"] != "login with "+logging.Redacted {
+		t.Fatalf("Expected the token in the message to be redacted, got %v", line["msg"])
+	}
+	if line["error"] != "rejected header "+logging.Redacted {
+		t.Fatalf("Expected the credential in the error to be redacted, got %v", line["error"])
+	}
+	if line["user"] != "testuser" {
+		t.Fatalf("Expected other attributes to be kept, got %v", line["user"])
+	}
+}
+
+// TestScope tests that lines logged with a request context carry its
+// attributes, including those added after the scope started.
+func TestScope(t *testing.T) {
+	logger, buf := newLogger(t, logging.FormatJSON, slog.LevelInfo)
+
+	ctx := logging.NewScope(context.Background(), slog.String("request_id", "req-1"))
+	derived := context.WithValue(ctx, struct{}{}, "derived")
+	logging.Add(derived, slog.Int("user_id", 7))
+
+	logger.InfoContext(ctx, "handled")
+	line := decodeLine(t, buf)
+	if line["request_id"] != "req-1" || line["user_id"] != float64(7) {
+		t.Fatalf("Expected the scope attributes, got %v", line)
+	}
+
+	logger.Info("background")
+	line = decodeLine(t, buf)
+	if _, ok := line["request_id"]; ok {
+		t.Fatalf("Expected no scope attributes without a context, got %v", line)
+	}
+
+	// adding outside a scope is a no-op
+	logging.Add(context.Background(), slog.Int("user_id", 1))
+}
+
+// TestLevelsAndFormats tests the configuration of the logger.
+func TestLevelsAndFormats(t *testing.T) {
+	level, err := logging.ParseLevel("warn")
+	if err != nil || level != slog.LevelWarn {
+		t.Fatalf("Expected level warn, got %v %v", level, err)
+	}
+	if level, err := logging.ParseLevel(""); err != nil || level != slog.LevelInfo {
+		t.Fatalf("Expected info by default, got %v %v", level, err)
+	}
+	if _, err := logging.ParseLevel("loud"); err == nil {
+		t.Fatalf("Expected an error for an unknown level")
+	}
+
+	logger, buf := newLogger(t, logging.FormatText, level)
+	logger.Info("quiet")
+	if buf.Len() != 0 {
+		t.Fatalf("Expected info lines to be dropped at warn, got %q", buf.String())
+	}
+	logger.Warn("loud", "password", "hunter2")
+	if out := buf.String(); !strings.Contains(out, "msg=loud") || strings.Contains(out, "hunter2") {
+		t.Fatalf("Expected a redacted text line, got %q", out)
+	}
+
+	if _, err := logging.New(logging.Config{Format: "xml", Output: buf}); err == nil {
+		t.Fatalf("Expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,55 @@
+package mergepatch_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/A-Victory/blog/mergepatch"
+)
+
+// TestApply runs the examples of RFC 7396, appendix A.
+func TestApply(t *testing.T) {
+	for _, test := range []struct {
+		doc, patch, expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		{``, `{"a":"b"}`, `{"a":"b"}`},
+	} {
+		result, err := mergepatch.Apply([]byte(test.doc), []byte(test.patch))
+		if err != nil {
+			t.Fatalf("Failed to apply %s to %s: %v", test.patch, test.doc, err)
+		}
+
+		var got, expected interface{}
+		if err := json.Unmarshal(result, &got); err != nil {
+			t.Fatalf("Failed to decode result %s: %v", result, err)
+		}
+		json.Unmarshal([]byte(test.expected), &expected)
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("Applying %s to %s: expected %s, got %s", test.patch, test.doc, test.expected, result)
+		}
+	}
+}
+
+// TestApplyInvalidPatch tests that a patch which is not JSON is rejected.
+func TestApplyInvalidPatch(t *testing.T) {
+	if _, err := mergepatch.Apply([]byte(`{}`), []byte(`{"a":`)); !errors.Is(err, mergepatch.ErrInvalidPatch) {
+		t.Fatalf("Expected ErrInvalidPatch, got %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package metrics_test
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/A-Victory/blog/auth"
+	"github.com/A-Victory/blog/database"
+	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/metrics"
+	"github.com/A-Victory/blog/routes"
+)
+
+func scrape(t *testing.T, server http.Handler) string {
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 from /metrics, got %d", rec.Code)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+// TestMetricsEndpoint tests the HTTP, authentication, database and runtime
+// metrics.
+func TestMetricsEndpoint(t *testing.T) {
+	auth.SetSigningKey([]byte("test-signing-key"))
+
+	db, err := sql.Open("mysql", "blog:blog@tcp(127.0.0.1:1)/blog?timeout=1s")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	if err := metrics.RegisterDB("blog_test", db); err != nil {
+		t.Fatalf("Failed to register database metrics: %v", err)
+	}
+
+	server := routes.NewServer(routes.ServerConfig{
+		DB:           conn.NewConn(&database.DBconn{DB: db}),
+		VA:           auth.NewValidator(),
+		ServeMetrics: true,
+	})
+
+	token, err := auth.GenerateJWT(1, "testuser")
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	for _, path := range []string{"/api/v1/posts/5", "/api/v1/posts/6"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		if rec.Code != http.StatusInternalServerError {
+			t.Fatalf("Expected status 500 without a database, got %d", rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/posts/5", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 without a token, got %d", rec.Code)
+	}
+
+	body := scrape(t, server)
+	for _, want := range []string{
+		`blog_http_requests_total{method="GET",route="/api/v1/posts/{id}",status="500"} 2`,
+		`blog_http_request_duration_seconds_count{method="GET",route="/api/v1/posts/{id}"} 2`,
+		`blog_auth_failures_total{reason="missing_token"}`,
+		`go_sql_max_open_connections{db_name="blog_test"}`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("Expected %s in the metrics, got:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, `route="/api/v1/posts/5"`) {
+		t.Fatalf("Expected requests to be labeled by route pattern, not path")
+	}
+
+	metrics.Login(metrics.LoginPassword, false)
+	if body := scrape(t, server); !strings.Contains(body, `blog_logins_total{method="password",result="failure"} 1`) {
+		t.Fatalf("Expected the failed login to be counted, got:\n%s", body)
+	}
+}
+
+// TestMetricsOff tests that /metrics is not on the API unless asked for.
+func TestMetricsOff(t *testing.T) {
+	server := routes.NewServer(routes.ServerConfig{})
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404 without ServeMetrics, got %d", rec.Code)
+	}
+}
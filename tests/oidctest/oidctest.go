@@ -0,0 +1,173 @@
+// Package oidctest provides a mock OpenID Connect provider for tests.
+package oidctest
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/A-Victory/blog/auth"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ClientID is the client the mock provider issues ID tokens to.
+const ClientID = "blog"
+
+// Provider is a minimal OpenID Connect provider serving discovery, JWKS and
+// a token endpoint that enforces PKCE. It signs in whoever its claims
+// describe.
+type Provider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu     sync.Mutex
+	codes  map[string]authRequest
+	issued int
+
+	// claims returned in the next ID token, merged over iss, aud, exp, iat
+	// and nonce
+	claims jwt.MapClaims
+}
+
+type authRequest struct {
+	challenge string
+	nonce     string
+}
+
+// New starts a mock provider that is closed when the test ends.
+func New(t testing.TB) *Provider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	mock := &Provider{key: key, codes: map[string]authRequest{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                mock.server.URL,
+			"authorization_endpoint":                mock.server.URL + "/authorize",
+			"token_endpoint":                        mock.server.URL + "/token",
+			"jwks_uri":                              mock.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", mock.token)
+	mock.server = httptest.NewServer(mux)
+	t.Cleanup(mock.server.Close)
+
+	return mock
+}
+
+// Issuer returns the issuer URL of the provider.
+func (m *Provider) Issuer() string {
+	return m.server.URL
+}
+
+// SetClaims sets the claims of the ID tokens issued from now on.
+func (m *Provider) SetClaims(claims jwt.MapClaims) {
+	m.mu.Lock()
+	m.claims = claims
+	m.mu.Unlock()
+}
+
+// Client returns a client of the provider. The issuer and client ID of the
+// config are filled in.
+func (m *Provider) Client(t testing.TB, config auth.OIDCConfig) *auth.OIDCProvider {
+	config.Issuer = m.server.URL
+	config.ClientID = ClientID
+
+	provider, err := auth.NewOIDCProvider(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	return provider
+}
+
+// Authorize simulates the user approving the login and returns the callback
+// code and state for the given authorization URL.
+func (m *Provider) Authorize(t testing.TB, authURL string) (string, string) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("Failed to parse authorization URL: %v", err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Fatalf("Expected PKCE S256 challenge in authorization URL, got %s", authURL)
+	}
+	if q.Get("client_id") != ClientID {
+		t.Fatalf("Expected client_id %s, got %s", ClientID, q.Get("client_id"))
+	}
+
+	m.mu.Lock()
+	m.issued++
+	code := fmt.Sprintf("code-%d", m.issued)
+	m.codes[code] = authRequest{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	m.mu.Unlock()
+
+	return code, q.Get("state")
+}
+
+// token redeems a code once for an ID token, given the verifier of its
+// challenge.
+func (m *Provider) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	m.mu.Lock()
+	req, ok := m.codes[r.Form.Get("code")]
+	delete(m.codes, r.Form.Get("code"))
+	claims := jwt.MapClaims{
+		"iss":   m.server.URL,
+		"aud":   ClientID,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": req.nonce,
+	}
+	for k, v := range m.claims {
+		claims[k] = v
+	}
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != req.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	idToken, _ := token.SignedString(m.key)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
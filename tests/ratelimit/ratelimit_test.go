@@ -0,0 +1,238 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/A-Victory/blog/auth"
+	"github.com/A-Victory/blog/ratelimit"
+)
+
+func TestParseRate(t *testing.T) {
+	cases := map[string]ratelimit.Rate{
+		"10/1m":   {Limit: 10, Period: time.Minute},
+		"10/m":    {Limit: 10, Period: time.Minute},
+		"300/30s": {Limit: 300, Period: 30 * time.Second},
+		" 5 / h ": {Limit: 5, Period: time.Hour},
+	}
+	for text, want := range cases {
+		var rate ratelimit.Rate
+		if err := rate.UnmarshalText([]byte(text)); err != nil {
+			t.Errorf("Failed to parse %q: %v", text, err)
+			continue
+		}
+		if rate != want {
+			t.Errorf("Expected %q to be %v, got %v", text, want, rate)
+		}
+	}
+
+	for _, text := range []string{"10", "ten/1m", "10/soon", ""} {
+		var rate ratelimit.Rate
+		if err := rate.UnmarshalText([]byte(text)); err == nil {
+			t.Errorf("Expected %q to be rejected", text)
+		}
+	}
+}
+
+func TestBucket(t *testing.T) {
+	rate := ratelimit.Rate{Limit: 3, Period: 3 * time.Second}
+	now := time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC)
+	var bucket ratelimit.Bucket
+
+	for i := 2; i >= 0; i-- {
+		result := bucket.Take(rate, now)
+		if !result.Allowed || result.Remaining != i {
+			t.Fatalf("Expected the request to be allowed with %d left, got %+v", i, result)
+		}
+	}
+	result := bucket.Take(rate, now)
+	if result.Allowed || result.Remaining != 0 {
+		t.Fatalf("Expected an empty bucket to refuse the request, got %+v", result)
+	}
+	if result.RetryAfter != time.Second || result.Reset != 3*time.Second {
+		t.Errorf("Expected to retry after 1s and a reset after 3s, got %s and %s", result.RetryAfter, result.Reset)
+	}
+
+	// a token refills every second
+	result = bucket.Take(rate, now.Add(time.Second))
+	if !result.Allowed || result.Remaining != 0 {
+		t.Errorf("Expected a refilled token to be taken, got %+v", result)
+	}
+	result = bucket.Take(rate, now.Add(time.Hour))
+	if !result.Allowed || result.Remaining != 2 {
+		t.Errorf("Expected the bucket to refill up to its limit, got %+v", result)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := ratelimit.NewMemoryStore()
+	rate := ratelimit.Rate{Limit: 1, Period: time.Minute}
+	now := time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	if result, _ := store.Take(ctx, "a", rate, now); !result.Allowed {
+		t.Fatal("Expected the first request of a to be allowed")
+	}
+	if result, _ := store.Take(ctx, "a", rate, now); result.Allowed {
+		t.Error("Expected the second request of a to be refused")
+	}
+	if result, _ := store.Take(ctx, "b", rate, now); !result.Allowed {
+		t.Error("Expected b to have its own bucket")
+	}
+	if store.Len() != 2 {
+		t.Errorf("Expected 2 buckets, got %d", store.Len())
+	}
+
+	// once full again, the buckets are dropped
+	store.Take(ctx, "c", rate, now.Add(2*time.Minute))
+	if store.Len() != 1 {
+		t.Errorf("Expected the full buckets to be dropped, got %d left", store.Len())
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ratelimit.ParseProxies("10.0.0.0/8, 192.168.1.10")
+	if err != nil {
+		t.Fatalf("Failed to parse the proxies: %v", err)
+	}
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), proxies)
+
+	cases := []struct {
+		name, remote, forwarded, want string
+	}{
+		{"direct", "203.0.113.7:4321", "", "203.0.113.7"},
+		{"untrusted forwarder", "203.0.113.7:4321", "198.51.100.1", "203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:4321", "198.51.100.1", "198.51.100.1"},
+		{"spoofed header", "10.1.2.3:4321", "1.2.3.4, 198.51.100.1", "198.51.100.1"},
+		{"proxy chain", "10.1.2.3:4321", "198.51.100.1, 192.168.1.10, 10.9.9.9", "198.51.100.1"},
+		{"only proxies", "10.1.2.3:4321", "10.9.9.9", "10.9.9.9"},
+		{"no header", "192.168.1.10:4321", "", "192.168.1.10"},
+		{"ipv6", "[2001:db8::1]:4321", "", "2001:db8::1"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = c.remote
+		if c.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", c.forwarded)
+		}
+		if got := limiter.ClientIP(r); got != c.want {
+			t.Errorf("%s: expected %s, got %s", c.name, c.want, got)
+		}
+	}
+
+	if _, err := ratelimit.ParseProxies("10.0.0.0/33"); err == nil {
+		t.Error("Expected an invalid CIDR to be rejected")
+	}
+	if _, err := ratelimit.ParseProxies("proxy.local"); err == nil {
+		t.Error("Expected a hostname to be rejected")
+	}
+}
+
+func fail(w http.ResponseWriter, status int, msg string) {
+	http.Error(w, msg, status)
+}
+
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+func request(handler http.Handler, remote string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.RemoteAddr = remote
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	return rec
+}
+
+func TestLimit(t *testing.T) {
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), nil)
+	policy := ratelimit.Policy{Name: "test", Rate: ratelimit.Rate{Limit: 2, Period: time.Minute}}
+	handler := limiter.Limit(policy, fail)(ok)
+
+	rec := request(handler, "203.0.113.7:1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the first request to pass, got %d", rec.Code)
+	}
+	headers := map[string]string{
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "1",
+		"RateLimit-Reset":     "30",
+		"RateLimit-Policy":    "2;w=60",
+	}
+	for name, want := range headers {
+		if got := rec.Header().Get(name); got != want {
+			t.Errorf("Expected %s %q, got %q", name, want, got)
+		}
+	}
+
+	request(handler, "203.0.113.7:2")
+	rec = request(handler, "203.0.113.7:3")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected the third request to be refused, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "30" || rec.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("Expected to retry after 30s with none left, got %q and %q", rec.Header().Get("Retry-After"), rec.Header().Get("RateLimit-Remaining"))
+	}
+
+	if rec := request(handler, "198.51.100.1:1"); rec.Code != http.StatusOK {
+		t.Errorf("Expected another client to pass, got %d", rec.Code)
+	}
+}
+
+func TestLimitByUser(t *testing.T) {
+	auth.SetSigningKey([]byte("test-signing-key"))
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), nil)
+	policy := ratelimit.Policy{Name: "test", Rate: ratelimit.Rate{Limit: 1, Period: time.Minute}}
+	handler := auth.Verify(limiter.Limit(policy, fail)(ok))
+
+	send := func(userID int, remote string) int {
+		token, err := auth.GenerateJWT(userID, "user")
+		if err != nil {
+			t.Fatalf("Failed to generate token: %v", err)
+		}
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remote
+		r.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	if code := send(1, "203.0.113.7:1"); code != http.StatusOK {
+		t.Fatalf("Expected the first request of user 1 to pass, got %d", code)
+	}
+	if code := send(2, "203.0.113.7:1"); code != http.StatusOK {
+		t.Errorf("Expected user 2 on the same IP to pass, got %d", code)
+	}
+	if code := send(1, "198.51.100.1:1"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected user 1 to be limited from another IP, got %d", code)
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, ratelimit.Rate, time.Time) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("store unreachable")
+}
+
+func TestLimitWithoutStore(t *testing.T) {
+	policy := ratelimit.Policy{Name: "test", Rate: ratelimit.Rate{Limit: 1, Period: time.Minute}}
+
+	handler := ratelimit.NewLimiter(failingStore{}, nil).Limit(policy, fail)(ok)
+	for i := 0; i < 3; i++ {
+		if rec := request(handler, "203.0.113.7:1"); rec.Code != http.StatusOK {
+			t.Fatalf("Expected a failing store to let requests through, got %d", rec.Code)
+		}
+	}
+
+	var limiter *ratelimit.Limiter
+	handler = limiter.Limit(policy, fail)(ok)
+	for i := 0; i < 3; i++ {
+		rec := request(handler, "203.0.113.7:1")
+		if rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Limit") != "" {
+			t.Fatalf("Expected a nil limiter to limit nothing, got %d %v", rec.Code, rec.Header())
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package routes_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestReservedUsernames tests that users cannot rename themselves to a name
+// whose profile a route would shadow.
+func TestReservedUsernames(t *testing.T) {
+	server := newServer(t)
+
+	for _, username := range []string{"me", "Profile", "login", "deleted user"} {
+		rec := serve(t, server, http.MethodPut, "/api/users/username", `{"username": "`+username+`"}`, true)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "is reserved") {
+			t.Errorf("Expected %q to be refused as reserved, got %d: %s", username, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package routes_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	blogv1 "github.com/A-Victory/blog/proto/blog/v1"
+	"github.com/A-Victory/blog/routes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// TestGRPCLoginUnknownEmail tests that an unknown email fails the login like
+// a wrong password.
+func TestGRPCLoginUnknownEmail(t *testing.T) {
+	server := routes.NewGRPCServer(withDB(t, "empty", "", routes.ServerConfig{}))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	client, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	_, err = blogv1.NewUserServiceClient(client).Login(context.Background(), &blogv1.LoginRequest{Email: "nobody@example.com", Password: "password123"})
+	if status.Code(err) != codes.Unauthenticated || status.Convert(err).Message() != "incorrect email or password" {
+		t.Fatalf("Expected Unauthenticated for an unknown email, got %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package routes_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/A-Victory/blog/logging"
+	"github.com/A-Victory/blog/routes"
+)
+
+// TestRequestLogging tests that request lines carry the request id, user id
+// and route, and never the token.
+func TestRequestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(logging.Config{Output: &buf, Level: slog.LevelDebug})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	server := newServerWith(t, routes.ServerConfig{Logger: logger})
+
+	serve(t, server, http.MethodGet, "/api/v1/posts/1", "", true)
+
+	var line map[string]interface{}
+	for _, raw := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if err := json.Unmarshal([]byte(raw), &line); err != nil {
+			t.Fatalf("Failed to decode log line %q: %v", raw, err)
+		}
+	}
+	if line["msg"] != "request completed" {
+		t.Fatalf("Expected the request line last, got %v", line)
+	}
+	if line["request_id"] == "" || line["request_id"] == nil {
+		t.Fatalf("Expected a request id, got %v", line)
+	}
+	if line["user_id"] != float64(1) || line["route"] != "/api/v1/posts/{id}" || line["status"] != float64(http.StatusInternalServerError) {
+		t.Fatalf("Expected the user, route and status of the request, got %v", line)
+	}
+	if line["level"] != "ERROR" {
+		t.Fatalf("Expected server errors to be logged as errors, got %v", line["level"])
+	}
+	if strings.Contains(buf.String(), "eyJ") {
+		t.Fatalf("Expected no token in the logs, got %s", buf.String())
+	}
+}
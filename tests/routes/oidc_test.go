@@ -0,0 +1,101 @@
+package routes_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/A-Victory/blog/auth"
+	"github.com/A-Victory/blog/routes"
+	"github.com/A-Victory/blog/tests/oidctest"
+)
+
+// newOIDCProvider returns a provider named corp. No code is authorized, so
+// the provider refuses every code.
+func newOIDCProvider(t *testing.T) *auth.OIDCProvider {
+	return oidctest.New(t).Client(t, auth.OIDCConfig{Name: "corp", RedirectURL: "http://example.com/api/v1/auth/oidc/corp/callback"})
+}
+
+// TestOIDCCookiesV1 tests that the login state set by either prefix reaches
+// the callback under /api/v1.
+func TestOIDCCookiesV1(t *testing.T) {
+	server := newServerWith(t, routes.ServerConfig{V1Sunset: sunset, OIDC: []*auth.OIDCProvider{newOIDCProvider(t)}})
+
+	for _, prefix := range []string{"/api/v1", "/api"} {
+		login := serve(t, server, http.MethodGet, prefix+"/auth/oidc/corp/login", "", false)
+		if login.Code != http.StatusFound {
+			t.Fatalf("%s: expected status 302 for the login, got %d", prefix, login.Code)
+		}
+		location, err := url.Parse(login.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("%s: failed to parse the redirect: %v", prefix, err)
+		}
+
+		jar, _ := cookiejar.New(nil)
+		jar.SetCookies(&url.URL{Scheme: "http", Host: "example.com", Path: prefix + "/auth/oidc/corp/login"}, login.Result().Cookies())
+		callback := &url.URL{Scheme: "http", Host: "example.com", Path: "/api/v1/auth/oidc/corp/callback"}
+		cookies := jar.Cookies(callback)
+		if len(cookies) != 2 {
+			t.Fatalf("%s: expected the state and mode cookies on the v1 callback, got %v", prefix, cookies)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, callback.Path+"?code=unknown&state="+url.QueryEscape(location.Query().Get("state")), nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+
+		// the state is present, so the login fails on the code exchange
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("%s: expected status 401 for a refused code, got %d: %s", prefix, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+// TestOIDCCallbackErrors tests the failures of the callback that happen
+// before an account is looked up.
+func TestOIDCCallbackErrors(t *testing.T) {
+	server := newServerWith(t, routes.ServerConfig{V1Sunset: sunset, OIDC: []*auth.OIDCProvider{newOIDCProvider(t)}})
+
+	login := serve(t, server, http.MethodGet, "/api/auth/oidc/corp/login", "", false)
+	if login.Code != http.StatusFound {
+		t.Fatalf("Expected status 302 for the login, got %d", login.Code)
+	}
+
+	for _, test := range []struct {
+		name    string
+		path    string
+		cookies bool
+		status  int
+		message string
+	}{
+		{"unknown provider", "/api/auth/oidc/other/callback?code=x&state=y", true, http.StatusNotFound, "provider not found"},
+		{"provider error", "/api/auth/oidc/corp/callback?error=access_denied&error_description=denied", true, http.StatusUnauthorized, "error"},
+		{"missing state", "/api/auth/oidc/corp/callback?code=x&state=y", false, http.StatusBadRequest, "invalid request"},
+		{"forged state", "/api/auth/oidc/corp/callback?code=x&state=forged", true, http.StatusUnauthorized, "error"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		if test.cookies {
+			for _, cookie := range login.Result().Cookies() {
+				req.AddCookie(cookie)
+			}
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+
+		var body struct {
+			Status  int    `json:"status"`
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: failed to decode response %q: %v", test.name, rec.Body.String(), err)
+		}
+		if rec.Code != test.status || body.Status != test.status || body.Message != test.message {
+			t.Fatalf("%s: expected %d %q, got %d %s", test.name, test.status, test.message, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package routes_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/A-Victory/blog/ratelimit"
+	"github.com/A-Victory/blog/routes"
+)
+
+func newLimitedServer(t *testing.T) http.Handler {
+	return newServerWith(t, routes.ServerConfig{
+		RateLimits: routes.RateLimits{
+			Limiter: ratelimit.NewLimiter(ratelimit.NewMemoryStore(), nil),
+			Auth:    ratelimit.Rate{Limit: 2, Period: time.Minute},
+			Read:    ratelimit.Rate{Limit: 2, Period: time.Minute},
+			Write:   ratelimit.Rate{Limit: 1, Period: time.Minute},
+		},
+	})
+}
+
+func TestLoginRateLimit(t *testing.T) {
+	server := newLimitedServer(t)
+
+	login := func(path string) *httptest.ResponseRecorder {
+		return serve(t, server, http.MethodPost, path, `{"username": "testuser", "password": "wrong"}`, false)
+	}
+
+	// v1 under /api/v1 and /api shares the buckets
+	login("/api/v1/users/login")
+	login("/api/users/login")
+	rec := login("/api/v1/users/login")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected the third login to be refused, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header")
+	}
+	var v1 struct {
+		Status int                    `json:"status"`
+		Data   map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&v1); err != nil || v1.Status != http.StatusTooManyRequests {
+		t.Errorf("Expected a v1 error body, got %+v (%v)", v1, err)
+	}
+
+	rec = login("/api/v2/users/login")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected the v2 login to share the auth limit, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `"code":"too_many_requests"`) {
+		t.Errorf("Expected a v2 error body, got %s", rec.Body.String())
+	}
+}
+
+func TestContentRateLimit(t *testing.T) {
+	server := newLimitedServer(t)
+
+	// the write fails on the database, but still takes its token
+	serve(t, server, http.MethodPost, "/api/v2/posts", `{"title": "t", "content": "c"}`, true)
+	rec := serve(t, server, http.MethodPost, "/api/v2/posts", `{"title": "t", "content": "c"}`, true)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected the second write to be refused, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("RateLimit-Policy"); got != "1;w=60" {
+		t.Errorf("Expected the write policy, got %q", got)
+	}
+
+	rec = serve(t, server, http.MethodGet, "/api/v2/posts", "", true)
+	if rec.Code == http.StatusTooManyRequests {
+		t.Error("Expected reads to have their own limit")
+	}
+	if got := rec.Header().Get("RateLimit-Remaining"); got != "1" {
+		t.Errorf("Expected 1 read left, got %q", got)
+	}
+
+	if rec := serve(t, server, http.MethodGet, "/livez", "", false); rec.Header().Get("RateLimit-Limit") != "" {
+		t.Error("Expected the probes not to be limited")
+	}
+}
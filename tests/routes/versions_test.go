@@ -0,0 +1,192 @@
+package routes_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/A-Victory/blog/auth"
+	"github.com/A-Victory/blog/database"
+	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/routes"
+)
+
+var sunset = time.Date(2027, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+// newServer returns the API backed by a database that cannot be reached, so
+// every query fails the same way.
+func newServer(t *testing.T) http.Handler {
+	return newServerWith(t, routes.ServerConfig{V1Sunset: sunset})
+}
+
+func newServerWith(t *testing.T, config routes.ServerConfig) http.Handler {
+	return routes.NewServer(withDB(t, "mysql", "blog:blog@tcp(127.0.0.1:1)/blog?timeout=1s", config))
+}
+
+// newEmptyServer returns the API backed by a database without any rows.
+func newEmptyServer(t *testing.T) http.Handler {
+	return routes.NewServer(withDB(t, "empty", "", routes.ServerConfig{V1Sunset: sunset}))
+}
+
+func withDB(t *testing.T, driverName, dsn string, config routes.ServerConfig) routes.ServerConfig {
+	auth.SetSigningKey([]byte("test-signing-key"))
+
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	config.DB = conn.NewConn(&database.DBconn{DB: db})
+	config.VA = auth.NewValidator()
+	return config
+}
+
+func init() {
+	sql.Register("empty", emptyDriver{})
+}
+
+// emptyDriver is a database in which every query finds no rows and every
+// statement changes nothing.
+type emptyDriver struct{}
+
+func (emptyDriver) Open(string) (driver.Conn, error) { return emptyConn{}, nil }
+
+type emptyConn struct{}
+
+func (emptyConn) Prepare(string) (driver.Stmt, error) { return emptyStmt{}, nil }
+func (emptyConn) Close() error                        { return nil }
+func (emptyConn) Begin() (driver.Tx, error)           { return emptyTx{}, nil }
+
+type emptyTx struct{}
+
+func (emptyTx) Commit() error   { return nil }
+func (emptyTx) Rollback() error { return nil }
+
+type emptyStmt struct{}
+
+func (emptyStmt) Close() error                               { return nil }
+func (emptyStmt) NumInput() int                              { return -1 }
+func (emptyStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(0), nil }
+func (emptyStmt) Query([]driver.Value) (driver.Rows, error)  { return emptyRows{}, nil }
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string         { return nil }
+func (emptyRows) Close() error              { return nil }
+func (emptyRows) Next([]driver.Value) error { return io.EOF }
+
+func serve(t *testing.T, server http.Handler, method, path, body string, token bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token {
+		jwt, err := auth.GenerateJWT(1, "testuser")
+		if err != nil {
+			t.Fatalf("Failed to generate token: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+jwt)
+	}
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestV1Responses pins the responses of v1, under both /api/v1 and the
+// unversioned /api, which must not change.
+func TestV1Responses(t *testing.T) {
+	server := newServer(t)
+
+	for _, prefix := range []string{"/api/v1", "/api"} {
+		rec := serve(t, server, http.MethodPost, prefix+"/users/login", "{", false)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected status 400 for a malformed login, got %d", prefix, rec.Code)
+		}
+		if got, want := rec.Body.String(), `{"status":400,"message":"error","data":{"message":"unexpected EOF"}}`+"\n"; got != want {
+			t.Fatalf("%s: expected login body %s, got %s", prefix, want, got)
+		}
+
+		if got, want := rec.Header().Get("Deprecation"), fmt.Sprintf("@%d", time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC).Unix()); got != want {
+			t.Fatalf("%s: expected Deprecation %s, got %q", prefix, want, got)
+		}
+		if got, want := rec.Header().Get("Sunset"), "Thu, 01 Apr 2027 00:00:00 GMT"; got != want {
+			t.Fatalf("%s: expected Sunset %s, got %q", prefix, want, got)
+		}
+		if got := rec.Header().Get("Link"); got != `</api/v2>; rel="successor-version"` {
+			t.Fatalf("%s: expected a successor-version Link, got %q", prefix, got)
+		}
+
+		rec = serve(t, server, http.MethodGet, prefix+"/posts/", "", false)
+		if rec.Code != http.StatusUnauthorized || rec.Body.String() != "User not authorized please login!\n" {
+			t.Fatalf("%s: expected the plain text 401, got %d %q", prefix, rec.Code, rec.Body.String())
+		}
+
+		rec = serve(t, server, http.MethodGet, prefix+"/posts/1", "", true)
+		if rec.Code != http.StatusInternalServerError {
+			t.Fatalf("%s: expected status 500 without a database, got %d", prefix, rec.Code)
+		}
+		var body struct {
+			Status  int                    `json:"status"`
+			Message string                 `json:"message"`
+			Data    map[string]interface{} `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", prefix, err)
+		}
+		msg, _ := body.Data["msg"].(string)
+		if body.Status != http.StatusInternalServerError || body.Message != "server error" || len(body.Data) != 1 ||
+			!strings.HasPrefix(msg, "failed to retrieve user's details: ") {
+			t.Fatalf("%s: unexpected error body %s", prefix, rec.Body.String())
+		}
+	}
+}
+
+// TestV2Errors tests the v2 error body and that v2 is not deprecated.
+func TestV2Errors(t *testing.T) {
+	server := newServer(t)
+
+	for _, test := range []struct {
+		method, path, body string
+		token              bool
+		status             int
+		code               string
+	}{
+		{http.MethodPost, "/api/v2/users/login", "{", false, http.StatusBadRequest, "bad_request"},
+		{http.MethodGet, "/api/v2/posts/", "", false, http.StatusUnauthorized, "unauthorized"},
+		{http.MethodGet, "/api/v2/posts/1", "", true, http.StatusInternalServerError, "internal_server_error"},
+		{http.MethodPost, "/api/v2/posts/", "{}", true, http.StatusInternalServerError, "internal_server_error"},
+	} {
+		rec := serve(t, server, test.method, test.path, test.body, test.token)
+		if rec.Code != test.status {
+			t.Fatalf("%s %s: expected status %d, got %d", test.method, test.path, test.status, rec.Code)
+		}
+		if rec.Header().Get("Deprecation") != "" {
+			t.Fatalf("%s %s: v2 must not be deprecated", test.method, test.path)
+		}
+
+		var body struct {
+			Error struct {
+				Status  int    `json:"status"`
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s %s: failed to decode response %q: %v", test.method, test.path, rec.Body.String(), err)
+		}
+		if body.Error.Status != test.status || body.Error.Code != test.code || body.Error.Message == "" {
+			t.Fatalf("%s %s: unexpected error body %s", test.method, test.path, rec.Body.String())
+		}
+	}
+
+	// an unknown email is a failed login, not a server error
+	rec := serve(t, newEmptyServer(t), http.MethodPost, "/api/v2/users/login", `{"email":"nobody@example.com","password":"password123"}`, false)
+	if got, want := rec.Body.String(), `{"error":{"status":401,"code":"unauthorized","message":"incorrect email or password"}}`+"\n"; rec.Code != http.StatusUnauthorized || got != want {
+		t.Fatalf("Expected 401 %s for an unknown email, got %d %s", want, rec.Code, got)
+	}
+}
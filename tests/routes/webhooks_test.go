@@ -0,0 +1,35 @@
+package routes_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestWebhookURLs tests that subscriptions to the network of the server are
+// refused before anything is stored.
+func TestWebhookURLs(t *testing.T) {
+	server := newServer(t)
+
+	for _, url := range []string{
+		"http://127.0.0.1:9100/metrics",
+		"https://127.0.0.1/hook",
+		"https://169.254.169.254/latest/meta-data",
+		"http://hooks.example.com/blog",
+	} {
+		body := `{"url": "` + url + `", "events": ["post.created"]}`
+		rec := serve(t, server, http.MethodPost, "/api/webhooks", body, true)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected %s to be refused with 400, got %d: %s", url, rec.Code, rec.Body.String())
+			continue
+		}
+		var response struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		json.NewDecoder(rec.Body).Decode(&response)
+		if message, _ := response.Data["message"].(string); !strings.Contains(message, "webhook") {
+			t.Errorf("Expected the reason for %s, got %v", url, response.Data)
+		}
+	}
+}
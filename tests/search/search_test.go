@@ -0,0 +1,233 @@
+package search_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/A-Victory/blog/models"
+	"github.com/A-Victory/blog/search"
+)
+
+// TestParse tests that query strings are parsed into clauses.
+func TestParse(t *testing.T) {
+	terms, err := search.Parse(`Go "error handling" OR panics -java +tips`)
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+	if len(terms) != 4 {
+		t.Fatalf("Expected 4 clauses, got %d: %v", len(terms), terms)
+	}
+
+	if len(terms[0].Alternatives) != 1 || terms[0].Alternatives[0][0] != "go" {
+		t.Fatalf("Expected lower cased word 'go', got %v", terms[0])
+	}
+	if len(terms[1].Alternatives) != 2 {
+		t.Fatalf("Expected OR to join two alternatives, got %v", terms[1])
+	}
+	if strings.Join(terms[1].Alternatives[0], " ") != "error handling" {
+		t.Fatalf("Expected phrase 'error handling', got %v", terms[1].Alternatives[0])
+	}
+	if !terms[2].Negated || terms[2].Alternatives[0][0] != "java" {
+		t.Fatalf("Expected negated 'java', got %v", terms[2])
+	}
+	if terms[3].Negated || terms[3].Alternatives[0][0] != "tips" {
+		t.Fatalf("Expected leading + to be ignored, got %v", terms[3])
+	}
+
+	words := terms.Words()
+	if strings.Join(words, ",") != "go,error,handling,panics,tips" {
+		t.Fatalf("Unexpected words: %v", words)
+	}
+
+	for _, query := range []string{"", "   ", "-java", `-"only excluded"`, "OR"} {
+		if _, err := search.Parse(query); err == nil {
+			t.Errorf("Expected %q to be rejected", query)
+		}
+	}
+}
+
+// TestHighlight tests that snippets are escaped, marked and trimmed.
+func TestHighlight(t *testing.T) {
+	snippet := search.Highlight("Go <b>errors</b> are values", []string{"errors"}, 100)
+	if snippet != "Go &lt;b&gt;<mark>errors</mark>&lt;/b&gt; are values" {
+		t.Fatalf("Unexpected snippet: %s", snippet)
+	}
+
+	text := strings.Repeat("filler words here ", 20) + "the needle is here " + strings.Repeat("more text after ", 20)
+	snippet = search.Highlight(text, []string{"needle"}, 60)
+	if !strings.Contains(snippet, "<mark>needle</mark>") {
+		t.Fatalf("Expected snippet around the match, got %s", snippet)
+	}
+	if !strings.HasPrefix(snippet, "…") || !strings.HasSuffix(snippet, "…") {
+		t.Fatalf("Expected ellipses on both ends, got %s", snippet)
+	}
+	if len([]rune(snippet)) > 80 {
+		t.Fatalf("Expected a short snippet, got %d characters", len([]rune(snippet)))
+	}
+}
+
+func newIndex() *search.MemoryIndex {
+	index := search.NewMemoryIndex()
+	index.Load([]models.Post{
+		{ID: 1, Title: "Error handling in Go", Content: "Errors are values. Wrap them with context.", AuthorID: 1, Status: models.PostPublished, CreatedAt: "2024-01-01 10:00:00"},
+		{ID: 2, Title: "Concurrency patterns", Content: "Channels carry errors between goroutines. Handling them is tricky.", AuthorID: 2, Status: models.PostPublished, CreatedAt: "2024-01-02 10:00:00"},
+		{ID: 3, Title: "Java exceptions", Content: "Checked exceptions versus error handling in Go.", AuthorID: 1, Status: models.PostPublished, CreatedAt: "2024-01-03 10:00:00"},
+		{ID: 4, Title: "Unfinished error handling notes", Content: "Draft about errors.", AuthorID: 1, Status: models.PostDraft, CreatedAt: "2024-01-04 10:00:00"},
+	}, []models.Comment{
+		{ID: 10, Postid: 1, AuthorID: 2, Content: "Great post about error handling!", CreatedAt: "2024-01-05 10:00:00"},
+		{ID: 11, Postid: 4, AuthorID: 2, Content: "Error handling comment on a draft.", CreatedAt: "2024-01-06 10:00:00"},
+	})
+	return index
+}
+
+func runSearch(t *testing.T, index search.Searcher, text string, types ...string) []search.Result {
+	t.Helper()
+	terms, err := search.Parse(text)
+	if err != nil {
+		t.Fatalf("Failed to parse %q: %v", text, err)
+	}
+	results, err := index.Search(context.Background(), search.Query{Terms: terms, Types: types, Limit: 10})
+	if err != nil {
+		t.Fatalf("Failed to search %q: %v", text, err)
+	}
+	return results
+}
+
+func ids(results []search.Result) []int {
+	var ids []int
+	for _, result := range results {
+		ids = append(ids, result.ID)
+	}
+	return ids
+}
+
+func sameIDs(got []int, want ...int) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestMemoryIndexBoolean tests AND, OR and exclusion.
+func TestMemoryIndexBoolean(t *testing.T) {
+	index := newIndex()
+
+	results := runSearch(t, index, "errors go", search.TypePost)
+	if !sameIDs(ids(results), 1) {
+		t.Fatalf("Expected only post 1 to contain both words, got %v", ids(results))
+	}
+
+	results = runSearch(t, index, "channels OR exceptions", search.TypePost)
+	if len(results) != 2 {
+		t.Fatalf("Expected posts 2 and 3, got %v", ids(results))
+	}
+
+	results = runSearch(t, index, "handling -java", search.TypePost)
+	if !sameIDs(ids(results), 1, 2) && !sameIDs(ids(results), 2, 1) {
+		t.Fatalf("Expected posts 1 and 2, got %v", ids(results))
+	}
+}
+
+// TestMemoryIndexPhrase tests that phrases only match adjacent words.
+func TestMemoryIndexPhrase(t *testing.T) {
+	index := newIndex()
+
+	results := runSearch(t, index, `"error handling"`, search.TypePost)
+	if len(results) != 2 {
+		t.Fatalf("Expected posts 1 and 3, got %v", ids(results))
+	}
+	for _, result := range results {
+		if result.ID == 2 {
+			t.Fatal("Expected post 2 not to match the phrase")
+		}
+	}
+}
+
+// TestMemoryIndexTitleBoost tests that title matches rank first.
+func TestMemoryIndexTitleBoost(t *testing.T) {
+	index := newIndex()
+
+	results := runSearch(t, index, "concurrency OR exceptions OR values", search.TypePost)
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %v", ids(results))
+	}
+	if results[2].ID != 1 {
+		t.Fatalf("Expected the body-only match to rank last, got %v", ids(results))
+	}
+	if results[0].Score < results[2].Score {
+		t.Fatalf("Expected results ordered by score, got %v", results)
+	}
+
+	results = runSearch(t, index, "error", search.TypePost)
+	if results[0].ID != 1 {
+		t.Fatalf("Expected the title match to rank first, got %v", ids(results))
+	}
+
+	results = runSearch(t, index, "values", search.TypePost)
+	if len(results) != 1 || results[0].Snippet != "Errors are <mark>values</mark>. Wrap them with context." {
+		t.Fatalf("Expected a highlighted snippet, got %v", results)
+	}
+}
+
+// TestMemoryIndexComments tests that comments are searchable and follow the
+// visibility of their post.
+func TestMemoryIndexComments(t *testing.T) {
+	index := newIndex()
+
+	results := runSearch(t, index, "great", search.TypeComment)
+	if !sameIDs(ids(results), 10) {
+		t.Fatalf("Expected comment 10, got %v", ids(results))
+	}
+	if results[0].Title != "Error handling in Go" || results[0].PostID != 1 {
+		t.Fatalf("Expected the comment to carry its post, got %+v", results[0])
+	}
+
+	results = runSearch(t, index, "draft")
+	if len(results) != 0 {
+		t.Fatalf("Expected drafts and their comments to be hidden, got %v", results)
+	}
+
+	results = runSearch(t, index, `"error handling"`)
+	if len(results) != 3 {
+		t.Fatalf("Expected 2 posts and 1 comment, got %v", results)
+	}
+
+	index.IndexPost(models.Post{ID: 1, Title: "Error handling in Go", Content: "Hidden again.", Status: models.PostDraft})
+	results = runSearch(t, index, "great")
+	if len(results) != 0 {
+		t.Fatalf("Expected comments to disappear with their post, got %v", results)
+	}
+
+	index.RemoveComment(10)
+	index.IndexPost(models.Post{ID: 1, Title: "Error handling in Go", Content: "Back again.", Status: models.PostPublished})
+	results = runSearch(t, index, "great")
+	if len(results) != 0 {
+		t.Fatalf("Expected removed comment to stay removed, got %v", results)
+	}
+}
+
+// TestMemoryIndexPagination tests limit and offset.
+func TestMemoryIndexPagination(t *testing.T) {
+	index := newIndex()
+	terms, _ := search.Parse("handling")
+
+	all, _ := index.Search(context.Background(), search.Query{Terms: terms, Limit: 10})
+	page, err := index.Search(context.Background(), search.Query{Terms: terms, Limit: 1, Offset: 1})
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if len(page) != 1 || page[0].ID != all[1].ID || page[0].Type != all[1].Type {
+		t.Fatalf("Expected the second result, got %v", page)
+	}
+
+	page, _ = index.Search(context.Background(), search.Query{Terms: terms, Limit: 10, Offset: 100})
+	if len(page) != 0 {
+		t.Fatalf("Expected an empty page, got %v", page)
+	}
+}
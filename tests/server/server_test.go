@@ -0,0 +1,234 @@
+package server_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/A-Victory/blog/server"
+)
+
+// freeAddr returns a local address nothing listens on.
+func freeAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+// waitListening waits for the server at addr to accept connections.
+func waitListening(t *testing.T, addr string) {
+	for i := 0; i < 100; i++ {
+		if c, err := net.Dial("tcp", addr); err == nil {
+			c.Close()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Server at %s never started", addr)
+}
+
+func TestNewDefaults(t *testing.T) {
+	srv := server.New(server.Config{Addr: ":8080", WriteTimeout: time.Minute}, http.NotFoundHandler())
+
+	if srv.ReadHeaderTimeout != server.DefaultReadHeaderTimeout || srv.ReadTimeout != server.DefaultReadTimeout || srv.IdleTimeout != server.DefaultIdleTimeout {
+		t.Errorf("Expected the default timeouts, got %s, %s and %s", srv.ReadHeaderTimeout, srv.ReadTimeout, srv.IdleTimeout)
+	}
+	if srv.WriteTimeout != time.Minute {
+		t.Errorf("Expected the configured write timeout, got %s", srv.WriteTimeout)
+	}
+	if srv.TLSConfig != nil {
+		t.Error("Expected no TLS without a certificate")
+	}
+}
+
+// TestRunDrains tests that a shutdown lets the requests in flight finish.
+func TestRunDrains(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	addr := freeAddr(t)
+	srv := server.New(server.Config{Addr: addr}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() { stopped <- server.Run(ctx, srv, 5*time.Second) }()
+	waitListening(t, addr)
+
+	responses := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr)
+		if err != nil {
+			responses <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		responses <- string(body)
+	}()
+
+	<-started
+	cancel()
+	select {
+	case err := <-stopped:
+		t.Fatalf("Expected Run to wait for the request in flight, it returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if body := <-responses; body != "done" {
+		t.Errorf("Expected the request in flight to complete, got %q", body)
+	}
+	if err := <-stopped; err != nil {
+		t.Errorf("Expected a clean shutdown, got %v", err)
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Error("Expected the server to stop listening")
+	}
+}
+
+func TestRunShutdownTimeout(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	addr := freeAddr(t)
+	srv := server.New(server.Config{Addr: addr}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() { stopped <- server.Run(ctx, srv, 50*time.Millisecond) }()
+	waitListening(t, addr)
+
+	go http.Get("http://" + addr)
+	<-started
+	cancel()
+
+	select {
+	case err := <-stopped:
+		if err == nil {
+			t.Error("Expected an error for the request left in flight")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Run to give up after the timeout")
+	}
+}
+
+func TestRunListenError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	srv := server.New(server.Config{Addr: listener.Addr().String()}, http.NotFoundHandler())
+	if err := server.Run(context.Background(), srv, time.Second); err == nil {
+		t.Error("Expected an error when the address is taken")
+	}
+}
+
+// writeCertificate writes a self-signed certificate for name.
+func writeCertificate(t *testing.T, certFile, keyFile, name string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to encode key: %v", err)
+	}
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+}
+
+func commonName(t *testing.T, cert *server.Certificate) string {
+	current, err := cert.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("Failed to get certificate: %v", err)
+	}
+	parsed, err := x509.ParseCertificate(current.Certificate[0])
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return parsed.Subject.CommonName
+}
+
+// TestCertificateReload tests that a renewed certificate is picked up, and
+// that a broken one does not replace the current one.
+func TestCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCertificate(t, certFile, keyFile, "old.example.com")
+
+	cert, err := server.LoadCertificate(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	if name := commonName(t, cert); name != "old.example.com" {
+		t.Fatalf("Expected the loaded certificate, got %s", name)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cert.Watch(ctx, 10*time.Millisecond)
+
+	if err := os.WriteFile(certFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	later := time.Now().Add(time.Second)
+	os.Chtimes(certFile, later, later)
+	time.Sleep(50 * time.Millisecond)
+	if name := commonName(t, cert); name != "old.example.com" {
+		t.Fatalf("Expected the current certificate to be kept, got %s", name)
+	}
+
+	writeCertificate(t, certFile, keyFile, "new.example.com")
+	later = later.Add(time.Second)
+	os.Chtimes(certFile, later, later)
+	for i := 0; i < 100 && commonName(t, cert) != "new.example.com"; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if name := commonName(t, cert); name != "new.example.com" {
+		t.Errorf("Expected the renewed certificate, got %s", name)
+	}
+}
+
+func TestLoadCertificateMissing(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := server.LoadCertificate(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")); err == nil {
+		t.Error("Expected an error for missing files")
+	}
+}
@@ -0,0 +1,138 @@
+package stream_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/A-Victory/blog/stream"
+)
+
+// startHub runs a hub over a local broker until the test ends.
+func startHub(t *testing.T) *stream.Hub {
+	hub := stream.NewHub(stream.NewLocalBroker())
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go hub.Run(ctx)
+	// wait for the hub to subscribe to the broker
+	time.Sleep(10 * time.Millisecond)
+	return hub
+}
+
+func receive(t *testing.T, sub *stream.Subscription) stream.Event {
+	select {
+	case event, ok := <-sub.Events():
+		if !ok {
+			t.Fatalf("Expected an event, the subscription was closed")
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatalf("Expected an event, got none")
+	}
+	return stream.Event{}
+}
+
+// TestHub tests that events reach the subscribers of their topic only.
+func TestHub(t *testing.T) {
+	hub := startHub(t)
+	ctx := context.Background()
+
+	sub, backlog := hub.Subscribe(stream.CommentTopic(1), 0)
+	defer sub.Close()
+	other, _ := hub.Subscribe(stream.CommentTopic(2), 0)
+	defer other.Close()
+	if len(backlog) != 0 {
+		t.Fatalf("Expected no backlog for a new client, got %+v", backlog)
+	}
+
+	if err := hub.Publish(ctx, stream.CommentTopic(1), "comment.created", map[string]int{"id": 7}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	event := receive(t, sub)
+	if event.Type != "comment.created" || string(event.Data) != `{"id":7}` || event.ID == 0 {
+		t.Fatalf("Unexpected event %+v", event)
+	}
+
+	select {
+	case event := <-other.Events():
+		t.Fatalf("Expected no event on another topic, got %+v", event)
+	default:
+	}
+}
+
+// TestHubResume tests that a client resuming from Last-Event-ID gets the
+// events it missed.
+func TestHubResume(t *testing.T) {
+	hub := startHub(t)
+	ctx := context.Background()
+	topic := stream.CommentTopic(1)
+
+	sub, _ := hub.Subscribe(topic, 0)
+	for i := 1; i <= 3; i++ {
+		hub.Publish(ctx, topic, "comment.created", map[string]int{"id": i})
+	}
+	first := receive(t, sub)
+	sub.Close()
+
+	resumed, backlog := hub.Subscribe(topic, first.ID)
+	defer resumed.Close()
+	if len(backlog) != 2 {
+		t.Fatalf("Expected the 2 missed events, got %+v", backlog)
+	}
+	var data map[string]int
+	json.Unmarshal(backlog[0].Data, &data)
+	if data["id"] != 2 || backlog[1].ID <= backlog[0].ID {
+		t.Fatalf("Expected the missed events in order, got %+v", backlog)
+	}
+}
+
+// TestHubSlowClient tests that a client that falls behind is disconnected.
+func TestHubSlowClient(t *testing.T) {
+	hub := startHub(t)
+	ctx := context.Background()
+	topic := stream.CommentTopic(1)
+
+	sub, _ := hub.Subscribe(topic, 0)
+	defer sub.Close()
+	for i := 0; i < 100; i++ {
+		hub.Publish(ctx, topic, "comment.created", i)
+	}
+
+	for range sub.Events() {
+	}
+}
+
+// TestHubClose tests that closing the hub ends the subscriptions, current
+// and later ones.
+func TestHubClose(t *testing.T) {
+	hub := startHub(t)
+
+	sub, _ := hub.Subscribe(stream.CommentTopic(1), 0)
+	defer sub.Close()
+	hub.Close()
+	if _, ok := <-sub.Events(); ok {
+		t.Error("Expected the subscription to end")
+	}
+
+	later, _ := hub.Subscribe(stream.CommentTopic(1), 0)
+	defer later.Close()
+	if _, ok := <-later.Events(); ok {
+		t.Error("Expected a later subscription to end at once")
+	}
+}
+
+// TestWrite tests the text/event-stream encoding.
+func TestWrite(t *testing.T) {
+	var buf bytes.Buffer
+	if err := stream.Write(&buf, stream.Event{ID: 42, Type: "comment.deleted", Data: []byte("{\"a\":1}\n{\"b\":2}")}); err != nil {
+		t.Fatalf("Failed to write event: %v", err)
+	}
+
+	expected := "id: 42\nevent: comment.deleted\ndata: {\"a\":1}\ndata: {\"b\":2}\n\n"
+	if buf.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, buf.String())
+	}
+}
@@ -0,0 +1,189 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/A-Victory/blog/auth"
+	"github.com/A-Victory/blog/database"
+	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/routes"
+	"github.com/A-Victory/blog/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var exporter = tracetest.NewInMemoryExporter()
+
+// TestMain installs the in-memory exporter before any span is started: the
+// tracers of the packages are bound to the first provider set.
+func TestMain(m *testing.M) {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	os.Exit(m.Run())
+}
+
+func newDB(t *testing.T) *conn.DB {
+	db, err := sql.Open("mysql", "blog:blog@tcp(127.0.0.1:1)/blog?timeout=1s")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return conn.NewConn(&database.DBconn{DB: db})
+}
+
+func find(spans tracetest.SpanStubs, match func(tracetest.SpanStub) bool) (tracetest.SpanStub, bool) {
+	for _, span := range spans {
+		if match(span) {
+			return span, true
+		}
+	}
+	return tracetest.SpanStub{}, false
+}
+
+func attribute(span tracetest.SpanStub, key string) string {
+	for _, attr := range span.Attributes {
+		if string(attr.Key) == key {
+			return attr.Value.Emit()
+		}
+	}
+	return ""
+}
+
+// TestRequestSpans tests that a request continues the trace of its
+// traceparent, and that its database calls are traced under it.
+func TestRequestSpans(t *testing.T) {
+	exporter.Reset()
+	auth.SetSigningKey([]byte("test-signing-key"))
+	server := routes.NewServer(routes.ServerConfig{DB: newDB(t), VA: auth.NewValidator()})
+
+	jwt, err := auth.GenerateJWT(1, "testuser")
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/posts/1", nil)
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+
+	spans := exporter.GetSpans()
+	request, ok := find(spans, func(s tracetest.SpanStub) bool { return s.Name == "GET /api/v2/posts/{id}" })
+	if !ok {
+		t.Fatalf("Expected a span named after the route, got %v", names(spans))
+	}
+	if request.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected the trace of the traceparent, got %s", request.SpanContext.TraceID())
+	}
+	if request.Parent.SpanID().String() != "00f067aa0ba902b7" || !request.Parent.IsRemote() {
+		t.Errorf("Expected the remote parent of the traceparent, got %s", request.Parent.SpanID())
+	}
+	if attribute(request, "http.response.status_code") != "500" || request.Status.Code != codes.Error {
+		t.Errorf("Expected a failed span for the 500 response, got status %s and %v", attribute(request, "http.response.status_code"), request.Status)
+	}
+
+	method, ok := find(spans, func(s tracetest.SpanStub) bool {
+		return strings.HasPrefix(s.Name, "conn.DB.") && s.Parent.SpanID() == request.SpanContext.SpanID()
+	})
+	if !ok {
+		t.Fatalf("Expected a conn.DB span under the request, got %v", names(spans))
+	}
+	statement, ok := find(spans, func(s tracetest.SpanStub) bool { return s.Parent.SpanID() == method.SpanContext.SpanID() })
+	if !ok {
+		t.Fatalf("Expected a statement span under %s, got %v", method.Name, names(spans))
+	}
+	if statement.Name != "SELECT" || !strings.HasPrefix(attribute(statement, "db.query.text"), "SELECT ") {
+		t.Errorf("Expected a SELECT statement, got %s: %q", statement.Name, attribute(statement, "db.query.text"))
+	}
+	if statement.Status.Code != codes.Error {
+		t.Errorf("Expected the failed statement to be recorded, got %v", statement.Status)
+	}
+}
+
+// TestDBSpans tests the spans of a conn.DB method outside a request.
+func TestDBSpans(t *testing.T) {
+	exporter.Reset()
+	db := newDB(t)
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+	db.WithContext(ctx).DeleteWebhook(1, 2)
+	parent.End()
+
+	spans := exporter.GetSpans()
+	method, ok := find(spans, func(s tracetest.SpanStub) bool { return s.Name == "conn.DB.DeleteWebhook" })
+	if !ok {
+		t.Fatalf("Expected a conn.DB.DeleteWebhook span, got %v", names(spans))
+	}
+	if method.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("Expected the span to be a child of the context's span")
+	}
+	if attribute(method, "db.system") != "mysql" {
+		t.Errorf("Expected db.system mysql, got %q", attribute(method, "db.system"))
+	}
+}
+
+func TestSanitizeSQL(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT id FROM posts WHERE id = ?", "SELECT id FROM posts WHERE id = ?"},
+		{"SELECT *\n\t\tFROM users\n\t\tWHERE email = 'jane@example.com'", "SELECT * FROM users WHERE email = ?"},
+		{"UPDATE users SET password = \"secret\" WHERE id = 42", "UPDATE users SET password = ? WHERE id = ?"},
+		{"SELECT 'it''s', t1.id FROM t1 LIMIT 10", "SELECT ?, t1.id FROM t1 LIMIT ?"},
+	}
+
+	for _, tt := range tests {
+		if got := conn.SanitizeSQL(tt.query); got != tt.want {
+			t.Errorf("SanitizeSQL(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+// TestStdoutExporter tests that Setup installs a provider writing the spans
+// to the configured output.
+func TestStdoutExporter(t *testing.T) {
+	provider := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(provider)
+
+	var output bytes.Buffer
+	shutdown, err := tracing.Setup(context.Background(), tracing.Config{Exporter: tracing.ExporterStdout, Output: &output})
+	if err != nil {
+		t.Fatalf("Failed to set up tracing: %v", err)
+	}
+	_, span := otel.Tracer("test").Start(context.Background(), "exported span")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("Failed to shut down tracing: %v", err)
+	}
+
+	if !strings.Contains(output.String(), `"Name":"exported span"`) {
+		t.Errorf("Expected the span in the output, got %s", output.String())
+	}
+	if !strings.Contains(output.String(), `"Value":"blog"`) {
+		t.Errorf("Expected the service name in the output, got %s", output.String())
+	}
+}
+
+func TestUnknownExporter(t *testing.T) {
+	if _, err := tracing.Setup(context.Background(), tracing.Config{Exporter: "zipkin"}); err == nil {
+		t.Error("Expected an error for an unknown exporter")
+	}
+}
+
+func names(spans tracetest.SpanStubs) []string {
+	var names []string
+	for _, span := range spans {
+		names = append(names, span.Name)
+	}
+	return names
+}
@@ -0,0 +1,154 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/A-Victory/blog/models"
+	"github.com/A-Victory/blog/webhook"
+)
+
+// TestSignVerify tests that signatures verify with the right secret and body
+// only, and expire.
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	header := webhook.Sign("secret", time.Now(), body)
+
+	if !webhook.Verify("secret", header, body, time.Minute) {
+		t.Fatalf("Expected %s to verify", header)
+	}
+	if webhook.Verify("other", header, body, time.Minute) {
+		t.Fatalf("Expected a different secret to fail")
+	}
+	if webhook.Verify("secret", header, []byte(`{"id":2}`), time.Minute) {
+		t.Fatalf("Expected a different body to fail")
+	}
+
+	old := webhook.Sign("secret", time.Now().Add(-time.Hour), body)
+	if webhook.Verify("secret", old, body, time.Minute) {
+		t.Fatalf("Expected an old signature to fail")
+	}
+}
+
+// TestBackoff tests that retries wait exponentially longer up to the cap.
+func TestBackoff(t *testing.T) {
+	for attempt, expected := range map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		3:  2 * time.Minute,
+		7:  32 * time.Minute,
+		20: 6 * time.Hour,
+	} {
+		if got := webhook.Backoff(attempt); got != expected {
+			t.Fatalf("Expected a wait of %s after attempt %d, got %s", expected, attempt, got)
+		}
+	}
+}
+
+// TestDeliver tests a delivery to a local receiver.
+func TestDeliver(t *testing.T) {
+	var received *http.Request
+	var body []byte
+	status := http.StatusOK
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	sub := models.WebhookSubscription{ID: 1, URL: receiver.URL, Secret: "secret", Active: true}
+	delivery := models.WebhookDelivery{ID: 9, SubscriptionID: 1, Event: models.EventPostCreated, Payload: `{"id":3,"title":"Hello"}`, CreatedAt: "2024-01-01 00:00:00"}
+
+	code, err := webhook.Deliver(context.Background(), receiver.Client(), sub, delivery)
+	if err != nil || code != http.StatusOK {
+		t.Fatalf("Expected a successful delivery, got %d and %v", code, err)
+	}
+
+	if received.Header.Get(webhook.HeaderEvent) != models.EventPostCreated || received.Header.Get(webhook.HeaderDelivery) != "9" {
+		t.Fatalf("Expected event and delivery headers, got %v", received.Header)
+	}
+	if !webhook.Verify("secret", received.Header.Get(webhook.HeaderSignature), body, time.Minute) {
+		t.Fatalf("Expected a valid signature, got %s", received.Header.Get(webhook.HeaderSignature))
+	}
+
+	var envelope webhook.Envelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		t.Fatalf("Failed to decode body: %v", err)
+	}
+	if envelope.ID != 9 || envelope.Event != models.EventPostCreated || !strings.Contains(string(envelope.Data), `"Hello"`) {
+		t.Fatalf("Unexpected envelope %+v", envelope)
+	}
+
+	// Test a receiver error fails the delivery
+	status = http.StatusServiceUnavailable
+	code, err = webhook.Deliver(context.Background(), receiver.Client(), sub, delivery)
+	if err == nil || code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected a failed delivery, got %d and %v", code, err)
+	}
+}
+
+// TestCheckURL tests that subscriptions only reach public https URLs.
+func TestCheckURL(t *testing.T) {
+	for _, url := range []string{
+		"https://hooks.example.com/blog",
+		"https://203.0.113.7:8443/hook",
+	} {
+		if err := webhook.CheckURL(url, false); err != nil {
+			t.Errorf("Expected %s to be accepted, got %v", url, err)
+		}
+	}
+
+	for _, url := range []string{
+		"http://hooks.example.com/blog",
+		"ftp://hooks.example.com/blog",
+		"https:///blog",
+		"https://127.0.0.1:9100/metrics",
+		"https://[::1]/hook",
+		"https://169.254.169.254/latest/meta-data",
+		"https://10.0.0.5/hook",
+		"https://192.168.1.1/hook",
+		"https://0.0.0.0/hook",
+		"https://[::ffff:127.0.0.1]/hook",
+	} {
+		if err := webhook.CheckURL(url, false); err == nil {
+			t.Errorf("Expected %s to be rejected", url)
+		}
+	}
+
+	if err := webhook.CheckURL("http://hooks.example.com/blog", true); err != nil {
+		t.Errorf("Expected http to be accepted when allowed, got %v", err)
+	}
+	if err := webhook.CheckURL("http://127.0.0.1/hook", true); err == nil {
+		t.Error("Expected a loopback address to be rejected even when http is allowed")
+	}
+}
+
+// TestClientRefusesLoopback tests that the delivery client refuses to
+// connect to a loopback receiver, whatever the URL names it.
+func TestClientRefusesLoopback(t *testing.T) {
+	called := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer receiver.Close()
+
+	// localhost resolves to the loopback address when dialing
+	url := strings.Replace(receiver.URL, "127.0.0.1", "localhost", 1)
+	sub := models.WebhookSubscription{ID: 1, URL: url, Secret: "secret"}
+	delivery := models.WebhookDelivery{ID: 1, Event: models.EventPostCreated, Payload: `{}`}
+
+	_, err := webhook.Deliver(context.Background(), webhook.NewClient(time.Second, true), sub, delivery)
+	if err == nil || !strings.Contains(err.Error(), webhook.ErrForbiddenAddress.Error()) {
+		t.Errorf("Expected the delivery to be refused, got %v", err)
+	}
+	if called {
+		t.Error("Expected the receiver not to be reached")
+	}
+}
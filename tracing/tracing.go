@@ -0,0 +1,86 @@
+// Package tracing sets up OpenTelemetry tracing: where the spans are
+// exported, the propagation of W3C Trace Context, and the spans of incoming
+// HTTP requests and gRPC calls.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Exporters of the spans.
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+const instrumentation = "github.com/A-Victory/blog/tracing"
+
+var tracer = otel.Tracer(instrumentation)
+
+type Config struct {
+	// Exporter is ExporterNone, the default, ExporterOTLP or ExporterStdout.
+	// The OTLP exporter is configured through the standard
+	// OTEL_EXPORTER_OTLP_* variables.
+	Exporter string
+	// ServiceName names the server in the traces. It defaults to "blog".
+	ServiceName string
+	// Output is where ExporterStdout writes, os.Stdout by default.
+	Output io.Writer
+}
+
+// Setup installs the global tracer provider and the W3C Trace Context
+// propagator. The returned function flushes the spans left and stops the
+// exporter.
+func Setup(ctx context.Context, config Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch config.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		exporter, err = otlptracegrpc.New(ctx)
+	case ExporterStdout:
+		output := config.Output
+		if output == nil {
+			output = os.Stdout
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(output))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", config.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	name := config.ServiceName
+	if name == "" {
+		name = "blog"
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(name)))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,94 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress refuses URLs reaching into the network of the server,
+// which users could otherwise probe through the delivery log.
+var ErrForbiddenAddress = errors.New("webhooks cannot be sent to loopback, link-local, private or unspecified addresses")
+
+// sharedAddressSpace is the carrier-grade NAT range, private in practice but
+// not covered by netip.Addr.IsPrivate.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// forbidden reports whether deliveries to addr are refused.
+func forbidden(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsPrivate() || addr.IsUnspecified() ||
+		sharedAddressSpace.Contains(addr)
+}
+
+// CheckURL reports whether a subscription URL may be delivered to: https, or
+// plain http when allowHTTP is set, to a host that is not a forbidden
+// address. Host names are checked again on every delivery, once resolved.
+func CheckURL(raw string, allowHTTP bool) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	switch {
+	case u.Scheme == "https":
+	case u.Scheme == "http" && allowHTTP:
+	default:
+		return fmt.Errorf("webhook URLs must use https, got %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return errors.New("webhook URLs need a host")
+	}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && forbidden(addr) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// control refuses connections to forbidden addresses. It runs on the
+// address being dialed, after the host name is resolved, so a name that
+// resolves to a public address when the subscription is saved and to a
+// private one later is still refused.
+func control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if forbidden(addr) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// NewClient returns the HTTP client of the deliveries. It only connects to
+// public addresses, ignores the proxy settings of the environment, which
+// would otherwise be the address checked, and checks every redirect like
+// the subscription URL.
+func NewClient(timeout time.Duration, allowHTTP bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second, Control: control}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			ForceAttemptHTTP2:   true,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 5 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("stopped after 5 redirects")
+			}
+			return CheckURL(req.URL.String(), allowHTTP)
+		},
+	}
+}
@@ -0,0 +1,143 @@
+// Package webhook sends content events to the URLs users subscribe. Events
+// are queued in the database when they happen and a Worker delivers them,
+// retrying failures with exponential backoff until MaxAttempts, after which
+// the delivery is dead-lettered.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/A-Victory/blog/models"
+)
+
+// Delivery request headers.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// MaxAttempts is how many times a delivery is tried before it is
+// dead-lettered.
+const MaxAttempts = 8
+
+const (
+	firstRetry = 30 * time.Second
+	maxRetry   = 6 * time.Hour
+)
+
+// Envelope is the JSON body of a delivery.
+type Envelope struct {
+	ID        int             `json:"id"`
+	Event     string          `json:"event"`
+	CreatedAt string          `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// NewSecret returns a random signing secret.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature header for a body sent at the given time. The
+// HMAC-SHA256 covers the Unix timestamp and the body joined by a dot, so a
+// captured delivery cannot be replayed later with a new timestamp.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header against the body, rejecting signatures
+// older than tolerance. Receivers written in Go can use it as is.
+func Verify(secret, header string, body []byte, tolerance time.Duration) bool {
+	var ts int64
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "t":
+			ts, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if ts == 0 || len(signatures) == 0 {
+		return false
+	}
+
+	timestamp := time.Unix(ts, 0)
+	if age := time.Since(timestamp); age > tolerance || age < -tolerance {
+		return false
+	}
+
+	_, expected, _ := strings.Cut(Sign(secret, timestamp, body), ",v1=")
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff returns how long to wait after the given failed attempt, counted
+// from 1: 30 seconds, doubling with each attempt up to 6 hours.
+func Backoff(attempt int) time.Duration {
+	wait := firstRetry
+	for i := 1; i < attempt && wait < maxRetry; i++ {
+		wait *= 2
+	}
+	if wait > maxRetry {
+		wait = maxRetry
+	}
+	return wait
+}
+
+// Deliver sends one delivery to a subscription and returns the response
+// status. Any status outside 2xx is an error.
+func Deliver(ctx context.Context, client *http.Client, sub models.WebhookSubscription, delivery models.WebhookDelivery) (int, error) {
+	body, err := json.Marshal(Envelope{ID: delivery.ID, Event: delivery.Event, CreatedAt: delivery.CreatedAt, Data: json.RawMessage(delivery.Payload)})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "blog-webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.Itoa(delivery.ID))
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, time.Now(), body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
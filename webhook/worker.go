@@ -0,0 +1,130 @@
+package webhook
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/A-Victory/blog/database/conn"
+	"github.com/A-Victory/blog/models"
+)
+
+// Worker delivers queued webhook deliveries in the background.
+type Worker struct {
+	db       *conn.DB
+	client   *http.Client
+	interval time.Duration
+	wake     chan struct{}
+	lastRun  atomic.Int64
+	// allowHTTP lets deliveries go to plain http URLs.
+	allowHTTP bool
+}
+
+// NewWorker returns a worker delivering to https URLs, or also to plain
+// http ones when allowHTTP is set.
+func NewWorker(db *conn.DB, allowHTTP bool) *Worker {
+	return &Worker{
+		db:        db,
+		client:    NewClient(10*time.Second, allowHTTP),
+		allowHTTP: allowHTTP,
+		interval:  15 * time.Second,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Trigger asks the worker to look for due deliveries now instead of waiting
+// for the next tick.
+func (wk *Worker) Trigger() {
+	select {
+	case wk.wake <- struct{}{}:
+	default:
+	}
+}
+
+// LastRun returns when the worker last looked for due deliveries or finished
+// one, for the liveness probe. A batch may take longer than the probe allows,
+// so every delivery counts as progress.
+func (wk *Worker) LastRun() time.Time {
+	if at := wk.lastRun.Load(); at != 0 {
+		return time.Unix(0, at)
+	}
+	return time.Time{}
+}
+
+// Run delivers webhooks until the context is cancelled.
+func (wk *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(wk.interval)
+	defer ticker.Stop()
+
+	for {
+		wk.lastRun.Store(time.Now().UnixNano())
+		wk.process(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wk.wake:
+		}
+	}
+}
+
+func (wk *Worker) process(ctx context.Context) {
+	due, err := wk.db.GetDueWebhookDeliveries(50)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to load webhook deliveries", "error", err)
+		return
+	}
+
+	subs := map[int]models.WebhookSubscription{}
+	for _, delivery := range due {
+		// the lease outlasts the request timeout, so a claimed delivery is
+		// only picked up again if this worker dies while sending it
+		claimed, err := wk.db.ClaimWebhookDelivery(delivery.ID, time.Minute)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to claim webhook delivery", "delivery_id", delivery.ID, "error", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		sub, ok := subs[delivery.SubscriptionID]
+		if !ok {
+			if sub, err = wk.db.GetWebhook(delivery.SubscriptionID); err != nil {
+				slog.ErrorContext(ctx, "failed to load webhook", "webhook_id", delivery.SubscriptionID, "error", err)
+				continue
+			}
+			subs[delivery.SubscriptionID] = sub
+		}
+
+		wk.send(ctx, sub, delivery)
+		wk.lastRun.Store(time.Now().UnixNano())
+	}
+}
+
+func (wk *Worker) send(ctx context.Context, sub models.WebhookSubscription, delivery models.WebhookDelivery) {
+	status, next := models.DeliveryDelivered, time.Now()
+	reason := ""
+
+	var responseStatus int
+	var err error
+	if sub.ID == 0 || !sub.Active {
+		status, reason = models.DeliveryDead, "the subscription is disabled"
+	} else if err = CheckURL(sub.URL, wk.allowHTTP); err != nil {
+		// subscriptions saved before the URLs were checked
+		status, reason = models.DeliveryDead, err.Error()
+	} else if responseStatus, err = Deliver(ctx, wk.client, sub, delivery); err != nil {
+		status, reason = models.DeliveryPending, err.Error()
+		next = next.Add(Backoff(delivery.Attempts + 1))
+		if delivery.Attempts+1 >= MaxAttempts {
+			status = models.DeliveryDead
+		}
+	}
+
+	if err := wk.db.RecordWebhookAttempt(delivery.ID, status, responseStatus, reason, next); err != nil {
+		slog.ErrorContext(ctx, "failed to record webhook delivery", "delivery_id", delivery.ID, "error", err)
+	}
+}